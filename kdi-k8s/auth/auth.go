@@ -12,9 +12,16 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/eks"
+	awsv1 "github.com/aws/aws-sdk-go/aws"
+	credentialsv1 "github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/kuro-jojo/kdi-k8s/metrics"
+	"github.com/kuro-jojo/kdi-k8s/shared/logging"
 	"github.com/kuro-jojo/kdi-k8s/utils"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
@@ -27,10 +34,29 @@ const (
 	TypeEKS               = "eks"
 )
 
+// Reasons of the failed authentications to the clusters
+const (
+	FailureMissingToken       = "missing_token"
+	FailureInvalidToken       = "invalid_token"
+	FailureInvalidSubject     = "invalid_subject"
+	FailureInvalidCredentials = "invalid_credentials"
+	FailureCertificate        = "certificate"
+	FailureUnreachable        = "unreachable"
+	FailureUnauthorized       = "unauthorized"
+	FailureConnection         = "connection"
+)
+
 type BaseAuth struct {
 	Address string
 	Port    string
 	Token   string
+
+	// TLS settings used to verify the API server certificate
+	CAData         string // PEM encoded CA bundle of the cluster
+	TLSServerName  string // server name used for SNI and certificate verification
+	ClientCertData string // PEM encoded client certificate (optional)
+	ClientKeyData  string // PEM encoded client key (optional)
+	Insecure       bool   // skip the server certificate verification (explicit opt-in)
 }
 
 // for AWS EKS cluster
@@ -43,27 +69,43 @@ type EKSAuth struct {
 
 // AuthenticateToCluster : Middleware to authenticate to the cluster
 func AuthenticateToCluster(c *gin.Context) {
+	start := time.Now()
+	clusterType := c.Request.Header.Get("cluster-type")
+
+	logging.With(c, logging.KeyClusterType, clusterType)
+
+	reason := authenticate(c, clusterType)
+	metrics.ObserveClusterAuth(clusterType, start, reason)
+	if reason != "" {
+		logging.Logger(c).Warn("Authentication to the cluster failed", "reason", reason)
+		return
+	}
+	c.Next()
+}
+
+// authenticate sets the clientset of the cluster on the context.
+// It returns the reason of the failure after aborting the request, or an empty string.
+func authenticate(c *gin.Context, clusterType string) string {
 	var auth BaseAuth
 	var eksAuth EKSAuth
-	clusterType := c.Request.Header.Get("cluster-type")
 
 	tokenString := getTokenFromHeader(c.Request.Header)
 	if tokenString == "" {
 		log.Println("No token provided for authentication to kubernetes api")
 		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "No authentication token provided"})
-		return
+		return FailureMissingToken
 	}
 
 	token := retrieveTokenFromJWT(tokenString, c)
 	if token == nil {
-		return
+		return FailureInvalidToken
 	}
 
 	if claims, ok := token.Claims.(jwt.MapClaims); ok {
 		if claims["sub"] != os.Getenv("KDI_JWT_SUB_FOR_K8S_API") {
 			log.Printf("Unauthorized - invalid sub %v", claims["sub"])
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Unauthorized"})
-			return
+			return FailureInvalidSubject
 		}
 		// c.Set("addr", claims["addr"].(string))
 		// c.Set("port", claims["port"].(string))
@@ -74,18 +116,18 @@ func AuthenticateToCluster(c *gin.Context) {
 			// check if the token is valid for the AWS authentication
 			ok := getAWSAuthFromRequest(claims, c, &eksAuth)
 			if !ok {
-				return
+				return FailureInvalidCredentials
 			}
 		default:
 			// check if the token is valid for the base authentication (addr, port, token)
 			ok := getAuthFromRequest(claims, c, &auth)
 			if !ok {
-				return
+				return FailureInvalidCredentials
 			}
 		}
 	} else {
 		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Unauthorized"})
-		return
+		return FailureInvalidToken
 	}
 
 	var code int
@@ -97,13 +139,26 @@ func AuthenticateToCluster(c *gin.Context) {
 	default:
 		code, err = checkConnection(auth, c)
 	}
-	removeEnvVars()
 
 	if err != nil {
 		c.AbortWithStatusJSON(code, gin.H{"message": err.Error()})
-		return
+		return connectionFailure(code, err)
+	}
+	return ""
+}
+
+// connectionFailure returns the reason of a failed connection to the cluster
+func connectionFailure(code int, err error) string {
+	switch {
+	case utils.IsCertificateError(err):
+		return FailureCertificate
+	case code == http.StatusBadGateway:
+		return FailureUnreachable
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		return FailureUnauthorized
+	default:
+		return FailureConnection
 	}
-	c.Next()
 }
 
 func getAWSAuthFromRequest(claims jwt.MapClaims, c *gin.Context, auth *EKSAuth) bool {
@@ -135,21 +190,36 @@ func getAuthFromRequest(claims jwt.MapClaims, c *gin.Context, auth *BaseAuth) bo
 	}
 
 	auth.Token = claims["token"].(string)
+
+	auth.CAData = getStringClaim(claims, "ca-data")
+	auth.TLSServerName = getStringClaim(claims, "tls-server-name")
+	auth.ClientCertData = getStringClaim(claims, "client-cert-data")
+	auth.ClientKeyData = getStringClaim(claims, "client-key-data")
+	if insecure, ok := claims["insecure"].(bool); ok {
+		auth.Insecure = insecure
+	}
+
+	if (auth.ClientCertData == "") != (auth.ClientKeyData == "") {
+		log.Println("Invalid credentials. Client certificate and client key must be provided together.")
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": "Invalid credentials. Client certificate and client key must be provided together."})
+		return false
+	}
 	return true
 }
 
+// getStringClaim returns the claim as a string or an empty string if it is not set
+func getStringClaim(claims jwt.MapClaims, key string) string {
+	if v, ok := claims[key].(string); ok {
+		return v
+	}
+	return ""
+}
+
 func checkAWSConnection(eksAuth EKSAuth, c *gin.Context) (int, error) {
 	log.Println("Checking connection to the eks cluster...")
 	var code int = http.StatusBadRequest
-	// set environment variables for AWS
-	os.Setenv("AWS_ACCESS_KEY_ID", eksAuth.AccessKeyID)
-	os.Setenv("AWS_SECRET_ACCESS_KEY", eksAuth.SecretKeyID)
-
-	cfg, err := config.LoadDefaultConfig(context.TODO(),
-		config.WithRegion(eksAuth.Region),
-		// config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(eksAuth.AccessKeyID, eksAuth.SecretKeyID, "")),
-	)
 
+	cfg, err := newAWSConfig(c.Request.Context(), eksAuth)
 	if err != nil {
 		log.Printf("failed to connect to cluster. Reason : failed to load config, %v", err)
 		return code, fmt.Errorf("failed to connect to cluster. Reason : failed to load config, %v", err)
@@ -158,7 +228,7 @@ func checkAWSConnection(eksAuth EKSAuth, c *gin.Context) (int, error) {
 	client := eks.NewFromConfig(cfg)
 
 	// Describe the EKS cluster
-	clusterDescription, err := client.DescribeCluster(context.TODO(), &eks.DescribeClusterInput{
+	clusterDescription, err := client.DescribeCluster(c.Request.Context(), &eks.DescribeClusterInput{
 		Name: aws.String(eksAuth.ClusterName),
 	})
 
@@ -174,12 +244,7 @@ func checkAWSConnection(eksAuth EKSAuth, c *gin.Context) (int, error) {
 		return code, fmt.Errorf("failed to connect to cluster. Reason: failed to decode certificate authority, %v", err)
 	}
 
-	g, _ := token.NewGenerator(false, false)
-	tk, err := g.GetWithOptions(&token.GetTokenOptions{
-		Region:    eksAuth.Region,
-		ClusterID: eksAuth.ClusterName,
-		Session:   nil,
-	})
+	tk, err := generateEKSToken(eksAuth)
 	if err != nil {
 		log.Printf("failed to connect to cluster. Reason: failed to get token, %v", err)
 		return code, fmt.Errorf("failed to connect to cluster. Reason: failed to get token, %v", err)
@@ -191,7 +256,7 @@ func checkAWSConnection(eksAuth EKSAuth, c *gin.Context) (int, error) {
 		TLSClientConfig: rest.TLSClientConfig{
 			CAData: decodedCert,
 		},
-		BearerToken: tk.Token,
+		BearerToken: tk,
 	}
 
 	clientset, err := kubernetes.NewForConfig(kubeConfig)
@@ -217,9 +282,41 @@ func checkAWSConnection(eksAuth EKSAuth, c *gin.Context) (int, error) {
 	return http.StatusOK, nil
 }
 
-func removeEnvVars() {
-	os.Unsetenv("AWS_ACCESS_KEY_ID")
-	os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+// newAWSConfig loads the AWS configuration with the credentials of the request.
+// The credentials are kept in the configuration so concurrent requests never share them.
+func newAWSConfig(ctx context.Context, eksAuth EKSAuth) (aws.Config, error) {
+	return config.LoadDefaultConfig(ctx,
+		config.WithRegion(eksAuth.Region),
+		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(eksAuth.AccessKeyID, eksAuth.SecretKeyID, "")),
+	)
+}
+
+// generateEKSToken generates the bearer token of the eks cluster with the credentials of the request
+func generateEKSToken(eksAuth EKSAuth) (string, error) {
+	// the session gets its own http client : the sdk would otherwise configure the shared http.DefaultClient
+	sess, err := session.NewSession(awsv1.NewConfig().
+		WithHTTPClient(&http.Client{}).
+		WithRegion(eksAuth.Region).
+		WithSTSRegionalEndpoint(endpoints.RegionalSTSEndpoint).
+		WithCredentials(credentialsv1.NewStaticCredentials(eksAuth.AccessKeyID, eksAuth.SecretKeyID, "")),
+	)
+	if err != nil {
+		return "", fmt.Errorf("could not create session: %v", err)
+	}
+
+	g, err := token.NewGenerator(false, false)
+	if err != nil {
+		return "", err
+	}
+	tk, err := g.GetWithOptions(&token.GetTokenOptions{
+		Region:    eksAuth.Region,
+		ClusterID: eksAuth.ClusterName,
+		Session:   sess,
+	})
+	if err != nil {
+		return "", err
+	}
+	return tk.Token, nil
 }
 
 func checkConnection(auth BaseAuth, c *gin.Context) (int, error) {
@@ -247,9 +344,7 @@ func checkConnection(auth BaseAuth, c *gin.Context) (int, error) {
 			return code, err
 		}
 		config.BearerToken = auth.Token
-		// TODO : remove this line
-
-		config.Insecure = true
+		setTLSClientConfig(config, auth)
 
 		clientset, err = kubernetes.NewForConfig(config)
 		if err != nil {
@@ -259,6 +354,11 @@ func checkConnection(auth BaseAuth, c *gin.Context) (int, error) {
 
 		err = checkClusterReachability(err, clientset, code, errReach, c)
 		if err != nil {
+			// the server was reached but its certificate could not be verified : retrying on another port is pointless
+			if utils.IsCertificateError(err) {
+				log.Printf("error while verifying the cluster certificate: %v", err)
+				return code, certificateError{addr: addr, err: err}
+			}
 			if auth.Port == "" {
 				auth.Port = "6443"
 				log.Println("Trying again with port 6443")
@@ -280,6 +380,36 @@ func checkConnection(auth BaseAuth, c *gin.Context) (int, error) {
 	return http.StatusOK, nil
 }
 
+// setTLSClientConfig sets the TLS configuration of the cluster on the rest config.
+// The server certificate is always verified unless the cluster explicitly opted in for the insecure mode.
+// certificateError explains why the certificate of the cluster was not verified, and keeps the error of the verification
+type certificateError struct {
+	addr string
+	err  error
+}
+
+func (e certificateError) Error() string {
+	return fmt.Sprintf("cannot verify the certificate of the cluster at %s : %s", e.addr, utils.CertificateErrorMessage(e.err))
+}
+
+func (e certificateError) Unwrap() error {
+	return e.err
+}
+
+func setTLSClientConfig(config *rest.Config, auth BaseAuth) {
+	config.TLSClientConfig = rest.TLSClientConfig{
+		ServerName: auth.TLSServerName,
+		CertData:   []byte(auth.ClientCertData),
+		KeyData:    []byte(auth.ClientKeyData),
+	}
+	if auth.Insecure {
+		log.Printf("TLS verification disabled for the cluster at %s (insecure mode)", auth.Address)
+		config.Insecure = true
+		return
+	}
+	config.CAData = []byte(auth.CAData)
+}
+
 func checkClusterReachability(err error, clientset *kubernetes.Clientset, code int, errReach string, c *gin.Context) error {
 	finished := make(chan bool)
 	go func() {
@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// accessKeyFromEKSToken returns the access key id used to presign the eks token
+func accessKeyFromEKSToken(t *testing.T, tk string) string {
+	t.Helper()
+	const prefix = "k8s-aws-v1."
+	if !strings.HasPrefix(tk, prefix) {
+		t.Fatalf("unexpected token format: %s", tk)
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(tk, prefix))
+	if err != nil {
+		t.Fatalf("failed to decode token: %v", err)
+	}
+	u, err := url.Parse(string(raw))
+	if err != nil {
+		t.Fatalf("failed to parse presigned url: %v", err)
+	}
+	// X-Amz-Credential = <access key id>/<date>/<region>/sts/aws4_request
+	return strings.Split(u.Query().Get("X-Amz-Credential"), "/")[0]
+}
+
+func TestConcurrentEKSAuthenticationsDoNotCrossOver(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+
+	tenants := []EKSAuth{
+		{ClusterName: "cluster-a", AccessKeyID: "AKIATENANTA000000000", SecretKeyID: "secret-a", Region: "eu-west-1"},
+		{ClusterName: "cluster-b", AccessKeyID: "AKIATENANTB000000000", SecretKeyID: "secret-b", Region: "us-east-1"},
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		for _, tenant := range tenants {
+			wg.Add(1)
+			go func(eksAuth EKSAuth) {
+				defer wg.Done()
+
+				cfg, err := newAWSConfig(context.Background(), eksAuth)
+				if err != nil {
+					t.Errorf("failed to load config: %v", err)
+					return
+				}
+				creds, err := cfg.Credentials.Retrieve(context.Background())
+				if err != nil {
+					t.Errorf("failed to retrieve credentials: %v", err)
+					return
+				}
+				if creds.AccessKeyID != eksAuth.AccessKeyID || creds.SecretAccessKey != eksAuth.SecretKeyID {
+					t.Errorf("config of %s uses the credentials %s", eksAuth.ClusterName, creds.AccessKeyID)
+				}
+				if cfg.Region != eksAuth.Region {
+					t.Errorf("config of %s uses the region %s", eksAuth.ClusterName, cfg.Region)
+				}
+
+				tk, err := generateEKSToken(eksAuth)
+				if err != nil {
+					t.Errorf("failed to generate token: %v", err)
+					return
+				}
+				if got := accessKeyFromEKSToken(t, tk); got != eksAuth.AccessKeyID {
+					t.Errorf("token of %s is signed with the credentials %s", eksAuth.ClusterName, got)
+				}
+			}(tenant)
+		}
+	}
+	wg.Wait()
+
+	if v := os.Getenv("AWS_ACCESS_KEY_ID"); v != "" {
+		t.Errorf("AWS_ACCESS_KEY_ID was set in the process environment: %s", v)
+	}
+}
+
+// newCluster returns the address of a cluster whose certificate is signed by an authority unknown to the system, and this authority
+func newCluster(t *testing.T) (string, string) {
+	t.Helper()
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"major":"1","minor":"30","gitVersion":"v1.30.0"}`))
+	}))
+	t.Cleanup(srv.Close)
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	return srv.URL, string(ca)
+}
+
+func TestCheckConnectionWithAnUntrustedCertificate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	addr, ca := newCluster(t)
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	code, err := checkConnection(BaseAuth{Address: addr, Token: "token"}, c)
+	if err == nil {
+		t.Fatal("checkConnection() succeeded with a certificate of an unknown authority")
+	}
+	if reason := connectionFailure(code, err); reason != FailureCertificate {
+		t.Errorf("connectionFailure() = %q, want %q for %v", reason, FailureCertificate, err)
+	}
+
+	// the same cluster is trusted with its authority
+	c, _ = gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	if _, err := checkConnection(BaseAuth{Address: addr, Token: "token", CAData: ca}, c); err != nil {
+		t.Errorf("checkConnection() with the authority of the cluster: %v", err)
+	}
+}
+
+func TestConnectionFailure(t *testing.T) {
+	tests := []struct {
+		name string
+		code int
+		err  error
+		want string
+	}{
+		{"unreachable", http.StatusBadGateway, errors.New("connection refused"), FailureUnreachable},
+		{"unauthorized", http.StatusUnauthorized, errors.New("please provide valid credentials"), FailureUnauthorized},
+		{"forbidden", http.StatusForbidden, errors.New("forbidden"), FailureUnauthorized},
+		// only the errors of the verification are certificate failures, not the messages mentioning a certificate
+		{"message only", http.StatusBadRequest, errors.New("cannot verify the certificate of the cluster"), FailureConnection},
+	}
+	for _, tt := range tests {
+		if got := connectionFailure(tt.code, tt.err); got != tt.want {
+			t.Errorf("connectionFailure(%s) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
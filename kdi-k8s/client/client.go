@@ -0,0 +1,165 @@
+// Package client is the go client of the kubernetes api of kdi.
+// Every route of the api has a typed method, the errors returned by the api are *Error values.
+//
+// The package only depends on the standard library so that it can be used by the web api and the tools
+// without the kubernetes libraries.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	// RequestIDHeader is the header carrying the request id between the services
+	RequestIDHeader = "X-Request-ID"
+	// ClusterTypeHeader is the header carrying the type of the cluster (in-cluster, aks...)
+	ClusterTypeHeader = "cluster-type"
+	// ClusterIDHeader is the header carrying the id of the cluster, the api adds it to its logs
+	ClusterIDHeader = "cluster-id"
+)
+
+// Credentials identify the cluster the requests are made for
+type Credentials struct {
+	Token       string // The token of the cluster signed by the web api
+	ClusterType string
+	ClusterID   string // Optional, only used in the logs of the api
+}
+
+// Client makes the requests to the kubernetes api on behalf of a cluster
+type Client struct {
+	baseURL     string
+	credentials Credentials
+	httpClient  *http.Client
+	requestID   func(ctx context.Context) string
+}
+
+// Option configures a client
+type Option func(*Client)
+
+// WithHTTPClient sets the http client making the requests, http.DefaultClient is used by default
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithRequestID sets the function reading the request id of a context, the id is sent with the requests
+func WithRequestID(requestID func(ctx context.Context) string) Option {
+	return func(c *Client) {
+		c.requestID = requestID
+	}
+}
+
+// New returns a client of the api served at baseURL (https://kdi-k8s.example.com/api/v1)
+func New(baseURL string, credentials Credentials, options ...Option) *Client {
+	c := &Client{
+		baseURL:     strings.TrimSuffix(baseURL, "/"),
+		credentials: credentials,
+		httpClient:  http.DefaultClient,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// OpenAPI returns the OpenAPI document of the api
+func (c *Client) OpenAPI(ctx context.Context) (json.RawMessage, error) {
+	var document json.RawMessage
+	err := c.get(ctx, "/openapi.json", nil, &document)
+	return document, err
+}
+
+// Auth checks that the api accepts the token of the cluster and can reach it
+func (c *Client) Auth(ctx context.Context) error {
+	return c.get(ctx, "/auth", nil, nil)
+}
+
+// path joins the segments of a path, each segment is escaped
+func path(segments ...string) string {
+	var b strings.Builder
+	for _, segment := range segments {
+		b.WriteString("/")
+		b.WriteString(url.PathEscape(segment))
+	}
+	return b.String()
+}
+
+// namespaced returns the path of a resource of the namespace
+func namespaced(namespace string, segments ...string) string {
+	return path(append([]string{"resources", "namespaces", namespace}, segments...)...)
+}
+
+func (c *Client) get(ctx context.Context, path string, query url.Values, out any) error {
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	return c.do(ctx, http.MethodGet, path, "", nil, out)
+}
+
+// send makes a request whose body is the json encoding of in
+func (c *Client) send(ctx context.Context, method string, path string, in any, out any) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("cannot encode the request : %w", err)
+		}
+		body = bytes.NewReader(b)
+	}
+	return c.do(ctx, method, path, "application/json", body, out)
+}
+
+// do makes the request and decodes the response into out.
+// The body of an error response is decoded too, the routes return partial results with their errors.
+func (c *Client) do(ctx context.Context, method string, path string, contentType string, body io.Reader, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return fmt.Errorf("cannot create the request : %w", err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", c.credentials.Token)
+	req.Header.Set(ClusterTypeHeader, c.credentials.ClusterType)
+	if c.credentials.ClusterID != "" {
+		req.Header.Set(ClusterIDHeader, c.credentials.ClusterID)
+	}
+	if c.requestID != nil {
+		if requestID := c.requestID(ctx); requestID != "" {
+			req.Header.Set(RequestIDHeader, requestID)
+		}
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("cannot read the response : %w", err)
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		if out != nil {
+			_ = json.Unmarshal(b, out)
+		}
+		return newError(resp, b)
+	}
+	if out != nil && len(b) > 0 {
+		if err := json.Unmarshal(b, out); err != nil {
+			return fmt.Errorf("cannot decode the response : %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type requestIDKey struct{}
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return New(server.URL+"/api/v1/", Credentials{Token: "token", ClusterType: "aks", ClusterID: "c1"},
+		WithHTTPClient(server.Client()),
+		WithRequestID(func(ctx context.Context) string {
+			id, _ := ctx.Value(requestIDKey{}).(string)
+			return id
+		}),
+	)
+}
+
+func TestRoutes(t *testing.T) {
+	var method, path string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.EscapedPath()
+		w.Write([]byte("{}"))
+	})
+	ctx := context.Background()
+
+	tests := []struct {
+		call   func() error
+		method string
+		path   string
+	}{
+		{func() error { _, err := c.OpenAPI(ctx); return err }, "GET", "/api/v1/openapi.json"},
+		{func() error { return c.Auth(ctx) }, "GET", "/api/v1/auth"},
+		{func() error { _, err := c.CreateResources(ctx, ResourcesForm{}); return err }, "POST", "/api/v1/resources/with-yaml"},
+		{func() error {
+			_, err := c.CreateDeployment(ctx, "ns", File{Name: "a.yaml", Content: strings.NewReader("")})
+			return err
+		}, "POST", "/api/v1/resources/deployments/with-yaml"},
+		{func() error {
+			_, err := c.CreateService(ctx, "ns", File{Name: "a.yaml", Content: strings.NewReader("")})
+			return err
+		}, "POST", "/api/v1/resources/services/with-yaml"},
+		{func() error { _, err := c.NodesUsage(ctx); return err }, "GET", "/api/v1/resources/nodes/usage"},
+		{func() error { _, err := c.Inventory(ctx); return err }, "GET", "/api/v1/resources/inventory"},
+		{func() error { _, err := c.Namespaces(ctx); return err }, "GET", "/api/v1/resources/namespaces"},
+		{func() error { _, err := c.NamespaceUsage(ctx, "ns"); return err }, "GET", "/api/v1/resources/namespaces/ns/usage"},
+		{func() error { _, err := c.Workloads(ctx, "ns", ""); return err }, "GET", "/api/v1/resources/namespaces/ns/workloads"},
+		{func() error { _, err := c.Workload(ctx, "ns", "Deployment", "web"); return err }, "GET", "/api/v1/resources/namespaces/ns/workloads/deployment/web"},
+		{func() error { _, err := c.WorkloadUsage(ctx, "ns", "statefulsets", "db"); return err }, "GET", "/api/v1/resources/namespaces/ns/workloads/statefulsets/db/usage"},
+		{func() error { _, err := c.Deployment(ctx, "ns", "web"); return err }, "GET", "/api/v1/resources/namespaces/ns/deployments/web"},
+		{func() error { _, err := c.UpdateDeployment(ctx, "ns", "web", UpdateRequest{}); return err }, "PATCH", "/api/v1/resources/namespaces/ns/deployments/web"},
+		{func() error { _, err := c.PauseDeployment(ctx, "ns", "web"); return err }, "POST", "/api/v1/resources/namespaces/ns/deployments/web/pause"},
+		{func() error { _, err := c.ResumeDeployment(ctx, "ns", "web"); return err }, "POST", "/api/v1/resources/namespaces/ns/deployments/web/resume"},
+		{func() error { _, err := c.RestartDeployment(ctx, "ns", "web"); return err }, "POST", "/api/v1/resources/namespaces/ns/deployments/web/restart"},
+		{func() error {
+			_, err := c.AttachConfigSource(ctx, "ns", "web", ConfigSource{Kind: ConfigMapKind, Name: "cfg"})
+			return err
+		}, "POST", "/api/v1/resources/namespaces/ns/deployments/web/config-sources"},
+		{func() error {
+			_, err := c.DetachConfigSource(ctx, "ns", "web", ConfigSource{Kind: SecretKind, Name: "creds"})
+			return err
+		}, "DELETE", "/api/v1/resources/namespaces/ns/deployments/web/config-sources/Secret/creds"},
+		{func() error { _, err := c.UpdateStatefulSet(ctx, "ns", "db", StatefulSetUpdateRequest{}); return err }, "PATCH", "/api/v1/resources/namespaces/ns/statefulsets/db"},
+		{func() error { _, err := c.StatefulSetRevisions(ctx, "ns", "db"); return err }, "GET", "/api/v1/resources/namespaces/ns/statefulsets/db/revisions"},
+		{func() error { _, err := c.SetStatefulSetPartition(ctx, "ns", "db", 2); return err }, "PUT", "/api/v1/resources/namespaces/ns/statefulsets/db/partition"},
+		{func() error { _, err := c.RecyclePod(ctx, "ns", "db", 1); return err }, "POST", "/api/v1/resources/namespaces/ns/statefulsets/db/pods/1/recycle"},
+		{func() error { _, err := c.ConfigMaps(ctx, "ns"); return err }, "GET", "/api/v1/resources/namespaces/ns/configmaps"},
+		{func() error { _, err := c.CreateConfigMap(ctx, "ns", ConfigRequest{}); return err }, "POST", "/api/v1/resources/namespaces/ns/configmaps"},
+		{func() error { _, err := c.ConfigMap(ctx, "ns", "cfg"); return err }, "GET", "/api/v1/resources/namespaces/ns/configmaps/cfg"},
+		{func() error { _, err := c.UpdateConfigMap(ctx, "ns", "cfg", ConfigRequest{}); return err }, "PUT", "/api/v1/resources/namespaces/ns/configmaps/cfg"},
+		{func() error { return c.DeleteConfigMap(ctx, "ns", "cfg") }, "DELETE", "/api/v1/resources/namespaces/ns/configmaps/cfg"},
+		{func() error { _, err := c.Secrets(ctx, "ns"); return err }, "GET", "/api/v1/resources/namespaces/ns/secrets"},
+		{func() error { _, err := c.CreateSecret(ctx, "ns", ConfigRequest{}); return err }, "POST", "/api/v1/resources/namespaces/ns/secrets"},
+		{func() error { _, err := c.Secret(ctx, "ns", "creds"); return err }, "GET", "/api/v1/resources/namespaces/ns/secrets/creds"},
+		{func() error { _, err := c.UpdateSecret(ctx, "ns", "creds", ConfigRequest{}); return err }, "PUT", "/api/v1/resources/namespaces/ns/secrets/creds"},
+		{func() error { return c.DeleteSecret(ctx, "ns", "creds") }, "DELETE", "/api/v1/resources/namespaces/ns/secrets/creds"},
+		{func() error { return c.ApplyConfig(ctx, "ns", SecretKind, ConfigRequest{Name: "creds"}) }, "PUT", "/api/v1/resources/namespaces/ns/secrets/creds"},
+		{func() error { return c.DeleteConfig(ctx, "ns", ConfigMapKind, "cfg") }, "DELETE", "/api/v1/resources/namespaces/ns/configmaps/cfg"},
+	}
+	for _, test := range tests {
+		if err := test.call(); err != nil {
+			t.Errorf("%s %s: %v", test.method, test.path, err)
+			continue
+		}
+		if method != test.method || path != test.path {
+			t.Errorf("expected %s %s, got %s %s", test.method, test.path, method, path)
+		}
+	}
+}
+
+func TestHeaders(t *testing.T) {
+	var header http.Header
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		w.Write([]byte(`{"status":"ok"}`))
+	})
+
+	ctx := context.WithValue(context.Background(), requestIDKey{}, "req-1")
+	if err := c.Auth(ctx); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"Authorization":   "token",
+		ClusterTypeHeader: "aks",
+		ClusterIDHeader:   "c1",
+		RequestIDHeader:   "req-1",
+	}
+	for name, value := range expected {
+		if header.Get(name) != value {
+			t.Errorf("expected %s %q, got %q", name, value, header.Get(name))
+		}
+	}
+}
+
+func TestPathSegmentsAreEscaped(t *testing.T) {
+	var path string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.EscapedPath()
+		w.Write([]byte("{}"))
+	})
+	if _, err := c.Deployment(context.Background(), "ns", "web/../x"); err != nil {
+		t.Fatal(err)
+	}
+	if path != "/api/v1/resources/namespaces/ns/deployments/web%2F..%2Fx" {
+		t.Errorf("unexpected path %s", path)
+	}
+}
+
+func TestError(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "3")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		w.Write([]byte(`{"message":"cannot create the configmap","reason":"Invalid","causes":[{"field":"data","type":"FieldValueInvalid","message":"bad key"}]}`))
+	})
+
+	_, err := c.CreateConfigMap(context.Background(), "ns", ConfigRequest{Name: "cfg"})
+	e, ok := AsError(err)
+	if !ok {
+		t.Fatalf("expected an api error, got %v", err)
+	}
+	if e.StatusCode != http.StatusUnprocessableEntity || e.Reason != ReasonInvalid || e.RetryAfter != 3 {
+		t.Errorf("unexpected error %+v", e)
+	}
+	if len(e.Causes) != 1 || e.Causes[0].Field != "data" {
+		t.Errorf("unexpected causes %+v", e.Causes)
+	}
+	if e.Error() != "kubernetes api : 422 cannot create the configmap (Invalid)" {
+		t.Errorf("unexpected message %q", e.Error())
+	}
+}
+
+func TestErrorNotFromTheAPI(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad gateway", http.StatusBadGateway)
+	})
+
+	err := c.DeleteSecret(context.Background(), "ns", "creds")
+	e, ok := AsError(err)
+	if !ok || e.StatusCode != http.StatusBadGateway || !strings.Contains(string(e.Body), "bad gateway") {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if IsNotFound(err) {
+		t.Error("a bad gateway is not a not found")
+	}
+}
+
+func TestUpdateReturnsTheRolloutWithTheError(t *testing.T) {
+	var update UpdateRequest
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&update)
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		w.Write([]byte(`{"message":"rollout failed - rolled back","reason":"RolledBack","rollout":{"outcome":"Failed","rollback":{"succeeded":true,"revision":2}}}`))
+	})
+
+	response, err := c.UpdateDeployment(context.Background(), "ns", "web", UpdateRequest{Strategy: RollingUpdateStrategy, Replicas: 2, AutoRollback: true})
+	if StatusCode(err) != http.StatusUnprocessableEntity {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if update.Strategy != RollingUpdateStrategy || update.Replicas != 2 || !update.AutoRollback {
+		t.Errorf("unexpected update %+v", update)
+	}
+	if response.Reason != ReasonRolledBack || response.Rollout == nil || response.Rollout.Rollback == nil || response.Rollout.Rollback.Revision != 2 {
+		t.Errorf("unexpected response %+v", response)
+	}
+}
+
+func TestCreateResources(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Fatal(err)
+		}
+		if r.FormValue(NamespaceField) != "ns" || r.FormValue(WaitField) != "true" || r.FormValue(TimeoutField) != "60" {
+			t.Errorf("unexpected form %v", r.MultipartForm.Value)
+		}
+		if r.FormValue(PoliciesField) != `[{"id":"no-latest-tag","severity":"deny"}]` {
+			t.Errorf("unexpected policies %s", r.FormValue(PoliciesField))
+		}
+		files := r.MultipartForm.File[FilesField]
+		if len(files) != 1 || files[0].Filename != "web.yaml" {
+			t.Fatalf("unexpected files %v", files)
+		}
+		f, _ := files[0].Open()
+		content, _ := io.ReadAll(f)
+		if string(content) != "kind: Deployment" {
+			t.Errorf("unexpected content %s", content)
+		}
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte(`{"messages":{"error":["web already exists"]},"reasons":{"AlreadyExists":["web"]},"results":[{"object":"web","namespace":"ns","status":409,"reason":"AlreadyExists"}]}`))
+	})
+
+	response, err := c.CreateResources(context.Background(), ResourcesForm{
+		Files:     []File{{Name: "web.yaml", Content: strings.NewReader("kind: Deployment")}},
+		Namespace: "ns",
+		Wait:      true,
+		Timeout:   60,
+		Policies:  []PolicyRule{{ID: "no-latest-tag", Severity: "deny"}},
+	})
+	e, ok := AsError(err)
+	if !ok || e.StatusCode != http.StatusConflict || e.Message != "web already exists" {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(response.Results) != 1 || response.Results[0].Reason != ReasonAlreadyExists {
+		t.Errorf("unexpected results %+v", response.Results)
+	}
+}
+
+func TestContextIsCanceled(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := c.Auth(ctx)
+	if err == nil || StatusCode(err) != 0 {
+		t.Fatalf("expected the error of the canceled context, got %v", err)
+	}
+}
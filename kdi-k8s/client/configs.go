@@ -0,0 +1,118 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+// ConfigMaps lists the configmaps of the namespace
+func (c *Client) ConfigMaps(ctx context.Context, namespace string) ([]ConfigMap, error) {
+	var response struct {
+		ConfigMaps []ConfigMap `json:"configmaps"`
+	}
+	if err := c.get(ctx, namespaced(namespace, "configmaps"), nil, &response); err != nil {
+		return nil, err
+	}
+	return response.ConfigMaps, nil
+}
+
+// ConfigMap returns a configmap
+func (c *Client) ConfigMap(ctx context.Context, namespace string, name string) (*ConfigMap, error) {
+	var response configMapResponse
+	if err := c.get(ctx, namespaced(namespace, "configmaps", name), nil, &response); err != nil {
+		return nil, err
+	}
+	return &response.ConfigMap, nil
+}
+
+// CreateConfigMap creates a configmap
+func (c *Client) CreateConfigMap(ctx context.Context, namespace string, config ConfigRequest) (*ConfigMap, error) {
+	var response configMapResponse
+	if err := c.send(ctx, http.MethodPost, namespaced(namespace, "configmaps"), config, &response); err != nil {
+		return nil, err
+	}
+	return &response.ConfigMap, nil
+}
+
+// UpdateConfigMap replaces the data of a configmap, it is created if missing
+func (c *Client) UpdateConfigMap(ctx context.Context, namespace string, name string, config ConfigRequest) (*ConfigMap, error) {
+	var response configMapResponse
+	if err := c.send(ctx, http.MethodPut, namespaced(namespace, "configmaps", name), config, &response); err != nil {
+		return nil, err
+	}
+	return &response.ConfigMap, nil
+}
+
+// DeleteConfigMap deletes a configmap
+func (c *Client) DeleteConfigMap(ctx context.Context, namespace string, name string) error {
+	return c.send(ctx, http.MethodDelete, namespaced(namespace, "configmaps", name), nil, nil)
+}
+
+// Secrets lists the secrets of the namespace, without their values
+func (c *Client) Secrets(ctx context.Context, namespace string) ([]Secret, error) {
+	var response struct {
+		Secrets []Secret `json:"secrets"`
+	}
+	if err := c.get(ctx, namespaced(namespace, "secrets"), nil, &response); err != nil {
+		return nil, err
+	}
+	return response.Secrets, nil
+}
+
+// Secret returns a secret, without its values
+func (c *Client) Secret(ctx context.Context, namespace string, name string) (*Secret, error) {
+	var response secretResponse
+	if err := c.get(ctx, namespaced(namespace, "secrets", name), nil, &response); err != nil {
+		return nil, err
+	}
+	return &response.Secret, nil
+}
+
+// CreateSecret creates a secret
+func (c *Client) CreateSecret(ctx context.Context, namespace string, config ConfigRequest) (*Secret, error) {
+	var response secretResponse
+	if err := c.send(ctx, http.MethodPost, namespaced(namespace, "secrets"), config, &response); err != nil {
+		return nil, err
+	}
+	return &response.Secret, nil
+}
+
+// UpdateSecret replaces the data of a secret, it is created if missing
+func (c *Client) UpdateSecret(ctx context.Context, namespace string, name string, config ConfigRequest) (*Secret, error) {
+	var response secretResponse
+	if err := c.send(ctx, http.MethodPut, namespaced(namespace, "secrets", name), config, &response); err != nil {
+		return nil, err
+	}
+	return &response.Secret, nil
+}
+
+// DeleteSecret deletes a secret
+func (c *Client) DeleteSecret(ctx context.Context, namespace string, name string) error {
+	return c.send(ctx, http.MethodDelete, namespaced(namespace, "secrets", name), nil, nil)
+}
+
+// ApplyConfig creates or replaces the configmap or the secret, depending on kind (ConfigMap or Secret)
+func (c *Client) ApplyConfig(ctx context.Context, namespace string, kind string, config ConfigRequest) error {
+	if kind == SecretKind {
+		_, err := c.UpdateSecret(ctx, namespace, config.Name, config)
+		return err
+	}
+	_, err := c.UpdateConfigMap(ctx, namespace, config.Name, config)
+	return err
+}
+
+// DeleteConfig deletes the configmap or the secret, depending on kind (ConfigMap or Secret)
+func (c *Client) DeleteConfig(ctx context.Context, namespace string, kind string, name string) error {
+	if kind == SecretKind {
+		return c.DeleteSecret(ctx, namespace, name)
+	}
+	return c.DeleteConfigMap(ctx, namespace, name)
+}
+
+type configMapResponse struct {
+	ConfigMap ConfigMap `json:"configmap"`
+}
+
+type secretResponse struct {
+	Secret Secret `json:"secret"`
+}
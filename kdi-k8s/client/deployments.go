@@ -0,0 +1,108 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+)
+
+// Actions on the rollout of a deployment
+const (
+	PauseAction   = "pause"
+	ResumeAction  = "resume"
+	RestartAction = "restart"
+)
+
+// Deployment returns a deployment in the kubernetes format
+func (c *Client) Deployment(ctx context.Context, namespace string, name string) (*DeploymentResponse, error) {
+	var response DeploymentResponse
+	if err := c.get(ctx, namespaced(namespace, Deployments, name), nil, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// UpdateDeployment updates a deployment with a strategy.
+// The response is returned with the error when the rollout did not complete.
+func (c *Client) UpdateDeployment(ctx context.Context, namespace string, name string, update UpdateRequest) (*UpdateResponse, error) {
+	var response UpdateResponse
+	err := c.send(ctx, http.MethodPatch, namespaced(namespace, Deployments, name), update, &response)
+	return &response, err
+}
+
+// PauseDeployment pauses the rollout of a deployment
+func (c *Client) PauseDeployment(ctx context.Context, namespace string, name string) (*DeploymentResponse, error) {
+	return c.DeploymentAction(ctx, namespace, name, PauseAction)
+}
+
+// ResumeDeployment resumes the rollout of a deployment
+func (c *Client) ResumeDeployment(ctx context.Context, namespace string, name string) (*DeploymentResponse, error) {
+	return c.DeploymentAction(ctx, namespace, name, ResumeAction)
+}
+
+// RestartDeployment restarts the pods of a deployment
+func (c *Client) RestartDeployment(ctx context.Context, namespace string, name string) (*DeploymentResponse, error) {
+	return c.DeploymentAction(ctx, namespace, name, RestartAction)
+}
+
+// DeploymentAction runs the action (pause, resume or restart) on the rollout of a deployment
+func (c *Client) DeploymentAction(ctx context.Context, namespace string, name string, action string) (*DeploymentResponse, error) {
+	var response DeploymentResponse
+	if err := c.send(ctx, http.MethodPost, namespaced(namespace, Deployments, name, action), nil, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// AttachConfigSource adds a configmap or a secret to the environment of the containers of a deployment
+func (c *Client) AttachConfigSource(ctx context.Context, namespace string, deployment string, source ConfigSource) (*ConfigSourceResponse, error) {
+	var response ConfigSourceResponse
+	if err := c.send(ctx, http.MethodPost, namespaced(namespace, Deployments, deployment, "config-sources"), source, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// DetachConfigSource removes a configmap or a secret from the environment of the containers of a deployment
+func (c *Client) DetachConfigSource(ctx context.Context, namespace string, deployment string, source ConfigSource) (*ConfigSourceResponse, error) {
+	var response ConfigSourceResponse
+	if err := c.send(ctx, http.MethodDelete, namespaced(namespace, Deployments, deployment, "config-sources", source.Kind, source.Name), nil, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// UpdateStatefulSet updates a statefulset and its update strategy
+func (c *Client) UpdateStatefulSet(ctx context.Context, namespace string, name string, update StatefulSetUpdateRequest) (*StatefulSetResponse, error) {
+	return c.statefulSet(ctx, http.MethodPatch, namespaced(namespace, StatefulSets, name), update)
+}
+
+// StatefulSetRevisions returns the revisions of the pods of a statefulset
+func (c *Client) StatefulSetRevisions(ctx context.Context, namespace string, name string) (*StatefulSetResponse, error) {
+	var response StatefulSetResponse
+	if err := c.get(ctx, namespaced(namespace, StatefulSets, name, "revisions"), nil, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// SetStatefulSetPartition moves the partition of a statefulset
+func (c *Client) SetStatefulSetPartition(ctx context.Context, namespace string, name string, partition int32) (*StatefulSetResponse, error) {
+	form := struct {
+		Partition int32 `json:"partition"`
+	}{partition}
+	return c.statefulSet(ctx, http.MethodPut, namespaced(namespace, StatefulSets, name, "partition"), form)
+}
+
+// RecyclePod deletes a pod of a statefulset so that it is recreated with the update revision
+func (c *Client) RecyclePod(ctx context.Context, namespace string, name string, ordinal int) (*StatefulSetResponse, error) {
+	return c.statefulSet(ctx, http.MethodPost, namespaced(namespace, StatefulSets, name, "pods", strconv.Itoa(ordinal), "recycle"), nil)
+}
+
+func (c *Client) statefulSet(ctx context.Context, method string, path string, in any) (*StatefulSetResponse, error) {
+	var response StatefulSetResponse
+	if err := c.send(ctx, method, path, in, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
@@ -0,0 +1,108 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// Reason codes returned with the errors of the api
+const (
+	ReasonBadRequest         = "BadRequest"
+	ReasonUnauthorized       = "Unauthorized"
+	ReasonForbidden          = "Forbidden"
+	ReasonNotFound           = "NotFound"
+	ReasonAlreadyExists      = "AlreadyExists"
+	ReasonConflict           = "Conflict"
+	ReasonInvalid            = "Invalid"
+	ReasonTimeout            = "Timeout"
+	ReasonTooManyRequests    = "TooManyRequests"
+	ReasonServiceUnavailable = "ServiceUnavailable"
+	ReasonInternalError      = "InternalError"
+
+	// Reasons of a rollout that did not complete
+	ReasonRolloutFailed      = "RolloutFailed"
+	ReasonRolloutTimedOut    = "RolloutTimedOut"
+	ReasonRolloutInterrupted = "RolloutInterrupted"
+	// The rollout did not complete and the update was reverted
+	ReasonRolledBack = "RolledBack"
+
+	// The object does not respect a rule with the deny severity
+	ReasonPolicyViolation = "PolicyViolation"
+
+	// The request was interrupted (shutdown of the server, client gone) before the object was handled
+	ReasonInterrupted = "Interrupted"
+)
+
+// ErrorCause is a field level cause of an Invalid error
+type ErrorCause struct {
+	Field   string `json:"field"`
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// Error is an error response of the api
+type Error struct {
+	StatusCode int          `json:"-"`
+	Message    string       `json:"message"`
+	Reason     string       `json:"reason"`
+	Causes     []ErrorCause `json:"causes,omitempty"`
+	// The errors of the uploads, by level
+	Messages map[string][]string `json:"messages,omitempty"`
+	// Set if the api asked to retry later
+	RetryAfter int `json:"-"`
+	// The body of the response, kept when it is not an error of the api (a proxy in between...)
+	Body []byte `json:"-"`
+}
+
+func newError(resp *http.Response, body []byte) *Error {
+	e := &Error{StatusCode: resp.StatusCode}
+	if err := json.Unmarshal(body, e); err != nil || (e.Message == "" && len(e.Messages) == 0) {
+		e.Body = body
+	}
+	if e.Message == "" {
+		e.Message = e.firstMessage()
+	}
+	e.RetryAfter, _ = strconv.Atoi(resp.Header.Get("Retry-After"))
+	return e
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("kubernetes api : %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	if e.Reason == "" {
+		return fmt.Sprintf("kubernetes api : %d %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("kubernetes api : %d %s (%s)", e.StatusCode, e.Message, e.Reason)
+}
+
+// firstMessage returns the first error message of the uploads
+func (e *Error) firstMessage() string {
+	if messages := e.Messages["error"]; len(messages) > 0 {
+		return messages[0]
+	}
+	return ""
+}
+
+// AsError returns the error of the api wrapped in err
+func AsError(err error) (*Error, bool) {
+	var e *Error
+	ok := errors.As(err, &e)
+	return e, ok
+}
+
+// StatusCode returns the status of the error of the api, 0 if err is not an error of the api
+func StatusCode(err error) int {
+	if e, ok := AsError(err); ok {
+		return e.StatusCode
+	}
+	return 0
+}
+
+// IsNotFound tells if the api did not find the object
+func IsNotFound(err error) bool {
+	return StatusCode(err) == http.StatusNotFound
+}
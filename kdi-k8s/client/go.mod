@@ -0,0 +1,3 @@
+module github.com/kuro-jojo/kdi-k8s/client
+
+go 1.23.0
@@ -0,0 +1,154 @@
+package client
+
+// This file contains the uploads of yaml files and the routes reading the cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+)
+
+// Fields of the multipart forms of the uploads
+const (
+	FilesField     = "files"
+	FileField      = "file"
+	NamespaceField = "namespace"
+	WaitField      = "wait"
+	TimeoutField   = "timeout"
+	PoliciesField  = "policies"
+)
+
+// File is an uploaded yaml file
+type File struct {
+	Name    string
+	Content io.Reader
+}
+
+// ResourcesForm is the upload of yaml files whose objects are created in the cluster
+type ResourcesForm struct {
+	Files     []File
+	Namespace string       // The namespace of the objects that do not set one
+	Wait      bool         // Wait for the rollout of the deployments
+	Timeout   int          // The deadline of the rollouts in seconds
+	Policies  []PolicyRule // The rules the containers must respect
+}
+
+// CreateResources creates the objects of the uploaded files.
+// The results are returned with the error when some objects could not be created.
+func (c *Client) CreateResources(ctx context.Context, form ResourcesForm) (*ResourcesResponse, error) {
+	fields := map[string]string{NamespaceField: form.Namespace}
+	if form.Wait {
+		fields[WaitField] = "true"
+	}
+	if form.Timeout > 0 {
+		fields[TimeoutField] = strconv.Itoa(form.Timeout)
+	}
+	if len(form.Policies) > 0 {
+		policies, err := json.Marshal(form.Policies)
+		if err != nil {
+			return nil, fmt.Errorf("cannot encode the policies : %w", err)
+		}
+		fields[PoliciesField] = string(policies)
+	}
+	contentType, body, err := multipartForm(fields, FilesField, form.Files)
+	if err != nil {
+		return nil, err
+	}
+	return c.UploadResources(ctx, contentType, body)
+}
+
+// UploadResources creates the objects of the files of a multipart form already encoded
+func (c *Client) UploadResources(ctx context.Context, contentType string, form io.Reader) (*ResourcesResponse, error) {
+	var response ResourcesResponse
+	err := c.do(ctx, http.MethodPost, "/resources/with-yaml", contentType, form, &response)
+	return &response, err
+}
+
+// CreateDeployment creates the deployment of the uploaded file in the namespace
+func (c *Client) CreateDeployment(ctx context.Context, namespace string, file File) (string, error) {
+	return c.uploadFile(ctx, "/resources/deployments/with-yaml", namespace, file)
+}
+
+// CreateService creates the service of the uploaded file in the namespace
+func (c *Client) CreateService(ctx context.Context, namespace string, file File) (string, error) {
+	return c.uploadFile(ctx, "/resources/services/with-yaml", namespace, file)
+}
+
+func (c *Client) uploadFile(ctx context.Context, path string, namespace string, file File) (string, error) {
+	contentType, body, err := multipartForm(map[string]string{NamespaceField: namespace}, FileField, []File{file})
+	if err != nil {
+		return "", err
+	}
+	var response struct {
+		Message string `json:"message"`
+	}
+	err = c.do(ctx, http.MethodPost, path, contentType, body, &response)
+	return response.Message, err
+}
+
+// multipartForm encodes the fields and the files in a multipart form
+func multipartForm(fields map[string]string, fileField string, files []File) (string, io.Reader, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for name, value := range fields {
+		if err := writer.WriteField(name, value); err != nil {
+			return "", nil, err
+		}
+	}
+	for _, file := range files {
+		part, err := writer.CreateFormFile(fileField, file.Name)
+		if err != nil {
+			return "", nil, err
+		}
+		if _, err := io.Copy(part, file.Content); err != nil {
+			return "", nil, fmt.Errorf("cannot read the file %s : %w", file.Name, err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return "", nil, err
+	}
+	return writer.FormDataContentType(), &body, nil
+}
+
+// Inventory returns the inventory of the cluster
+func (c *Client) Inventory(ctx context.Context) (*InventoryResponse, error) {
+	var response InventoryResponse
+	if err := c.get(ctx, "/resources/inventory", nil, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// NodesUsage returns the usage of the nodes
+func (c *Client) NodesUsage(ctx context.Context) (*UsageResponse, error) {
+	var response UsageResponse
+	if err := c.get(ctx, "/resources/nodes/usage", nil, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// Namespaces returns the names of the namespaces
+func (c *Client) Namespaces(ctx context.Context) ([]string, error) {
+	var response struct {
+		Namespaces []string `json:"namespaces"`
+	}
+	if err := c.get(ctx, "/resources/namespaces", nil, &response); err != nil {
+		return nil, err
+	}
+	return response.Namespaces, nil
+}
+
+// NamespaceUsage returns the usage of the workloads of the namespace
+func (c *Client) NamespaceUsage(ctx context.Context, namespace string) (*UsageResponse, error) {
+	var response UsageResponse
+	if err := c.get(ctx, namespaced(namespace, "usage"), nil, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
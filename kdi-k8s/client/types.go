@@ -0,0 +1,419 @@
+package client
+
+// This file contains the types of the requests and the responses of the api.
+// The fields without json tag are sent with their go name by the api.
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Outcomes of a rollout
+const (
+	RolloutAvailable   = "Available"
+	RolloutFailed      = "Failed"
+	RolloutTimedOut    = "TimedOut"
+	RolloutInterrupted = "Interrupted" // the wait was canceled, the rollout goes on in the cluster
+)
+
+// Strategies of the updates of the deployments
+const (
+	RollingUpdateStrategy = "RollingUpdate"
+	RecreateStrategy      = "Recreate"
+	ABTestingStrategy     = "ab-testing"
+	CanaryStrategy        = "canary"
+	BlueGreenStrategy     = "blue-green"
+)
+
+// Kinds of the configs used as config sources of the deployments
+const (
+	ConfigMapKind = "ConfigMap"
+	SecretKind    = "Secret"
+)
+
+type Condition struct {
+	Type    string
+	Message string
+	Reason  string
+}
+
+type Container struct {
+	Name  string
+	Image string
+	Port  int32
+}
+
+// Microservice is a workload created from the uploaded files
+type Microservice struct {
+	Kind       string
+	Name       string
+	Namespace  string
+	Replicas   int32
+	Labels     map[string]string
+	Selectors  map[string]string
+	Strategy   string
+	Conditions []Condition
+	Containers []Container
+}
+
+// PolicyRule is a rule checked on the containers of the uploaded objects
+type PolicyRule struct {
+	ID         string   `json:"id"`
+	Severity   string   `json:"severity"`
+	Registries []string `json:"registries,omitempty"`
+}
+
+// PolicyViolation is a rule not respected by an object
+type PolicyViolation struct {
+	Rule      string `json:"rule"`
+	Severity  string `json:"severity"`
+	Object    string `json:"object"`
+	Container string `json:"container,omitempty"`
+	Message   string `json:"message"`
+}
+
+// PodFailure is the reason why a container of a pod of the deployment is not running
+type PodFailure struct {
+	Pod       string `json:"pod"`
+	Container string `json:"container"`
+	Reason    string `json:"reason"`
+	Message   string `json:"message"`
+}
+
+// Rollback is the revert of an update whose rollout failed
+type Rollback struct {
+	Succeeded bool   `json:"succeeded"`
+	Revision  int64  `json:"revision,omitempty"`
+	Message   string `json:"message"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Rollout is the outcome of the rollout of a deployment
+type Rollout struct {
+	Outcome     string       `json:"outcome"`
+	Message     string       `json:"message"`
+	Conditions  []Condition  `json:"conditions"`
+	PodFailures []PodFailure `json:"podFailures"`
+	Rollback    *Rollback    `json:"rollback,omitempty"`
+}
+
+// ObjectResult is the outcome of the creation of an uploaded object
+type ObjectResult struct {
+	Object     string            `json:"object"`
+	Namespace  string            `json:"namespace"`
+	File       string            `json:"file"`
+	Status     int               `json:"status"`
+	Message    string            `json:"message"`
+	Reason     string            `json:"reason,omitempty"`
+	Rollout    *Rollout          `json:"rollout,omitempty"`
+	Violations []PolicyViolation `json:"violations,omitempty"`
+}
+
+// ResourcesResponse is the outcome of the creation of the objects of uploaded files
+type ResourcesResponse struct {
+	Messages      map[string][]string `json:"messages"`
+	Reasons       map[string][]string `json:"reasons"` // The objects that failed by reason code
+	Results       []ObjectResult      `json:"results"`
+	Microservices []Microservice      `json:"microservices"`
+}
+
+// Usage is the use of a resource compared with what is reserved for it.
+// The cpu is in millicores and the memory in bytes.
+type Usage struct {
+	Used      int64
+	Requests  int64
+	Limits    int64
+	Unlimited bool // A container has no limit, Limits is then only the sum of the limits set
+}
+
+type ResourceUsage struct {
+	CPU    Usage
+	Memory Usage
+}
+
+func (r *ResourceUsage) Add(other ResourceUsage) {
+	r.CPU.add(other.CPU)
+	r.Memory.add(other.Memory)
+}
+
+func (u *Usage) add(other Usage) {
+	u.Used += other.Used
+	u.Requests += other.Requests
+	u.Limits += other.Limits
+	u.Unlimited = u.Unlimited || other.Unlimited
+}
+
+type PodUsage struct {
+	Name  string
+	Node  string
+	Phase string
+	Usage ResourceUsage
+}
+
+// WorkloadUsage is the usage of the pods of a workload.
+// Used is 0 when the metrics are not available.
+type WorkloadUsage struct {
+	Kind             string
+	Name             string
+	Namespace        string
+	MetricsAvailable bool
+	Pods             []PodUsage
+	Total            ResourceUsage
+}
+
+type NodeResource struct {
+	Used        int64
+	Allocatable int64
+	Capacity    int64
+}
+
+// NodeUsage is the usage of a node, the cpu is in millicores and the memory in bytes
+type NodeUsage struct {
+	Name   string
+	CPU    NodeResource
+	Memory NodeResource
+}
+
+// UsageResponse is the usage of a workload, a namespace or the nodes.
+// Message explains why the metrics are not available.
+type UsageResponse struct {
+	MetricsAvailable bool            `json:"metricsAvailable"`
+	Message          string          `json:"message"`
+	Usage            WorkloadUsage   `json:"usage"`
+	Workloads        []WorkloadUsage `json:"workloads"`
+	Total            ResourceUsage   `json:"total"`
+	Nodes            []NodeUsage     `json:"nodes"`
+}
+
+// WorkloadOwner is the controller of a workload (a HelmRelease, an operator...)
+type WorkloadOwner struct {
+	Kind string
+	Name string
+}
+
+// Workload is the summary of a workload of any kind
+type Workload struct {
+	Kind          string
+	Name          string
+	Namespace     string
+	Replicas      int32
+	ReadyReplicas int32
+	Images        []string
+	Labels        map[string]string
+	Selectors     map[string]string
+	Strategy      string
+	Conditions    []Condition
+	Owner         *WorkloadOwner
+	CreatedAt     time.Time
+
+	// For cronjobs
+	Schedule         string
+	Suspended        bool
+	LastScheduleTime *time.Time
+}
+
+// WorkloadsResponse is the list of the workloads of a namespace.
+// The kinds of workloads that could not be listed are in Errors.
+type WorkloadsResponse struct {
+	Workloads []Workload        `json:"workloads"`
+	Errors    map[string]*Error `json:"errors"`
+}
+
+// Inventory is the description of a cluster : its version, its nodes and what is installed on it
+type Inventory struct {
+	ServerVersion  string
+	Platform       string
+	Nodes          []NodeInventory
+	StorageClasses []StorageClass
+	IngressClasses []IngressClass
+	CRDs           []CRD
+	CollectedAt    time.Time
+}
+
+type NodeCondition struct {
+	Type    string
+	Status  string
+	Reason  string
+	Message string
+}
+
+// NodeResources are the resources of a node, the cpu is in millicores and the memory in bytes
+type NodeResources struct {
+	CPU    int64
+	Memory int64
+	Pods   int64
+}
+
+// NodeAllocation is the sum of the requests and limits of the pods running on a node
+type NodeAllocation struct {
+	CPURequests    int64
+	CPULimits      int64
+	MemoryRequests int64
+	MemoryLimits   int64
+	Pods           int64
+}
+
+type NodeInventory struct {
+	Name             string
+	Roles            []string
+	KubeletVersion   string
+	OSImage          string
+	ContainerRuntime string
+	Architecture     string
+	Unschedulable    bool
+	Allocatable      NodeResources
+	Allocated        NodeAllocation
+	Conditions       []NodeCondition
+	CreatedAt        time.Time
+}
+
+type StorageClass struct {
+	Name                 string
+	Provisioner          string
+	ReclaimPolicy        string
+	VolumeBindingMode    string
+	AllowVolumeExpansion bool
+	Default              bool
+}
+
+type IngressClass struct {
+	Name       string
+	Controller string
+	Default    bool
+}
+
+// CRD is a custom resource definition installed on the cluster
+type CRD struct {
+	Name     string
+	Group    string
+	Kind     string
+	Scope    string
+	Versions []string
+}
+
+// InventoryResponse is the inventory of the cluster.
+// The parts of the inventory that could not be read are in Errors.
+type InventoryResponse struct {
+	Inventory Inventory         `json:"inventory"`
+	Errors    map[string]*Error `json:"errors"`
+}
+
+// UpdateRequest is the update of a deployment with a strategy
+type UpdateRequest struct {
+	Strategy       string            `json:"strategy"`
+	Container      string            `json:"container,omitempty"` // The container targeted by Image (optional if the deployment has a single container)
+	Image          string            `json:"image,omitempty"`
+	Replicas       int32             `json:"replicas"`
+	MaxUnavailable string            `json:"max_unavailable,omitempty"`
+	MaxSurge       string            `json:"max_surge,omitempty"`
+	Containers     []ContainerUpdate `json:"containers,omitempty"`
+	PodAnnotations map[string]string `json:"pod_annotations,omitempty"`
+	PatchType      string            `json:"patch_type,omitempty"` // strategic (default) or json
+	JSONPatch      json.RawMessage   `json:"json_patch,omitempty"`
+	Wait           bool              `json:"wait,omitempty"`
+	Timeout        int               `json:"timeout,omitempty"` // The deadline of the rollout in seconds
+	AutoRollback   bool              `json:"auto_rollback,omitempty"`
+}
+
+// ContainerUpdate describes the changes to apply to a container.
+// Env, resources and probes use the kubernetes format.
+type ContainerUpdate struct {
+	Name           string          `json:"name"`
+	Init           bool            `json:"init,omitempty"`
+	Image          string          `json:"image,omitempty"`
+	Env            json.RawMessage `json:"env,omitempty"`
+	Resources      json.RawMessage `json:"resources,omitempty"`
+	LivenessProbe  json.RawMessage `json:"liveness_probe,omitempty"`
+	ReadinessProbe json.RawMessage `json:"readiness_probe,omitempty"`
+	StartupProbe   json.RawMessage `json:"startup_probe,omitempty"`
+}
+
+// UpdateResponse is the outcome of an update, Rollout is set if the update waited for the rollout
+type UpdateResponse struct {
+	Message string   `json:"message"`
+	Reason  string   `json:"reason"`
+	Rollout *Rollout `json:"rollout"`
+}
+
+// DeploymentResponse is a deployment in the kubernetes format
+type DeploymentResponse struct {
+	Message     string          `json:"message"`
+	RestartedAt string          `json:"restartedAt"`
+	Deployment  json.RawMessage `json:"deployment"`
+}
+
+// ConfigSource is a configmap or a secret added to the environment of the containers of a deployment
+type ConfigSource struct {
+	Kind string `json:"kind"` // ConfigMap or Secret
+	Name string `json:"name"`
+}
+
+// ConfigSourceResponse tells if the containers of the deployment were changed
+type ConfigSourceResponse struct {
+	Message string `json:"message"`
+	Changed bool   `json:"changed"`
+}
+
+// StatefulSetUpdateRequest is the update of a statefulset and of its update strategy
+type StatefulSetUpdateRequest struct {
+	Strategy       string            `json:"strategy"`            // RollingUpdate or OnDelete
+	Partition      *int32            `json:"partition,omitempty"` // Only the pods with an ordinal >= partition are updated
+	Replicas       int32             `json:"replicas,omitempty"`  // Left untouched if 0
+	Container      string            `json:"container,omitempty"`
+	Image          string            `json:"image,omitempty"`
+	Containers     []ContainerUpdate `json:"containers,omitempty"`
+	PodAnnotations map[string]string `json:"pod_annotations,omitempty"`
+}
+
+// PodRevision is the revision run by a pod of a statefulset
+type PodRevision struct {
+	Ordinal  int    `json:"ordinal"`
+	Name     string `json:"name"`
+	Revision string `json:"revision"`
+	Updated  bool   `json:"updated"`
+	Ready    bool   `json:"ready"`
+	Phase    string `json:"phase"`
+}
+
+// StatefulSetRevisions is the progress of the update of a statefulset
+type StatefulSetRevisions struct {
+	Strategy        string        `json:"strategy"`
+	Partition       int32         `json:"partition"`
+	Replicas        int32         `json:"replicas"`
+	CurrentRevision string        `json:"currentRevision"`
+	UpdateRevision  string        `json:"updateRevision"`
+	UpdatedReplicas int32         `json:"updatedReplicas"`
+	Pods            []PodRevision `json:"pods"`
+}
+
+// StatefulSetResponse is a statefulset after a change
+type StatefulSetResponse struct {
+	Message   string               `json:"message"`
+	Revisions StatefulSetRevisions `json:"revisions"`
+}
+
+// ConfigRequest is the content of a configmap or a secret
+type ConfigRequest struct {
+	Name   string            `json:"name,omitempty"`
+	Type   string            `json:"type,omitempty"` // The type of a secret, Opaque by default
+	Data   map[string]string `json:"data"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+type ConfigMap struct {
+	Name      string            `json:"name"`
+	Namespace string            `json:"namespace"`
+	Data      map[string]string `json:"data"`
+	Labels    map[string]string `json:"labels"`
+	CreatedAt time.Time         `json:"createdAt"`
+}
+
+// Secret is a secret without its values
+type Secret struct {
+	Name      string            `json:"name"`
+	Namespace string            `json:"namespace"`
+	Type      string            `json:"type"`
+	Keys      []string          `json:"keys"`
+	Labels    map[string]string `json:"labels"`
+	CreatedAt time.Time         `json:"createdAt"`
+}
@@ -0,0 +1,48 @@
+package client
+
+import (
+	"context"
+	"net/url"
+	"strings"
+)
+
+// Kinds of workloads, as written in the paths
+const (
+	Deployments  = "deployments"
+	StatefulSets = "statefulsets"
+	DaemonSets   = "daemonsets"
+	CronJobs     = "cronjobs"
+)
+
+// Workloads lists the workloads of the namespace, of every kind if kind is empty
+func (c *Client) Workloads(ctx context.Context, namespace string, kind string) (*WorkloadsResponse, error) {
+	query := url.Values{}
+	if kind != "" {
+		query.Set("kind", kind)
+	}
+	var response WorkloadsResponse
+	if err := c.get(ctx, namespaced(namespace, "workloads"), query, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// Workload returns a workload, kind is its kind (Deployment) or the kind in the paths (deployments)
+func (c *Client) Workload(ctx context.Context, namespace string, kind string, name string) (*Workload, error) {
+	var response struct {
+		Workload Workload `json:"workload"`
+	}
+	if err := c.get(ctx, namespaced(namespace, "workloads", strings.ToLower(kind), name), nil, &response); err != nil {
+		return nil, err
+	}
+	return &response.Workload, nil
+}
+
+// WorkloadUsage returns the usage of the pods of a workload
+func (c *Client) WorkloadUsage(ctx context.Context, namespace string, kind string, name string) (*UsageResponse, error) {
+	var response UsageResponse
+	if err := c.get(ctx, namespaced(namespace, "workloads", strings.ToLower(kind), name, "usage"), nil, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
@@ -0,0 +1,157 @@
+package configs
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kuro-jojo/kdi-k8s/utils"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+// ConfigForm is the content of a configmap or a secret
+type ConfigForm struct {
+	Name   string            `json:"name"`
+	Type   string            `json:"type"` // The type of a secret, Opaque by default
+	Data   map[string]string `json:"data"`
+	Labels map[string]string `json:"labels"`
+}
+
+// ConfigMapSummary is a configmap returned by the api
+type ConfigMapSummary struct {
+	Name      string            `json:"name"`
+	Namespace string            `json:"namespace"`
+	Data      map[string]string `json:"data"`
+	Labels    map[string]string `json:"labels"`
+	CreatedAt time.Time         `json:"createdAt"`
+}
+
+func configMapSummary(cm *corev1.ConfigMap) ConfigMapSummary {
+	return ConfigMapSummary{
+		Name:      cm.Name,
+		Namespace: cm.Namespace,
+		Data:      cm.Data,
+		Labels:    cm.Labels,
+		CreatedAt: cm.CreationTimestamp.Time,
+	}
+}
+
+func GetConfigMaps(c *gin.Context) {
+	namespace := c.Param("namespace")
+	log.Printf("Getting configmaps in namespace %s...", namespace)
+
+	list, err := utils.GetClientSet(c).CoreV1().ConfigMaps(namespace).List(c, metav1.ListOptions{})
+	if err != nil {
+		log.Printf("Error getting configmaps: %v", err)
+		utils.RespondWithK8sError(c, err, fmt.Sprintf("cannot get the configmaps in namespace %s", namespace))
+		return
+	}
+
+	configMaps := make([]ConfigMapSummary, 0)
+	for i := range list.Items {
+		configMaps = append(configMaps, configMapSummary(&list.Items[i]))
+	}
+	c.JSON(http.StatusOK, gin.H{"configmaps": configMaps, "size": len(configMaps)})
+}
+
+func GetConfigMap(c *gin.Context) {
+	namespace := c.Param("namespace")
+	name := c.Param("name")
+
+	cm, err := utils.GetClientSet(c).CoreV1().ConfigMaps(namespace).Get(c, name, metav1.GetOptions{})
+	if err != nil {
+		log.Printf("Error getting configmap %s: %v", name, err)
+		utils.RespondWithK8sError(c, err, fmt.Sprintf("cannot get configmap %s in namespace %s", name, namespace))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"configmap": configMapSummary(cm)})
+}
+
+func CreateConfigMap(c *gin.Context) {
+	var form ConfigForm
+	if err := c.ShouldBindJSON(&form); err != nil || form.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid form - Please provide at least the name of the configmap"})
+		return
+	}
+	namespace := c.Param("namespace")
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: form.Name, Namespace: namespace, Labels: form.Labels},
+		Data:       form.Data,
+	}
+	cm, err := utils.GetClientSet(c).CoreV1().ConfigMaps(namespace).Create(c, cm, metav1.CreateOptions{})
+	if err != nil {
+		log.Printf("Error creating configmap %s: %v", form.Name, err)
+		utils.RespondWithK8sError(c, err, fmt.Sprintf("cannot create configmap %s in namespace %s", form.Name, namespace))
+		return
+	}
+
+	log.Printf("Configmap %s created in namespace %s", cm.Name, namespace)
+	c.JSON(http.StatusCreated, gin.H{"message": fmt.Sprintf("configmap %s created", cm.Name), "configmap": configMapSummary(cm)})
+}
+
+// UpdateConfigMap replaces the data of a configmap, creating it if it does not exist
+func UpdateConfigMap(c *gin.Context) {
+	var form ConfigForm
+	if err := c.ShouldBindJSON(&form); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid form"})
+		return
+	}
+	namespace := c.Param("namespace")
+	name := c.Param("name")
+	configMaps := utils.GetClientSet(c).CoreV1().ConfigMaps(namespace)
+
+	var cm *corev1.ConfigMap
+	created := false
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		current, err := configMaps.Get(c, name, metav1.GetOptions{})
+		if utils.IsNotFoundError(err) {
+			created = true
+			cm, err = configMaps.Create(c, &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: form.Labels},
+				Data:       form.Data,
+			}, metav1.CreateOptions{})
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		current.Data = form.Data
+		if form.Labels != nil {
+			current.Labels = form.Labels
+		}
+		cm, err = configMaps.Update(c, current, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		log.Printf("Error updating configmap %s: %v", name, err)
+		utils.RespondWithK8sError(c, err, fmt.Sprintf("cannot update configmap %s in namespace %s", name, namespace))
+		return
+	}
+
+	log.Printf("Configmap %s updated in namespace %s", name, namespace)
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	c.JSON(status, gin.H{"message": fmt.Sprintf("configmap %s updated", name), "configmap": configMapSummary(cm)})
+}
+
+func DeleteConfigMap(c *gin.Context) {
+	namespace := c.Param("namespace")
+	name := c.Param("name")
+
+	err := utils.GetClientSet(c).CoreV1().ConfigMaps(namespace).Delete(c, name, metav1.DeleteOptions{})
+	if err != nil {
+		log.Printf("Error deleting configmap %s: %v", name, err)
+		utils.RespondWithK8sError(c, err, fmt.Sprintf("cannot delete configmap %s in namespace %s", name, namespace))
+		return
+	}
+
+	log.Printf("Configmap %s deleted from namespace %s", name, namespace)
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("configmap %s deleted", name)})
+}
@@ -0,0 +1,171 @@
+package configs
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kuro-jojo/kdi-k8s/utils"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+// SecretSummary is a secret returned by the api.
+// The values of a secret are never returned, only its keys.
+type SecretSummary struct {
+	Name      string            `json:"name"`
+	Namespace string            `json:"namespace"`
+	Type      string            `json:"type"`
+	Keys      []string          `json:"keys"`
+	Labels    map[string]string `json:"labels"`
+	CreatedAt time.Time         `json:"createdAt"`
+}
+
+func secretSummary(s *corev1.Secret) SecretSummary {
+	keys := make([]string, 0, len(s.Data))
+	for key := range s.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return SecretSummary{
+		Name:      s.Name,
+		Namespace: s.Namespace,
+		Type:      string(s.Type),
+		Keys:      keys,
+		Labels:    s.Labels,
+		CreatedAt: s.CreationTimestamp.Time,
+	}
+}
+
+func GetSecrets(c *gin.Context) {
+	namespace := c.Param("namespace")
+	log.Printf("Getting secrets in namespace %s...", namespace)
+
+	list, err := utils.GetClientSet(c).CoreV1().Secrets(namespace).List(c, metav1.ListOptions{})
+	if err != nil {
+		log.Printf("Error getting secrets: %v", err)
+		utils.RespondWithK8sError(c, err, fmt.Sprintf("cannot get the secrets in namespace %s", namespace))
+		return
+	}
+
+	secrets := make([]SecretSummary, 0)
+	for i := range list.Items {
+		secrets = append(secrets, secretSummary(&list.Items[i]))
+	}
+	c.JSON(http.StatusOK, gin.H{"secrets": secrets, "size": len(secrets)})
+}
+
+func GetSecret(c *gin.Context) {
+	namespace := c.Param("namespace")
+	name := c.Param("name")
+
+	s, err := utils.GetClientSet(c).CoreV1().Secrets(namespace).Get(c, name, metav1.GetOptions{})
+	if err != nil {
+		log.Printf("Error getting secret %s: %v", name, err)
+		utils.RespondWithK8sError(c, err, fmt.Sprintf("cannot get secret %s in namespace %s", name, namespace))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"secret": secretSummary(s)})
+}
+
+func CreateSecret(c *gin.Context) {
+	var form ConfigForm
+	if err := c.ShouldBindJSON(&form); err != nil || form.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid form - Please provide at least the name of the secret"})
+		return
+	}
+	namespace := c.Param("namespace")
+
+	secretType := corev1.SecretTypeOpaque
+	if form.Type != "" {
+		secretType = corev1.SecretType(form.Type)
+	}
+	s := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: form.Name, Namespace: namespace, Labels: form.Labels},
+		Type:       secretType,
+		StringData: form.Data,
+	}
+	s, err := utils.GetClientSet(c).CoreV1().Secrets(namespace).Create(c, s, metav1.CreateOptions{})
+	if err != nil {
+		log.Printf("Error creating secret %s: %v", form.Name, err)
+		utils.RespondWithK8sError(c, err, fmt.Sprintf("cannot create secret %s in namespace %s", form.Name, namespace))
+		return
+	}
+
+	log.Printf("Secret %s created in namespace %s", s.Name, namespace)
+	c.JSON(http.StatusCreated, gin.H{"message": fmt.Sprintf("secret %s created", s.Name), "secret": secretSummary(s)})
+}
+
+// UpdateSecret replaces the values of a secret, creating it if it does not exist.
+// The type of an existing secret cannot be changed.
+func UpdateSecret(c *gin.Context) {
+	var form ConfigForm
+	if err := c.ShouldBindJSON(&form); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid form"})
+		return
+	}
+	namespace := c.Param("namespace")
+	name := c.Param("name")
+	secrets := utils.GetClientSet(c).CoreV1().Secrets(namespace)
+
+	var s *corev1.Secret
+	created := false
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		current, err := secrets.Get(c, name, metav1.GetOptions{})
+		if utils.IsNotFoundError(err) {
+			created = true
+			secretType := corev1.SecretTypeOpaque
+			if form.Type != "" {
+				secretType = corev1.SecretType(form.Type)
+			}
+			s, err = secrets.Create(c, &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: form.Labels},
+				Type:       secretType,
+				StringData: form.Data,
+			}, metav1.CreateOptions{})
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		// string data is merged into data by the api server, so the previous values are dropped first
+		current.Data = nil
+		current.StringData = form.Data
+		if form.Labels != nil {
+			current.Labels = form.Labels
+		}
+		s, err = secrets.Update(c, current, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		log.Printf("Error updating secret %s: %v", name, err)
+		utils.RespondWithK8sError(c, err, fmt.Sprintf("cannot update secret %s in namespace %s", name, namespace))
+		return
+	}
+
+	log.Printf("Secret %s updated in namespace %s", name, namespace)
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	c.JSON(status, gin.H{"message": fmt.Sprintf("secret %s updated", name), "secret": secretSummary(s)})
+}
+
+func DeleteSecret(c *gin.Context) {
+	namespace := c.Param("namespace")
+	name := c.Param("name")
+
+	err := utils.GetClientSet(c).CoreV1().Secrets(namespace).Delete(c, name, metav1.DeleteOptions{})
+	if err != nil {
+		log.Printf("Error deleting secret %s: %v", name, err)
+		utils.RespondWithK8sError(c, err, fmt.Sprintf("cannot delete secret %s in namespace %s", name, namespace))
+		return
+	}
+
+	log.Printf("Secret %s deleted from namespace %s", name, namespace)
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("secret %s deleted", name)})
+}
@@ -0,0 +1,122 @@
+package configs
+
+// This file attaches configmaps and secrets to the containers of a deployment as sources of environment variables
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kuro-jojo/kdi-k8s/utils"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	ConfigMapKind = "ConfigMap"
+	SecretKind    = "Secret"
+)
+
+// ConfigSourceForm is a configmap or a secret used as a source of environment variables
+type ConfigSourceForm struct {
+	Kind string `json:"kind" binding:"required"` // ConfigMap or Secret
+	Name string `json:"name" binding:"required"`
+}
+
+// AttachConfigSource adds the configmap or the secret to the environment of all the containers of the deployment
+func AttachConfigSource(c *gin.Context) {
+	var form ConfigSourceForm
+	if err := c.ShouldBindJSON(&form); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid form - Please provide the kind and the name of the config"})
+		return
+	}
+	updateConfigSources(c, form, true)
+}
+
+// DetachConfigSource removes the configmap or the secret from the environment of the containers of the deployment
+func DetachConfigSource(c *gin.Context) {
+	updateConfigSources(c, ConfigSourceForm{Kind: c.Param("kind"), Name: c.Param("name")}, false)
+}
+
+func updateConfigSources(c *gin.Context, form ConfigSourceForm, attach bool) {
+	kind, ok := configKind(form.Kind)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid kind - use ConfigMap or Secret", "reason": utils.ReasonBadRequest})
+		return
+	}
+	namespace := c.Param("namespace")
+	name := c.Param("deployment")
+	deployments := utils.GetClientSet(c).AppsV1().Deployments(namespace)
+
+	// The deployment is updated only if one of its containers changes, to avoid a useless rollout
+	changed := false
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		deployment, err := deployments.Get(c, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		changed = false
+		containers := deployment.Spec.Template.Spec.Containers
+		for i := range containers {
+			index := sourceIndex(containers[i].EnvFrom, kind, form.Name)
+			if attach && index < 0 {
+				containers[i].EnvFrom = append(containers[i].EnvFrom, newSource(kind, form.Name))
+				changed = true
+			} else if !attach && index >= 0 {
+				containers[i].EnvFrom = append(containers[i].EnvFrom[:index], containers[i].EnvFrom[index+1:]...)
+				changed = true
+			}
+		}
+		if !changed {
+			return nil
+		}
+		_, err = deployments.Update(c, deployment, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		log.Printf("Error updating the config sources of deployment %s: %v", name, err)
+		utils.RespondWithK8sError(c, err, fmt.Sprintf("cannot update the config sources of deployment %s in namespace %s", name, namespace))
+		return
+	}
+
+	action := "attached to"
+	if !attach {
+		action = "detached from"
+	}
+	log.Printf("%s %s %s deployment %s", kind, form.Name, action, name)
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("%s %s %s deployment %s", strings.ToLower(kind), form.Name, action, name), "changed": changed})
+}
+
+func configKind(kind string) (string, bool) {
+	switch strings.ToLower(kind) {
+	case "configmap", "configmaps":
+		return ConfigMapKind, true
+	case "secret", "secrets":
+		return SecretKind, true
+	}
+	return "", false
+}
+
+func newSource(kind, name string) corev1.EnvFromSource {
+	reference := corev1.LocalObjectReference{Name: name}
+	if kind == SecretKind {
+		return corev1.EnvFromSource{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: reference}}
+	}
+	return corev1.EnvFromSource{ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: reference}}
+}
+
+// sourceIndex returns the position of the config in the sources or -1 if it is not a source
+func sourceIndex(sources []corev1.EnvFromSource, kind, name string) int {
+	for i, source := range sources {
+		if kind == ConfigMapKind && source.ConfigMapRef != nil && source.ConfigMapRef.Name == name {
+			return i
+		}
+		if kind == SecretKind && source.SecretRef != nil && source.SecretRef.Name == name {
+			return i
+		}
+	}
+	return -1
+}
@@ -24,13 +24,15 @@ func GetDeploymentInNamespace(c *gin.Context) {
 	}
 	if !isDeploymentFormValid(deploymentForm) {
 		c.JSON(http.StatusBadRequest, gin.H{"message": " Please provide deployment_name and namespace"})
+		return
 	}
 
 	clientset := utils.GetClientSet(c)
 	deployment, err := clientset.AppsV1().Deployments(deploymentForm.Namespace).Get(c, deploymentForm.DeploymentName, metav1.GetOptions{})
-	if err != nil && utils.IsNotFoundError(err.Error()) {
+	if err != nil {
 		log.Printf("Error getting deployment: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"message": fmt.Sprintf("deployment %s not found in namespace %s", deploymentForm.DeploymentName, deploymentForm.Namespace)})
+		utils.RespondWithK8sError(c, err, fmt.Sprintf("cannot get deployment %s in namespace %s", deploymentForm.DeploymentName, deploymentForm.Namespace))
+		return
 	}
 
 	log.Printf("Deployment %s found in namespace %s", deploymentForm.DeploymentName, deploymentForm.Namespace)
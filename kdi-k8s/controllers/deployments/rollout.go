@@ -0,0 +1,108 @@
+package deployments
+
+// This file contains the equivalent of kubectl rollout pause, resume and restart
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kuro-jojo/kdi-k8s/utils"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// RestartedAtAnnotation is the pod template annotation set by kubectl rollout restart
+	RestartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+)
+
+// PauseDeployment stops the rollout of the changes made to the pod template of the deployment
+func PauseDeployment(c *gin.Context) {
+	setPaused(c, true)
+}
+
+// ResumeDeployment rolls out the changes made to the pod template while the deployment was paused
+func ResumeDeployment(c *gin.Context) {
+	setPaused(c, false)
+}
+
+// RestartDeployment replaces all the pods of the deployment by changing an annotation of its pod template
+func RestartDeployment(c *gin.Context) {
+	deploymentForm := DeploymentForm{
+		DeploymentName: c.Param("deployment"),
+		Namespace:      c.Param("namespace"),
+	}
+	if !isDeploymentFormValid(deploymentForm) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": " Please provide deployment_name and namespace"})
+		return
+	}
+	log.Printf("Restarting deployment %s...", deploymentForm.DeploymentName)
+
+	deployments := utils.GetClientSet(c).AppsV1().Deployments(deploymentForm.Namespace)
+	deployment, err := deployments.Get(c, deploymentForm.DeploymentName, metav1.GetOptions{})
+	if err != nil {
+		log.Printf("Error getting deployment: %v", err)
+		utils.RespondWithK8sError(c, err, fmt.Sprintf("cannot get deployment %s in namespace %s", deploymentForm.DeploymentName, deploymentForm.Namespace))
+		return
+	}
+	// the new template would not be rolled out
+	if deployment.Spec.Paused {
+		c.JSON(http.StatusConflict, gin.H{"message": fmt.Sprintf("deployment %s is paused, resume it before restarting it", deploymentForm.DeploymentName), "reason": utils.ReasonConflict})
+		return
+	}
+
+	restartedAt := time.Now().Format(time.RFC3339)
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"annotations": map[string]string{RestartedAtAnnotation: restartedAt},
+				},
+			},
+		},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error preparing the restart"})
+		return
+	}
+
+	deployment, err = deployments.Patch(c, deploymentForm.DeploymentName, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		log.Printf("Error restarting deployment: %v", err)
+		utils.RespondWithK8sError(c, err, fmt.Sprintf("cannot restart deployment %s in namespace %s", deploymentForm.DeploymentName, deploymentForm.Namespace))
+		return
+	}
+
+	log.Printf("Deployment %s restarted", deploymentForm.DeploymentName)
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("deployment %s restarted", deploymentForm.DeploymentName), "restartedAt": restartedAt, "deployment": deployment})
+}
+
+func setPaused(c *gin.Context, paused bool) {
+	deploymentForm := DeploymentForm{
+		DeploymentName: c.Param("deployment"),
+		Namespace:      c.Param("namespace"),
+	}
+	if !isDeploymentFormValid(deploymentForm) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": " Please provide deployment_name and namespace"})
+		return
+	}
+	action := "resumed"
+	if paused {
+		action = "paused"
+	}
+
+	patch := []byte(fmt.Sprintf(`{"spec":{"paused":%t}}`, paused))
+	deployment, err := utils.GetClientSet(c).AppsV1().Deployments(deploymentForm.Namespace).Patch(c, deploymentForm.DeploymentName, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		log.Printf("Error updating deployment: %v", err)
+		utils.RespondWithK8sError(c, err, fmt.Sprintf("cannot update deployment %s in namespace %s", deploymentForm.DeploymentName, deploymentForm.Namespace))
+		return
+	}
+
+	log.Printf("Deployment %s %s", deploymentForm.DeploymentName, action)
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("deployment %s %s", deploymentForm.DeploymentName, action), "deployment": deployment})
+}
@@ -0,0 +1,158 @@
+package inventory
+
+// This file describes a cluster : its version, its nodes and the storage classes, ingress classes and CRDs installed on it
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kuro-jojo/kdi-k8s/models"
+	"github.com/kuro-jojo/kdi-k8s/usage"
+	"github.com/kuro-jojo/kdi-k8s/utils"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const CRDsAPIPath = "/apis/apiextensions.k8s.io/v1/customresourcedefinitions"
+
+// crdList is the part of the custom resource definitions used by the inventory
+type crdList struct {
+	Items []struct {
+		metav1.ObjectMeta `json:"metadata"`
+		Spec              struct {
+			Group string `json:"group"`
+			Scope string `json:"scope"`
+			Names struct {
+				Kind string `json:"kind"`
+			} `json:"names"`
+			Versions []struct {
+				Name   string `json:"name"`
+				Served bool   `json:"served"`
+			} `json:"versions"`
+		} `json:"spec"`
+	} `json:"items"`
+}
+
+// GetClusterInventory returns the inventory of the cluster.
+// A part that cannot be read (missing permissions for instance) is reported in errors without failing the others.
+func GetClusterInventory(c *gin.Context) {
+	log.Println("Getting the inventory of the cluster...")
+	clientset := utils.GetClientSet(c)
+
+	version, err := clientset.Discovery().ServerVersion()
+	if err != nil {
+		log.Printf("Error getting the server version: %v", err)
+		utils.RespondWithK8sError(c, err, "cannot get the version of the cluster")
+		return
+	}
+
+	inventory := models.Inventory{
+		ServerVersion:  version.GitVersion,
+		Platform:       version.Platform,
+		Nodes:          make([]models.NodeInventory, 0),
+		StorageClasses: make([]models.StorageClass, 0),
+		IngressClasses: make([]models.IngressClass, 0),
+		CRDs:           make([]models.CRD, 0),
+		CollectedAt:    time.Now(),
+	}
+	errs := make(map[string]utils.K8sError)
+	collect := func(part string, f func(context.Context, kubernetes.Interface, *models.Inventory) error) {
+		if err := f(c, clientset, &inventory); err != nil {
+			log.Printf("Error getting the %s of the cluster: %v", part, err)
+			errs[part] = utils.ClassifyK8sError(err)
+		}
+	}
+	collect("nodes", collectNodes)
+	collect("storageClasses", collectStorageClasses)
+	collect("ingressClasses", collectIngressClasses)
+	collect("crds", collectCRDs)
+
+	c.JSON(http.StatusOK, gin.H{"inventory": inventory, "errors": errs})
+}
+
+func collectNodes(ctx context.Context, clientset kubernetes.Interface, inventory *models.Inventory) error {
+	nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	// the allocated resources are the requests and limits of the pods still running on the nodes
+	pods, err := clientset.CoreV1().Pods("").List(ctx, metav1.ListOptions{FieldSelector: "status.phase!=Succeeded,status.phase!=Failed"})
+	if err != nil {
+		return err
+	}
+	allocated := make(map[string]models.NodeAllocation)
+	for _, pod := range usage.Pods(pods.Items, nil) {
+		a := allocated[pod.Node]
+		a.CPURequests += pod.Usage.CPU.Requests
+		a.CPULimits += pod.Usage.CPU.Limits
+		a.MemoryRequests += pod.Usage.Memory.Requests
+		a.MemoryLimits += pod.Usage.Memory.Limits
+		a.Pods++
+		allocated[pod.Node] = a
+	}
+
+	for i := range nodes.Items {
+		node := models.NodeInventoryFrom(&nodes.Items[i])
+		node.Allocated = allocated[node.Name]
+		inventory.Nodes = append(inventory.Nodes, node)
+	}
+	return nil
+}
+
+func collectStorageClasses(ctx context.Context, clientset kubernetes.Interface, inventory *models.Inventory) error {
+	list, err := clientset.StorageV1().StorageClasses().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	for i := range list.Items {
+		inventory.StorageClasses = append(inventory.StorageClasses, models.StorageClassFrom(&list.Items[i]))
+	}
+	return nil
+}
+
+func collectIngressClasses(ctx context.Context, clientset kubernetes.Interface, inventory *models.Inventory) error {
+	list, err := clientset.NetworkingV1().IngressClasses().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	for i := range list.Items {
+		inventory.IngressClasses = append(inventory.IngressClasses, models.IngressClassFrom(&list.Items[i]))
+	}
+	return nil
+}
+
+// collectCRDs reads the custom resource definitions with the raw api to avoid depending on the apiextensions clientset
+func collectCRDs(ctx context.Context, clientset kubernetes.Interface, inventory *models.Inventory) error {
+	raw, err := clientset.Discovery().RESTClient().Get().AbsPath(CRDsAPIPath).Do(ctx).Raw()
+	if err != nil {
+		return err
+	}
+	var list crdList
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return err
+	}
+
+	for _, item := range list.Items {
+		crd := models.CRD{
+			Name:     item.Name,
+			Group:    item.Spec.Group,
+			Kind:     item.Spec.Names.Kind,
+			Scope:    item.Spec.Scope,
+			Versions: make([]string, 0, len(item.Spec.Versions)),
+		}
+		for _, v := range item.Spec.Versions {
+			if v.Served {
+				crd.Versions = append(crd.Versions, v.Name)
+			}
+		}
+		inventory.CRDs = append(inventory.CRDs, crd)
+	}
+	sort.Slice(inventory.CRDs, func(i, j int) bool { return inventory.CRDs[i].Name < inventory.CRDs[j].Name })
+	return nil
+}
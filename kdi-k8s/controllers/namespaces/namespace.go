@@ -19,9 +19,7 @@ func GetNamespaces(c *gin.Context) {
 
 	if err != nil {
 		log.Println("Error getting namespaces: ", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"message": err.Error(),
-		})
+		utils.RespondWithK8sError(c, err, "cannot get the namespaces")
 		return
 	}
 
@@ -0,0 +1,50 @@
+package nodes
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kuro-jojo/kdi-k8s/models"
+	"github.com/kuro-jojo/kdi-k8s/usage"
+	"github.com/kuro-jojo/kdi-k8s/utils"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// GetNodesUsage returns the cpu and memory used by the nodes compared with their allocatable resources.
+// When the metrics api is missing only the allocatable resources are returned.
+func GetNodesUsage(c *gin.Context) {
+	clientset := utils.GetClientSet(c)
+	log.Println("Getting the resource usage of the nodes...")
+
+	nodes, err := clientset.CoreV1().Nodes().List(c, metav1.ListOptions{})
+	if err != nil {
+		log.Printf("Error listing nodes: %v", err)
+		utils.RespondWithK8sError(c, err, "cannot list the nodes")
+		return
+	}
+
+	response := gin.H{"metricsAvailable": true}
+	metrics, err := usage.GetNodeMetrics(c, clientset)
+	if err != nil {
+		log.Printf("Error getting the node metrics: %v", err)
+		response["metricsAvailable"] = false
+		if usage.IsUnavailable(err) {
+			response["message"] = usage.UnavailableMessage
+		} else {
+			response["message"] = "cannot get the node metrics: " + err.Error()
+		}
+	}
+
+	usages := make([]models.NodeUsage, 0, len(nodes.Items))
+	for _, node := range nodes.Items {
+		var nodeMetrics *usage.NodeMetrics
+		if m, ok := metrics[node.Name]; ok {
+			nodeMetrics = &m
+		}
+		usages = append(usages, usage.Node(node, nodeMetrics))
+	}
+	response["nodes"] = usages
+	response["size"] = len(usages)
+	c.JSON(http.StatusOK, response)
+}
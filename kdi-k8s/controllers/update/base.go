@@ -10,9 +10,9 @@ import (
 
 	v1 "k8s.io/api/apps/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/util/intstr"
 
 	"github.com/gin-gonic/gin"
+	"github.com/kuro-jojo/kdi-k8s/rollout"
 	"github.com/kuro-jojo/kdi-k8s/utils"
 	"k8s.io/client-go/util/retry"
 )
@@ -52,62 +52,55 @@ func UpdateUsingRollingUpdateStrategy(c *gin.Context, updateForm UpdateForm) {
 		updateForm.MaxSurge = "0%"
 	}
 
-	ok := updateUsingK8sStrategy(c, updateForm, v1.RollingUpdateDeploymentStrategyType)
+	revision, ok := updateUsingK8sStrategy(c, updateForm, v1.RollingUpdateDeploymentStrategyType)
 	if !ok {
 		return
 	}
 
-	log.Printf("Deployment %s updated successfully", updateForm.Name)
-	c.JSON(http.StatusOK, gin.H{"message": "Deployment updated successfully"})
+	respondUpdated(c, updateForm, revision)
 }
 
 func UpdateUsingRecreateStrategy(c *gin.Context, updateForm UpdateForm) {
 	log.Println("Updating deployment using recreate strategy...")
 
-	ok := updateUsingK8sStrategy(c, updateForm, v1.RecreateDeploymentStrategyType)
+	revision, ok := updateUsingK8sStrategy(c, updateForm, v1.RecreateDeploymentStrategyType)
 	if !ok {
 		return
 	}
 
-	log.Printf("Deployment %s updated successfully", updateForm.Name)
-	c.JSON(http.StatusOK, gin.H{"message": "Deployment updated successfully"})
+	respondUpdated(c, updateForm, revision)
 }
 
-func updateUsingK8sStrategy(c *gin.Context, updateForm UpdateForm, strategy v1.DeploymentStrategyType) bool {
+// updateUsingK8sStrategy patches the deployment and returns its revision before the update
+func updateUsingK8sStrategy(c *gin.Context, updateForm UpdateForm, strategy v1.DeploymentStrategyType) (int64, bool) {
 
 	clientset := utils.GetClientSet(c)
 	deployment := clientset.AppsV1().Deployments(updateForm.Namespace)
+	var revision int64
 
-	// Retrieve the latest version of Deployment before attempting update
+	// Patch the latest version of the Deployment instead of replacing the whole object
 	// RetryOnConflict uses exponential backoff to avoid exhausting the apiserver
 	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
 
 		result, err := deployment.Get(context.TODO(), updateForm.Name, metav1.GetOptions{})
-		if err != nil && utils.IsNotFoundError(err.Error()) {
-			return fmt.Errorf("deployment %s not found in namespace %s", updateForm.Name, updateForm.Namespace)
+		if err != nil {
+			return err
 		}
-		result.Spec.Replicas = &updateForm.Replicas
-		result.Spec.Strategy.Type = strategy
-		if strategy == v1.RecreateDeploymentStrategyType {
-			result.Spec.Strategy.RollingUpdate = nil
-		} else if strategy == v1.RollingUpdateDeploymentStrategyType {
-			result.Spec.Strategy.RollingUpdate = &v1.RollingUpdateDeployment{
-				MaxUnavailable: &intstr.IntOrString{Type: intstr.String, StrVal: updateForm.MaxUnavailable},
-				MaxSurge:       &intstr.IntOrString{Type: intstr.String, StrVal: updateForm.MaxSurge},
-			}
-		}
-		result.Spec.Template.Spec.Containers[0].Image = updateForm.Image
-		_, updateErr := deployment.Update(context.TODO(), result, metav1.UpdateOptions{})
-		if updateErr != nil {
-			return fmt.Errorf("failed to update deployment %s: %v", updateForm.Name, updateErr)
+		revision = rollout.Revision(result)
+
+		patchType, patch, err := buildDeploymentPatch(updateForm, result, strategy)
+		if err != nil {
+			return err
 		}
-		return nil
+		_, err = deployment.Patch(context.TODO(), updateForm.Name, patchType, patch, metav1.PatchOptions{})
+		return err
 	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
-		return false
+		log.Printf("Error updating deployment %s: %v", updateForm.Name, err)
+		respondWithUpdateError(c, err, fmt.Sprintf("failed to update deployment %s in namespace %s", updateForm.Name, updateForm.Namespace))
+		return 0, false
 	}
-	return true
+	return revision, true
 }
 
 func isNumber(val string) bool {
@@ -3,26 +3,42 @@ package update
 import (
 	"errors"
 	"fmt"
-	"log"
+	"maps"
+	"net/http"
 
 	v1 "k8s.io/api/apps/v1"
 	apicorev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	appsv1 "k8s.io/client-go/kubernetes/typed/apps/v1"
 	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/util/retry"
 
 	"github.com/gin-gonic/gin"
+	"github.com/kuro-jojo/kdi-k8s/rollout"
+	"github.com/kuro-jojo/kdi-k8s/shared/logging"
 	"github.com/kuro-jojo/kdi-k8s/utils"
 )
 
-var (
-	servicesClient    corev1.ServiceInterface
-	deploymentsClient appsv1.DeploymentInterface
-)
+// clients holds the kubernetes clients of a single request.
+// They must not be shared between requests since each request may target a different cluster.
+type clients struct {
+	deployments appsv1.DeploymentInterface
+	services    corev1.ServiceInterface
+}
+
+// newClients returns the clients of the request for the given namespace
+func newClients(c *gin.Context, namespace string) clients {
+	clientset := utils.GetClientSet(c)
+	return clients{
+		deployments: clientset.AppsV1().Deployments(namespace),
+		services:    clientset.CoreV1().Services(namespace),
+	}
+}
 
 // This file contains the Blue/Green strategie for updating a deployment
 
-func UpdateUsingBlueGreenStrategy(c *gin.Context, updateForm UpdateForm) error {
+// UpdateUsingBlueGreenStrategy returns the outcome of the rollout of the new version if the update waited for it
+func UpdateUsingBlueGreenStrategy(c *gin.Context, updateForm UpdateForm) (*rollout.Result, error) {
 
 	// Retrieve the namespace and deployment name from the URL parameters
 	namespace := c.Param("namespace")
@@ -31,69 +47,106 @@ func UpdateUsingBlueGreenStrategy(c *gin.Context, updateForm UpdateForm) error {
 	updateForm.Namespace = namespace
 	updateForm.Name = deploymentName
 
-	clientset := utils.GetClientSet(c)
-	deploymentsClient = clientset.AppsV1().Deployments(updateForm.Namespace)
-	servicesClient = clientset.CoreV1().Services(updateForm.Namespace)
+	cl := newClients(c, updateForm.Namespace)
+	logger := logging.Logger(c).With("deployment", updateForm.Name, "strategy", "blue-green")
 
 	// Step 1: Retrieve the current deployment and service
-	fmt.Println("Getting the current deployment")
-	deployment, err := deploymentsClient.Get(c, updateForm.Name, metav1.GetOptions{})
+	logger.Debug("Getting the current deployment")
+	deployment, err := cl.deployments.Get(c, updateForm.Name, metav1.GetOptions{})
 	if err != nil {
-		return fmt.Errorf("failed to get the current deployment: %v", err)
+		return nil, fmt.Errorf("failed to get the current deployment: %w", err)
 	}
 
-	fmt.Println("Getting the associated service")
+	logger.Debug("Getting the associated service")
 	service, err := getServiceByDeployment(c, deployment, updateForm.Namespace)
 	if err != nil {
-		return fmt.Errorf("failed to get the associated service: %v", err)
+		return nil, fmt.Errorf("failed to get the associated service: %w", err)
 	}
 
 	// Step 2: Create the new deployment
-	fmt.Println("Creating the new deployment")
-	newDeployment, err := createNewDeployment(c, deployment, updateForm)
+	logger.Info("Creating the new deployment")
+	newDeployment, err := createNewDeployment(c, cl, deployment, updateForm)
 	if err != nil {
-		return fmt.Errorf("failed to create new deployment: %v", err)
+		return nil, fmt.Errorf("failed to create new deployment: %w", err)
 	}
 
-	// Step 3: Verify the new deployment
-	/*fmt.Println("Verifying the new deployment")
-	err = verifyDeployment(c, newDeployment.Name, updateForm.Namespace)
-	if err != nil {
-		return err
-	}*/
+	// Step 3: Verify the new deployment before switching the traffic to it
+	var result *rollout.Result
+	if updateForm.Wait {
+		logger.Info("Verifying the new deployment")
+		clientset := utils.GetClientSet(c)
+		timeout := rollout.Timeout(updateForm.Timeout)
+		var r rollout.Result
+		if updateForm.AutoRollback {
+			r = rollout.Watch(c.Request.Context(), clientset, updateForm.Namespace, newDeployment.Name, timeout)
+		} else {
+			r = rollout.Wait(c.Request.Context(), clientset, updateForm.Namespace, newDeployment.Name, timeout)
+		}
+		if r.Outcome != rollout.Available {
+			deleteErr := DeleteNewDeployment(c, newDeployment.Name, updateForm.Namespace)
+			if deleteErr != nil {
+				logger.Error("Failed to delete the new deployment", "new_deployment", newDeployment.Name, "error", deleteErr)
+			}
+			if updateForm.AutoRollback {
+				// the traffic was not switched yet so it stays on the current version
+				r.SetRollback(blueGreenRollback(service.Name, deployment.Name, newDeployment.Name, deleteErr))
+			}
+			return nil, &rolloutError{result: r}
+		}
+		result = &r
+	}
+
+	// an interrupted request stops before switching the traffic, which stays on the current version
+	if err := c.Request.Context().Err(); err != nil {
+		logger.Warn("Update interrupted before switching the traffic", "error", err)
+		message := fmt.Sprintf("the update was interrupted before switching the traffic, deployment %s was deleted", newDeployment.Name)
+		if deleteErr := DeleteNewDeployment(c, newDeployment.Name, updateForm.Namespace); deleteErr != nil {
+			message = fmt.Sprintf("the update was interrupted before switching the traffic but %v", deleteErr)
+		}
+		return nil, &patchError{status: http.StatusServiceUnavailable, reason: utils.ReasonInterrupted, message: message}
+	}
 
 	// Step 4: Update the service to point to the new deployment
-	fmt.Println("Updating the service to point to the new deployment")
-	err = updateService(c, service, updateForm)
+	logger.Info("Updating the service to point to the new deployment", "service", service.Name)
+	blueSelector := maps.Clone(service.Spec.Selector)
+	err = updateService(c, cl, service)
 	if err != nil {
 		// Clean up the new deployment if updating the service fails
 		deleteErr := DeleteNewDeployment(c, newDeployment.Name, updateForm.Namespace)
 		if deleteErr != nil {
-			return fmt.Errorf("failed to update service and failed to delete new deployment: %v, %v", err, deleteErr)
+			return nil, fmt.Errorf("failed to update service and failed to delete new deployment: %w, %v", err, deleteErr)
 		}
-		return fmt.Errorf("failed to update service: %v", err)
+		return nil, fmt.Errorf("failed to update service: %w", err)
 	}
 
 	// Step 5: Scale down the old deployment
-	fmt.Println("Redefining the old deployment")
+	logger.Info("Redefining the old deployment")
 	err = RedefineOldVersion(c, updateForm.Namespace, deployment.ObjectMeta.Name)
 	if err != nil {
-		return fmt.Errorf("failed to redefine the old deployment : %v", err)
+		if updateForm.AutoRollback {
+			// Switch the service back to the old deployment which was left untouched
+			if switchErr := switchServiceBack(c, cl, service.Name, blueSelector); switchErr != nil {
+				return nil, fmt.Errorf("failed to redefine the old deployment and failed to switch the service back: %w, %v", err, switchErr)
+			}
+			if deleteErr := DeleteNewDeployment(c, newDeployment.Name, updateForm.Namespace); deleteErr != nil {
+				logger.Error("Failed to delete the new deployment", "new_deployment", newDeployment.Name, "error", deleteErr)
+			}
+		}
+		return nil, fmt.Errorf("failed to redefine the old deployment : %w", err)
 	}
 
-	return nil
-
+	return result, nil
 }
 
 // GetDeploymentStatus retrieves the status of the specified deployment
 func GetDeploymentStatus(c *gin.Context, deploymentName, namespace string) (*DeploymentStatus, error) {
 	clientset := utils.GetClientSet(c)
-	deploymentsClient = clientset.AppsV1().Deployments(namespace)
+	deploymentsClient := clientset.AppsV1().Deployments(namespace)
 
 	// Retrieve the deployment
 	deployment, err := deploymentsClient.Get(c, deploymentName, metav1.GetOptions{})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get deployment: %v", err)
+		return nil, fmt.Errorf("failed to get deployment: %w", err)
 	}
 
 	// Retrieve the pods associated with the deployment
@@ -102,7 +155,7 @@ func GetDeploymentStatus(c *gin.Context, deploymentName, namespace string) (*Dep
 		LabelSelector: metav1.FormatLabelSelector(deployment.Spec.Selector),
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to list pods: %v", err)
+		return nil, fmt.Errorf("failed to list pods: %w", err)
 	}
 
 	// Collect the status of the pods
@@ -156,7 +209,7 @@ func getServiceByDeployment(c *gin.Context, deployment *v1.Deployment, namespace
 			}
 		}
 		if matches {
-			log.Printf("%v", s)
+			logging.Logger(c).Debug("Service of the deployment found", "service", s.Name)
 			return &s, nil
 		}
 	}
@@ -164,21 +217,29 @@ func getServiceByDeployment(c *gin.Context, deployment *v1.Deployment, namespace
 	return nil, errors.New("associated service not found")
 }
 
-func createNewDeployment(c *gin.Context, deployment *v1.Deployment, updateForm UpdateForm) (*v1.Deployment, error) {
-	newDeployment := deployment.DeepCopy()
+func createNewDeployment(c *gin.Context, cl clients, deployment *v1.Deployment, updateForm UpdateForm) (*v1.Deployment, error) {
+	// The strategy of the deployment is kept since the traffic is switched by the service
+	patchType, patch, err := buildDeploymentPatch(updateForm, deployment, "")
+	if err != nil {
+		return nil, err
+	}
+	newDeployment, err := applyDeploymentPatch(deployment, patchType, patch)
+	if err != nil {
+		return nil, err
+	}
 	newDeployment.ObjectMeta.ResourceVersion = ""
+	newDeployment.ObjectMeta.UID = ""
 	newDeployment.ObjectMeta.Name = updateForm.Name + "-green"
-	newDeployment.Spec.Template.Spec.Containers[0].Image = updateForm.Image
-	newDeployment.Spec.Replicas = &updateForm.Replicas
 	//newDeployment.Spec.Strategy.Type = updateForm.Strategy
 
 	labels := newDeployment.Spec.Template.Labels
+	if labels == nil {
+		labels = make(map[string]string)
+	}
 	labels["version"] = "green"
 	newDeployment.Spec.Template.Labels = labels
 
-	clientset := utils.GetClientSet(c)
-	deploymentsClient = clientset.AppsV1().Deployments(updateForm.Namespace)
-	createdDeployment, err := deploymentsClient.Create(c, newDeployment, metav1.CreateOptions{})
+	createdDeployment, err := cl.deployments.Create(c, newDeployment, metav1.CreateOptions{})
 	if err != nil {
 		return nil, err
 	}
@@ -186,14 +247,12 @@ func createNewDeployment(c *gin.Context, deployment *v1.Deployment, updateForm U
 	return createdDeployment, nil
 }
 
-func updateService(c *gin.Context, service *apicorev1.Service, updateForm UpdateForm) error {
-	clientset := utils.GetClientSet(c)
-	servicesClient = clientset.CoreV1().Services(updateForm.Namespace)
+func updateService(c *gin.Context, cl clients, service *apicorev1.Service) error {
 	selector := service.Spec.Selector
 	selector["version"] = "green"
 	service.Spec.Selector = selector
 
-	_, err := servicesClient.Update(c, service, metav1.UpdateOptions{})
+	_, err := cl.services.Update(c, service, metav1.UpdateOptions{})
 
 	/*if err != nil {
 		return err
@@ -201,14 +260,39 @@ func updateService(c *gin.Context, service *apicorev1.Service, updateForm Update
 	return err
 }
 
+// switchServiceBack restores the selector of the service to send the traffic to the old deployment
+func switchServiceBack(c *gin.Context, cl clients, serviceName string, selector map[string]string) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		service, err := cl.services.Get(c, serviceName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		service.Spec.Selector = selector
+		_, err = cl.services.Update(c, service, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// blueGreenRollback describes the revert of a blue/green update whose new deployment failed its rollout
+func blueGreenRollback(serviceName, oldDeploymentName, newDeploymentName string, deleteErr error) rollout.Rollback {
+	rollback := rollout.Rollback{
+		Succeeded: true,
+		Message:   fmt.Sprintf("service %s kept on deployment %s and deployment %s deleted", serviceName, oldDeploymentName, newDeploymentName),
+	}
+	if deleteErr != nil {
+		rollback.Succeeded = false
+		rollback.Error = fmt.Sprintf("service %s kept on deployment %s but %v", serviceName, oldDeploymentName, deleteErr)
+	}
+	return rollback
+}
+
 func DeleteNewDeployment(c *gin.Context, newDeploymentName string, namespace string) error {
-	clientset := utils.GetClientSet(c)
-	deploymentsClient = clientset.AppsV1().Deployments(namespace)
+	deploymentsClient := newClients(c, namespace).deployments
 	err := deploymentsClient.Delete(c, newDeploymentName, metav1.DeleteOptions{})
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to delete the deployment: %w", err)
 	}
-	return errors.New("failed to delete the deployment")
+	return nil
 }
 
 func RedefineOldVersion(c *gin.Context, namespace string, deploymentName string) error {
@@ -218,7 +302,7 @@ func RedefineOldVersion(c *gin.Context, namespace string, deploymentName string)
 	// Step 1: Retrieve the existing deployment
 	deployment, err := deploymentsClient.Get(c, deploymentName, metav1.GetOptions{})
 	if err != nil {
-		return fmt.Errorf("failed to get deployment: %v", err)
+		return fmt.Errorf("failed to get deployment: %w", err)
 	}
 
 	// Step 2: Add the new label to the deployment's pod template labels
@@ -230,8 +314,8 @@ func RedefineOldVersion(c *gin.Context, namespace string, deploymentName string)
 	// Step 3: Update the deployment
 	_, err = deploymentsClient.Update(c, deployment, metav1.UpdateOptions{})
 	if err != nil {
-		return fmt.Errorf("failed to update deployment: %v", err)
+		return fmt.Errorf("failed to update deployment: %w", err)
 	}
 
 	return nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,292 @@
+package update
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	v1 "k8s.io/api/apps/v1"
+	apicorev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+
+	"github.com/kuro-jojo/kdi-k8s/utils"
+)
+
+// This file builds the patches applied to a deployment's pod template.
+// Containers are always targeted by name since sidecars make their position unpredictable.
+
+// patchError is returned when the patch cannot be built from the update form
+type patchError struct {
+	status  int
+	reason  string
+	message string
+}
+
+func (e *patchError) Error() string {
+	return e.message
+}
+
+// resolveContainerUpdates returns the container updates of the form.
+// The legacy image field is turned into an update of the container named in the form,
+// or of the only container of the pod if no name is given.
+func resolveContainerUpdates(updateForm UpdateForm, podSpec apicorev1.PodSpec) ([]ContainerUpdate, error) {
+	updates := append([]ContainerUpdate{}, updateForm.Containers...)
+
+	if updateForm.Image != "" {
+		name := updateForm.Container
+		if name == "" {
+			if len(podSpec.Containers) != 1 {
+				return nil, &patchError{http.StatusBadRequest, utils.ReasonBadRequest, "The pod template has several containers - Please provide the name of the container to update"}
+			}
+			name = podSpec.Containers[0].Name
+		}
+		updates = append(updates, ContainerUpdate{Name: name, Image: updateForm.Image})
+	}
+
+	merged := []ContainerUpdate{}
+	for _, update := range updates {
+		if update.Name == "" {
+			return nil, &patchError{http.StatusBadRequest, utils.ReasonBadRequest, "Please provide the name of each container to update"}
+		}
+		if containerIndex(podSpec, update.Name, update.Init) < 0 {
+			kind := "container"
+			if update.Init {
+				kind = "init container"
+			}
+			return nil, &patchError{http.StatusNotFound, utils.ReasonNotFound, fmt.Sprintf("%s %s not found in the pod template", kind, update.Name)}
+		}
+		merged = mergeContainerUpdate(merged, update)
+	}
+	return merged, nil
+}
+
+// mergeContainerUpdate adds the update to the list, merging it with a previous update of the same container
+func mergeContainerUpdate(updates []ContainerUpdate, update ContainerUpdate) []ContainerUpdate {
+	for i := range updates {
+		u := &updates[i]
+		if u.Name != update.Name || u.Init != update.Init {
+			continue
+		}
+		if update.Image != "" {
+			u.Image = update.Image
+		}
+		if update.Env != nil {
+			u.Env = update.Env
+		}
+		if update.Resources != nil {
+			u.Resources = update.Resources
+		}
+		if update.LivenessProbe != nil {
+			u.LivenessProbe = update.LivenessProbe
+		}
+		if update.ReadinessProbe != nil {
+			u.ReadinessProbe = update.ReadinessProbe
+		}
+		if update.StartupProbe != nil {
+			u.StartupProbe = update.StartupProbe
+		}
+		return updates
+	}
+	return append(updates, update)
+}
+
+// containerIndex returns the position of the named container in the pod spec or -1 if it does not exist
+func containerIndex(podSpec apicorev1.PodSpec, name string, init bool) int {
+	containers := podSpec.Containers
+	if init {
+		containers = podSpec.InitContainers
+	}
+	for i, container := range containers {
+		if container.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// buildDeploymentPatch returns the patch to apply to the deployment according to the patch type of the form.
+// The strategy is left untouched if it is empty.
+func buildDeploymentPatch(updateForm UpdateForm, deployment *v1.Deployment, strategy v1.DeploymentStrategyType) (types.PatchType, []byte, error) {
+	updates, err := resolveContainerUpdates(updateForm, deployment.Spec.Template.Spec)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if updateForm.PatchType == JSONPatchType {
+		data, err := buildJSONPatch(updateForm, deployment, strategy, updates)
+		return types.JSONPatchType, data, err
+	}
+	if len(updateForm.JSONPatch) > 0 {
+		return "", nil, &patchError{http.StatusBadRequest, utils.ReasonBadRequest, "JSON patch operations require the json patch type"}
+	}
+	data, err := buildStrategicMergePatch(updateForm, strategy, updates)
+	return types.StrategicMergePatchType, data, err
+}
+
+func buildStrategicMergePatch(updateForm UpdateForm, strategy v1.DeploymentStrategyType, updates []ContainerUpdate) ([]byte, error) {
+	spec := map[string]interface{}{
+		"replicas": updateForm.Replicas,
+		"template": templatePatch(updateForm.PodAnnotations, updates),
+	}
+	if strategy != "" {
+		spec["strategy"] = strategyPatch(updateForm, strategy)
+	}
+
+	return json.Marshal(map[string]interface{}{"spec": spec})
+}
+
+// templatePatch returns the strategic merge patch of a pod template
+func templatePatch(podAnnotations map[string]string, updates []ContainerUpdate) map[string]interface{} {
+	podSpec := map[string]interface{}{}
+	var containers, initContainers []map[string]interface{}
+	for _, update := range updates {
+		if update.Init {
+			initContainers = append(initContainers, containerPatch(update))
+		} else {
+			containers = append(containers, containerPatch(update))
+		}
+	}
+	if len(containers) > 0 {
+		podSpec["containers"] = containers
+	}
+	if len(initContainers) > 0 {
+		podSpec["initContainers"] = initContainers
+	}
+
+	template := map[string]interface{}{"spec": podSpec}
+	if len(podAnnotations) > 0 {
+		template["metadata"] = map[string]interface{}{"annotations": podAnnotations}
+	}
+	return template
+}
+
+// containerPatch returns the fields of the container to merge. The name is the merge key.
+func containerPatch(update ContainerUpdate) map[string]interface{} {
+	patch := map[string]interface{}{"name": update.Name}
+	for field, value := range containerFields(update) {
+		patch[field] = value
+	}
+	return patch
+}
+
+// containerFields returns the fields of the container set in the update
+func containerFields(update ContainerUpdate) map[string]interface{} {
+	fields := map[string]interface{}{}
+	if update.Image != "" {
+		fields["image"] = update.Image
+	}
+	if update.Env != nil {
+		fields["env"] = update.Env
+	}
+	if update.Resources != nil {
+		fields["resources"] = update.Resources
+	}
+	if update.LivenessProbe != nil {
+		fields["livenessProbe"] = update.LivenessProbe
+	}
+	if update.ReadinessProbe != nil {
+		fields["readinessProbe"] = update.ReadinessProbe
+	}
+	if update.StartupProbe != nil {
+		fields["startupProbe"] = update.StartupProbe
+	}
+	return fields
+}
+
+func strategyPatch(updateForm UpdateForm, strategy v1.DeploymentStrategyType) map[string]interface{} {
+	patch := map[string]interface{}{"type": strategy}
+	if strategy == v1.RollingUpdateDeploymentStrategyType {
+		patch["rollingUpdate"] = v1.RollingUpdateDeployment{
+			MaxUnavailable: &intstr.IntOrString{Type: intstr.String, StrVal: updateForm.MaxUnavailable},
+			MaxSurge:       &intstr.IntOrString{Type: intstr.String, StrVal: updateForm.MaxSurge},
+		}
+	} else {
+		// a recreate deployment must not have rolling update parameters
+		patch["rollingUpdate"] = nil
+	}
+	return patch
+}
+
+// buildJSONPatch returns the RFC 6902 operations updating the deployment.
+// The operations are guarded by the resource version of the deployment they were computed from.
+func buildJSONPatch(updateForm UpdateForm, deployment *v1.Deployment, strategy v1.DeploymentStrategyType, updates []ContainerUpdate) ([]byte, error) {
+	operations := []JSONPatchOperation{
+		{Op: "test", Path: "/metadata/resourceVersion", Value: deployment.ResourceVersion},
+		{Op: "replace", Path: "/spec/replicas", Value: updateForm.Replicas},
+	}
+	if strategy != "" {
+		s := v1.DeploymentStrategy{Type: strategy}
+		if strategy == v1.RollingUpdateDeploymentStrategyType {
+			s.RollingUpdate = &v1.RollingUpdateDeployment{
+				MaxUnavailable: &intstr.IntOrString{Type: intstr.String, StrVal: updateForm.MaxUnavailable},
+				MaxSurge:       &intstr.IntOrString{Type: intstr.String, StrVal: updateForm.MaxSurge},
+			}
+		}
+		operations = append(operations, JSONPatchOperation{Op: "replace", Path: "/spec/strategy", Value: s})
+	}
+
+	for _, update := range updates {
+		list := "containers"
+		if update.Init {
+			list = "initContainers"
+		}
+		base := fmt.Sprintf("/spec/template/spec/%s/%d", list, containerIndex(deployment.Spec.Template.Spec, update.Name, update.Init))
+		for field, value := range containerFields(update) {
+			// add replaces the value of an existing member
+			operations = append(operations, JSONPatchOperation{Op: "add", Path: base + "/" + field, Value: value})
+		}
+	}
+
+	if len(updateForm.PodAnnotations) > 0 {
+		if deployment.Spec.Template.Annotations == nil {
+			operations = append(operations, JSONPatchOperation{Op: "add", Path: "/spec/template/metadata/annotations", Value: updateForm.PodAnnotations})
+		} else {
+			for key, value := range updateForm.PodAnnotations {
+				operations = append(operations, JSONPatchOperation{Op: "add", Path: "/spec/template/metadata/annotations/" + escapeJSONPointer(key), Value: value})
+			}
+		}
+	}
+
+	operations = append(operations, updateForm.JSONPatch...)
+	return json.Marshal(operations)
+}
+
+// escapeJSONPointer escapes a key to be used as a JSON pointer token (RFC 6901)
+func escapeJSONPointer(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
+
+// applyDeploymentPatch applies the patch locally to a copy of the deployment
+func applyDeploymentPatch(deployment *v1.Deployment, patchType types.PatchType, patch []byte) (*v1.Deployment, error) {
+	original, err := json.Marshal(deployment)
+	if err != nil {
+		return nil, err
+	}
+
+	var patched []byte
+	if patchType == types.JSONPatchType {
+		operations, err := jsonpatch.DecodePatch(patch)
+		if err != nil {
+			return nil, &patchError{http.StatusBadRequest, utils.ReasonBadRequest, fmt.Sprintf("invalid json patch: %v", err)}
+		}
+		patched, err = operations.Apply(original)
+		if err != nil {
+			return nil, &patchError{http.StatusUnprocessableEntity, utils.ReasonInvalid, fmt.Sprintf("failed to apply json patch: %v", err)}
+		}
+	} else {
+		patched, err = strategicpatch.StrategicMergePatch(original, patch, v1.Deployment{})
+		if err != nil {
+			return nil, &patchError{http.StatusUnprocessableEntity, utils.ReasonInvalid, fmt.Sprintf("failed to apply patch: %v", err)}
+		}
+	}
+
+	result := &v1.Deployment{}
+	if err := json.Unmarshal(patched, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
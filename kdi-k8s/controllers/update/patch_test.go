@@ -0,0 +1,243 @@
+package update
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	v1 "k8s.io/api/apps/v1"
+	apicorev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// newDeployment returns a deployment with an app container, a sidecar and an init container
+func newDeployment(annotations map[string]string) *v1.Deployment {
+	replicas := int32(2)
+	return &v1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", ResourceVersion: "42"},
+		Spec: v1.DeploymentSpec{
+			Replicas: &replicas,
+			Strategy: v1.DeploymentStrategy{Type: v1.RollingUpdateDeploymentStrategyType},
+			Template: apicorev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Annotations: annotations},
+				Spec: apicorev1.PodSpec{
+					InitContainers: []apicorev1.Container{{Name: "migrate", Image: "migrate:1"}},
+					Containers: []apicorev1.Container{
+						{Name: "proxy", Image: "proxy:1"},
+						{Name: "app", Image: "app:1"},
+					},
+				},
+			},
+		},
+	}
+}
+
+// patchStatus returns the status of a patch error or 0 if err is not one
+func patchStatus(err error) int {
+	var pErr *patchError
+	if errors.As(err, &pErr) {
+		return pErr.status
+	}
+	return 0
+}
+
+func TestResolveContainerUpdates(t *testing.T) {
+	single := apicorev1.PodSpec{Containers: []apicorev1.Container{{Name: "app"}}}
+	several := newDeployment(nil).Spec.Template.Spec
+	tests := []struct {
+		name    string
+		form    UpdateForm
+		podSpec apicorev1.PodSpec
+		want    []ContainerUpdate
+		status  int
+	}{
+		{"image of the only container", UpdateForm{Image: "app:2"}, single, []ContainerUpdate{{Name: "app", Image: "app:2"}}, 0},
+		{"image of a named container", UpdateForm{Container: "app", Image: "app:2"}, several, []ContainerUpdate{{Name: "app", Image: "app:2"}}, 0},
+		{"image without container name", UpdateForm{Image: "app:2"}, several, nil, http.StatusBadRequest},
+		{"container without name", UpdateForm{Containers: []ContainerUpdate{{Image: "app:2"}}}, several, nil, http.StatusBadRequest},
+		{"unknown container", UpdateForm{Containers: []ContainerUpdate{{Name: "db", Image: "db:2"}}}, several, nil, http.StatusNotFound},
+		{"init container as a container", UpdateForm{Containers: []ContainerUpdate{{Name: "migrate", Image: "migrate:2"}}}, several, nil, http.StatusNotFound},
+		{"init container", UpdateForm{Containers: []ContainerUpdate{{Name: "migrate", Init: true, Image: "migrate:2"}}}, several,
+			[]ContainerUpdate{{Name: "migrate", Init: true, Image: "migrate:2"}}, 0},
+		{"updates of a container merged", UpdateForm{
+			Container:  "app",
+			Image:      "app:3",
+			Containers: []ContainerUpdate{{Name: "app", Image: "app:2", Env: []apicorev1.EnvVar{{Name: "MODE", Value: "prod"}}}},
+		}, several, []ContainerUpdate{{Name: "app", Image: "app:3", Env: []apicorev1.EnvVar{{Name: "MODE", Value: "prod"}}}}, 0},
+	}
+	for _, tt := range tests {
+		updates, err := resolveContainerUpdates(tt.form, tt.podSpec)
+		if status := patchStatus(err); status != tt.status || (err != nil && status == 0) {
+			t.Errorf("%s: error = %v, want status %d", tt.name, err, tt.status)
+			continue
+		}
+		got, _ := json.Marshal(updates)
+		want, _ := json.Marshal(tt.want)
+		if tt.status == 0 && string(got) != string(want) {
+			t.Errorf("%s: updates = %s, want %s", tt.name, got, want)
+		}
+	}
+}
+
+func TestBuildStrategicMergePatch(t *testing.T) {
+	form := UpdateForm{
+		Replicas:       3,
+		MaxUnavailable: "25%",
+		MaxSurge:       "1",
+		PodAnnotations: map[string]string{"kdi/revision": "2"},
+	}
+	updates := []ContainerUpdate{{Name: "app", Image: "app:2"}, {Name: "migrate", Init: true, Image: "migrate:2"}}
+
+	patch, err := buildStrategicMergePatch(form, v1.RollingUpdateDeploymentStrategyType, updates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"spec":{"replicas":3,"strategy":{"rollingUpdate":{"maxUnavailable":"25%","maxSurge":"1"},"type":"RollingUpdate"},` +
+		`"template":{"metadata":{"annotations":{"kdi/revision":"2"}},` +
+		`"spec":{"containers":[{"image":"app:2","name":"app"}],"initContainers":[{"image":"migrate:2","name":"migrate"}]}}}}`
+	if string(patch) != want {
+		t.Errorf("patch = %s, want %s", patch, want)
+	}
+
+	deployment, err := applyDeploymentPatch(newDeployment(nil), types.StrategicMergePatchType, patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	containers := deployment.Spec.Template.Spec.Containers
+	if len(containers) != 2 || containers[0].Image != "proxy:1" || containers[1].Image != "app:2" {
+		t.Errorf("containers = %+v, want only the app updated", containers)
+	}
+	if image := deployment.Spec.Template.Spec.InitContainers[0].Image; image != "migrate:2" {
+		t.Errorf("init container image = %s, want migrate:2", image)
+	}
+	if *deployment.Spec.Replicas != 3 || deployment.Spec.Template.Annotations["kdi/revision"] != "2" {
+		t.Errorf("replicas = %d, annotations = %v", *deployment.Spec.Replicas, deployment.Spec.Template.Annotations)
+	}
+}
+
+func TestBuildStrategicMergePatchRecreate(t *testing.T) {
+	patch, err := buildStrategicMergePatch(UpdateForm{Replicas: 1}, v1.RecreateDeploymentStrategyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"spec":{"replicas":1,"strategy":{"rollingUpdate":null,"type":"Recreate"},"template":{"spec":{}}}}`
+	if string(patch) != want {
+		t.Errorf("patch = %s, want %s", patch, want)
+	}
+
+	deployment, err := applyDeploymentPatch(newDeployment(nil), types.StrategicMergePatchType, patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deployment.Spec.Strategy.Type != v1.RecreateDeploymentStrategyType || deployment.Spec.Strategy.RollingUpdate != nil {
+		t.Errorf("strategy = %+v, want recreate without rolling update parameters", deployment.Spec.Strategy)
+	}
+}
+
+func TestBuildJSONPatch(t *testing.T) {
+	form := UpdateForm{
+		Replicas:       3,
+		PatchType:      JSONPatchType,
+		PodAnnotations: map[string]string{"kdi/revision": "2"},
+		JSONPatch:      []JSONPatchOperation{{Op: "replace", Path: "/spec/minReadySeconds", Value: 0}},
+	}
+	updates := []ContainerUpdate{{Name: "app", Image: "app:2"}}
+
+	patch, err := buildJSONPatch(form, newDeployment(nil), "", updates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"op":"test","path":"/metadata/resourceVersion","value":"42"},` +
+		`{"op":"replace","path":"/spec/replicas","value":3},` +
+		`{"op":"add","path":"/spec/template/spec/containers/1/image","value":"app:2"},` +
+		`{"op":"add","path":"/spec/template/metadata/annotations","value":{"kdi/revision":"2"}},` +
+		`{"op":"replace","path":"/spec/minReadySeconds","value":0}]`
+	if string(patch) != want {
+		t.Errorf("patch = %s, want %s", patch, want)
+	}
+
+	deployment, err := applyDeploymentPatch(newDeployment(nil), types.JSONPatchType, patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	containers := deployment.Spec.Template.Spec.Containers
+	if containers[0].Image != "proxy:1" || containers[1].Image != "app:2" {
+		t.Errorf("containers = %+v, want only the app updated", containers)
+	}
+	if *deployment.Spec.Replicas != 3 || deployment.Spec.Template.Annotations["kdi/revision"] != "2" {
+		t.Errorf("replicas = %d, annotations = %v", *deployment.Spec.Replicas, deployment.Spec.Template.Annotations)
+	}
+}
+
+func TestBuildJSONPatchExistingAnnotations(t *testing.T) {
+	form := UpdateForm{Replicas: 1, PodAnnotations: map[string]string{"kdi/revision": "2"}}
+	original := newDeployment(map[string]string{"team": "web"})
+
+	patch, err := buildJSONPatch(form, original, v1.RecreateDeploymentStrategyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"op":"test","path":"/metadata/resourceVersion","value":"42"},` +
+		`{"op":"replace","path":"/spec/replicas","value":1},` +
+		`{"op":"replace","path":"/spec/strategy","value":{"type":"Recreate"}},` +
+		`{"op":"add","path":"/spec/template/metadata/annotations/kdi~1revision","value":"2"}]`
+	if string(patch) != want {
+		t.Errorf("patch = %s, want %s", patch, want)
+	}
+
+	deployment, err := applyDeploymentPatch(original, types.JSONPatchType, patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if annotations := deployment.Spec.Template.Annotations; annotations["team"] != "web" || annotations["kdi/revision"] != "2" {
+		t.Errorf("annotations = %v, want both annotations", annotations)
+	}
+}
+
+func TestBuildJSONPatchStaleResourceVersion(t *testing.T) {
+	patch, err := buildJSONPatch(UpdateForm{Replicas: 1}, newDeployment(nil), "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed := newDeployment(nil)
+	changed.ResourceVersion = "43"
+	if _, err := applyDeploymentPatch(changed, types.JSONPatchType, patch); patchStatus(err) != http.StatusUnprocessableEntity {
+		t.Errorf("error = %v, want the test of the resource version to fail", err)
+	}
+}
+
+func TestBuildDeploymentPatchOperationsNeedJSONType(t *testing.T) {
+	form := UpdateForm{
+		Replicas:  1,
+		PatchType: StrategicMergePatchType,
+		JSONPatch: []JSONPatchOperation{{Op: "remove", Path: "/spec/minReadySeconds"}},
+	}
+	if _, _, err := buildDeploymentPatch(form, newDeployment(nil), ""); patchStatus(err) != http.StatusBadRequest {
+		t.Errorf("error = %v, want a bad request", err)
+	}
+}
+
+func TestJSONPatchOperationValue(t *testing.T) {
+	tests := []struct {
+		operation JSONPatchOperation
+		want      string
+	}{
+		{JSONPatchOperation{Op: "replace", Path: "/spec/replicas", Value: 0}, `{"op":"replace","path":"/spec/replicas","value":0}`},
+		{JSONPatchOperation{Op: "add", Path: "/metadata/labels/tier", Value: ""}, `{"op":"add","path":"/metadata/labels/tier","value":""}`},
+		{JSONPatchOperation{Op: "test", Path: "/spec/paused", Value: false}, `{"op":"test","path":"/spec/paused","value":false}`},
+		{JSONPatchOperation{Op: "add", Path: "/spec/selector", Value: nil}, `{"op":"add","path":"/spec/selector","value":null}`},
+		{JSONPatchOperation{Op: "remove", Path: "/spec/minReadySeconds"}, `{"op":"remove","path":"/spec/minReadySeconds"}`},
+		{JSONPatchOperation{Op: "move", Path: "/a", From: "/b"}, `{"op":"move","path":"/a","from":"/b"}`},
+	}
+	for _, tt := range tests {
+		got, err := json.Marshal(tt.operation)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s %s = %s, want %s", tt.operation.Op, tt.operation.Path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package update
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/kuro-jojo/kdi-k8s/metrics"
+	"github.com/kuro-jojo/kdi-k8s/models"
+	"github.com/kuro-jojo/kdi-k8s/utils"
+	v1 "k8s.io/api/apps/v1"
+	apicorev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// This file contains the update strategies of a statefulset.
+// A RollingUpdate with a partition only updates the pods with an ordinal greater than or equal to the partition,
+// so the update can be verified on the last pods before lowering the partition step by step.
+// With OnDelete the pods are only updated when they are deleted, one by one with the recycle endpoint.
+
+// StatefulSetUpdateForm is the update of the pod template and the update strategy of a statefulset
+type StatefulSetUpdateForm struct {
+	Strategy  string `json:"strategy" binding:"required"` // RollingUpdate or OnDelete
+	Partition *int32 `json:"partition"`                   // Only the pods with an ordinal >= partition are updated (RollingUpdate only), unchanged if not given
+	Replicas  int32  `json:"replicas"`                    // Left untouched if 0
+	Container string `json:"container"`
+	Image     string `json:"image"`
+
+	Containers     []ContainerUpdate `json:"containers"`
+	PodAnnotations map[string]string `json:"pod_annotations"`
+}
+
+// PartitionForm moves the partition of a statefulset
+type PartitionForm struct {
+	Partition int32 `json:"partition"`
+}
+
+// PodRevision is the revision of a pod of a statefulset
+type PodRevision struct {
+	Ordinal  int    `json:"ordinal"`
+	Name     string `json:"name"`
+	Revision string `json:"revision"`
+	Updated  bool   `json:"updated"` // The pod runs the update revision
+	Ready    bool   `json:"ready"`
+	Phase    string `json:"phase"`
+}
+
+// StatefulSetRevisions is the progress of the update of a statefulset
+type StatefulSetRevisions struct {
+	Strategy        string        `json:"strategy"`
+	Partition       int32         `json:"partition"`
+	Replicas        int32         `json:"replicas"`
+	CurrentRevision string        `json:"currentRevision"`
+	UpdateRevision  string        `json:"updateRevision"`
+	UpdatedReplicas int32         `json:"updatedReplicas"`
+	Pods            []PodRevision `json:"pods"`
+}
+
+// UpdateStatefulSet updates the pod template of a statefulset and its update strategy
+func UpdateStatefulSet(c *gin.Context) {
+	var updateForm StatefulSetUpdateForm
+	if err := c.ShouldBindBodyWith(&updateForm, binding.JSON); err != nil {
+		log.Printf("Invalid form %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid form - Please provide at least the strategy used"})
+		return
+	}
+	namespace := c.Param("namespace")
+	name := c.Param("statefulset")
+
+	strategy := v1.StatefulSetUpdateStrategyType(updateForm.Strategy)
+	if strategy != v1.RollingUpdateStatefulSetStrategyType && strategy != v1.OnDeleteStatefulSetStrategyType {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid strategy - use RollingUpdate or OnDelete", "reason": utils.ReasonBadRequest})
+		return
+	}
+	if updateForm.Partition != nil && (*updateForm.Partition < 0 || strategy != v1.RollingUpdateStatefulSetStrategyType) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "The partition must be positive and is only used by the RollingUpdate strategy", "reason": utils.ReasonBadRequest})
+		return
+	}
+	log.Printf("Updating statefulset %s using %s strategy...", name, strategy)
+	defer func() { metrics.ObserveUpdate(models.StatefulSetKind, string(strategy), c.Writer.Status()) }()
+
+	clientset := utils.GetClientSet(c)
+	statefulsets := clientset.AppsV1().StatefulSets(namespace)
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		statefulset, err := statefulsets.Get(c, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		form := UpdateForm{Container: updateForm.Container, Image: updateForm.Image, Containers: updateForm.Containers}
+		updates, err := resolveContainerUpdates(form, statefulset.Spec.Template.Spec)
+		if err != nil {
+			return err
+		}
+
+		spec := map[string]interface{}{
+			"template":       templatePatch(updateForm.PodAnnotations, updates),
+			"updateStrategy": statefulSetStrategyPatch(strategy, updateForm.Partition),
+		}
+		if updateForm.Replicas > 0 {
+			spec["replicas"] = updateForm.Replicas
+		}
+		patch, err := json.Marshal(map[string]interface{}{"spec": spec})
+		if err != nil {
+			return err
+		}
+		_, err = statefulsets.Patch(c, name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+		return err
+	})
+	if err != nil {
+		log.Printf("Error updating statefulset %s: %v", name, err)
+		respondWithUpdateError(c, err, fmt.Sprintf("failed to update statefulset %s in namespace %s", name, namespace))
+		return
+	}
+
+	log.Printf("Statefulset %s updated successfully", name)
+	respondWithRevisions(c, clientset, namespace, name, "Statefulset updated successfully")
+}
+
+// SetStatefulSetPartition moves the partition of a statefulset using the RollingUpdate strategy.
+// Lowering the partition rolls the update out to the pods with an ordinal greater than or equal to the new partition.
+func SetStatefulSetPartition(c *gin.Context) {
+	var form PartitionForm
+	if err := c.ShouldBindJSON(&form); err != nil || form.Partition < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid form - Please provide a positive partition"})
+		return
+	}
+	namespace := c.Param("namespace")
+	name := c.Param("statefulset")
+
+	clientset := utils.GetClientSet(c)
+	statefulset, err := clientset.AppsV1().StatefulSets(namespace).Get(c, name, metav1.GetOptions{})
+	if err != nil {
+		log.Printf("Error getting statefulset %s: %v", name, err)
+		utils.RespondWithK8sError(c, err, fmt.Sprintf("cannot get statefulset %s in namespace %s", name, namespace))
+		return
+	}
+	if statefulset.Spec.UpdateStrategy.Type == v1.OnDeleteStatefulSetStrategyType {
+		c.JSON(http.StatusConflict, gin.H{"message": fmt.Sprintf("statefulset %s uses the OnDelete strategy, recycle its pods instead", name), "reason": utils.ReasonConflict})
+		return
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"updateStrategy": statefulSetStrategyPatch(v1.RollingUpdateStatefulSetStrategyType, &form.Partition),
+		},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error preparing the update"})
+		return
+	}
+	_, err = clientset.AppsV1().StatefulSets(namespace).Patch(c, name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		log.Printf("Error moving the partition of statefulset %s: %v", name, err)
+		utils.RespondWithK8sError(c, err, fmt.Sprintf("cannot move the partition of statefulset %s in namespace %s", name, namespace))
+		return
+	}
+
+	log.Printf("Partition of statefulset %s moved to %d", name, form.Partition)
+	respondWithRevisions(c, clientset, namespace, name, fmt.Sprintf("Partition moved to %d", form.Partition))
+}
+
+// RecyclePod deletes a pod of a statefulset so it is recreated from the update revision.
+// It is the way to roll out an update with the OnDelete strategy.
+func RecyclePod(c *gin.Context) {
+	namespace := c.Param("namespace")
+	name := c.Param("statefulset")
+	ordinal, err := strconv.Atoi(c.Param("ordinal"))
+	if err != nil || ordinal < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid ordinal"})
+		return
+	}
+
+	clientset := utils.GetClientSet(c)
+	statefulset, err := clientset.AppsV1().StatefulSets(namespace).Get(c, name, metav1.GetOptions{})
+	if err != nil {
+		log.Printf("Error getting statefulset %s: %v", name, err)
+		utils.RespondWithK8sError(c, err, fmt.Sprintf("cannot get statefulset %s in namespace %s", name, namespace))
+		return
+	}
+	if statefulset.Spec.Replicas != nil && int32(ordinal) >= *statefulset.Spec.Replicas {
+		c.JSON(http.StatusNotFound, gin.H{"message": fmt.Sprintf("statefulset %s has no pod with ordinal %d", name, ordinal), "reason": utils.ReasonNotFound})
+		return
+	}
+
+	pod := fmt.Sprintf("%s-%d", name, ordinal)
+	err = clientset.CoreV1().Pods(namespace).Delete(c, pod, metav1.DeleteOptions{})
+	if err != nil {
+		log.Printf("Error deleting pod %s: %v", pod, err)
+		utils.RespondWithK8sError(c, err, fmt.Sprintf("cannot recycle pod %s in namespace %s", pod, namespace))
+		return
+	}
+
+	log.Printf("Pod %s of statefulset %s recycled", pod, name)
+	respondWithRevisions(c, clientset, namespace, name, fmt.Sprintf("Pod %s recycled", pod))
+}
+
+// GetStatefulSetRevisions reports the revision of each pod of a statefulset
+func GetStatefulSetRevisions(c *gin.Context) {
+	respondWithRevisions(c, utils.GetClientSet(c), c.Param("namespace"), c.Param("statefulset"), "")
+}
+
+func respondWithRevisions(c *gin.Context, clientset kubernetes.Interface, namespace, name, message string) {
+	revisions, err := getStatefulSetRevisions(c, clientset, namespace, name)
+	if err != nil {
+		log.Printf("Error getting the revisions of statefulset %s: %v", name, err)
+		utils.RespondWithK8sError(c, err, fmt.Sprintf("cannot get the revisions of statefulset %s in namespace %s", name, namespace))
+		return
+	}
+	if message == "" {
+		message = fmt.Sprintf("%d of %d pods of statefulset %s updated", revisions.UpdatedReplicas, revisions.Replicas, name)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": message, "revisions": revisions})
+}
+
+func getStatefulSetRevisions(ctx context.Context, clientset kubernetes.Interface, namespace, name string) (*StatefulSetRevisions, error) {
+	statefulset, err := clientset.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: metav1.FormatLabelSelector(statefulset.Spec.Selector),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	revisions := &StatefulSetRevisions{
+		Strategy:        string(statefulset.Spec.UpdateStrategy.Type),
+		CurrentRevision: statefulset.Status.CurrentRevision,
+		UpdateRevision:  statefulset.Status.UpdateRevision,
+		UpdatedReplicas: statefulset.Status.UpdatedReplicas,
+		Replicas:        1,
+		Pods:            make([]PodRevision, 0),
+	}
+	if statefulset.Spec.Replicas != nil {
+		revisions.Replicas = *statefulset.Spec.Replicas
+	}
+	if ru := statefulset.Spec.UpdateStrategy.RollingUpdate; ru != nil && ru.Partition != nil {
+		revisions.Partition = *ru.Partition
+	}
+
+	for _, pod := range pods.Items {
+		ordinal, ok := podOrdinal(statefulset.Name, pod.Name)
+		if !ok {
+			continue
+		}
+		revision := pod.Labels[v1.ControllerRevisionHashLabelKey]
+		revisions.Pods = append(revisions.Pods, PodRevision{
+			Ordinal:  ordinal,
+			Name:     pod.Name,
+			Revision: revision,
+			Updated:  revision == statefulset.Status.UpdateRevision,
+			Ready:    isPodReady(pod),
+			Phase:    string(pod.Status.Phase),
+		})
+	}
+	sort.Slice(revisions.Pods, func(i, j int) bool {
+		return revisions.Pods[i].Ordinal < revisions.Pods[j].Ordinal
+	})
+	return revisions, nil
+}
+
+// statefulSetStrategyPatch returns the patch of the update strategy, the partition of the statefulset is kept when none is given
+func statefulSetStrategyPatch(strategy v1.StatefulSetUpdateStrategyType, partition *int32) map[string]interface{} {
+	patch := map[string]interface{}{"type": strategy}
+	if strategy == v1.RollingUpdateStatefulSetStrategyType {
+		if partition != nil {
+			patch["rollingUpdate"] = map[string]interface{}{"partition": *partition}
+		}
+	} else {
+		// an OnDelete statefulset must not have rolling update parameters
+		patch["rollingUpdate"] = nil
+	}
+	return patch
+}
+
+// podOrdinal returns the ordinal of a pod of the statefulset from its name
+func podOrdinal(statefulset, pod string) (int, bool) {
+	suffix, found := strings.CutPrefix(pod, statefulset+"-")
+	if !found {
+		return 0, false
+	}
+	ordinal, err := strconv.Atoi(suffix)
+	return ordinal, err == nil
+}
+
+func isPodReady(pod apicorev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == apicorev1.PodReady {
+			return condition.Status == apicorev1.ConditionTrue
+		}
+	}
+	return false
+}
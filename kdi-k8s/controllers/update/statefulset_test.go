@@ -0,0 +1,33 @@
+package update
+
+import (
+	"encoding/json"
+	"testing"
+
+	v1 "k8s.io/api/apps/v1"
+)
+
+func TestStatefulSetStrategyPatch(t *testing.T) {
+	partition := int32(2)
+	zero := int32(0)
+	tests := []struct {
+		name      string
+		strategy  v1.StatefulSetUpdateStrategyType
+		partition *int32
+		want      string
+	}{
+		{"partition kept", v1.RollingUpdateStatefulSetStrategyType, nil, `{"type":"RollingUpdate"}`},
+		{"partition", v1.RollingUpdateStatefulSetStrategyType, &partition, `{"rollingUpdate":{"partition":2},"type":"RollingUpdate"}`},
+		{"partition reset", v1.RollingUpdateStatefulSetStrategyType, &zero, `{"rollingUpdate":{"partition":0},"type":"RollingUpdate"}`},
+		{"on delete", v1.OnDeleteStatefulSetStrategyType, nil, `{"rollingUpdate":null,"type":"OnDelete"}`},
+	}
+	for _, tt := range tests {
+		patch, err := json.Marshal(statefulSetStrategyPatch(tt.strategy, tt.partition))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(patch) != tt.want {
+			t.Errorf("%s: patch = %s, want %s", tt.name, patch, tt.want)
+		}
+	}
+}
@@ -1,26 +1,82 @@
 package update
 
 import (
+	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
+	"github.com/kuro-jojo/kdi-k8s/metrics"
 	"github.com/kuro-jojo/kdi-k8s/models"
+	"github.com/kuro-jojo/kdi-k8s/rollout"
+	"github.com/kuro-jojo/kdi-k8s/utils"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	StrategicMergePatchType = "strategic"
+	JSONPatchType           = "json"
 )
 
 type UpdateForm struct {
 	Name      string `json:"name" `
 	Namespace string `json:"namespace" `
 	Strategy  string `json:"strategy" binding:"required"`
-	Container string `json:"container"`
-	Image     string `json:"image" binding:"required"`
+	Container string `json:"container"` // The container targeted by Image (optional if the deployment has a single container)
+	Image     string `json:"image"`
 	Replicas  int32  `json:"replicas" binding:"required"`
 	// Add more fields here depending on the strategy
 
 	// For rolling update strategy
 	MaxUnavailable string `json:"max_unavailable"` // The maximum number of pods that can be unavailable during the update process
 	MaxSurge       string `json:"max_surge"`       // The maximum number of pods that can be scheduled above the desired number of pods
+
+	// Pod template updates
+	Containers     []ContainerUpdate    `json:"containers"`      // The containers (and init containers) to update, targeted by name
+	PodAnnotations map[string]string    `json:"pod_annotations"` // The annotations to set on the pod template
+	PatchType      string               `json:"patch_type"`      // strategic (default) or json
+	JSONPatch      []JSONPatchOperation `json:"json_patch"`      // Additional JSON patch operations applied when patch_type is json
+
+	// Wait for the rollout to complete before responding
+	Wait    bool `json:"wait"`
+	Timeout int  `json:"timeout"` // The deadline of the rollout in seconds
+	// Revert the update if the new version fails to become available or crash loops (implies wait)
+	AutoRollback bool `json:"auto_rollback"`
+}
+
+// ContainerUpdate describes the changes to apply to a container of the pod template
+type ContainerUpdate struct {
+	Name           string                       `json:"name" binding:"required"`
+	Init           bool                         `json:"init"` // true if the container is an init container
+	Image          string                       `json:"image"`
+	Env            []corev1.EnvVar              `json:"env"`
+	Resources      *corev1.ResourceRequirements `json:"resources"`
+	LivenessProbe  *corev1.Probe                `json:"liveness_probe"`
+	ReadinessProbe *corev1.Probe                `json:"readiness_probe"`
+	StartupProbe   *corev1.Probe                `json:"startup_probe"`
+}
+
+// JSONPatchOperation is a RFC 6902 operation
+type JSONPatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	From  string      `json:"from,omitempty"`
+	Value interface{} `json:"value,omitempty"` // Written even if empty for add, replace and test (see MarshalJSON)
+}
+
+// MarshalJSON keeps the value of the operations requiring one even if it is empty (0 replicas, an empty string...)
+func (o JSONPatchOperation) MarshalJSON() ([]byte, error) {
+	type operation JSONPatchOperation
+	switch o.Op {
+	case "add", "replace", "test":
+		return json.Marshal(struct {
+			operation
+			Value interface{} `json:"value"`
+		}{operation(o), o.Value})
+	}
+	return json.Marshal(operation(o))
 }
 
 type DeploymentStatus struct {
@@ -39,14 +95,33 @@ func UpdateDeployment(c *gin.Context) {
 		log.Printf("Invalid form %v", c.ShouldBindBodyWith(&updateForm, binding.JSON).Error())
 		message := "Invalid form"
 		if !isUpdateFormValid(updateForm) {
-			message += " - Please provide at least deployment's image, replicas and strategy used"
+			message += " - Please provide at least deployment's replicas, strategy used and the image or containers to update"
 		}
 		c.JSON(http.StatusBadRequest, gin.H{"message": message})
 		return
 	}
 	updateForm.Namespace = c.Param("namespace")
 	updateForm.Name = c.Param("deployment")
-	updateForm.Name = c.Param("deployment")
+
+	if updateForm.PatchType == "" {
+		updateForm.PatchType = StrategicMergePatchType
+	}
+	if updateForm.PatchType != StrategicMergePatchType && updateForm.PatchType != JSONPatchType {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid patch type - use strategic or json"})
+		return
+	}
+	if !isUpdateFormValid(updateForm) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid form - Please provide at least deployment's replicas, strategy used and the image or containers to update"})
+		return
+	}
+	if updateForm.AutoRollback {
+		updateForm.Wait = true
+	}
+	// only the known strategies are recorded to keep the cardinality of the metrics bounded
+	switch updateForm.Strategy {
+	case models.RollingUpdateStrategy, models.RecreateStrategy, models.BlueGreenStrategy:
+		defer func() { metrics.ObserveUpdate(models.DeploymentKind, updateForm.Strategy, c.Writer.Status()) }()
+	}
 
 	switch updateForm.Strategy {
 	case models.RollingUpdateStrategy:
@@ -58,12 +133,100 @@ func UpdateDeployment(c *gin.Context) {
 	// case models.CanaryStrategy:
 	// 	UpdateUsingCanaryStrategy(c, updateForm)
 	case models.BlueGreenStrategy:
-		UpdateUsingBlueGreenStrategy(c, updateForm)
+		result, err := UpdateUsingBlueGreenStrategy(c, updateForm)
+		if err != nil {
+			log.Printf("Error updating deployment %s: %v", updateForm.Name, err)
+			respondWithUpdateError(c, err, "failed to update deployment "+updateForm.Name)
+			return
+		}
+		log.Printf("Deployment %s updated successfully", updateForm.Name)
+		if result != nil {
+			respondWithRollout(c, *result)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Deployment updated successfully"})
 	default:
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid strategy"})
 	}
 }
 
+// rolloutError is returned when the new version did not become available
+type rolloutError struct {
+	result rollout.Result
+}
+
+func (e *rolloutError) Error() string {
+	return e.result.Message
+}
+
+// respondWithUpdateError writes the error of an update.
+// Errors of the form are bad requests while errors of the kubernetes api are classified by their reason.
+func respondWithUpdateError(c *gin.Context, err error, message string) {
+	var pErr *patchError
+	if errors.As(err, &pErr) {
+		c.JSON(pErr.status, gin.H{"message": pErr.message, "reason": pErr.reason})
+		return
+	}
+	var rErr *rolloutError
+	if errors.As(err, &rErr) {
+		respondWithRollout(c, rErr.result)
+		return
+	}
+	utils.RespondWithK8sError(c, err, message)
+}
+
+// respondUpdated writes the response of an applied update, waiting for the rollout if requested.
+// previousRevision is the revision of the deployment before the update, restored if the rollout fails with auto rollback.
+func respondUpdated(c *gin.Context, updateForm UpdateForm, previousRevision int64) {
+	log.Printf("Deployment %s updated successfully", updateForm.Name)
+	if !updateForm.Wait {
+		c.JSON(http.StatusOK, gin.H{"message": "Deployment updated successfully"})
+		return
+	}
+	log.Printf("Waiting for the rollout of deployment %s", updateForm.Name)
+	clientset := utils.GetClientSet(c)
+	timeout := rollout.Timeout(updateForm.Timeout)
+	if !updateForm.AutoRollback {
+		respondWithRollout(c, rollout.Wait(c.Request.Context(), clientset, updateForm.Namespace, updateForm.Name, timeout))
+		return
+	}
+
+	result := rollout.Watch(c.Request.Context(), clientset, updateForm.Namespace, updateForm.Name, timeout)
+	// an interrupted wait says nothing about the rollout so it is not reverted
+	if result.Outcome != rollout.Available && result.Outcome != rollout.Interrupted {
+		log.Printf("Rolling back deployment %s to revision %d", updateForm.Name, previousRevision)
+		result.SetRollback(rollout.Undo(c.Request.Context(), clientset, updateForm.Namespace, updateForm.Name, previousRevision))
+	}
+	respondWithRollout(c, result)
+}
+
+// respondWithRollout writes the outcome of a rollout
+func respondWithRollout(c *gin.Context, result rollout.Result) {
+	if result.Outcome == rollout.Available {
+		c.JSON(http.StatusOK, gin.H{"message": "Deployment updated successfully", "rollout": result})
+		return
+	}
+
+	status, reason := http.StatusUnprocessableEntity, utils.ReasonRolloutFailed
+	switch result.Outcome {
+	case rollout.TimedOut:
+		status, reason = http.StatusGatewayTimeout, utils.ReasonRolloutTimedOut
+	case rollout.Interrupted:
+		status, reason = http.StatusServiceUnavailable, utils.ReasonRolloutInterrupted
+	}
+	message := result.Message
+	if result.Rollback != nil {
+		if result.Rollback.Succeeded {
+			reason = utils.ReasonRolledBack
+			message += " - " + result.Rollback.Message
+		} else {
+			message += " - " + result.Rollback.Error
+		}
+	}
+	c.JSON(status, gin.H{"message": message, "reason": reason, "rollout": result})
+}
+
 func isUpdateFormValid(form UpdateForm) bool {
-	return form.Strategy != "" && form.Image != "" && form.Replicas > 0
+	hasChanges := form.Image != "" || len(form.Containers) > 0 || len(form.PodAnnotations) > 0 || len(form.JSONPatch) > 0
+	return form.Strategy != "" && hasChanges && form.Replicas > 0
 }
@@ -0,0 +1,213 @@
+package workloads
+
+// This file returns the cpu and memory used by the workloads compared with their requests and limits.
+// When the metrics api is missing the requests and limits are still returned with metricsAvailable set to false.
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kuro-jojo/kdi-k8s/models"
+	"github.com/kuro-jojo/kdi-k8s/usage"
+	"github.com/kuro-jojo/kdi-k8s/utils"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// workloadSelector is the selector of the pods of a workload
+type workloadSelector struct {
+	Kind     string
+	Name     string
+	Selector labels.Selector
+}
+
+// GetWorkloadUsage returns the usage of the pods of a deployment, a statefulset or a daemonset
+func GetWorkloadUsage(c *gin.Context) {
+	namespace := c.Param("namespace")
+	name := c.Param("name")
+	kind, ok := kinds[strings.ToLower(c.Param("kind"))]
+	if !ok || kind == models.CronJobKind {
+		c.JSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("Invalid kind %s - use deployments, statefulsets or daemonsets", c.Param("kind")), "reason": utils.ReasonBadRequest})
+		return
+	}
+	clientset := utils.GetClientSet(c)
+
+	selector, err := getWorkloadSelector(c, clientset, namespace, kind, name)
+	if err != nil {
+		log.Printf("Error getting %s %s: %v", kind, name, err)
+		utils.RespondWithK8sError(c, err, fmt.Sprintf("cannot get %s %s in namespace %s", strings.ToLower(kind), name, namespace))
+		return
+	}
+
+	pods, err := clientset.CoreV1().Pods(namespace).List(c, metav1.ListOptions{LabelSelector: selector.Selector.String()})
+	if err != nil {
+		log.Printf("Error listing the pods of %s %s: %v", kind, name, err)
+		utils.RespondWithK8sError(c, err, fmt.Sprintf("cannot list the pods of %s %s in namespace %s", strings.ToLower(kind), name, namespace))
+		return
+	}
+
+	metrics, available, message := getPodMetrics(c, clientset, namespace, selector.Selector)
+	workloadUsage := newWorkloadUsage(namespace, selector, pods.Items, metrics, available)
+
+	response := gin.H{"usage": workloadUsage, "metricsAvailable": available}
+	if message != "" {
+		response["message"] = message
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetNamespaceUsage returns the usage of all the deployments, statefulsets and daemonsets of the namespace
+func GetNamespaceUsage(c *gin.Context) {
+	namespace := c.Param("namespace")
+	clientset := utils.GetClientSet(c)
+	log.Printf("Getting the resource usage in namespace %s...", namespace)
+
+	selectors, err := listWorkloadSelectors(c, clientset, namespace)
+	if err != nil {
+		log.Printf("Error listing workloads in namespace %s: %v", namespace, err)
+		utils.RespondWithK8sError(c, err, fmt.Sprintf("cannot list the workloads in namespace %s", namespace))
+		return
+	}
+	pods, err := clientset.CoreV1().Pods(namespace).List(c, metav1.ListOptions{})
+	if err != nil {
+		log.Printf("Error listing pods in namespace %s: %v", namespace, err)
+		utils.RespondWithK8sError(c, err, fmt.Sprintf("cannot list the pods in namespace %s", namespace))
+		return
+	}
+
+	metrics, available, message := getPodMetrics(c, clientset, namespace, nil)
+	workloads, total := namespaceUsage(namespace, selectors, pods.Items, metrics, available)
+
+	response := gin.H{"workloads": workloads, "size": len(workloads), "total": total, "metricsAvailable": available}
+	if message != "" {
+		response["message"] = message
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// getPodMetrics returns the metrics of the pods, or no metrics with a message if they cannot be read
+func getPodMetrics(ctx context.Context, clientset kubernetes.Interface, namespace string, selector labels.Selector) (map[string]usage.PodMetrics, bool, string) {
+	metrics, err := usage.GetPodMetrics(ctx, clientset, namespace, selector)
+	if err != nil {
+		log.Printf("Error getting the pod metrics in namespace %s: %v", namespace, err)
+		if usage.IsUnavailable(err) {
+			return nil, false, usage.UnavailableMessage
+		}
+		return nil, false, fmt.Sprintf("cannot get the pod metrics: %v", err)
+	}
+	return metrics, true, ""
+}
+
+// namespaceUsage returns the usage of each workload from the pods matching its selector and the total of the workloads
+func namespaceUsage(namespace string, selectors []workloadSelector, pods []corev1.Pod, metrics map[string]usage.PodMetrics, available bool) ([]models.WorkloadUsage, models.ResourceUsage) {
+	workloads := make([]models.WorkloadUsage, 0, len(selectors))
+	var total models.ResourceUsage
+	for _, selector := range selectors {
+		matching := make([]corev1.Pod, 0)
+		for _, pod := range pods {
+			if selector.Selector.Matches(labels.Set(pod.Labels)) {
+				matching = append(matching, pod)
+			}
+		}
+		w := newWorkloadUsage(namespace, selector, matching, metrics, available)
+		total.Add(w.Total)
+		workloads = append(workloads, w)
+	}
+	return workloads, total
+}
+
+func newWorkloadUsage(namespace string, selector workloadSelector, pods []corev1.Pod, metrics map[string]usage.PodMetrics, available bool) models.WorkloadUsage {
+	podUsages := usage.Pods(pods, metrics)
+	return models.WorkloadUsage{
+		Kind:             selector.Kind,
+		Name:             selector.Name,
+		Namespace:        namespace,
+		MetricsAvailable: available,
+		Pods:             podUsages,
+		Total:            usage.Sum(podUsages),
+	}
+}
+
+func getWorkloadSelector(ctx context.Context, clientset kubernetes.Interface, namespace, kind, name string) (workloadSelector, error) {
+	var selector *metav1.LabelSelector
+	switch kind {
+	case models.StatefulSetKind:
+		s, err := clientset.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return workloadSelector{}, err
+		}
+		selector = s.Spec.Selector
+	case models.DaemonSetKind:
+		d, err := clientset.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return workloadSelector{}, err
+		}
+		selector = d.Spec.Selector
+	default:
+		d, err := clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return workloadSelector{}, err
+		}
+		selector = d.Spec.Selector
+	}
+	return newWorkloadSelector(kind, name, selector)
+}
+
+func listWorkloadSelectors(ctx context.Context, clientset kubernetes.Interface, namespace string) ([]workloadSelector, error) {
+	selectors := make([]workloadSelector, 0)
+	add := func(kind, name string, selector *metav1.LabelSelector) error {
+		s, err := newWorkloadSelector(kind, name, selector)
+		if err != nil {
+			return err
+		}
+		selectors = append(selectors, s)
+		return nil
+	}
+
+	deployments, err := clientset.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range deployments.Items {
+		if err := add(models.DeploymentKind, d.Name, d.Spec.Selector); err != nil {
+			return nil, err
+		}
+	}
+	statefulSets, err := clientset.AppsV1().StatefulSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range statefulSets.Items {
+		if err := add(models.StatefulSetKind, s.Name, s.Spec.Selector); err != nil {
+			return nil, err
+		}
+	}
+	daemonSets, err := clientset.AppsV1().DaemonSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range daemonSets.Items {
+		if err := add(models.DaemonSetKind, d.Name, d.Spec.Selector); err != nil {
+			return nil, err
+		}
+	}
+	return selectors, nil
+}
+
+func newWorkloadSelector(kind, name string, selector *metav1.LabelSelector) (workloadSelector, error) {
+	// a nil selector would match all the pods of the namespace
+	if selector == nil {
+		return workloadSelector{Kind: kind, Name: name, Selector: labels.Nothing()}, nil
+	}
+	s, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return workloadSelector{}, err
+	}
+	return workloadSelector{Kind: kind, Name: name, Selector: s}, nil
+}
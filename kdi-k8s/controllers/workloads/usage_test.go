@@ -0,0 +1,101 @@
+package workloads
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kuro-jojo/kdi-k8s/models"
+	"github.com/kuro-jojo/kdi-k8s/usage"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func appPod(name, app, cpuRequest string) corev1.Pod {
+	return corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "shop", Labels: map[string]string{"app": app}},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse(cpuRequest)},
+			Limits:   corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1"), corev1.ResourceMemory: resource.MustParse("1Gi")},
+		}}}},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+}
+
+func selector(app string) *metav1.LabelSelector {
+	return &metav1.LabelSelector{MatchLabels: map[string]string{"app": app}}
+}
+
+func TestListWorkloadSelectors(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop"}, Spec: appsv1.DeploymentSpec{Selector: selector("web")}},
+		&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "shop"}, Spec: appsv1.StatefulSetSpec{Selector: selector("db")}},
+		&appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Name: "agent", Namespace: "shop"}},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "default"}, Spec: appsv1.DeploymentSpec{Selector: selector("other")}},
+	)
+
+	selectors, err := listWorkloadSelectors(context.Background(), clientset, "shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"Deployment/web app=web", "StatefulSet/db app=db", "DaemonSet/agent "}
+	if len(selectors) != len(want) {
+		t.Fatalf("listWorkloadSelectors() = %+v, want %v", selectors, want)
+	}
+	for i, s := range selectors {
+		if got := s.Kind + "/" + s.Name + " " + s.Selector.String(); got != want[i] {
+			t.Errorf("selector %d = %q, want %q", i, got, want[i])
+		}
+	}
+	// a workload without selector must not be given all the pods of the namespace
+	if selectors[2].Selector.Matches(nil) {
+		t.Error("a nil selector should match no pod")
+	}
+}
+
+func TestNamespaceUsage(t *testing.T) {
+	web, _ := newWorkloadSelector(models.DeploymentKind, "web", selector("web"))
+	db, _ := newWorkloadSelector(models.StatefulSetKind, "db", selector("db"))
+	agent, _ := newWorkloadSelector(models.DaemonSetKind, "agent", nil)
+	pods := []corev1.Pod{
+		appPod("web-1", "web", "100m"),
+		appPod("web-2", "web", "100m"),
+		appPod("db-0", "db", "500m"),
+		appPod("debug", "debug", "1"), // not part of a workload
+	}
+	metrics := map[string]usage.PodMetrics{
+		"web-1": {Containers: []usage.ContainerMetrics{{Usage: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("40m")}}}},
+		"db-0":  {Containers: []usage.ContainerMetrics{{Usage: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("300m")}}}},
+		"debug": {Containers: []usage.ContainerMetrics{{Usage: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("900m")}}}},
+	}
+
+	workloads, total := namespaceUsage("shop", []workloadSelector{web, db, agent}, pods, metrics, true)
+	if len(workloads) != 3 {
+		t.Fatalf("namespaceUsage() = %+v, want 3 workloads", workloads)
+	}
+	tests := []struct {
+		pods int
+		cpu  models.Usage
+	}{
+		{2, models.Usage{Used: 40, Requests: 200, Limits: 2000}},
+		{1, models.Usage{Used: 300, Requests: 500, Limits: 1000}},
+		{0, models.Usage{}},
+	}
+	for i, tt := range tests {
+		w := workloads[i]
+		if len(w.Pods) != tt.pods || w.Total.CPU != tt.cpu || w.Namespace != "shop" || !w.MetricsAvailable {
+			t.Errorf("usage of %s/%s = %+v, want %d pods using %+v", w.Kind, w.Name, w, tt.pods, tt.cpu)
+		}
+	}
+
+	// the pods outside of the workloads are not counted
+	want := models.ResourceUsage{
+		CPU:    models.Usage{Used: 340, Requests: 700, Limits: 3000},
+		Memory: models.Usage{Limits: 3 << 30},
+	}
+	if total != want {
+		t.Errorf("total = %+v, want %+v", total, want)
+	}
+}
@@ -0,0 +1,154 @@
+package workloads
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kuro-jojo/kdi-k8s/models"
+	"github.com/kuro-jojo/kdi-k8s/utils"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// kinds maps the names accepted in the url to the kinds of workloads
+var kinds = map[string]string{
+	"deployment":   models.DeploymentKind,
+	"deployments":  models.DeploymentKind,
+	"statefulset":  models.StatefulSetKind,
+	"statefulsets": models.StatefulSetKind,
+	"daemonset":    models.DaemonSetKind,
+	"daemonsets":   models.DaemonSetKind,
+	"cronjob":      models.CronJobKind,
+	"cronjobs":     models.CronJobKind,
+}
+
+// GetWorkloadsInNamespace lists the workloads of the namespace.
+// All the kinds are listed unless the kind query parameter is set.
+// A kind that cannot be listed (missing permissions for instance) is reported in errors without failing the others.
+func GetWorkloadsInNamespace(c *gin.Context) {
+	namespace := c.Param("namespace")
+	log.Printf("Getting workloads in namespace %s...", namespace)
+
+	listed := models.WorkloadKinds
+	if k := c.Query("kind"); k != "" {
+		kind, ok := kinds[strings.ToLower(k)]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("Invalid kind %s - use deployments, statefulsets, daemonsets or cronjobs", k), "reason": utils.ReasonBadRequest})
+			return
+		}
+		listed = []string{kind}
+	}
+
+	clientset := utils.GetClientSet(c)
+	workloads := make([]models.Workload, 0)
+	errs := make(map[string]utils.K8sError)
+	var lastErr error
+	for _, kind := range listed {
+		w, err := listWorkloads(c, clientset, namespace, kind)
+		if err != nil {
+			log.Printf("Error listing %s in namespace %s: %v", kind, namespace, err)
+			errs[kind] = utils.ClassifyK8sError(err)
+			lastErr = err
+			continue
+		}
+		workloads = append(workloads, w...)
+	}
+	if len(errs) == len(listed) {
+		utils.RespondWithK8sError(c, lastErr, fmt.Sprintf("cannot list the workloads in namespace %s", namespace))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"workloads": workloads, "size": len(workloads), "errors": errs})
+}
+
+// GetWorkloadInNamespace returns the summary of a workload of the namespace
+func GetWorkloadInNamespace(c *gin.Context) {
+	namespace := c.Param("namespace")
+	name := c.Param("name")
+	kind, ok := kinds[strings.ToLower(c.Param("kind"))]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("Invalid kind %s - use deployments, statefulsets, daemonsets or cronjobs", c.Param("kind")), "reason": utils.ReasonBadRequest})
+		return
+	}
+
+	workload, err := getWorkload(c, utils.GetClientSet(c), namespace, kind, name)
+	if err != nil {
+		log.Printf("Error getting %s %s: %v", kind, name, err)
+		utils.RespondWithK8sError(c, err, fmt.Sprintf("cannot get %s %s in namespace %s", strings.ToLower(kind), name, namespace))
+		return
+	}
+
+	log.Printf("%s %s found in namespace %s", kind, name, namespace)
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("%s %s found in namespace %s", strings.ToLower(kind), name, namespace), "workload": workload})
+}
+
+func listWorkloads(ctx context.Context, clientset kubernetes.Interface, namespace, kind string) ([]models.Workload, error) {
+	workloads := make([]models.Workload, 0)
+	switch kind {
+	case models.DeploymentKind:
+		list, err := clientset.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for i := range list.Items {
+			workloads = append(workloads, models.WorkloadFromDeployment(&list.Items[i]))
+		}
+	case models.StatefulSetKind:
+		list, err := clientset.AppsV1().StatefulSets(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for i := range list.Items {
+			workloads = append(workloads, models.WorkloadFromStatefulSet(&list.Items[i]))
+		}
+	case models.DaemonSetKind:
+		list, err := clientset.AppsV1().DaemonSets(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for i := range list.Items {
+			workloads = append(workloads, models.WorkloadFromDaemonSet(&list.Items[i]))
+		}
+	case models.CronJobKind:
+		list, err := clientset.BatchV1().CronJobs(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for i := range list.Items {
+			workloads = append(workloads, models.WorkloadFromCronJob(&list.Items[i]))
+		}
+	}
+	return workloads, nil
+}
+
+func getWorkload(ctx context.Context, clientset kubernetes.Interface, namespace, kind, name string) (models.Workload, error) {
+	switch kind {
+	case models.StatefulSetKind:
+		s, err := clientset.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return models.Workload{}, err
+		}
+		return models.WorkloadFromStatefulSet(s), nil
+	case models.DaemonSetKind:
+		d, err := clientset.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return models.Workload{}, err
+		}
+		return models.WorkloadFromDaemonSet(d), nil
+	case models.CronJobKind:
+		cj, err := clientset.BatchV1().CronJobs(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return models.Workload{}, err
+		}
+		return models.WorkloadFromCronJob(cj), nil
+	}
+	d, err := clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return models.Workload{}, err
+	}
+	return models.WorkloadFromDeployment(d), nil
+}
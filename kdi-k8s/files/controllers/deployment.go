@@ -1,18 +1,23 @@
 package controllers
 
 import (
+	"fmt"
 	"log"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/kuro-jojo/kdi-k8s/files"
 	"github.com/kuro-jojo/kdi-k8s/files/objecthandlers"
+	"github.com/kuro-jojo/kdi-k8s/files/policy"
+	"github.com/kuro-jojo/kdi-k8s/metrics"
 	"github.com/kuro-jojo/kdi-k8s/models"
 	"github.com/kuro-jojo/kdi-k8s/utils"
 )
 
 // CreateDeployment handles the creation request of a kubernetes deployment from a file
 func CreateDeployment(c *gin.Context) {
+	defer func() { metrics.ObserveDeploy(metrics.SourceDeploymentFile, c.Writer.Status()) }()
+
 	namespace, exist := c.GetPostForm("namespace")
 
 	file, err := c.FormFile(files.NameForDeploymentFileForm)
@@ -20,6 +25,11 @@ func CreateDeployment(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"message": "No file found"})
 		return
 	}
+	rules, err := policy.Parse(c.PostForm(policy.NameForPoliciesForm))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
 	objects, co, m := files.ProcessUploadedFile(c, file)
 	if co != 0 {
 		c.JSON(co, gin.H{"message": m})
@@ -39,9 +49,16 @@ func CreateDeployment(c *gin.Context) {
 				obj.Deployment.Namespace = namespace
 			}
 			obj.Clientset = clientset
-			co, m = objecthandlers.HandleKubeObjectCreation(obj, c)
+			violations := policy.Evaluate(obj, rules)
+			if policy.Denied(violations) {
+				log.Printf("Deployment %s denied by the policies", obj.GetName())
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"message": fmt.Sprintf("%s denied by the policies", obj.GetName()), "reason": utils.ReasonPolicyViolation, "violations": violations})
+				return
+			}
+			var reason string
+			co, m, reason = objecthandlers.HandleKubeObjectCreation(obj, c)
 			if co != http.StatusOK {
-				c.JSON(co, gin.H{"message": m})
+				c.JSON(co, gin.H{"message": m, "reason": reason})
 				return
 			}
 			wasDeploymentCreated = true
@@ -44,14 +44,12 @@ func HelmDeploymentFromRepo(c *gin.Context) {
 		return
 	}
 
-	os.Setenv("HELM_NAMESPACE", repoEntry.Namespace)
-
 	// Add helm repo
 	RepoAdd(repoEntry.RepoName, repoEntry.RepoUrl)
 	// Update charts from the helm repo
 	RepoUpdate()
 	// Install charts
-	InstallChartFromRepo(repoEntry.ReleaseName, repoEntry.RepoName, repoEntry.ChartName, args)
+	InstallChartFromRepo(repoEntry.ReleaseName, repoEntry.RepoName, repoEntry.ChartName, repoEntry.Namespace, args)
 
 }
 
@@ -149,8 +147,6 @@ func HelmDeployment(c *gin.Context) {
 	namespace, _ := c.GetPostForm("namespace")
 	releaseName, _ := c.GetPostForm("releaseName")
 
-	os.Setenv("HELM_NAMESPACE", namespace)
-
 	file, _, err := c.Request.FormFile("file")
 	if err != nil {
 		c.String(400, "Bad Request - No file provided")
@@ -169,7 +165,7 @@ func HelmDeployment(c *gin.Context) {
 	}
 
 	// Deploy the chart to Kubernetes cluster
-	err = deployChart(chartContent, releaseName)
+	err = deployChart(chartContent, releaseName, namespace)
 	if err != nil {
 		c.String(500, "Internal Server Error - Unable to deploy chart")
 		return
@@ -178,9 +174,9 @@ func HelmDeployment(c *gin.Context) {
 	//c.String(200, "Chart deployed successfully")
 }
 
-func deployChart(chartContent []byte, releaseName string) error {
+func deployChart(chartContent []byte, releaseName string, namespace string) error {
 	// Initialize Helm action configuration
-	settings := cli.New()
+	settings := newHelmSettings(namespace)
 
 	// Create a Helm action configuration
 	actionConfig := new(action.Configuration)
@@ -192,7 +188,7 @@ func deployChart(chartContent []byte, releaseName string) error {
 	install := action.NewInstall(actionConfig)
 
 	// Set namespace and release name
-	//install.Namespace = namespace
+	install.Namespace = settings.Namespace()
 	install.ReleaseName = releaseName
 	/*fmt.Printf("release Name ", releaseName)
 	fmt.Printf("Namespace", namespace)*/
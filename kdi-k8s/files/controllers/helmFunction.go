@@ -139,10 +139,20 @@ func RepoUpdate() {
 
 }
 
+// newHelmSettings returns the helm settings of a request.
+// The namespace is set on the settings instead of the HELM_NAMESPACE variable which is shared by all requests.
+func newHelmSettings(namespace string) *cli.EnvSettings {
+	settings := cli.New()
+	if namespace != "" {
+		settings.SetNamespace(namespace)
+	}
+	return settings
+}
+
 // InstallChart
-func InstallChartFromRepo(name, repo, chart string, args map[string]string) {
+func InstallChartFromRepo(name, repo, chart, namespace string, args map[string]string) {
 
-	settings := cli.New()
+	settings := newHelmSettings(namespace)
 	actionConfig := new(action.Configuration)
 	if err := actionConfig.Init(settings.RESTClientGetter(), settings.Namespace(), os.Getenv("KDI_HELM_DRIVER"), log.Printf); err != nil {
 		log.Fatal(err)
@@ -208,7 +218,7 @@ func InstallChartFromRepo(name, repo, chart string, args map[string]string) {
 		}
 	}
 
-	//client.Namespace = settings.Namespace()
+	client.Namespace = settings.Namespace()
 	release, err := client.Run(chartRequested, vals)
 	if err != nil {
 		log.Fatal(err)
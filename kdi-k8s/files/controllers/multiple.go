@@ -2,14 +2,20 @@ package controllers
 
 import (
 	"context"
-	"log"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/kuro-jojo/kdi-k8s/files"
 	"github.com/kuro-jojo/kdi-k8s/files/objecthandlers"
+	"github.com/kuro-jojo/kdi-k8s/files/policy"
+	"github.com/kuro-jojo/kdi-k8s/metrics"
 	"github.com/kuro-jojo/kdi-k8s/models"
+	"github.com/kuro-jojo/kdi-k8s/rollout"
+	"github.com/kuro-jojo/kdi-k8s/shared/logging"
 	"github.com/kuro-jojo/kdi-k8s/utils"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -20,27 +26,59 @@ const (
 
 // CreateMultipleRessources handles the creation request of multiple kubernetes resources from a file
 func CreateMultipleRessources(c *gin.Context) {
+	defer func() { metrics.ObserveDeploy(metrics.SourceFiles, c.Writer.Status()) }()
+
 	namespace, exist := c.GetPostForm("namespace")
 	if exist {
-		log.Printf("Setting default namespace to %s", namespace)
+		logging.With(c, logging.KeyNamespace, namespace)
+	}
+	logger := logging.Logger(c)
+	// wait for the rollout of the deployments to complete before responding
+	waitForRollout := c.PostForm("wait") == "true"
+	timeoutSeconds, _ := strconv.Atoi(c.PostForm("timeout"))
+	rolloutTimeout := rollout.Timeout(timeoutSeconds)
+
+	// Result is the outcome of the creation of a single object
+	type Result struct {
+		Object    string          `json:"object"`
+		Namespace string          `json:"namespace"`
+		File      string          `json:"file"`
+		Status    int             `json:"status"`
+		Message   string          `json:"message"`
+		Reason    string          `json:"reason,omitempty"`
+		Rollout   *rollout.Result `json:"rollout,omitempty"`
+
+		Violations []policy.Violation `json:"violations,omitempty"` // The policy rules not respected by the object
 	}
 	type Response struct {
 		Messages      map[string][]string   `json:"messages"`
+		Reasons       map[string][]string   `json:"reasons"` // The objects that failed by reason code
+		Results       []Result              `json:"results"`
 		Microservices []models.Microservice `json:"microservices"`
 	}
 	var response Response
 	response.Messages = make(map[string][]string, 0)
+	response.Reasons = make(map[string][]string, 0)
 	form, err := c.MultipartForm()
 	if err != nil {
-		log.Printf("Error getting the form : %v", err)
+		logger.Error("Error getting the form", "error", err)
 		response.Messages["error"] = append(response.Messages["error"], "Error getting the form")
 		c.JSON(http.StatusBadRequest, gin.H{"messages": response.Messages})
 		return
 	}
 
+	// the objects are checked against the policies of the environment before their creation
+	rules, err := policy.Parse(c.PostForm(policy.NameForPoliciesForm))
+	if err != nil {
+		logger.Warn("Error parsing the policies", "error", err)
+		response.Messages["error"] = append(response.Messages["error"], err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"messages": response.Messages})
+		return
+	}
+
 	uploadedFiles := form.File[files.NameForFilesForm]
 	if len(uploadedFiles) == 0 {
-		log.Printf("No file uploaded")
+		logger.Warn("No file uploaded")
 		response.Messages["error"] = append(response.Messages["error"], "No file uploaded")
 		c.JSON(http.StatusNotFound, gin.H{"messages": response.Messages})
 		return
@@ -56,7 +94,6 @@ func CreateMultipleRessources(c *gin.Context) {
 		}
 
 		for _, obj := range objects {
-			isDeployment := false
 			switch obj := obj.(type) {
 			case *models.Deployment:
 				if obj.Deployment != nil {
@@ -64,7 +101,20 @@ func CreateMultipleRessources(c *gin.Context) {
 						obj.Deployment.Namespace = namespace
 					}
 					obj.Clientset = clientset
-					isDeployment = true
+				}
+			case *models.StatefulSet:
+				if obj.StatefulSet != nil {
+					if exist && namespace != "" {
+						obj.StatefulSet.Namespace = namespace
+					}
+					obj.Clientset = clientset
+				}
+			case *models.DaemonSet:
+				if obj.DaemonSet != nil {
+					if exist && namespace != "" {
+						obj.DaemonSet.Namespace = namespace
+					}
+					obj.Clientset = clientset
 				}
 			case *models.Service:
 				if obj.Service != nil {
@@ -75,61 +125,115 @@ func CreateMultipleRessources(c *gin.Context) {
 				}
 			}
 
-			co, m = objecthandlers.HandleKubeObjectCreation(obj, c)
+			// the objects are created one at a time so an interrupted request stops between two objects
+			if c.Request.Context().Err() != nil {
+				co = http.StatusServiceUnavailable
+				m = fmt.Sprintf("%s was not created, the request was interrupted", obj.GetName())
+				httpResps[co] = append(httpResps[co], m+" (file : "+file.Filename+")")
+				response.Reasons[utils.ReasonInterrupted] = append(response.Reasons[utils.ReasonInterrupted], obj.GetName())
+				response.Results = append(response.Results, Result{
+					Object:    obj.GetName(),
+					Namespace: obj.GetNamespace(),
+					File:      file.Filename,
+					Status:    co,
+					Message:   m,
+					Reason:    utils.ReasonInterrupted,
+				})
+				continue
+			}
+
+			violations := policy.Evaluate(obj, rules)
+			if warnings := policy.Messages(violations, policy.SeverityWarn); len(warnings) > 0 {
+				response.Messages["warning"] = append(response.Messages["warning"], warnings...)
+			}
+			if policy.Denied(violations) {
+				logger.Warn("Object denied by the policies", "object", obj.GetName(), "file", file.Filename)
+				co = http.StatusUnprocessableEntity
+				m = fmt.Sprintf("%s denied by the policies : %s", obj.GetName(), strings.Join(policy.Messages(violations, policy.SeverityDeny), "; "))
+				httpResps[co] = append(httpResps[co], m+" (file : "+file.Filename+")")
+				response.Reasons[utils.ReasonPolicyViolation] = append(response.Reasons[utils.ReasonPolicyViolation], obj.GetName())
+				response.Results = append(response.Results, Result{
+					Object:     obj.GetName(),
+					Namespace:  obj.GetNamespace(),
+					File:       file.Filename,
+					Status:     co,
+					Message:    m,
+					Reason:     utils.ReasonPolicyViolation,
+					Violations: violations,
+				})
+				continue
+			}
+
+			var reason string
+			co, m, reason = objecthandlers.HandleKubeObjectCreation(obj, c)
 			httpResps[co] = append(httpResps[co], m+" (file : "+file.Filename+")")
+			if reason != "" {
+				response.Reasons[reason] = append(response.Reasons[reason], obj.GetName())
+			}
+			response.Results = append(response.Results, Result{
+				Object:    obj.GetName(),
+				Namespace: obj.GetNamespace(),
+				File:      file.Filename,
+				Status:    co,
+				Message:   m,
+				Reason:    reason,
 
-			if isDeployment && co == http.StatusCreated {
-				o, ok := obj.(*models.Deployment)
-				if !ok {
-					log.Printf("Error casting object to deployment")
-					continue
+				Violations: violations,
+			})
+
+			if co != http.StatusCreated {
+				continue
+			}
+			var microservice models.Microservice
+			switch o := obj.(type) {
+			case *models.Deployment:
+				if waitForRollout {
+					logger.Info("Waiting for the rollout of deployment", "object", o.GetName())
+					result := rollout.Wait(c.Request.Context(), clientset, o.GetNamespace(), o.GetName(), rolloutTimeout)
+					response.Results[len(response.Results)-1].Rollout = &result
+					if result.Outcome != rollout.Available {
+						response.Messages["error"] = append(response.Messages["error"], fmt.Sprintf("Rollout of %s %s : %s", o.GetName(), strings.ToLower(result.Outcome), result.Message))
+					}
+					if result.Deployment != nil {
+						o.Deployment = result.Deployment
+					}
+					microservice = models.NewMicroservice(models.WorkloadFromDeployment(o.Deployment), o.Deployment.Spec.Template)
+					microservice.Conditions = result.Conditions
+					break
 				}
 				// waiting a few seconds to get the deployment status after creation
 				time.Sleep(TimeToWaitForGettingDeploymentStatus)
-				err = o.Get(context.TODO(), o.GetName(), metav1.GetOptions{})
-				if err != nil {
-					log.Printf("Error getting deployment %s: %v", o.GetName(), err)
+				if err := o.Get(context.TODO(), o.GetName(), metav1.GetOptions{}); err != nil {
+					logger.Error("Error getting deployment", "object", o.GetName(), "error", err)
 					continue
 				}
-				conditions := make([]models.Conditions, 0)
-				for _, c := range o.Deployment.Status.Conditions {
-					conditions = append(conditions, models.Conditions{
-						Type:    string(c.Type),
-						Message: c.Message,
-						Reason:  c.Reason,
-					})
+				microservice = models.NewMicroservice(models.WorkloadFromDeployment(o.Deployment), o.Deployment.Spec.Template)
+			case *models.StatefulSet:
+				// only the rollout of the deployments is awaited
+				time.Sleep(TimeToWaitForGettingDeploymentStatus)
+				if err := o.Get(context.TODO(), o.GetName(), metav1.GetOptions{}); err != nil {
+					logger.Error("Error getting statefulset", "object", o.GetName(), "error", err)
+					continue
 				}
-
-				containers := make([]models.Container, 0)
-				for _, c := range o.Deployment.Spec.Template.Spec.Containers {
-					containers = append(containers, models.Container{
-						Name:  c.Name,
-						Image: c.Image,
-					})
-					if len(c.Ports) > 0 {
-						containers[len(containers)-1].Port = c.Ports[0].ContainerPort
-					}
+				microservice = models.NewMicroservice(models.WorkloadFromStatefulSet(o.StatefulSet), o.StatefulSet.Spec.Template)
+			case *models.DaemonSet:
+				time.Sleep(TimeToWaitForGettingDeploymentStatus)
+				if err := o.Get(context.TODO(), o.GetName(), metav1.GetOptions{}); err != nil {
+					logger.Error("Error getting daemonset", "object", o.GetName(), "error", err)
+					continue
 				}
-
-				response.Microservices = append(response.Microservices, models.Microservice{
-					Name:       o.GetName(),
-					Namespace:  o.GetNamespace(),
-					Replicas:   *o.Deployment.Spec.Replicas,
-					Labels:     o.Deployment.Spec.Template.Labels,
-					Selectors:  o.Deployment.Spec.Selector.MatchLabels,
-					Strategy:   string(o.Deployment.Spec.Strategy.Type),
-					Conditions: conditions,
-					Containers: containers,
-				})
-
-				log.Printf("Microservice %s created successfully", o.GetName())
+				microservice = models.NewMicroservice(models.WorkloadFromDaemonSet(o.DaemonSet), o.DaemonSet.Spec.Template)
+			default:
+				continue
 			}
+			response.Microservices = append(response.Microservices, microservice)
+			logger.Info("Microservice created", "object", obj.GetName(), "kind", microservice.Kind)
 		}
 	}
 
 	status := utils.GetMostSeenCode(httpResps)
 	if status == -1 {
-		log.Printf("No valid kubernetes object found in all the files")
+		logger.Warn("No valid kubernetes object found in all the files")
 		response.Messages["error"] = append(response.Messages["error"], "No valid kubernetes object found in  all the files")
 		c.JSON(http.StatusBadRequest, gin.H{"messages": response.Messages})
 		return
@@ -145,5 +249,5 @@ func CreateMultipleRessources(c *gin.Context) {
 			response.Messages["error"] = append(response.Messages["error"], v...)
 		}
 	}
-	c.JSON(status, gin.H{"messages": response.Messages, "microservices": response.Microservices, "size": len(response.Microservices)})
+	c.JSON(status, gin.H{"messages": response.Messages, "reasons": response.Reasons, "results": response.Results, "microservices": response.Microservices, "size": len(response.Microservices)})
 }
@@ -6,6 +6,7 @@ import (
 
 	"github.com/kuro-jojo/kdi-k8s/files"
 	"github.com/kuro-jojo/kdi-k8s/files/objecthandlers"
+	"github.com/kuro-jojo/kdi-k8s/metrics"
 	"github.com/kuro-jojo/kdi-k8s/models"
 	"github.com/kuro-jojo/kdi-k8s/utils"
 
@@ -14,6 +15,8 @@ import (
 
 // CreateService handles the creation request of a kubernetes service from a file
 func CreateService(c *gin.Context) {
+	defer func() { metrics.ObserveDeploy(metrics.SourceServiceFile, c.Writer.Status()) }()
+
 	namespace, exist := c.GetPostForm("namespace")
 
 	file, err := c.FormFile(files.NameForServiceFileForm)
@@ -41,9 +44,10 @@ func CreateService(c *gin.Context) {
 				obj.Service.Namespace = namespace
 			}
 			obj.Clientset = clientset
-			co, m = objecthandlers.HandleKubeObjectCreation(obj, c)
+			var reason string
+			co, m, reason = objecthandlers.HandleKubeObjectCreation(obj, c)
 			if co != http.StatusOK {
-				c.JSON(co, gin.H{"message": m})
+				c.JSON(co, gin.H{"message": m, "reason": reason})
 				return
 			}
 			wasServiceCreated = true
@@ -0,0 +1,223 @@
+package policy
+
+// This file checks the kubernetes objects of the uploaded files against rules before they are created.
+// A rule with the deny severity prevents the creation of the object, a rule with the warn severity is only reported.
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/kuro-jojo/kdi-k8s/models"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// NameForPoliciesForm is the form field holding the rules, as a json array
+const NameForPoliciesForm = "policies"
+
+const (
+	SeverityWarn = "warn"
+	SeverityDeny = "deny"
+)
+
+// Rules that can be checked
+const (
+	DisallowLatestTag     = "disallow-latest-tag"     // images without a tag or with the latest tag
+	RequireResourceLimits = "require-resource-limits" // containers without cpu or memory limits
+	DisallowPrivileged    = "disallow-privileged"     // privileged containers
+	AllowedRegistries     = "allowed-registries"      // images pulled from a registry that is not in Registries
+)
+
+// DefaultRegistry is the registry of the images whose name has no registry
+const DefaultRegistry = "docker.io"
+
+// Rule is a check applied to the objects with its severity
+type Rule struct {
+	ID         string   `json:"id"`
+	Severity   string   `json:"severity"`
+	Registries []string `json:"registries,omitempty"` // The registries allowed by allowed-registries (docker.io, ghcr.io/my-org...)
+}
+
+// Violation is a rule not respected by an object
+type Violation struct {
+	Rule      string `json:"rule"`
+	Severity  string `json:"severity"`
+	Object    string `json:"object"`
+	Container string `json:"container,omitempty"`
+	Message   string `json:"message"`
+}
+
+// check returns the message of the violation of the rule by the container, or an empty string
+type check func(rule Rule, container corev1.Container) string
+
+var checks = map[string]check{
+	DisallowLatestTag:     checkLatestTag,
+	RequireResourceLimits: checkResourceLimits,
+	DisallowPrivileged:    checkPrivileged,
+	AllowedRegistries:     checkRegistry,
+}
+
+// Parse reads the rules of the form field and validates them.
+// An empty value means that there is no rule to check.
+func Parse(raw string) ([]Rule, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	var rules []Rule
+	if err := json.Unmarshal([]byte(raw), &rules); err != nil {
+		return nil, fmt.Errorf("invalid policies : %v", err)
+	}
+	for _, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
+
+func (r Rule) Validate() error {
+	if _, ok := checks[r.ID]; !ok {
+		return fmt.Errorf("unknown policy rule %q", r.ID)
+	}
+	if r.Severity != SeverityWarn && r.Severity != SeverityDeny {
+		return fmt.Errorf("invalid severity %q for rule %s - use warn or deny", r.Severity, r.ID)
+	}
+	if r.ID == AllowedRegistries && len(r.Registries) == 0 {
+		return fmt.Errorf("rule %s needs at least one registry", r.ID)
+	}
+	return nil
+}
+
+// Evaluate returns the violations of the rules by the object.
+// Only the objects running containers are checked.
+func Evaluate(obj models.KubeObject, rules []Rule) []Violation {
+	violations := make([]Violation, 0)
+	kind, spec := podSpec(obj)
+	if spec == nil {
+		return violations
+	}
+
+	containers := append(append([]corev1.Container{}, spec.InitContainers...), spec.Containers...)
+	for _, rule := range rules {
+		check, ok := checks[rule.ID]
+		if !ok {
+			continue
+		}
+		for _, container := range containers {
+			if message := check(rule, container); message != "" {
+				violations = append(violations, Violation{
+					Rule:      rule.ID,
+					Severity:  rule.Severity,
+					Object:    kind + "/" + obj.GetName(),
+					Container: container.Name,
+					Message:   message,
+				})
+			}
+		}
+	}
+	return violations
+}
+
+// Denied returns true if one of the violations has the deny severity
+func Denied(violations []Violation) bool {
+	for _, v := range violations {
+		if v.Severity == SeverityDeny {
+			return true
+		}
+	}
+	return false
+}
+
+// Messages returns the messages of the violations with the given severity
+func Messages(violations []Violation, severity string) []string {
+	messages := make([]string, 0)
+	for _, v := range violations {
+		if v.Severity == severity {
+			messages = append(messages, fmt.Sprintf("%s (container %s) : %s [%s]", v.Object, v.Container, v.Message, v.Rule))
+		}
+	}
+	return messages
+}
+
+func podSpec(obj models.KubeObject) (string, *corev1.PodSpec) {
+	switch obj := obj.(type) {
+	case *models.Deployment:
+		if obj.Deployment != nil {
+			return models.DeploymentKind, &obj.Deployment.Spec.Template.Spec
+		}
+	case *models.StatefulSet:
+		if obj.StatefulSet != nil {
+			return models.StatefulSetKind, &obj.StatefulSet.Spec.Template.Spec
+		}
+	case *models.DaemonSet:
+		if obj.DaemonSet != nil {
+			return models.DaemonSetKind, &obj.DaemonSet.Spec.Template.Spec
+		}
+	}
+	return "", nil
+}
+
+func checkLatestTag(_ Rule, container corev1.Container) string {
+	_, tag, digest := parseImage(container.Image)
+	if digest {
+		return ""
+	}
+	if tag == "" {
+		return fmt.Sprintf("image %s has no tag, latest is used", container.Image)
+	}
+	if tag == "latest" {
+		return fmt.Sprintf("image %s uses the latest tag", container.Image)
+	}
+	return ""
+}
+
+func checkResourceLimits(_ Rule, container corev1.Container) string {
+	missing := make([]string, 0)
+	for _, resource := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+		if _, ok := container.Resources.Limits[resource]; !ok {
+			missing = append(missing, string(resource))
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Sprintf("no %s limit", strings.Join(missing, " and "))
+	}
+	return ""
+}
+
+func checkPrivileged(_ Rule, container corev1.Container) string {
+	if container.SecurityContext != nil && container.SecurityContext.Privileged != nil && *container.SecurityContext.Privileged {
+		return "the container is privileged"
+	}
+	return ""
+}
+
+func checkRegistry(rule Rule, container corev1.Container) string {
+	repository, _, _ := parseImage(container.Image)
+	for _, registry := range rule.Registries {
+		registry = strings.TrimSuffix(registry, "/")
+		if repository == registry || strings.HasPrefix(repository, registry+"/") {
+			return ""
+		}
+	}
+	return fmt.Sprintf("image %s is not from an allowed registry (%s)", container.Image, strings.Join(rule.Registries, ", "))
+}
+
+// parseImage returns the repository of the image including its registry (docker.io/library/nginx),
+// its tag and whether it is pinned by a digest
+func parseImage(image string) (string, string, bool) {
+	name, _, digest := strings.Cut(image, "@")
+
+	tag := ""
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, tag = name[:i], name[i+1:]
+	}
+
+	// the first part is a registry only if it looks like a host
+	first, rest, found := strings.Cut(name, "/")
+	if !found {
+		name = DefaultRegistry + "/library/" + name
+	} else if !strings.ContainsAny(first, ".:") && first != "localhost" {
+		name = DefaultRegistry + "/" + first + "/" + rest
+	}
+	return name, tag, digest
+}
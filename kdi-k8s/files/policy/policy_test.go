@@ -0,0 +1,173 @@
+package policy
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kuro-jojo/kdi-k8s/models"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    []Rule
+		wantErr bool
+	}{
+		{"empty", "  ", nil, false},
+		{"rules", `[{"id":"disallow-latest-tag","severity":"deny"},{"id":"allowed-registries","severity":"warn","registries":["ghcr.io"]}]`,
+			[]Rule{{ID: DisallowLatestTag, Severity: SeverityDeny}, {ID: AllowedRegistries, Severity: SeverityWarn, Registries: []string{"ghcr.io"}}}, false},
+		{"invalid json", `{"id"`, nil, true},
+		{"unknown rule", `[{"id":"no-root","severity":"deny"}]`, nil, true},
+		{"invalid severity", `[{"id":"disallow-privileged","severity":"error"}]`, nil, true},
+		{"registries missing", `[{"id":"allowed-registries","severity":"deny"}]`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := Parse(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(rules, tt.want) {
+				t.Errorf("Parse() = %+v, want %+v", rules, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseImage(t *testing.T) {
+	tests := []struct {
+		image      string
+		repository string
+		tag        string
+		digest     bool
+	}{
+		{"nginx", "docker.io/library/nginx", "", false},
+		{"nginx:1.27", "docker.io/library/nginx", "1.27", false},
+		{"bitnami/redis:latest", "docker.io/bitnami/redis", "latest", false},
+		{"ghcr.io/org/app:v1", "ghcr.io/org/app", "v1", false},
+		{"localhost/app", "localhost/app", "", false},
+		{"registry:5000/app", "registry:5000/app", "", false},
+		{"registry:5000/app:v2", "registry:5000/app", "v2", false},
+		{"nginx@sha256:abc", "docker.io/library/nginx", "", true},
+		{"ghcr.io/org/app:v1@sha256:abc", "ghcr.io/org/app", "v1", true},
+	}
+	for _, tt := range tests {
+		repository, tag, digest := parseImage(tt.image)
+		if repository != tt.repository || tag != tt.tag || digest != tt.digest {
+			t.Errorf("parseImage(%q) = %q, %q, %v, want %q, %q, %v", tt.image, repository, tag, digest, tt.repository, tt.tag, tt.digest)
+		}
+	}
+}
+
+func TestChecks(t *testing.T) {
+	privileged := true
+	limits := corev1.ResourceRequirements{Limits: corev1.ResourceList{
+		corev1.ResourceCPU:    resource.MustParse("500m"),
+		corev1.ResourceMemory: resource.MustParse("128Mi"),
+	}}
+	registries := Rule{ID: AllowedRegistries, Registries: []string{"ghcr.io/org/", "docker.io/library"}}
+
+	tests := []struct {
+		name      string
+		rule      Rule
+		container corev1.Container
+		violated  bool
+	}{
+		{"no tag", Rule{ID: DisallowLatestTag}, corev1.Container{Image: "nginx"}, true},
+		{"latest tag", Rule{ID: DisallowLatestTag}, corev1.Container{Image: "nginx:latest"}, true},
+		{"pinned tag", Rule{ID: DisallowLatestTag}, corev1.Container{Image: "nginx:1.27"}, false},
+		{"digest", Rule{ID: DisallowLatestTag}, corev1.Container{Image: "nginx@sha256:abc"}, false},
+		{"no limits", Rule{ID: RequireResourceLimits}, corev1.Container{}, true},
+		{"cpu limit only", Rule{ID: RequireResourceLimits}, corev1.Container{Resources: corev1.ResourceRequirements{
+			Limits: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")}}}, true},
+		{"limits", Rule{ID: RequireResourceLimits}, corev1.Container{Resources: limits}, false},
+		{"privileged", Rule{ID: DisallowPrivileged}, corev1.Container{SecurityContext: &corev1.SecurityContext{Privileged: &privileged}}, true},
+		{"not privileged", Rule{ID: DisallowPrivileged}, corev1.Container{SecurityContext: &corev1.SecurityContext{}}, false},
+		{"allowed registry", registries, corev1.Container{Image: "ghcr.io/org/app:v1"}, false},
+		{"default registry", registries, corev1.Container{Image: "nginx:1.27"}, false},
+		{"registry prefix of another", registries, corev1.Container{Image: "ghcr.io/organization/app:v1"}, true},
+		{"other registry", registries, corev1.Container{Image: "quay.io/org/app:v1"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message := checks[tt.rule.ID](tt.rule, tt.container)
+			if (message != "") != tt.violated {
+				t.Errorf("check %s = %q, want violated %v", tt.rule.ID, message, tt.violated)
+			}
+		})
+	}
+}
+
+func deployment(containers ...corev1.Container) *models.Deployment {
+	return &models.Deployment{Deployment: &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "api"},
+		Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+			InitContainers: []corev1.Container{{Name: "migrate", Image: "ghcr.io/org/migrate:v1"}},
+			Containers:     containers,
+		}}},
+	}}
+}
+
+func TestEvaluate(t *testing.T) {
+	rules := []Rule{
+		{ID: DisallowLatestTag, Severity: SeverityDeny},
+		{ID: RequireResourceLimits, Severity: SeverityWarn},
+	}
+
+	t.Run("deny and warn", func(t *testing.T) {
+		violations := Evaluate(deployment(corev1.Container{Name: "app", Image: "nginx:latest"}), rules)
+		want := []Violation{
+			{Rule: DisallowLatestTag, Severity: SeverityDeny, Object: "Deployment/api", Container: "app", Message: "image nginx:latest uses the latest tag"},
+			{Rule: RequireResourceLimits, Severity: SeverityWarn, Object: "Deployment/api", Container: "migrate", Message: "no cpu and memory limit"},
+			{Rule: RequireResourceLimits, Severity: SeverityWarn, Object: "Deployment/api", Container: "app", Message: "no cpu and memory limit"},
+		}
+		if !reflect.DeepEqual(violations, want) {
+			t.Fatalf("Evaluate() = %+v, want %+v", violations, want)
+		}
+		if !Denied(violations) {
+			t.Error("Denied() = false, want true")
+		}
+		if got := Messages(violations, SeverityWarn); len(got) != 2 {
+			t.Errorf("Messages(warn) = %v, want 2 messages", got)
+		}
+		if got := Messages(violations, SeverityDeny); len(got) != 1 || got[0] != "Deployment/api (container app) : image nginx:latest uses the latest tag [disallow-latest-tag]" {
+			t.Errorf("Messages(deny) = %v", got)
+		}
+	})
+
+	t.Run("warn only", func(t *testing.T) {
+		violations := Evaluate(deployment(corev1.Container{Name: "app", Image: "nginx:1.27"}), rules)
+		if len(violations) != 2 || Denied(violations) {
+			t.Errorf("Evaluate() = %+v, want 2 warnings", violations)
+		}
+	})
+
+	t.Run("statefulsets and daemonsets", func(t *testing.T) {
+		template := corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "db", Image: "postgres"}}}}
+		objects := map[string]models.KubeObject{
+			"StatefulSet/db": &models.StatefulSet{StatefulSet: &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "db"}, Spec: appsv1.StatefulSetSpec{Template: template}}},
+			"DaemonSet/db":   &models.DaemonSet{DaemonSet: &appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Name: "db"}, Spec: appsv1.DaemonSetSpec{Template: template}}},
+		}
+		for object, obj := range objects {
+			violations := Evaluate(obj, rules[:1])
+			if len(violations) != 1 || violations[0].Object != object || !Denied(violations) {
+				t.Errorf("Evaluate() = %+v, want the latest tag of %s denied", violations, object)
+			}
+		}
+	})
+
+	t.Run("unknown rules and objects", func(t *testing.T) {
+		violations := Evaluate(deployment(corev1.Container{Name: "app", Image: "nginx"}), []Rule{{ID: "no-root", Severity: SeverityDeny}})
+		if len(violations) != 0 {
+			t.Errorf("Evaluate() = %+v, want no violation for an unknown rule", violations)
+		}
+		if violations := Evaluate(&models.Service{}, rules); len(violations) != 0 {
+			t.Errorf("Evaluate() = %+v, want no violation for a service", violations)
+		}
+	})
+}
@@ -62,6 +62,10 @@ func getKuberbenetesObjectFromFile(fileContent string) ([]models.KubeObject, err
 		switch obj.GetObjectKind().GroupVersionKind().Kind {
 		case "Deployment":
 			objects = append(objects, &models.Deployment{Deployment: obj.(*appv1.Deployment)})
+		case "StatefulSet":
+			objects = append(objects, &models.StatefulSet{StatefulSet: obj.(*appv1.StatefulSet)})
+		case "DaemonSet":
+			objects = append(objects, &models.DaemonSet{DaemonSet: obj.(*appv1.DaemonSet)})
 		case "Service":
 			objects = append(objects, &models.Service{Service: obj.(*corev1.Service)})
 
@@ -2,11 +2,14 @@ package main
 
 import (
 	"github.com/kuro-jojo/kdi-k8s/server"
+	"github.com/kuro-jojo/kdi-k8s/shared/logging"
 )
 
 func main() {
 	// Load environment variables
 	server.LoadEnv()
+	// Log in JSON with the fields of the requests
+	logging.Init()
 	// Initialize Server
 	server.Init()
 }
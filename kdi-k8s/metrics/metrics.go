@@ -0,0 +1,90 @@
+package metrics
+
+// This file exposes the operational metrics of the kubernetes api in the prometheus format
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/kuro-jojo/kdi-k8s/shared/httpmetrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	Namespace = "kdi_k8s"
+
+	// Sources of the deployments
+	SourceFiles          = "files"
+	SourceDeploymentFile = "deployment_file"
+	SourceServiceFile    = "service_file"
+
+	OutcomeSucceeded = "succeeded"
+	OutcomePartial   = "partial" // some of the objects could not be created
+	OutcomeFailed    = "failed"
+)
+
+// Requests are the metrics of the http requests of the api
+var Requests = httpmetrics.NewRequests(Namespace)
+
+var (
+	clusterAuthDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      "cluster_auth_duration_seconds",
+		Help:      "Duration of the authentication to the clusters by cluster type and result.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"cluster_type", "result"})
+
+	clusterAuthFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "cluster_auth_failures_total",
+		Help:      "Number of failed authentications to the clusters by cluster type and reason.",
+	}, []string{"cluster_type", "reason"})
+
+	deploys = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "deploys_total",
+		Help:      "Number of deployments of uploaded files by source and outcome.",
+	}, []string{"source", "outcome"})
+
+	updates = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "updates_total",
+		Help:      "Number of updates of workloads by kind, strategy and outcome.",
+	}, []string{"kind", "strategy", "outcome"})
+)
+
+// ObserveClusterAuth records an authentication to a cluster, reason is empty if it succeeded
+func ObserveClusterAuth(clusterType string, start time.Time, reason string) {
+	if clusterType == "" {
+		clusterType = "default"
+	}
+	result := OutcomeSucceeded
+	if reason != "" {
+		result = OutcomeFailed
+		clusterAuthFailures.WithLabelValues(clusterType, reason).Inc()
+	}
+	clusterAuthDuration.WithLabelValues(clusterType, result).Observe(time.Since(start).Seconds())
+}
+
+// ObserveDeploy records a deployment of uploaded files from the status of its response
+func ObserveDeploy(source string, status int) {
+	deploys.WithLabelValues(source, Outcome(status)).Inc()
+}
+
+// ObserveUpdate records an update of a workload from the status of its response
+func ObserveUpdate(kind string, strategy string, status int) {
+	updates.WithLabelValues(kind, strategy, Outcome(status)).Inc()
+}
+
+// Outcome returns the outcome of an operation from the status of its response
+func Outcome(status int) string {
+	switch {
+	case status == http.StatusMultiStatus:
+		return OutcomePartial
+	case status < http.StatusBadRequest:
+		return OutcomeSucceeded
+	default:
+		return OutcomeFailed
+	}
+}
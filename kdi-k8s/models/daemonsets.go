@@ -0,0 +1,51 @@
+package models
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// DaemonSet
+
+type DaemonSet struct {
+	Clientset *kubernetes.Clientset
+	DaemonSet *appsv1.DaemonSet
+}
+
+func (d *DaemonSet) GetName() string {
+	return d.DaemonSet.Name
+}
+
+func (d *DaemonSet) GetNamespace() string {
+	return d.DaemonSet.Namespace
+}
+
+func (d *DaemonSet) SetNamespace(namespace string) {
+	d.DaemonSet.Namespace = namespace
+}
+
+func (d *DaemonSet) Get(ctx context.Context, name string, opts metav1.GetOptions) error {
+	_d, err := d.Clientset.AppsV1().DaemonSets(d.GetNamespace()).Get(ctx, name, opts)
+	if err != nil {
+		return err
+	}
+	d.DaemonSet = _d
+	return nil
+}
+
+func (d *DaemonSet) Create(ctx context.Context, obj KubeObject, opts metav1.CreateOptions) error {
+	o, ok := obj.(*DaemonSet)
+	if !ok {
+		return fmt.Errorf("invalid type for daemonset object")
+	}
+	created, err := d.Clientset.AppsV1().DaemonSets(d.DaemonSet.Namespace).Create(ctx, o.DaemonSet, opts)
+	if err != nil {
+		return err
+	}
+	d.DaemonSet = created
+	return nil
+}
@@ -0,0 +1,144 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	storagev1 "k8s.io/api/storage/v1"
+)
+
+const (
+	// NodeRoleLabelPrefix is the prefix of the labels giving the roles of a node (node-role.kubernetes.io/control-plane)
+	NodeRoleLabelPrefix = "node-role.kubernetes.io/"
+
+	DefaultStorageClassAnnotation = "storageclass.kubernetes.io/is-default-class"
+	DefaultIngressClassAnnotation = "ingressclass.kubernetes.io/is-default-class"
+)
+
+// Inventory is the description of a cluster : its version, its nodes and what is installed on it
+type Inventory struct {
+	ServerVersion  string
+	Platform       string
+	Nodes          []NodeInventory
+	StorageClasses []StorageClass
+	IngressClasses []IngressClass
+	CRDs           []CRD
+	CollectedAt    time.Time
+}
+
+type NodeCondition struct {
+	Type    string
+	Status  string
+	Reason  string
+	Message string
+}
+
+// NodeResources are the resources of a node, the cpu is in millicores and the memory in bytes
+type NodeResources struct {
+	CPU    int64
+	Memory int64
+	Pods   int64
+}
+
+// NodeAllocation is the sum of the requests and limits of the pods running on a node
+type NodeAllocation struct {
+	CPURequests    int64
+	CPULimits      int64
+	MemoryRequests int64
+	MemoryLimits   int64
+	Pods           int64
+}
+
+type NodeInventory struct {
+	Name             string
+	Roles            []string
+	KubeletVersion   string
+	OSImage          string
+	ContainerRuntime string
+	Architecture     string
+	Unschedulable    bool
+	Allocatable      NodeResources
+	Allocated        NodeAllocation
+	Conditions       []NodeCondition
+	CreatedAt        time.Time
+}
+
+type StorageClass struct {
+	Name                 string
+	Provisioner          string
+	ReclaimPolicy        string
+	VolumeBindingMode    string
+	AllowVolumeExpansion bool
+	Default              bool
+}
+
+type IngressClass struct {
+	Name       string
+	Controller string
+	Default    bool
+}
+
+// CRD is a custom resource definition installed on the cluster
+type CRD struct {
+	Name     string
+	Group    string
+	Kind     string
+	Scope    string
+	Versions []string
+}
+
+func NodeInventoryFrom(n *corev1.Node) NodeInventory {
+	node := NodeInventory{
+		Name:             n.Name,
+		Roles:            make([]string, 0),
+		KubeletVersion:   n.Status.NodeInfo.KubeletVersion,
+		OSImage:          n.Status.NodeInfo.OSImage,
+		ContainerRuntime: n.Status.NodeInfo.ContainerRuntimeVersion,
+		Architecture:     n.Status.NodeInfo.Architecture,
+		Unschedulable:    n.Spec.Unschedulable,
+		Allocatable: NodeResources{
+			CPU:    n.Status.Allocatable.Cpu().MilliValue(),
+			Memory: n.Status.Allocatable.Memory().Value(),
+			Pods:   n.Status.Allocatable.Pods().Value(),
+		},
+		Conditions: make([]NodeCondition, 0),
+		CreatedAt:  n.CreationTimestamp.Time,
+	}
+	for label := range n.Labels {
+		if role, ok := strings.CutPrefix(label, NodeRoleLabelPrefix); ok && role != "" {
+			node.Roles = append(node.Roles, role)
+		}
+	}
+	for _, c := range n.Status.Conditions {
+		node.Conditions = append(node.Conditions, NodeCondition{Type: string(c.Type), Status: string(c.Status), Reason: c.Reason, Message: c.Message})
+	}
+	return node
+}
+
+func StorageClassFrom(s *storagev1.StorageClass) StorageClass {
+	storageClass := StorageClass{
+		Name:        s.Name,
+		Provisioner: s.Provisioner,
+		Default:     s.Annotations[DefaultStorageClassAnnotation] == "true",
+	}
+	if s.ReclaimPolicy != nil {
+		storageClass.ReclaimPolicy = string(*s.ReclaimPolicy)
+	}
+	if s.VolumeBindingMode != nil {
+		storageClass.VolumeBindingMode = string(*s.VolumeBindingMode)
+	}
+	if s.AllowVolumeExpansion != nil {
+		storageClass.AllowVolumeExpansion = *s.AllowVolumeExpansion
+	}
+	return storageClass
+}
+
+func IngressClassFrom(i *networkingv1.IngressClass) IngressClass {
+	return IngressClass{
+		Name:       i.Name,
+		Controller: i.Spec.Controller,
+		Default:    i.Annotations[DefaultIngressClassAnnotation] == "true",
+	}
+}
@@ -1,8 +1,10 @@
 package models
 
-// This file describes the microservice model that will be returned when a deployment is created in the cluster
+// This file describes the microservice model that will be returned when a workload is created in the cluster
 // It will be used to display the deployment information in the frontend
 
+import corev1 "k8s.io/api/core/v1"
+
 const (
 	RollingUpdateStrategy = "RollingUpdate"
 	RecreateStrategy      = "Recreate"
@@ -25,6 +27,7 @@ type Container struct {
 
 // Microservice represents a deployed microservice
 type Microservice struct {
+	Kind       string // The kind of workload (Deployment, StatefulSet...)
 	Name       string
 	Namespace  string
 	Replicas   int32
@@ -34,3 +37,26 @@ type Microservice struct {
 	Conditions []Conditions
 	Containers []Container
 }
+
+// NewMicroservice returns the microservice of a workload created from its summary and its pod template
+func NewMicroservice(w Workload, template corev1.PodTemplateSpec) Microservice {
+	m := Microservice{
+		Kind:       w.Kind,
+		Name:       w.Name,
+		Namespace:  w.Namespace,
+		Replicas:   w.Replicas,
+		Labels:     template.Labels,
+		Selectors:  w.Selectors,
+		Strategy:   w.Strategy,
+		Conditions: w.Conditions,
+		Containers: make([]Container, 0),
+	}
+	for _, c := range template.Spec.Containers {
+		container := Container{Name: c.Name, Image: c.Image}
+		if len(c.Ports) > 0 {
+			container.Port = c.Ports[0].ContainerPort
+		}
+		m.Containers = append(m.Containers, container)
+	}
+	return m
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// StatefulSet
+
+type StatefulSet struct {
+	Clientset   *kubernetes.Clientset
+	StatefulSet *appsv1.StatefulSet
+}
+
+func (s *StatefulSet) GetName() string {
+	return s.StatefulSet.Name
+}
+
+func (s *StatefulSet) GetNamespace() string {
+	return s.StatefulSet.Namespace
+}
+
+func (s *StatefulSet) SetNamespace(namespace string) {
+	s.StatefulSet.Namespace = namespace
+}
+
+func (s *StatefulSet) Get(ctx context.Context, name string, opts metav1.GetOptions) error {
+	_s, err := s.Clientset.AppsV1().StatefulSets(s.GetNamespace()).Get(ctx, name, opts)
+	if err != nil {
+		return err
+	}
+	s.StatefulSet = _s
+	return nil
+}
+
+func (s *StatefulSet) Create(ctx context.Context, obj KubeObject, opts metav1.CreateOptions) error {
+	o, ok := obj.(*StatefulSet)
+	if !ok {
+		return fmt.Errorf("invalid type for statefulset object")
+	}
+	created, err := s.Clientset.AppsV1().StatefulSets(s.StatefulSet.Namespace).Create(ctx, o.StatefulSet, opts)
+	if err != nil {
+		return err
+	}
+	s.StatefulSet = created
+	return nil
+}
@@ -0,0 +1,58 @@
+package models
+
+// Usage is the use of a resource compared with what is reserved for it.
+// The cpu is in millicores and the memory in bytes.
+type Usage struct {
+	Used      int64
+	Requests  int64
+	Limits    int64
+	Unlimited bool // A container has no limit, Limits is then only the sum of the limits set
+}
+
+type ResourceUsage struct {
+	CPU    Usage
+	Memory Usage
+}
+
+func (r *ResourceUsage) Add(other ResourceUsage) {
+	r.CPU.add(other.CPU)
+	r.Memory.add(other.Memory)
+}
+
+func (u *Usage) add(other Usage) {
+	u.Used += other.Used
+	u.Requests += other.Requests
+	u.Limits += other.Limits
+	u.Unlimited = u.Unlimited || other.Unlimited
+}
+
+type PodUsage struct {
+	Name  string
+	Node  string
+	Phase string
+	Usage ResourceUsage
+}
+
+// WorkloadUsage is the usage of the pods of a workload.
+// Used is 0 when the metrics are not available.
+type WorkloadUsage struct {
+	Kind             string
+	Name             string
+	Namespace        string
+	MetricsAvailable bool
+	Pods             []PodUsage
+	Total            ResourceUsage
+}
+
+type NodeResource struct {
+	Used        int64
+	Allocatable int64
+	Capacity    int64
+}
+
+// NodeUsage is the usage of a node, the cpu is in millicores and the memory in bytes
+type NodeUsage struct {
+	Name   string
+	CPU    NodeResource
+	Memory NodeResource
+}
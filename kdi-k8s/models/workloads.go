@@ -0,0 +1,130 @@
+package models
+
+// This file describes the normalized summary of the workloads (deployments, statefulsets, daemonsets and cronjobs)
+// It is used to display the workloads of a namespace whatever their kind
+
+import (
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	DeploymentKind  = "Deployment"
+	StatefulSetKind = "StatefulSet"
+	DaemonSetKind   = "DaemonSet"
+	CronJobKind     = "CronJob"
+)
+
+// WorkloadKinds are the kinds of workloads in the order they are listed
+var WorkloadKinds = []string{DeploymentKind, StatefulSetKind, DaemonSetKind, CronJobKind}
+
+// WorkloadOwner is the controller of a workload (a HelmRelease, an operator...)
+type WorkloadOwner struct {
+	Kind string
+	Name string
+}
+
+// Workload is the summary of a workload of any kind
+type Workload struct {
+	Kind          string
+	Name          string
+	Namespace     string
+	Replicas      int32 // The desired number of pods (scheduled nodes for a daemonset, active jobs for a cronjob)
+	ReadyReplicas int32
+	Images        []string
+	Labels        map[string]string
+	Selectors     map[string]string
+	Strategy      string // The update strategy used
+	Conditions    []Conditions
+	Owner         *WorkloadOwner
+	CreatedAt     time.Time
+
+	// For cronjobs
+	Schedule         string
+	Suspended        bool
+	LastScheduleTime *time.Time
+}
+
+// WorkloadFromDeployment returns the summary of a deployment
+func WorkloadFromDeployment(d *appsv1.Deployment) Workload {
+	w := newWorkload(DeploymentKind, d.ObjectMeta, d.Spec.Template.Spec, d.Spec.Selector)
+	w.Replicas = replicas(d.Spec.Replicas)
+	w.ReadyReplicas = d.Status.ReadyReplicas
+	w.Strategy = string(d.Spec.Strategy.Type)
+	for _, c := range d.Status.Conditions {
+		w.Conditions = append(w.Conditions, Conditions{Type: string(c.Type), Message: c.Message, Reason: c.Reason})
+	}
+	return w
+}
+
+// WorkloadFromStatefulSet returns the summary of a statefulset
+func WorkloadFromStatefulSet(s *appsv1.StatefulSet) Workload {
+	w := newWorkload(StatefulSetKind, s.ObjectMeta, s.Spec.Template.Spec, s.Spec.Selector)
+	w.Replicas = replicas(s.Spec.Replicas)
+	w.ReadyReplicas = s.Status.ReadyReplicas
+	w.Strategy = string(s.Spec.UpdateStrategy.Type)
+	for _, c := range s.Status.Conditions {
+		w.Conditions = append(w.Conditions, Conditions{Type: string(c.Type), Message: c.Message, Reason: c.Reason})
+	}
+	return w
+}
+
+// WorkloadFromDaemonSet returns the summary of a daemonset
+func WorkloadFromDaemonSet(d *appsv1.DaemonSet) Workload {
+	w := newWorkload(DaemonSetKind, d.ObjectMeta, d.Spec.Template.Spec, d.Spec.Selector)
+	w.Replicas = d.Status.DesiredNumberScheduled
+	w.ReadyReplicas = d.Status.NumberReady
+	w.Strategy = string(d.Spec.UpdateStrategy.Type)
+	for _, c := range d.Status.Conditions {
+		w.Conditions = append(w.Conditions, Conditions{Type: string(c.Type), Message: c.Message, Reason: c.Reason})
+	}
+	return w
+}
+
+// WorkloadFromCronJob returns the summary of a cronjob
+func WorkloadFromCronJob(c *batchv1.CronJob) Workload {
+	w := newWorkload(CronJobKind, c.ObjectMeta, c.Spec.JobTemplate.Spec.Template.Spec, c.Spec.JobTemplate.Spec.Selector)
+	w.Replicas = int32(len(c.Status.Active))
+	w.Strategy = string(c.Spec.ConcurrencyPolicy)
+	w.Schedule = c.Spec.Schedule
+	w.Suspended = c.Spec.Suspend != nil && *c.Spec.Suspend
+	if c.Status.LastScheduleTime != nil {
+		t := c.Status.LastScheduleTime.Time
+		w.LastScheduleTime = &t
+	}
+	return w
+}
+
+func newWorkload(kind string, meta metav1.ObjectMeta, pod corev1.PodSpec, selector *metav1.LabelSelector) Workload {
+	w := Workload{
+		Kind:       kind,
+		Name:       meta.Name,
+		Namespace:  meta.Namespace,
+		Labels:     meta.Labels,
+		Images:     make([]string, 0),
+		Conditions: make([]Conditions, 0),
+		CreatedAt:  meta.CreationTimestamp.Time,
+	}
+	for _, c := range pod.Containers {
+		w.Images = append(w.Images, c.Image)
+	}
+	if selector != nil {
+		w.Selectors = selector.MatchLabels
+	}
+	if owner := metav1.GetControllerOfNoCopy(&meta); owner != nil {
+		w.Owner = &WorkloadOwner{Kind: owner.Kind, Name: owner.Name}
+	}
+	return w
+}
+
+func replicas(r *int32) int32 {
+	// defaulted to 1 by the api server
+	if r == nil {
+		return 1
+	}
+	return *r
+}
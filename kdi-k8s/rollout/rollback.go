@@ -0,0 +1,133 @@
+package rollout
+
+// This file reverts a deployment to a previous revision after a failed rollout
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// RevisionAnnotation is set by the deployment controller on the deployment and its replica sets
+	RevisionAnnotation = "deployment.kubernetes.io/revision"
+
+	RollbackTimeout = 30 * time.Second
+)
+
+// Rollback is the revert of an update whose rollout failed
+type Rollback struct {
+	Succeeded bool   `json:"succeeded"`
+	Revision  int64  `json:"revision,omitempty"` // The revision restored
+	Message   string `json:"message"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Revision returns the revision of a deployment or a replica set, 0 if it has none
+func Revision(object metav1.Object) int64 {
+	revision, err := strconv.ParseInt(object.GetAnnotations()[RevisionAnnotation], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return revision
+}
+
+// Undo restores the pod template of the given revision of the deployment
+func Undo(ctx context.Context, clientset kubernetes.Interface, namespace, name string, revision int64) Rollback {
+	// the rollback must happen even if the request was cancelled during the rollout
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), RollbackTimeout)
+	defer cancel()
+
+	rollback, err := undo(ctx, clientset, namespace, name, revision)
+	if err != nil {
+		rollback.Error = fmt.Sprintf("failed to roll back deployment %s to revision %d: %v", name, revision, err)
+	}
+	return rollback
+}
+
+func undo(ctx context.Context, clientset kubernetes.Interface, namespace, name string, revision int64) (Rollback, error) {
+	rollback := Rollback{Revision: revision}
+	deployments := clientset.AppsV1().Deployments(namespace)
+
+	deployment, err := deployments.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return rollback, err
+	}
+	if Revision(deployment) == revision {
+		return rollback, fmt.Errorf("the update did not create a new revision")
+	}
+
+	replicaSets, err := ownedReplicaSets(ctx, clientset, deployment)
+	if err != nil {
+		return rollback, err
+	}
+	var previous *appsv1.ReplicaSet
+	for i := range replicaSets {
+		if Revision(&replicaSets[i]) == revision {
+			previous = &replicaSets[i]
+			break
+		}
+	}
+	if previous == nil {
+		return rollback, fmt.Errorf("revision not found")
+	}
+
+	// the label is added by the deployment controller to the template of the replica set
+	template := previous.Spec.Template.DeepCopy()
+	delete(template.Labels, appsv1.DefaultDeploymentUniqueLabelKey)
+
+	patch, err := json.Marshal([]map[string]interface{}{
+		{"op": "test", "path": "/metadata/resourceVersion", "value": deployment.ResourceVersion},
+		{"op": "replace", "path": "/spec/template", "value": template},
+	})
+	if err != nil {
+		return rollback, err
+	}
+	if _, err := deployments.Patch(ctx, name, types.JSONPatchType, patch, metav1.PatchOptions{}); err != nil {
+		return rollback, err
+	}
+
+	rollback.Succeeded = true
+	rollback.Message = fmt.Sprintf("deployment %s rolled back to revision %d", name, revision)
+	return rollback, nil
+}
+
+// ownedReplicaSets returns the replica sets controlled by the deployment
+func ownedReplicaSets(ctx context.Context, clientset kubernetes.Interface, deployment *appsv1.Deployment) ([]appsv1.ReplicaSet, error) {
+	list, err := clientset.AppsV1().ReplicaSets(deployment.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: metav1.FormatLabelSelector(deployment.Spec.Selector),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	replicaSets := make([]appsv1.ReplicaSet, 0)
+	for _, rs := range list.Items {
+		if owner := metav1.GetControllerOf(&rs); owner != nil && owner.UID == deployment.UID {
+			replicaSets = append(replicaSets, rs)
+		}
+	}
+	return replicaSets, nil
+}
+
+// newReplicaSet returns the replica set of the latest revision of the deployment
+func newReplicaSet(ctx context.Context, clientset kubernetes.Interface, deployment *appsv1.Deployment) (*appsv1.ReplicaSet, error) {
+	replicaSets, err := ownedReplicaSets(ctx, clientset, deployment)
+	if err != nil {
+		return nil, err
+	}
+	revision := Revision(deployment)
+	for i := range replicaSets {
+		if Revision(&replicaSets[i]) == revision {
+			return &replicaSets[i], nil
+		}
+	}
+	return nil, nil
+}
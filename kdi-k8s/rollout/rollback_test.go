@@ -0,0 +1,57 @@
+package rollout
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestUndo(t *testing.T) {
+	t.Run("previous revision restored", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(newDeployment(2, ProgressDeadlineExceeded, 0), newReplicaSetOf(1, "web:v1"), newReplicaSetOf(2, "web:v2"))
+		rollback := Undo(context.Background(), clientset, "shop", "web", 1)
+		if !rollback.Succeeded || rollback.Error != "" || rollback.Revision != 1 {
+			t.Fatalf("Undo() = %+v, want the revision 1 restored", rollback)
+		}
+
+		deployment, err := clientset.AppsV1().Deployments("shop").Get(context.Background(), "web", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		template := deployment.Spec.Template
+		if template.Spec.Containers[0].Image != "web:v1" {
+			t.Errorf("image = %s, want the one of the revision 1", template.Spec.Containers[0].Image)
+		}
+		// the hash of the replica set is set back by the deployment controller
+		if _, ok := template.Labels[appsv1.DefaultDeploymentUniqueLabelKey]; ok || template.Labels["app"] != "web" {
+			t.Errorf("labels = %v, want the labels of the revision without its hash", template.Labels)
+		}
+	})
+
+	t.Run("no new revision", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(newDeployment(1, ProgressDeadlineExceeded, 0), newReplicaSetOf(1, "web:v1"))
+		rollback := Undo(context.Background(), clientset, "shop", "web", 1)
+		if rollback.Succeeded || !strings.Contains(rollback.Error, "did not create a new revision") {
+			t.Fatalf("Undo() = %+v, want the rollback refused", rollback)
+		}
+		for _, action := range clientset.Actions() {
+			if action.GetVerb() == "patch" {
+				t.Errorf("deployment patched by %+v", action)
+			}
+		}
+	})
+
+	t.Run("revision not found", func(t *testing.T) {
+		// the replica set of the revision 1 belongs to another deployment
+		other := newReplicaSetOf(1, "web:v1")
+		other.OwnerReferences[0].UID = "other-uid"
+		clientset := fake.NewSimpleClientset(newDeployment(2, ProgressDeadlineExceeded, 0), other)
+		if rollback := Undo(context.Background(), clientset, "shop", "web", 1); rollback.Succeeded {
+			t.Errorf("Undo() = %+v, want the revision not found", rollback)
+		}
+	})
+}
@@ -0,0 +1,293 @@
+package rollout
+
+// This package waits for the rollout of a deployment to complete and reverts it if it failed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/kuro-jojo/kdi-k8s/models"
+)
+
+const (
+	// Outcomes of a rollout
+	Available   = "Available"
+	Failed      = "Failed"
+	TimedOut    = "TimedOut"
+	Interrupted = "Interrupted" // the wait was canceled, the rollout goes on in the cluster
+
+	DefaultTimeout = 5 * time.Minute
+	MaxTimeout     = 30 * time.Minute
+	PollInterval   = 2 * time.Second
+
+	// Reasons set by the deployment controller on the Progressing condition
+	NewReplicaSetAvailable   = "NewReplicaSetAvailable"
+	ProgressDeadlineExceeded = "ProgressDeadlineExceeded"
+
+	// Types of the conditions added to the microservice
+	RolloutConditionType    = "Rollout"
+	PodFailureConditionType = "PodFailure"
+	RollbackConditionType   = "Rollback"
+
+	// CrashLoopBackOff is the waiting reason of a container restarting after crashing
+	CrashLoopBackOff = "CrashLoopBackOff"
+)
+
+// podFailureReasons are the waiting reasons of a container that will not recover by itself
+var podFailureReasons = map[string]bool{
+	"CrashLoopBackOff":           true,
+	"ImagePullBackOff":           true,
+	"ErrImagePull":               true,
+	"InvalidImageName":           true,
+	"CreateContainerConfigError": true,
+	"CreateContainerError":       true,
+	"RunContainerError":          true,
+}
+
+// PodFailure is the reason why a container of a pod of the deployment is not running
+type PodFailure struct {
+	Pod       string `json:"pod"`
+	Container string `json:"container"`
+	Reason    string `json:"reason"`
+	Message   string `json:"message"`
+}
+
+// Result is the outcome of a rollout
+type Result struct {
+	Outcome     string              `json:"outcome"`
+	Message     string              `json:"message"`
+	Conditions  []models.Conditions `json:"conditions"`
+	PodFailures []PodFailure        `json:"podFailures"`
+	Rollback    *Rollback           `json:"rollback,omitempty"` // Set if the update was reverted after the failure of the rollout
+
+	Deployment *appsv1.Deployment `json:"-"`
+}
+
+// Timeout returns the deadline of a rollout from the number of seconds requested
+func Timeout(seconds int) time.Duration {
+	if seconds <= 0 {
+		return DefaultTimeout
+	}
+	timeout := time.Duration(seconds) * time.Second
+	if timeout > MaxTimeout {
+		return MaxTimeout
+	}
+	return timeout
+}
+
+// Wait blocks until the Progressing condition of the deployment reports NewReplicaSetAvailable,
+// the deployment controller gives up on the rollout or the timeout expires.
+func Wait(ctx context.Context, clientset kubernetes.Interface, namespace, name string, timeout time.Duration) Result {
+	return waitForRollout(ctx, clientset, namespace, name, timeout, false)
+}
+
+// Watch is like Wait but the rollout fails as soon as a pod of the new revision enters CrashLoopBackOff
+func Watch(ctx context.Context, clientset kubernetes.Interface, namespace, name string, timeout time.Duration) Result {
+	return waitForRollout(ctx, clientset, namespace, name, timeout, true)
+}
+
+func waitForRollout(ctx context.Context, clientset kubernetes.Interface, namespace, name string, timeout time.Duration, failOnCrashLoop bool) Result {
+	var result Result
+	deployments := clientset.AppsV1().Deployments(namespace)
+
+	err := wait.PollUntilContextTimeout(ctx, PollInterval, timeout, true, func(ctx context.Context) (bool, error) {
+		deployment, err := deployments.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		result.Deployment = deployment
+
+		// the status is not up to date with the latest spec yet
+		if deployment.Status.ObservedGeneration < deployment.Generation {
+			return false, nil
+		}
+
+		progressing := getCondition(deployment, appsv1.DeploymentProgressing)
+		if progressing == nil {
+			return false, nil
+		}
+		switch progressing.Reason {
+		case ProgressDeadlineExceeded:
+			result.Outcome = Failed
+			result.Message = progressing.Message
+			return true, nil
+		case NewReplicaSetAvailable:
+			if isComplete(deployment) {
+				result.Outcome = Available
+				result.Message = progressing.Message
+				return true, nil
+			}
+		}
+
+		if failOnCrashLoop {
+			if pod := crashLoopingPod(ctx, clientset, deployment); pod != "" {
+				result.Outcome = Failed
+				result.Message = fmt.Sprintf("pod %s of deployment %s is in %s", pod, name, CrashLoopBackOff)
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+
+	if err != nil {
+		switch {
+		case errors.Is(ctx.Err(), context.Canceled):
+			// the request was canceled by the client or by the shutdown of the server
+			result.Outcome = Interrupted
+			result.Message = fmt.Sprintf("the wait for the rollout of deployment %s was interrupted, the rollout goes on in the cluster", name)
+		case errors.Is(err, context.DeadlineExceeded) || wait.Interrupted(err):
+			result.Outcome = TimedOut
+			result.Message = fmt.Sprintf("deployment %s did not become available within %v", name, timeout)
+		default:
+			result.Outcome = Failed
+			result.Message = fmt.Sprintf("failed to get the status of deployment %s: %v", name, err)
+		}
+	}
+
+	if result.Deployment != nil && result.Outcome != Available {
+		result.PodFailures = podFailures(ctx, clientset, result.Deployment)
+	}
+	result.Conditions = result.conditions()
+	return result
+}
+
+// isComplete returns true if all the replicas run the latest pod template and are available
+func isComplete(deployment *appsv1.Deployment) bool {
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	return deployment.Status.UpdatedReplicas == replicas &&
+		deployment.Status.Replicas == replicas &&
+		deployment.Status.AvailableReplicas == replicas
+}
+
+func getCondition(deployment *appsv1.Deployment, conditionType appsv1.DeploymentConditionType) *appsv1.DeploymentCondition {
+	for i := range deployment.Status.Conditions {
+		if deployment.Status.Conditions[i].Type == conditionType {
+			return &deployment.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// podFailures returns the containers of the deployment's pods that failed to start
+func podFailures(ctx context.Context, clientset kubernetes.Interface, deployment *appsv1.Deployment) []PodFailure {
+	// the context may have expired with the rollout
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+
+	pods, err := clientset.CoreV1().Pods(deployment.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: metav1.FormatLabelSelector(deployment.Spec.Selector),
+	})
+	if err != nil {
+		return nil
+	}
+
+	failures := make([]PodFailure, 0)
+	for _, pod := range pods.Items {
+		statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+		for _, status := range statuses {
+			if status.State.Waiting != nil && podFailureReasons[status.State.Waiting.Reason] {
+				failures = append(failures, PodFailure{
+					Pod:       pod.Name,
+					Container: status.Name,
+					Reason:    status.State.Waiting.Reason,
+					Message:   status.State.Waiting.Message,
+				})
+			}
+			if status.State.Terminated != nil && status.State.Terminated.ExitCode != 0 {
+				failures = append(failures, PodFailure{
+					Pod:       pod.Name,
+					Container: status.Name,
+					Reason:    status.State.Terminated.Reason,
+					Message:   status.State.Terminated.Message,
+				})
+			}
+		}
+	}
+	return failures
+}
+
+// crashLoopingPod returns the name of a pod of the latest revision of the deployment in CrashLoopBackOff
+func crashLoopingPod(ctx context.Context, clientset kubernetes.Interface, deployment *appsv1.Deployment) string {
+	replicaSet, err := newReplicaSet(ctx, clientset, deployment)
+	if err != nil || replicaSet == nil {
+		return ""
+	}
+
+	pods, err := clientset.CoreV1().Pods(deployment.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: metav1.FormatLabelSelector(deployment.Spec.Selector),
+	})
+	if err != nil {
+		return ""
+	}
+
+	hash := replicaSet.Labels[appsv1.DefaultDeploymentUniqueLabelKey]
+	for _, pod := range pods.Items {
+		if pod.Labels[appsv1.DefaultDeploymentUniqueLabelKey] != hash {
+			continue
+		}
+		statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+		for _, status := range statuses {
+			if status.State.Waiting != nil && status.State.Waiting.Reason == CrashLoopBackOff {
+				return pod.Name
+			}
+		}
+	}
+	return ""
+}
+
+// SetRollback records the revert of the update in the result
+func (r *Result) SetRollback(rollback Rollback) {
+	r.Rollback = &rollback
+	r.Conditions = r.conditions()
+}
+
+// conditions returns the conditions of the deployment followed by the outcome of the rollout and the pod failures
+func (r Result) conditions() []models.Conditions {
+	conditions := make([]models.Conditions, 0)
+	if r.Deployment != nil {
+		for _, c := range r.Deployment.Status.Conditions {
+			conditions = append(conditions, models.Conditions{
+				Type:    string(c.Type),
+				Message: c.Message,
+				Reason:  c.Reason,
+			})
+		}
+	}
+	conditions = append(conditions, models.Conditions{
+		Type:    RolloutConditionType,
+		Message: r.Message,
+		Reason:  r.Outcome,
+	})
+	for _, f := range r.PodFailures {
+		conditions = append(conditions, models.Conditions{
+			Type:    PodFailureConditionType,
+			Message: fmt.Sprintf("pod %s, container %s : %s", f.Pod, f.Container, f.Message),
+			Reason:  f.Reason,
+		})
+	}
+	if r.Rollback != nil {
+		reason := "Succeeded"
+		message := r.Rollback.Message
+		if r.Rollback.Error != "" {
+			reason = Failed
+			message = r.Rollback.Error
+		}
+		conditions = append(conditions, models.Conditions{
+			Type:    RollbackConditionType,
+			Message: message,
+			Reason:  reason,
+		})
+	}
+	return conditions
+}
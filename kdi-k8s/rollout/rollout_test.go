@@ -0,0 +1,163 @@
+package rollout
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const deploymentUID = types.UID("web-uid")
+
+// newDeployment returns the deployment web at the revision with the Progressing condition of the reason
+func newDeployment(revision int64, reason string, available int32) *appsv1.Deployment {
+	replicas := int32(2)
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "web",
+			Namespace:       "shop",
+			UID:             deploymentUID,
+			Generation:      2,
+			ResourceVersion: "10",
+			Annotations:     map[string]string{RevisionAnnotation: strconv.FormatInt(revision, 10)},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+			Template: podTemplate("web:v2"),
+		},
+		Status: appsv1.DeploymentStatus{
+			ObservedGeneration: 2,
+			Replicas:           replicas,
+			UpdatedReplicas:    replicas,
+			AvailableReplicas:  available,
+		},
+	}
+	if reason != "" {
+		deployment.Status.Conditions = []appsv1.DeploymentCondition{{Type: appsv1.DeploymentProgressing, Reason: reason, Message: reason}}
+	}
+	return deployment
+}
+
+func podTemplate(image string) corev1.PodTemplateSpec {
+	return corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "web"}},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "web", Image: image}}},
+	}
+}
+
+// newReplicaSetOf returns the replica set of the revision of the deployment web running the image
+func newReplicaSetOf(revision int64, image string) *appsv1.ReplicaSet {
+	hash := "hash-" + strconv.FormatInt(revision, 10)
+	template := podTemplate(image)
+	template.Labels = map[string]string{"app": "web", appsv1.DefaultDeploymentUniqueLabelKey: hash}
+	controller := true
+	return &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "web-" + hash,
+			Namespace:       "shop",
+			Labels:          template.Labels,
+			Annotations:     map[string]string{RevisionAnnotation: strconv.FormatInt(revision, 10)},
+			OwnerReferences: []metav1.OwnerReference{{Kind: "Deployment", Name: "web", UID: deploymentUID, Controller: &controller}},
+		},
+		Spec: appsv1.ReplicaSetSpec{Template: template},
+	}
+}
+
+// newPod returns a pod of the replica set of the revision whose container waits for the reason
+func newPod(name string, revision int64, waiting string) *corev1.Pod {
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:      name,
+		Namespace: "shop",
+		Labels:    map[string]string{"app": "web", appsv1.DefaultDeploymentUniqueLabelKey: "hash-" + strconv.FormatInt(revision, 10)},
+	}}
+	if waiting != "" {
+		pod.Status.ContainerStatuses = []corev1.ContainerStatus{{Name: "web", State: corev1.ContainerState{
+			Waiting: &corev1.ContainerStateWaiting{Reason: waiting, Message: "back-off restarting failed container"},
+		}}}
+	}
+	return pod
+}
+
+func TestWait(t *testing.T) {
+	t.Run("available", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(newDeployment(2, NewReplicaSetAvailable, 2))
+		result := Wait(context.Background(), clientset, "shop", "web", time.Minute)
+		if result.Outcome != Available || len(result.PodFailures) != 0 {
+			t.Errorf("Wait() = %+v, want the deployment available", result)
+		}
+		if last := result.Conditions[len(result.Conditions)-1]; last.Type != RolloutConditionType || last.Reason != Available {
+			t.Errorf("conditions = %+v, want the outcome last", result.Conditions)
+		}
+	})
+
+	t.Run("progress deadline exceeded", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(
+			newDeployment(2, ProgressDeadlineExceeded, 0),
+			newPod("web-1", 2, "ImagePullBackOff"),
+		)
+		result := Wait(context.Background(), clientset, "shop", "web", time.Minute)
+		if result.Outcome != Failed || result.Message != ProgressDeadlineExceeded {
+			t.Errorf("Wait() = %+v, want the rollout failed", result)
+		}
+		if len(result.PodFailures) != 1 || result.PodFailures[0].Pod != "web-1" || result.PodFailures[0].Reason != "ImagePullBackOff" {
+			t.Errorf("pod failures = %+v, want the image of web-1 not pulled", result.PodFailures)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		// the replicas of the new revision are not all available yet
+		clientset := fake.NewSimpleClientset(newDeployment(2, NewReplicaSetAvailable, 1))
+		result := Wait(context.Background(), clientset, "shop", "web", 50*time.Millisecond)
+		if result.Outcome != TimedOut {
+			t.Errorf("Wait() = %+v, want the rollout timed out", result)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		result := Wait(context.Background(), fake.NewSimpleClientset(), "shop", "web", time.Minute)
+		if result.Outcome != Failed || result.Deployment != nil {
+			t.Errorf("Wait() = %+v, want the rollout failed", result)
+		}
+	})
+}
+
+func TestWatchCrashLoop(t *testing.T) {
+	objects := func(waiting string) *fake.Clientset {
+		return fake.NewSimpleClientset(
+			newDeployment(2, "ReplicaSetUpdated", 1),
+			newReplicaSetOf(1, "web:v1"),
+			newReplicaSetOf(2, "web:v2"),
+			newPod("web-old", 1, CrashLoopBackOff), // the previous revision is not looked at
+			newPod("web-new", 2, waiting),
+		)
+	}
+
+	t.Run("crash-looping pod", func(t *testing.T) {
+		result := Watch(context.Background(), objects(CrashLoopBackOff), "shop", "web", time.Minute)
+		if result.Outcome != Failed || result.Message != "pod web-new of deployment web is in CrashLoopBackOff" {
+			t.Errorf("Watch() = %+v, want the rollout failed on web-new", result)
+		}
+	})
+
+	t.Run("waited by Wait", func(t *testing.T) {
+		result := Wait(context.Background(), objects(CrashLoopBackOff), "shop", "web", 50*time.Millisecond)
+		if result.Outcome != TimedOut {
+			t.Errorf("Wait() = %+v, want the rollout timed out", result)
+		}
+	})
+
+	t.Run("pods of the new revision running", func(t *testing.T) {
+		clientset := objects("")
+		deployment, _ := clientset.AppsV1().Deployments("shop").Get(context.Background(), "web", metav1.GetOptions{})
+		if pod := crashLoopingPod(context.Background(), clientset, deployment); pod != "" {
+			t.Errorf("crashLoopingPod() = %q, want none", pod)
+		}
+	})
+}
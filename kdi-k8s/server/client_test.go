@@ -0,0 +1,193 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kuro-jojo/kdi-k8s/client"
+	controllersconfigs "github.com/kuro-jojo/kdi-k8s/controllers/configs"
+	controllersupdate "github.com/kuro-jojo/kdi-k8s/controllers/update"
+	"github.com/kuro-jojo/kdi-k8s/files/policy"
+	"github.com/kuro-jojo/kdi-k8s/models"
+	"github.com/kuro-jojo/kdi-k8s/rollout"
+	"github.com/kuro-jojo/kdi-k8s/utils"
+)
+
+// The types of the client are copies of the models of the api.
+// These tests send every field of a model through the type of the other side and back,
+// so a field renamed, retyped or missing on one side fails them.
+
+// rawValues are the values of the json.RawMessage fields of the client, by field name.
+// They are in the format the api writes them back.
+var rawValues = map[string]string{
+	"Env":            `[{"name":"MODE","value":"prod"}]`,
+	"Resources":      `{"limits":{"cpu":"500m"}}`,
+	"LivenessProbe":  `{"httpGet":{"path":"/health","port":8080},"periodSeconds":5}`,
+	"ReadinessProbe": `{"httpGet":{"path":"/ready","port":8080}}`,
+	"StartupProbe":   `{"tcpSocket":{"port":8080},"failureThreshold":30}`,
+	"JSONPatch":      `[{"op":"replace","path":"/spec/minReadySeconds","value":10}]`,
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	rawType  = reflect.TypeOf(json.RawMessage{})
+)
+
+// filler sets every field sent by a type to a distinct value
+type filler struct {
+	t *testing.T
+	n int
+}
+
+func (f *filler) fill(v reflect.Value, field string) {
+	f.n++
+	switch v.Type() {
+	case timeType:
+		v.Set(reflect.ValueOf(time.Date(2024, 1, 1, 0, 0, f.n, 0, time.UTC)))
+		return
+	case rawType:
+		raw, ok := rawValues[field]
+		if !ok {
+			f.t.Fatalf("no raw value for the field %s", field)
+		}
+		v.SetBytes([]byte(raw))
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(fmt.Sprintf("%s-%d", strings.ToLower(field), f.n))
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		v.SetInt(int64(f.n))
+	case reflect.Ptr:
+		v.Set(reflect.New(v.Type().Elem()))
+		f.fill(v.Elem(), field)
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), 1, 1))
+		f.fill(v.Index(0), field)
+	case reflect.Map:
+		key, value := reflect.New(v.Type().Key()).Elem(), reflect.New(v.Type().Elem()).Elem()
+		f.fill(key, field)
+		f.fill(value, field)
+		v.Set(reflect.MakeMap(v.Type()))
+		v.SetMapIndex(key, value)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			sf := v.Type().Field(i)
+			// the fields that are not sent are left empty
+			if !sf.IsExported() || sf.Tag.Get("json") == "-" {
+				continue
+			}
+			f.fill(v.Field(i), sf.Name)
+		}
+	default:
+		f.t.Fatalf("cannot fill the field %s of kind %s", field, v.Kind())
+	}
+}
+
+// filled returns a pointer to a value of the type of v with all its fields set
+func filled(t *testing.T, v interface{}) interface{} {
+	t.Helper()
+	value := reflect.New(reflect.TypeOf(v))
+	(&filler{t: t}).fill(value.Elem(), "")
+	return value.Interface()
+}
+
+// decodeStrict decodes data into v, failing on the fields v does not know
+func decodeStrict(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+func TestClientResponseTypes(t *testing.T) {
+	tests := []struct {
+		server interface{} // the model written by the api
+		client interface{} // the type read by the client
+	}{
+		{models.Microservice{}, client.Microservice{}},
+		{models.Workload{}, client.Workload{}},
+		{models.WorkloadUsage{}, client.WorkloadUsage{}},
+		{models.NodeUsage{}, client.NodeUsage{}},
+		{models.ResourceUsage{}, client.ResourceUsage{}},
+		{models.Inventory{}, client.Inventory{}},
+		{rollout.Result{}, client.Rollout{}},
+		{policy.Violation{}, client.PolicyViolation{}},
+		{utils.K8sError{}, client.Error{}},
+		{controllersupdate.StatefulSetRevisions{}, client.StatefulSetRevisions{}},
+		{controllersconfigs.ConfigMapSummary{}, client.ConfigMap{}},
+		{controllersconfigs.SecretSummary{}, client.Secret{}},
+	}
+	for _, tt := range tests {
+		name := reflect.TypeOf(tt.server).String()
+		t.Run(name, func(t *testing.T) {
+			sent, err := json.Marshal(filled(t, tt.server))
+			if err != nil {
+				t.Fatal(err)
+			}
+			received := reflect.New(reflect.TypeOf(tt.client)).Interface()
+			if err := decodeStrict(sent, received); err != nil {
+				t.Fatalf("%s cannot read %s: %v", reflect.TypeOf(tt.client), sent, err)
+			}
+			back, err := json.Marshal(received)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var want, got interface{}
+			json.Unmarshal(sent, &want)
+			json.Unmarshal(back, &got)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("the client lost fields of the api:\n sent %s\n read %s", sent, back)
+			}
+		})
+	}
+}
+
+func TestClientRequestTypes(t *testing.T) {
+	tests := []struct {
+		client interface{} // the request sent by the client
+		server interface{} // the form bound by the api
+	}{
+		{client.UpdateRequest{}, controllersupdate.UpdateForm{}},
+		{client.StatefulSetUpdateRequest{}, controllersupdate.StatefulSetUpdateForm{}},
+		{client.ConfigRequest{}, controllersconfigs.ConfigForm{}},
+		{client.ConfigSource{}, controllersconfigs.ConfigSourceForm{}},
+		{client.PolicyRule{}, policy.Rule{}},
+	}
+	for _, tt := range tests {
+		name := reflect.TypeOf(tt.client).String()
+		t.Run(name, func(t *testing.T) {
+			request := filled(t, tt.client)
+			sent, err := json.Marshal(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			form := reflect.New(reflect.TypeOf(tt.server)).Interface()
+			if err := decodeStrict(sent, form); err != nil {
+				t.Fatalf("%s cannot bind %s: %v", reflect.TypeOf(tt.server), sent, err)
+			}
+
+			// the form also holds the parameters of the path, ignored by the client
+			bound, err := json.Marshal(form)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := reflect.New(reflect.TypeOf(tt.client)).Interface()
+			if err := json.Unmarshal(bound, got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, request) {
+				back, _ := json.Marshal(got)
+				t.Errorf("the api lost fields of the request:\n sent  %s\n bound %s", sent, back)
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	controllersconfigs "github.com/kuro-jojo/kdi-k8s/controllers/configs"
+	controllersupdate "github.com/kuro-jojo/kdi-k8s/controllers/update"
+	"github.com/kuro-jojo/kdi-k8s/files/policy"
+	"github.com/kuro-jojo/kdi-k8s/models"
+	"github.com/kuro-jojo/kdi-k8s/rollout"
+	"github.com/kuro-jojo/kdi-k8s/shared/openapi"
+	"github.com/kuro-jojo/kdi-k8s/utils"
+	appsv1 "k8s.io/api/apps/v1"
+)
+
+// OpenAPIPath is the path of the OpenAPI document of the api
+const OpenAPIPath = BASE_API + "/openapi.json"
+
+const namespaced = BASE_API + "/resources/namespaces/:namespace"
+
+// deployForm is the multipart form of the deployments of uploaded files
+var deployForm = openapi.Fields{
+	"namespace":                "",
+	"wait":                     "",
+	"timeout":                  "",
+	policy.NameForPoliciesForm: "",
+}
+
+var usageResponse = openapi.Fields{"metricsAvailable": true, "message": ""}
+
+var statefulSetResponse = openapi.Fields{"message": "", "revisions": controllersupdate.StatefulSetRevisions{}}
+
+// Docs describes every route of the api, a route without entry fails the tests
+var Docs = openapi.Spec{
+	Title:       "KDI Kubernetes API",
+	Description: "Creates and manages the resources of the clusters. Every route except the document needs the token of a cluster.",
+	APIVersion:  "1.0.0",
+	BasePath:    BASE_API,
+	Operations: map[string]openapi.Operation{
+		openapi.Key(http.MethodGet, OpenAPIPath): {Summary: "OpenAPI document of the api", Tag: "docs", Response: openapi.Fields{}},
+		openapi.Key(http.MethodGet, BASE_API+"/auth"): {
+			Summary:  "Check the authentication to the cluster",
+			Tag:      "auth",
+			Response: openapi.Fields{"status": ""},
+		},
+
+		openapi.Key(http.MethodPost, BASE_API+"/resources/with-yaml"): {
+			Summary: "Create the objects of the uploaded yaml files",
+			Tag:     "files",
+			Form:    merge(deployForm, openapi.Fields{"files": []openapi.File{}}),
+			Response: openapi.Fields{
+				"messages": map[string][]string{},
+				"reasons":  map[string][]string{},
+				"results": []openapi.Fields{{
+					"object":     "",
+					"namespace":  "",
+					"file":       "",
+					"status":     0,
+					"message":    "",
+					"reason":     "",
+					"rollout":    rollout.Result{},
+					"violations": []policy.Violation{},
+				}},
+				"microservices": []models.Microservice{},
+				"size":          0,
+			},
+			Status: http.StatusCreated,
+		},
+		openapi.Key(http.MethodPost, BASE_API+"/resources/deployments/with-yaml"): {
+			Summary: "Create the deployment of the uploaded yaml file",
+			Tag:     "files",
+			Form:    openapi.Fields{"file": openapi.File{}, "namespace": "", policy.NameForPoliciesForm: ""},
+			Status:  http.StatusCreated,
+		},
+		openapi.Key(http.MethodPost, BASE_API+"/resources/services/with-yaml"): {
+			Summary: "Create the service of the uploaded yaml file",
+			Tag:     "files",
+			Form:    openapi.Fields{"file": openapi.File{}, "namespace": ""},
+			Status:  http.StatusCreated,
+		},
+
+		openapi.Key(http.MethodGet, BASE_API+"/resources/nodes/usage"): {
+			Summary:  "Resource usage of the nodes",
+			Tag:      "usage",
+			Response: merge(usageResponse, openapi.Fields{"nodes": []models.NodeUsage{}, "size": 0}),
+		},
+		openapi.Key(http.MethodGet, BASE_API+"/resources/inventory"): {
+			Summary:  "Inventory of the cluster",
+			Tag:      "cluster",
+			Response: openapi.Fields{"inventory": models.Inventory{}, "errors": map[string]utils.K8sError{}},
+		},
+
+		openapi.Key(http.MethodGet, BASE_API+"/resources/namespaces"): {
+			Summary:  "List the namespaces",
+			Tag:      "namespaces",
+			Response: openapi.Fields{"namespaces": []string{}},
+		},
+		openapi.Key(http.MethodGet, namespaced+"/usage"): {
+			Summary:  "Resource usage of the workloads of the namespace",
+			Tag:      "usage",
+			Response: merge(usageResponse, openapi.Fields{"workloads": []models.WorkloadUsage{}, "size": 0, "total": models.ResourceUsage{}}),
+		},
+
+		openapi.Key(http.MethodGet, namespaced+"/workloads"): {
+			Summary:  "List the workloads of the namespace",
+			Tag:      "workloads",
+			Query:    map[string]string{"kind": "Only list the workloads of this kind (deployments, statefulsets, daemonsets or cronjobs)"},
+			Response: openapi.Fields{"workloads": []models.Workload{}, "size": 0, "errors": map[string]utils.K8sError{}},
+		},
+		openapi.Key(http.MethodGet, namespaced+"/workloads/:kind/:name"): {
+			Summary:  "Get a workload",
+			Tag:      "workloads",
+			Response: openapi.Fields{"message": "", "workload": models.Workload{}},
+		},
+		openapi.Key(http.MethodGet, namespaced+"/workloads/:kind/:name/usage"): {
+			Summary:  "Resource usage of a workload",
+			Tag:      "usage",
+			Response: merge(usageResponse, openapi.Fields{"usage": models.WorkloadUsage{}}),
+		},
+
+		openapi.Key(http.MethodGet, namespaced+"/deployments/:deployment"): {
+			Summary:  "Get a deployment",
+			Tag:      "deployments",
+			Response: openapi.Fields{"message": "", "deployment": appsv1.Deployment{}},
+		},
+		openapi.Key(http.MethodPatch, namespaced+"/deployments/:deployment"): {
+			Summary:  "Update a deployment with a strategy",
+			Tag:      "deployments",
+			Request:  controllersupdate.UpdateForm{},
+			Response: openapi.Fields{"message": "", "rollout": rollout.Result{}},
+		},
+		openapi.Key(http.MethodPost, namespaced+"/deployments/:deployment/pause"): {
+			Summary:  "Pause the rollout of a deployment",
+			Tag:      "deployments",
+			Response: openapi.Fields{"message": "", "deployment": appsv1.Deployment{}},
+		},
+		openapi.Key(http.MethodPost, namespaced+"/deployments/:deployment/resume"): {
+			Summary:  "Resume the rollout of a deployment",
+			Tag:      "deployments",
+			Response: openapi.Fields{"message": "", "deployment": appsv1.Deployment{}},
+		},
+		openapi.Key(http.MethodPost, namespaced+"/deployments/:deployment/restart"): {
+			Summary:  "Restart the pods of a deployment",
+			Tag:      "deployments",
+			Response: openapi.Fields{"message": "", "restartedAt": "", "deployment": appsv1.Deployment{}},
+		},
+		openapi.Key(http.MethodPost, namespaced+"/deployments/:deployment/config-sources"): {
+			Summary:  "Add a configmap or a secret to the environment of the containers of a deployment",
+			Tag:      "configs",
+			Request:  controllersconfigs.ConfigSourceForm{},
+			Response: openapi.Fields{"message": "", "changed": true},
+		},
+		openapi.Key(http.MethodDelete, namespaced+"/deployments/:deployment/config-sources/:kind/:name"): {
+			Summary:  "Remove a configmap or a secret from the environment of the containers of a deployment",
+			Tag:      "configs",
+			Response: openapi.Fields{"message": "", "changed": true},
+		},
+
+		openapi.Key(http.MethodPatch, namespaced+"/statefulsets/:statefulset"): {
+			Summary:  "Update a statefulset and its update strategy",
+			Tag:      "statefulsets",
+			Request:  controllersupdate.StatefulSetUpdateForm{},
+			Response: statefulSetResponse,
+		},
+		openapi.Key(http.MethodGet, namespaced+"/statefulsets/:statefulset/revisions"): {
+			Summary:  "Revisions of the pods of a statefulset",
+			Tag:      "statefulsets",
+			Response: statefulSetResponse,
+		},
+		openapi.Key(http.MethodPut, namespaced+"/statefulsets/:statefulset/partition"): {
+			Summary:  "Move the partition of a statefulset",
+			Tag:      "statefulsets",
+			Request:  controllersupdate.PartitionForm{},
+			Response: statefulSetResponse,
+		},
+		openapi.Key(http.MethodPost, namespaced+"/statefulsets/:statefulset/pods/:ordinal/recycle"): {
+			Summary:  "Delete a pod of a statefulset so that it is recreated with the update revision",
+			Tag:      "statefulsets",
+			Response: statefulSetResponse,
+		},
+
+		openapi.Key(http.MethodGet, namespaced+"/configmaps"): {
+			Summary:  "List the configmaps",
+			Tag:      "configs",
+			Response: openapi.Fields{"configmaps": []controllersconfigs.ConfigMapSummary{}, "size": 0},
+		},
+		openapi.Key(http.MethodPost, namespaced+"/configmaps"): {
+			Summary:  "Create a configmap",
+			Tag:      "configs",
+			Request:  controllersconfigs.ConfigForm{},
+			Response: openapi.Fields{"message": "", "configmap": controllersconfigs.ConfigMapSummary{}},
+			Status:   http.StatusCreated,
+		},
+		openapi.Key(http.MethodGet, namespaced+"/configmaps/:name"): {
+			Summary:  "Get a configmap",
+			Tag:      "configs",
+			Response: openapi.Fields{"configmap": controllersconfigs.ConfigMapSummary{}},
+		},
+		openapi.Key(http.MethodPut, namespaced+"/configmaps/:name"): {
+			Summary:  "Replace the data of a configmap, created if missing",
+			Tag:      "configs",
+			Request:  controllersconfigs.ConfigForm{},
+			Response: openapi.Fields{"message": "", "configmap": controllersconfigs.ConfigMapSummary{}},
+		},
+		openapi.Key(http.MethodDelete, namespaced+"/configmaps/:name"): {
+			Summary: "Delete a configmap",
+			Tag:     "configs",
+		},
+
+		openapi.Key(http.MethodGet, namespaced+"/secrets"): {
+			Summary:  "List the secrets, without their values",
+			Tag:      "configs",
+			Response: openapi.Fields{"secrets": []controllersconfigs.SecretSummary{}, "size": 0},
+		},
+		openapi.Key(http.MethodPost, namespaced+"/secrets"): {
+			Summary:  "Create a secret",
+			Tag:      "configs",
+			Request:  controllersconfigs.ConfigForm{},
+			Response: openapi.Fields{"message": "", "secret": controllersconfigs.SecretSummary{}},
+			Status:   http.StatusCreated,
+		},
+		openapi.Key(http.MethodGet, namespaced+"/secrets/:name"): {
+			Summary:  "Get a secret, without its values",
+			Tag:      "configs",
+			Response: openapi.Fields{"secret": controllersconfigs.SecretSummary{}},
+		},
+		openapi.Key(http.MethodPut, namespaced+"/secrets/:name"): {
+			Summary:  "Replace the data of a secret, created if missing",
+			Tag:      "configs",
+			Request:  controllersconfigs.ConfigForm{},
+			Response: openapi.Fields{"message": "", "secret": controllersconfigs.SecretSummary{}},
+		},
+		openapi.Key(http.MethodDelete, namespaced+"/secrets/:name"): {
+			Summary: "Delete a secret",
+			Tag:     "configs",
+		},
+	},
+}
+
+// SetupDocs serves the OpenAPI document of the routes of the router
+func SetupDocs(router *gin.Engine) {
+	router.GET(OpenAPIPath, Docs.Handler(router.Routes))
+}
+
+func merge(fields ...openapi.Fields) openapi.Fields {
+	merged := make(openapi.Fields)
+	for _, f := range fields {
+		for name, value := range f {
+			merged[name] = value
+		}
+	}
+	return merged
+}
@@ -5,9 +5,13 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/kuro-jojo/kdi-k8s/auth"
+	controllersconfigs "github.com/kuro-jojo/kdi-k8s/controllers/configs"
 	controllersdeployments "github.com/kuro-jojo/kdi-k8s/controllers/deployments"
+	controllersinventory "github.com/kuro-jojo/kdi-k8s/controllers/inventory"
 	controllersnamespaces "github.com/kuro-jojo/kdi-k8s/controllers/namespaces"
+	controllersnodes "github.com/kuro-jojo/kdi-k8s/controllers/nodes"
 	controllersupdate "github.com/kuro-jojo/kdi-k8s/controllers/update"
+	controllersworkloads "github.com/kuro-jojo/kdi-k8s/controllers/workloads"
 	controllersfiles "github.com/kuro-jojo/kdi-k8s/files/controllers"
 )
 
@@ -33,6 +37,8 @@ func SetupRoutes(group *gin.RouterGroup) {
 		}
 		authenticated.POST("/resources/services/with-yaml", controllersfiles.CreateService)
 		authenticated.POST("/resources/with-yaml", controllersfiles.CreateMultipleRessources)
+		authenticated.GET("/resources/nodes/usage", controllersnodes.GetNodesUsage)
+		authenticated.GET("/resources/inventory", controllersinventory.GetClusterInventory)
 
 		// resources bounded to a namespace
 		namespaces := authenticated.Group("/resources/namespaces")
@@ -41,8 +47,34 @@ func SetupRoutes(group *gin.RouterGroup) {
 			// namespaces.GET("/:namespace", controllersdeployments.GetNamespace)
 			// namespaces.GET(":namespace/deployments", controllersdeployments.GetDeploymentsInNamespace)
 			namespaces.GET(":namespace/deployments/:deployment", controllersdeployments.GetDeploymentInNamespace)
+			namespaces.GET(":namespace/workloads", controllersworkloads.GetWorkloadsInNamespace)
+			namespaces.GET(":namespace/workloads/:kind/:name", controllersworkloads.GetWorkloadInNamespace)
+			namespaces.GET(":namespace/workloads/:kind/:name/usage", controllersworkloads.GetWorkloadUsage)
+			namespaces.GET(":namespace/usage", controllersworkloads.GetNamespaceUsage)
 
 			namespaces.PATCH(":namespace/deployments/:deployment", controllersupdate.UpdateDeployment)
+			namespaces.POST(":namespace/deployments/:deployment/pause", controllersdeployments.PauseDeployment)
+			namespaces.POST(":namespace/deployments/:deployment/resume", controllersdeployments.ResumeDeployment)
+			namespaces.POST(":namespace/deployments/:deployment/restart", controllersdeployments.RestartDeployment)
+			namespaces.POST(":namespace/deployments/:deployment/config-sources", controllersconfigs.AttachConfigSource)
+			namespaces.DELETE(":namespace/deployments/:deployment/config-sources/:kind/:name", controllersconfigs.DetachConfigSource)
+
+			namespaces.PATCH(":namespace/statefulsets/:statefulset", controllersupdate.UpdateStatefulSet)
+			namespaces.GET(":namespace/statefulsets/:statefulset/revisions", controllersupdate.GetStatefulSetRevisions)
+			namespaces.PUT(":namespace/statefulsets/:statefulset/partition", controllersupdate.SetStatefulSetPartition)
+			namespaces.POST(":namespace/statefulsets/:statefulset/pods/:ordinal/recycle", controllersupdate.RecyclePod)
+
+			namespaces.GET(":namespace/configmaps", controllersconfigs.GetConfigMaps)
+			namespaces.POST(":namespace/configmaps", controllersconfigs.CreateConfigMap)
+			namespaces.GET(":namespace/configmaps/:name", controllersconfigs.GetConfigMap)
+			namespaces.PUT(":namespace/configmaps/:name", controllersconfigs.UpdateConfigMap)
+			namespaces.DELETE(":namespace/configmaps/:name", controllersconfigs.DeleteConfigMap)
+
+			namespaces.GET(":namespace/secrets", controllersconfigs.GetSecrets)
+			namespaces.POST(":namespace/secrets", controllersconfigs.CreateSecret)
+			namespaces.GET(":namespace/secrets/:name", controllersconfigs.GetSecret)
+			namespaces.PUT(":namespace/secrets/:name", controllersconfigs.UpdateSecret)
+			namespaces.DELETE(":namespace/secrets/:name", controllersconfigs.DeleteSecret)
 		}
 	}
 }
@@ -2,11 +2,16 @@ package server
 
 import (
 	"log"
+	"net/http"
 	"os"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/kuro-jojo/kdi-k8s/metrics"
+	"github.com/kuro-jojo/kdi-k8s/shared/graceful"
+	"github.com/kuro-jojo/kdi-k8s/shared/httpmetrics"
+	"github.com/kuro-jojo/kdi-k8s/shared/logging"
 )
 
 const BASE_API = "/api/v1"
@@ -20,7 +25,7 @@ func Init() {
 
 	log.Printf("Starting server on port: %s\n", port)
 
-	r.Run(": " + port)
+	graceful.Serve(&http.Server{Addr: ":" + port, Handler: r}, graceful.GracePeriod(), nil)
 }
 
 // NewRouter : Function with routes
@@ -36,12 +41,21 @@ func NewRouter() *gin.Engine {
 		AllowCredentials: true,
 		MaxAge:           1 * time.Hour,
 	}))
-	router.Use(gin.Logger())
+	router.Use(logging.Middleware(), logging.ClusterMiddleware())
 	router.Use(gin.Recovery())
+	router.Use(metrics.Requests.Middleware())
+
+	// the metrics are only exposed to the scrapers knowing the token
+	if token := os.Getenv("KDI_METRICS_TOKEN"); token != "" {
+		router.GET(httpmetrics.Path, httpmetrics.Handler(token))
+	} else {
+		log.Println("KDI_METRICS_TOKEN is not set, the metrics endpoint is disabled")
+	}
 
 	// routes for kubernetes service
 	kubernetesRouter := router.Group(BASE_API)
 	SetupRoutes(kubernetesRouter)
+	SetupDocs(router)
 
 	return router
 }
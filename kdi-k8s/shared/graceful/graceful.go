@@ -0,0 +1,97 @@
+package graceful
+
+// This file stops the web api and the kubernetes api gracefully: the in-flight requests are given a grace period
+// to finish, the ones still running after it are interrupted through their context so that they stop at a safe
+// checkpoint (between two objects of an apply, before switching the traffic of a blue/green update...) and respond.
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// DefaultGracePeriod is the time given to the in-flight requests and operations to finish once the server is asked to stop
+	DefaultGracePeriod = 25 * time.Second
+	// InterruptGracePeriod is the time given to the requests still running after the grace period to stop and respond
+	InterruptGracePeriod = 5 * time.Second
+)
+
+// GracePeriod returns the grace period set by KDI_SHUTDOWN_GRACE_PERIOD (45s, 2m...) or the default one
+func GracePeriod() time.Duration {
+	value := os.Getenv("KDI_SHUTDOWN_GRACE_PERIOD")
+	if value == "" {
+		return DefaultGracePeriod
+	}
+	grace, err := time.ParseDuration(value)
+	if err != nil || grace < 0 {
+		log.Printf("Invalid KDI_SHUTDOWN_GRACE_PERIOD %q, using %v", value, DefaultGracePeriod)
+		return DefaultGracePeriod
+	}
+	return grace
+}
+
+// Serve serves the requests until the process receives SIGINT or SIGTERM, then shuts the server down gracefully.
+// drain, if not nil, runs alongside the shutdown of the server, its context expires at the end of the grace period.
+func Serve(srv *http.Server, grace time.Duration, drain func(ctx context.Context)) {
+	// the requests still running at the end of the grace period are interrupted through their context
+	base, interrupt := context.WithCancel(context.Background())
+	defer interrupt()
+	srv.BaseContext = func(net.Listener) context.Context { return base }
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.ListenAndServe()
+	}()
+	select {
+	case err := <-errs:
+		log.Fatalf("Error starting server: %v", err)
+	case <-ctx.Done():
+	}
+	// a second signal kills the process
+	stop()
+
+	shutdown(srv, interrupt, grace, drain)
+}
+
+// shutdown stops accepting requests and waits for the in-flight ones during the grace period,
+// the ones still running after it are interrupted.
+func shutdown(srv *http.Server, interrupt context.CancelFunc, grace time.Duration, drain func(ctx context.Context)) {
+	log.Printf("Shutting down, waiting up to %v for the in-flight requests", grace)
+	graceCtx, cancelGrace := context.WithTimeout(context.Background(), grace)
+	defer cancelGrace()
+	ctx, cancel := context.WithTimeout(context.Background(), grace+InterruptGracePeriod)
+	defer cancel()
+
+	timer := time.AfterFunc(grace, func() {
+		log.Println("Grace period expired, interrupting the requests still running")
+		interrupt()
+	})
+	defer timer.Stop()
+
+	var wg sync.WaitGroup
+	if drain != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			drain(graceCtx)
+		}()
+	}
+
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("Error shutting down the server, closing the remaining connections: %v", err)
+		srv.Close()
+	} else {
+		log.Println("Server stopped")
+	}
+	wg.Wait()
+}
@@ -0,0 +1,106 @@
+package graceful
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestGracePeriod(t *testing.T) {
+	tests := map[string]time.Duration{
+		"":      DefaultGracePeriod,
+		"45s":   45 * time.Second,
+		"0s":    0,
+		"-1s":   DefaultGracePeriod,
+		"never": DefaultGracePeriod,
+	}
+	for value, want := range tests {
+		t.Setenv("KDI_SHUTDOWN_GRACE_PERIOD", value)
+		if got := GracePeriod(); got != want {
+			t.Errorf("GracePeriod() with %q = %v, want %v", value, got, want)
+		}
+	}
+}
+
+// start serves the handler like Serve and returns the url of the server and the interruption of its requests
+func start(t *testing.T, handler http.HandlerFunc) (*http.Server, string, context.CancelFunc) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, interrupt := context.WithCancel(context.Background())
+	t.Cleanup(interrupt)
+	srv := &http.Server{Handler: handler, BaseContext: func(net.Listener) context.Context { return base }}
+	go srv.Serve(listener)
+	return srv, "http://" + listener.Addr().String(), interrupt
+}
+
+func TestShutdownWaitsForTheRequests(t *testing.T) {
+	started := make(chan struct{})
+	srv, url, interrupt := start(t, func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(50 * time.Millisecond)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	status := make(chan int, 1)
+	go func() {
+		resp, err := http.Get(url)
+		if err != nil {
+			status <- 0
+			return
+		}
+		resp.Body.Close()
+		status <- resp.StatusCode
+	}()
+	<-started
+
+	drained := false
+	shutdown(srv, interrupt, time.Second, func(ctx context.Context) { drained = true })
+	if got := <-status; got != http.StatusNoContent {
+		t.Errorf("status = %d, want the response of the request", got)
+	}
+	if !drained {
+		t.Error("drain was not called")
+	}
+}
+
+func TestShutdownInterruptsTheRequestsAfterTheGracePeriod(t *testing.T) {
+	started := make(chan struct{})
+	interrupted := make(chan error, 1)
+	srv, url, interrupt := start(t, func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		// the request stops at its checkpoint once interrupted
+		<-r.Context().Done()
+		interrupted <- r.Context().Err()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	go http.Get(url)
+	<-started
+
+	var drainErr error
+	begin := time.Now()
+	shutdown(srv, interrupt, 20*time.Millisecond, func(ctx context.Context) {
+		<-ctx.Done()
+		drainErr = ctx.Err()
+	})
+	if err := <-interrupted; !errors.Is(err, context.Canceled) {
+		t.Errorf("request context = %v, want canceled", err)
+	}
+	if !errors.Is(drainErr, context.DeadlineExceeded) {
+		t.Errorf("drain context = %v, want the end of the grace period", drainErr)
+	}
+	if elapsed := time.Since(begin); elapsed > InterruptGracePeriod {
+		t.Errorf("shutdown took %v", elapsed)
+	}
+}
+
+func TestShutdownWithoutDrain(t *testing.T) {
+	srv, _, interrupt := start(t, func(w http.ResponseWriter, r *http.Request) {})
+	shutdown(srv, interrupt, time.Second, nil)
+}
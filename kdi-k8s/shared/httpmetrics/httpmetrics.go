@@ -0,0 +1,73 @@
+package httpmetrics
+
+// This file exposes the metrics of the http requests of the web api and the kubernetes api in the prometheus format.
+// Each api registers its requests under its own namespace and keeps its other metrics in its metrics package.
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Path is the path of the metrics endpoint
+const Path = "/metrics"
+
+// Requests counts the http requests of an api and observes their duration
+type Requests struct {
+	total    *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+// NewRequests registers the metrics of the requests of the api with the namespace (kdi_web, kdi_k8s)
+func NewRequests(namespace string) *Requests {
+	return &Requests{
+		total: promauto.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "Number of http requests by route and status.",
+		}, []string{"method", "route", "status"}),
+		duration: promauto.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Duration of the http requests by route and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+	}
+}
+
+// Middleware counts the requests and observes their duration.
+// The route is the pattern of the matched route so that the cardinality stays bounded.
+func (r *Requests) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		r.total.WithLabelValues(c.Request.Method, route, status).Inc()
+		r.duration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Handler serves the metrics to the clients presenting the token as a bearer token
+func Handler(token string) gin.HandlerFunc {
+	handler := promhttp.Handler()
+	return func(c *gin.Context) {
+		provided, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Unauthorized"})
+			return
+		}
+		handler.ServeHTTP(c.Writer, c.Request)
+	}
+}
@@ -0,0 +1,64 @@
+package httpmetrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var requests = NewRequests("kdi_test")
+
+func newRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(requests.Middleware())
+	router.GET("/items/:id", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	router.GET(Path, Handler("secret"))
+	return router
+}
+
+func TestMiddlewareCountsByRoute(t *testing.T) {
+	router := newRouter()
+	for _, path := range []string{"/items/1", "/items/2", "/unknown"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	if got := testutil.ToFloat64(requests.total.WithLabelValues(http.MethodGet, "/items/:id", "204")); got != 2 {
+		t.Errorf("requests of the route = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(requests.total.WithLabelValues(http.MethodGet, "unmatched", "404")); got != 1 {
+		t.Errorf("unmatched requests = %v, want 1", got)
+	}
+}
+
+func TestHandlerNeedsTheToken(t *testing.T) {
+	router := newRouter()
+	tests := []struct {
+		name          string
+		authorization string
+		status        int
+	}{
+		{"no token", "", http.StatusUnauthorized},
+		{"wrong token", "Bearer other", http.StatusUnauthorized},
+		{"not a bearer token", "secret", http.StatusUnauthorized},
+		{"token", "Bearer secret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, Path, nil)
+			req.Header.Set("Authorization", tt.authorization)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if tt.status == http.StatusOK && !strings.Contains(w.Body.String(), "kdi_test_http_requests_total") {
+				t.Error("the metrics of the requests are not served")
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package logging
+
+// This file sets up the structured logging of the web api and the kubernetes api.
+// Each request gets a logger carrying its request id, sent by the web api to the kubernetes api, completed with
+// the user, teamspace, cluster and namespace once they are known, so that one action can be followed across the apis.
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kuro-jojo/kdi-k8s/client"
+)
+
+const (
+	// RequestIDHeader is the header carrying the request id between the services
+	RequestIDHeader = client.RequestIDHeader
+	// ClusterIDHeader is the header carrying the id of the cluster of the request, set by the web api
+	ClusterIDHeader = client.ClusterIDHeader
+)
+
+// Keys of the fields of the logs
+const (
+	KeyRequestID   = "request_id"
+	KeyUserID      = "user_id"
+	KeyTeamspace   = "teamspace"
+	KeyClusterID   = "cluster_id"
+	KeyClusterType = "cluster_type"
+	KeyNamespace   = "namespace"
+	KeyOperationID = "operation_id"
+)
+
+type contextKey struct{}
+
+type requestIDKey struct{}
+
+// Init makes a JSON logger the default one, the lines of the log package go through it.
+// The level is read from KDI_LOG_LEVEL (debug, info, warn or error).
+func Init() {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(os.Getenv("KDI_LOG_LEVEL"))); err != nil {
+		level = slog.LevelInfo
+	}
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: level})))
+}
+
+// NewRequestID returns a random request id
+func NewRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// WithRequestID returns a context carrying the request id and a logger with it
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	ctx = context.WithValue(ctx, requestIDKey{}, requestID)
+	return NewContext(ctx, FromContext(ctx).With(KeyRequestID, requestID))
+}
+
+// RequestID returns the request id of the context, empty if there is none
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// NewContext returns a context carrying the logger
+func NewContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the logger of the context or the default one
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// With adds the fields to the logger of the request, the empty values are ignored
+func With(c *gin.Context, args ...any) {
+	fields := make([]any, 0, len(args))
+	for i := 0; i+1 < len(args); i += 2 {
+		if s, ok := args[i+1].(string); ok && s == "" {
+			continue
+		}
+		fields = append(fields, args[i], args[i+1])
+	}
+	if len(fields) == 0 {
+		return
+	}
+	ctx := c.Request.Context()
+	c.Request = c.Request.WithContext(NewContext(ctx, FromContext(ctx).With(fields...)))
+}
+
+// Logger returns the logger of the request
+func Logger(c *gin.Context) *slog.Logger {
+	return FromContext(c.Request.Context())
+}
+
+// Middleware gives a request id to each request, the one sent by the client if it is valid, and logs the requests
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validID(requestID) {
+			requestID = NewRequestID()
+		}
+		c.Request = c.Request.WithContext(WithRequestID(c.Request.Context(), requestID))
+		c.Header(RequestIDHeader, requestID)
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		level := slog.LevelInfo
+		switch {
+		case c.Writer.Status() >= 500:
+			level = slog.LevelError
+		case c.Writer.Status() >= 400:
+			level = slog.LevelWarn
+		}
+		Logger(c).LogAttrs(c.Request.Context(), level, "request",
+			slog.String("method", c.Request.Method),
+			slog.String("route", route),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", c.Writer.Status()),
+			slog.Duration("duration", time.Since(start)),
+			slog.String("client_ip", c.ClientIP()),
+		)
+	}
+}
+
+// ClusterMiddleware adds the cluster sent by the web api and the namespace of the route to the logger of the request,
+// it follows Middleware in the kubernetes api
+func ClusterMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		clusterID := c.GetHeader(ClusterIDHeader)
+		if !validID(clusterID) {
+			clusterID = ""
+		}
+		// the namespace of the namespaced routes, the one of the forms is added by their handlers
+		With(c, KeyClusterID, clusterID, KeyNamespace, c.Param("namespace"))
+	}
+}
+
+// validID tells if an id sent by a client can be kept, it ends up in the logs so its size and characters are limited
+func validID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	return strings.Trim(id, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_.") == ""
+}
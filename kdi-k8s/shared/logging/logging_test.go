@@ -0,0 +1,86 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// record serves the request and returns the fields of the request line
+func record(t *testing.T, router *gin.Engine, req *http.Request) (*httptest.ResponseRecorder, map[string]any) {
+	t.Helper()
+	var buf bytes.Buffer
+	defer func(logger *slog.Logger) { slog.SetDefault(logger) }(slog.Default())
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var fields map[string]any
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &fields); err != nil {
+		t.Fatalf("invalid log line %q: %v", buf.String(), err)
+	}
+	return w, fields
+}
+
+func TestMiddlewareRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Middleware())
+	router.GET("/items/:id", func(c *gin.Context) {
+		With(c, KeyUserID, "user-1", KeyTeamspace, "")
+		c.Status(http.StatusNotFound)
+	})
+
+	tests := []struct {
+		name, sent string
+		kept       bool
+	}{
+		{"valid id", "req-1", true},
+		{"no id", "", false},
+		{"invalid characters", "req 1\n", false},
+		{"too long", strings.Repeat("a", 65), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/items/1", nil)
+			req.Header.Set(RequestIDHeader, tt.sent)
+			w, fields := record(t, router, req)
+
+			id := w.Header().Get(RequestIDHeader)
+			if tt.kept != (id == tt.sent) || id == "" {
+				t.Errorf("request id = %q, sent %q", id, tt.sent)
+			}
+			if fields[KeyRequestID] != id {
+				t.Errorf("logged request id = %v, want %s", fields[KeyRequestID], id)
+			}
+			if fields[KeyUserID] != "user-1" || fields["route"] != "/items/:id" || fields["level"] != "WARN" {
+				t.Errorf("fields = %v", fields)
+			}
+			if _, ok := fields[KeyTeamspace]; ok {
+				t.Error("the empty values should not be logged")
+			}
+		})
+	}
+}
+
+func TestClusterMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Middleware(), ClusterMiddleware())
+	router.GET("/namespaces/:namespace", func(c *gin.Context) {})
+
+	req := httptest.NewRequest(http.MethodGet, "/namespaces/default", nil)
+	req.Header.Set(ClusterIDHeader, "cluster-1")
+	_, fields := record(t, router, req)
+	if fields[KeyClusterID] != "cluster-1" || fields[KeyNamespace] != "default" {
+		t.Errorf("fields = %v", fields)
+	}
+}
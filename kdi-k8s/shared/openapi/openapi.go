@@ -0,0 +1,354 @@
+package openapi
+
+// This file generates the OpenAPI 3 document of the api from the gin routes and the documented operations.
+// The schemas of the bodies are generated from the go types with their json tags.
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const Version = "3.0.3"
+
+// Operation documents a route
+type Operation struct {
+	Summary  string
+	Tag      string
+	Query    map[string]string // The query parameters with their description
+	Request  any               // The json body, nil if the route has none
+	Form     Fields            // The multipart form fields, used instead of Request
+	Response any               // The body of the success response, a message if nil
+	Status   int               // The status of the success response, 200 if 0
+}
+
+// Fields describes an object built with gin.H : the schema of each field is the one of its value
+type Fields map[string]any
+
+// File is a file of a multipart form
+type File struct{}
+
+// Message is the body of the responses only made of a message
+type Message struct {
+	Message string `json:"message"`
+}
+
+// Error is the body of the error responses
+type Error struct {
+	Message string `json:"message"`
+	Reason  string `json:"reason,omitempty"` // The reason code of the error (NotFound, Conflict, Invalid...)
+}
+
+// Spec is the description of the api
+type Spec struct {
+	Title       string
+	Description string
+	APIVersion  string
+	BasePath    string               // The prefix of the routes removed from the paths, set as the server url
+	Operations  map[string]Operation // The documented operations by Key
+}
+
+// Key returns the key of the operation of a route, with the gin syntax for the path parameters
+func Key(method string, path string) string {
+	return method + " " + path
+}
+
+// Undocumented returns the keys of the routes without operation
+func (s Spec) Undocumented(routes gin.RoutesInfo) []string {
+	keys := make([]string, 0)
+	for _, route := range routes {
+		if _, ok := s.Operations[Key(route.Method, route.Path)]; !ok {
+			keys = append(keys, Key(route.Method, route.Path))
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Stale returns the keys of the operations without route
+func (s Spec) Stale(routes gin.RoutesInfo) []string {
+	registered := make(map[string]bool, len(routes))
+	for _, route := range routes {
+		registered[Key(route.Method, route.Path)] = true
+	}
+	keys := make([]string, 0)
+	for key := range s.Operations {
+		if !registered[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Document returns the OpenAPI document of the documented routes
+func (s Spec) Document(routes gin.RoutesInfo) map[string]any {
+	g := &generator{schemas: make(map[string]any), names: make(map[reflect.Type]string)}
+	paths := make(map[string]map[string]any)
+
+	for _, route := range routes {
+		operation, ok := s.Operations[Key(route.Method, route.Path)]
+		if !ok || !strings.HasPrefix(route.Path, s.BasePath) {
+			continue
+		}
+		path, parameters := convertPath(strings.TrimPrefix(route.Path, s.BasePath))
+		if path == "" {
+			path = "/"
+		}
+		if paths[path] == nil {
+			paths[path] = make(map[string]any)
+		}
+		paths[path][strings.ToLower(route.Method)] = g.operation(operation, parameters)
+	}
+
+	return map[string]any{
+		"openapi": Version,
+		"info": map[string]any{
+			"title":       s.Title,
+			"description": s.Description,
+			"version":     s.APIVersion,
+		},
+		"servers":    []any{map[string]any{"url": s.BasePath}},
+		"paths":      paths,
+		"components": map[string]any{"schemas": g.schemas},
+	}
+}
+
+// Handler serves the document, generated once from the routes
+func (s Spec) Handler(routes func() gin.RoutesInfo) gin.HandlerFunc {
+	var once sync.Once
+	var document []byte
+	return func(c *gin.Context) {
+		once.Do(func() {
+			var err error
+			if document, err = json.Marshal(s.Document(routes())); err != nil {
+				document = nil
+			}
+		})
+		if document == nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error generating the OpenAPI document"})
+			return
+		}
+		c.Data(http.StatusOK, "application/json", document)
+	}
+}
+
+// convertPath returns the path with the OpenAPI syntax for the parameters (:id -> {id}) and the parameters
+func convertPath(path string) (string, []string) {
+	parts := strings.Split(path, "/")
+	parameters := make([]string, 0)
+	for i, part := range parts {
+		if strings.HasPrefix(part, ":") || strings.HasPrefix(part, "*") {
+			parameters = append(parameters, part[1:])
+			parts[i] = "{" + part[1:] + "}"
+		}
+	}
+	return strings.Join(parts, "/"), parameters
+}
+
+type generator struct {
+	schemas map[string]any
+	names   map[reflect.Type]string
+}
+
+func (g *generator) operation(operation Operation, pathParameters []string) map[string]any {
+	parameters := make([]any, 0)
+	for _, name := range pathParameters {
+		parameters = append(parameters, map[string]any{"name": name, "in": "path", "required": true, "schema": map[string]any{"type": "string"}})
+	}
+	queries := make([]string, 0, len(operation.Query))
+	for name := range operation.Query {
+		queries = append(queries, name)
+	}
+	sort.Strings(queries)
+	for _, name := range queries {
+		parameters = append(parameters, map[string]any{"name": name, "in": "query", "description": operation.Query[name], "schema": map[string]any{"type": "string"}})
+	}
+
+	status := operation.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	response := operation.Response
+	if response == nil {
+		response = Message{}
+	}
+
+	o := map[string]any{
+		"summary":    operation.Summary,
+		"parameters": parameters,
+		"responses": map[string]any{
+			strconv.Itoa(status): map[string]any{
+				"description": http.StatusText(status),
+				"content":     map[string]any{"application/json": map[string]any{"schema": g.schema(response)}},
+			},
+			"default": map[string]any{
+				"description": "Error",
+				"content":     map[string]any{"application/json": map[string]any{"schema": g.schema(Error{})}},
+			},
+		},
+	}
+	if operation.Tag != "" {
+		o["tags"] = []string{operation.Tag}
+	}
+	switch {
+	case operation.Form != nil:
+		o["requestBody"] = map[string]any{
+			"required": true,
+			"content":  map[string]any{"multipart/form-data": map[string]any{"schema": g.schema(operation.Form)}},
+		}
+	case operation.Request != nil:
+		o["requestBody"] = map[string]any{
+			"required": true,
+			"content":  map[string]any{"application/json": map[string]any{"schema": g.schema(operation.Request)}},
+		}
+	}
+	return o
+}
+
+// schema returns the schema of a value, the Fields are described by the values of their fields.
+// A list of objects built with gin.H is described by a slice holding a single Fields.
+func (g *generator) schema(v any) map[string]any {
+	if list, ok := v.([]Fields); ok && len(list) == 1 {
+		return map[string]any{"type": "array", "items": g.schema(list[0])}
+	}
+	fields, ok := v.(Fields)
+	if !ok {
+		return g.typeSchema(reflect.TypeOf(v))
+	}
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	properties := make(map[string]any, len(fields))
+	for _, name := range names {
+		if fields[name] == nil {
+			properties[name] = map[string]any{}
+			continue
+		}
+		properties[name] = g.schema(fields[name])
+	}
+	return map[string]any{"type": "object", "properties": properties}
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	fileType      = reflect.TypeOf(File{})
+	marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+func (g *generator) typeSchema(t reflect.Type) map[string]any {
+	if t == nil {
+		return map[string]any{}
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t == fileType:
+		return map[string]any{"type": "string", "format": "binary"}
+	case t.Kind() != reflect.Slice && t.Kind() != reflect.Map && (t.Implements(marshalerType) || reflect.PointerTo(t).Implements(marshalerType)):
+		// the types with their own json encoding (ids, quantities, times...) are encoded as strings
+		return map[string]any{"type": "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": g.typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.typeSchema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + g.component(t)}
+	}
+	return map[string]any{}
+}
+
+// component registers the schema of the named struct and returns its name
+func (g *generator) component(t reflect.Type) string {
+	if name, ok := g.names[t]; ok {
+		return name
+	}
+	pkg := t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:]
+	name := strings.NewReplacer("[", "_", "]", "", "*", "", "/", "_").Replace(pkg + "." + t.Name())
+	for taken := true; taken; {
+		_, taken = g.schemas[name]
+		if taken {
+			name += "_"
+		}
+	}
+	g.names[t] = name
+	// the name is reserved before generating the fields for the recursive types
+	g.schemas[name] = map[string]any{}
+	g.schemas[name] = g.structSchema(t)
+	return name
+}
+
+func (g *generator) structSchema(t reflect.Type) map[string]any {
+	properties := make(map[string]any)
+	required := make([]string, 0)
+	g.addFields(t, properties, &required)
+	s := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		sort.Strings(required)
+		s["required"] = required
+	}
+	return s
+}
+
+func (g *generator) addFields(t reflect.Type, properties map[string]any, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+
+		// the fields of the embedded structs are promoted
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				g.addFields(ft, properties, required)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = g.typeSchema(field.Type)
+		if strings.Contains(field.Tag.Get("binding"), "required") && !strings.Contains(options, "omitempty") {
+			*required = append(*required, name)
+		}
+	}
+}
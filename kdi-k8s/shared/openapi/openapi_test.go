@@ -0,0 +1,205 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type item struct {
+	ID       string    `json:"id"`
+	Name     string    `json:"name" binding:"required"`
+	Comment  string    `json:"comment,omitempty" binding:"required"`
+	Created  time.Time `json:"created"`
+	Children []item    `json:"children"`
+	Data     []byte    `json:"data"`
+	Hidden   string    `json:"-"`
+	embedded
+}
+
+type embedded struct {
+	Replicas int32 `json:"replicas"`
+}
+
+var spec = Spec{
+	Title:      "test",
+	APIVersion: "1.0",
+	BasePath:   "/api/v1",
+	Operations: map[string]Operation{
+		Key(http.MethodGet, "/api/v1/items"):              {Summary: "List the items", Tag: "items", Query: map[string]string{"name": "The name"}, Response: []item{}},
+		Key(http.MethodPost, "/api/v1/items"):             {Summary: "Create an item", Request: item{}, Response: Fields{"id": ""}, Status: http.StatusCreated},
+		Key(http.MethodPost, "/api/v1/items/:id/files"):   {Summary: "Upload a file", Form: Fields{"file": File{}}},
+		Key(http.MethodDelete, "/api/v1/items/:id/*path"): {Summary: "Delete a file"},
+		Key(http.MethodGet, "/api/v1/removed"):            {Summary: "A removed route"},
+	},
+}
+
+func routes() gin.RoutesInfo {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	ok := func(c *gin.Context) {}
+	group := router.Group("/api/v1")
+	group.GET("items", ok)
+	group.POST("items", ok)
+	group.POST("items/:id/files", ok)
+	group.DELETE("items/:id/*path", ok)
+	group.PATCH("items/:id", ok)
+	return router.Routes()
+}
+
+// lookup returns the value at the path of keys in the decoded document
+func lookup(t *testing.T, v any, keys ...string) any {
+	t.Helper()
+	for _, key := range keys {
+		m, ok := v.(map[string]any)
+		if !ok {
+			t.Fatalf("%s is not in an object", key)
+		}
+		if v, ok = m[key]; !ok {
+			t.Fatalf("%s not found in %v", key, m)
+		}
+	}
+	return v
+}
+
+func document(t *testing.T) map[string]any {
+	t.Helper()
+	// the document is encoded like the one served
+	b, err := json.Marshal(spec.Document(routes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var d map[string]any
+	if err := json.Unmarshal(b, &d); err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestUndocumentedAndStale(t *testing.T) {
+	if got, want := spec.Undocumented(routes()), []string{"PATCH /api/v1/items/:id"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Undocumented() = %v, want %v", got, want)
+	}
+	if got, want := spec.Stale(routes()), []string{"GET /api/v1/removed"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Stale() = %v, want %v", got, want)
+	}
+}
+
+func TestDocumentPaths(t *testing.T) {
+	d := document(t)
+	if d["openapi"] != Version {
+		t.Errorf("openapi = %v, want %s", d["openapi"], Version)
+	}
+	if url := lookup(t, d["servers"].([]any)[0], "url"); url != "/api/v1" {
+		t.Errorf("server url = %v", url)
+	}
+
+	paths := lookup(t, d, "paths").(map[string]any)
+	for _, path := range []string{"/items", "/items/{id}/files", "/items/{id}/{path}"} {
+		if _, ok := paths[path]; !ok {
+			t.Errorf("%s is not documented", path)
+		}
+	}
+	if _, ok := paths["/removed"]; ok {
+		t.Error("an operation without route is documented")
+	}
+	if _, ok := paths["/items/{id}"]; ok {
+		t.Error("a route without operation is documented")
+	}
+
+	parameters := lookup(t, paths, "/items/{id}/{path}", "delete", "parameters").([]any)
+	if len(parameters) != 2 || lookup(t, parameters[1], "name") != "path" || lookup(t, parameters[1], "in") != "path" {
+		t.Errorf("parameters = %v, want id and path", parameters)
+	}
+	query := lookup(t, paths, "/items", "get", "parameters").([]any)
+	if len(query) != 1 || lookup(t, query[0], "in") != "query" || lookup(t, query[0], "description") != "The name" {
+		t.Errorf("query parameters = %v", query)
+	}
+	if tags := lookup(t, paths, "/items", "get", "tags").([]any); len(tags) != 1 || tags[0] != "items" {
+		t.Errorf("tags = %v", tags)
+	}
+}
+
+func TestDocumentResponses(t *testing.T) {
+	d := document(t)
+	paths := lookup(t, d, "paths")
+
+	// the default status is 200 and the default body a message
+	message := lookup(t, paths, "/items/{id}/{path}", "delete", "responses", "200", "content", "application/json", "schema")
+	if lookup(t, message, "$ref") != "#/components/schemas/openapi.Message" {
+		t.Errorf("default response = %v", message)
+	}
+	created := lookup(t, paths, "/items", "post", "responses", "201", "content", "application/json", "schema")
+	if lookup(t, created, "type") != "object" || lookup(t, created, "properties", "id", "type") != "string" {
+		t.Errorf("fields response = %v", created)
+	}
+	list := lookup(t, paths, "/items", "get", "responses", "200", "content", "application/json", "schema")
+	if lookup(t, list, "type") != "array" || lookup(t, list, "items", "$ref") != "#/components/schemas/openapi.item" {
+		t.Errorf("list response = %v", list)
+	}
+	failure := lookup(t, paths, "/items", "get", "responses", "default", "content", "application/json", "schema")
+	if lookup(t, failure, "$ref") != "#/components/schemas/openapi.Error" {
+		t.Errorf("error response = %v", failure)
+	}
+	form := lookup(t, paths, "/items/{id}/files", "post", "requestBody", "content", "multipart/form-data", "schema")
+	if lookup(t, form, "properties", "file", "format") != "binary" {
+		t.Errorf("form = %v", form)
+	}
+}
+
+func TestDocumentSchemas(t *testing.T) {
+	schema := lookup(t, document(t), "components", "schemas", "openapi.item")
+	properties := lookup(t, schema, "properties").(map[string]any)
+
+	for name, want := range map[string]string{"id": "string", "replicas": "integer", "children": "array"} {
+		if got := lookup(t, properties, name, "type"); got != want {
+			t.Errorf("type of %s = %v, want %s", name, got, want)
+		}
+	}
+	if got := lookup(t, properties, "created", "format"); got != "date-time" {
+		t.Errorf("format of a time = %v", got)
+	}
+	if got := lookup(t, properties, "data", "format"); got != "byte" {
+		t.Errorf("format of the bytes = %v", got)
+	}
+	// the recursive types refer to their own component
+	if got := lookup(t, properties, "children", "items", "$ref"); got != "#/components/schemas/openapi.item" {
+		t.Errorf("children = %v", got)
+	}
+	for _, name := range []string{"Hidden", "-", "embedded"} {
+		if _, ok := properties[name]; ok {
+			t.Errorf("%s should not be a property", name)
+		}
+	}
+	// the omitted fields are not required even with a binding
+	if required := lookup(t, schema, "required").([]any); len(required) != 1 || required[0] != "name" {
+		t.Errorf("required = %v, want [name]", required)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	calls := 0
+	handler := spec.Handler(func() gin.RoutesInfo {
+		calls++
+		return routes()
+	})
+	for range 2 {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		handler(c)
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/json" {
+			t.Fatalf("status %d, content type %q", w.Code, w.Header().Get("Content-Type"))
+		}
+		if !json.Valid(w.Body.Bytes()) {
+			t.Fatalf("invalid document: %s", w.Body.String())
+		}
+	}
+	if calls != 1 {
+		t.Errorf("the document was generated %d times, want once", calls)
+	}
+}
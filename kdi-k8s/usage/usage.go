@@ -0,0 +1,173 @@
+package usage
+
+// This file reads the cpu and memory used by the pods and the nodes from the metrics api served by metrics-server
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/kuro-jojo/kdi-k8s/models"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+const MetricsAPIPath = "/apis/metrics.k8s.io/v1beta1"
+
+// UnavailableMessage is returned instead of the usage when the metrics api cannot be queried
+const UnavailableMessage = "the metrics api is not available in the cluster (is metrics-server installed?), only the requests and limits are returned"
+
+type ContainerMetrics struct {
+	Name  string              `json:"name"`
+	Usage corev1.ResourceList `json:"usage"`
+}
+
+// PodMetrics is the usage of the containers of a pod, as returned by the metrics api
+type PodMetrics struct {
+	metav1.ObjectMeta `json:"metadata"`
+	Containers        []ContainerMetrics `json:"containers"`
+}
+
+// NodeMetrics is the usage of a node, as returned by the metrics api
+type NodeMetrics struct {
+	metav1.ObjectMeta `json:"metadata"`
+	Usage             corev1.ResourceList `json:"usage"`
+}
+
+// IsUnavailable returns true if the error means that the metrics api is not served by the cluster
+func IsUnavailable(err error) bool {
+	return apierrors.IsNotFound(err) || apierrors.IsServiceUnavailable(err)
+}
+
+// GetPodMetrics returns the metrics of the pods of the namespace matching the selector, by pod name
+func GetPodMetrics(ctx context.Context, clientset kubernetes.Interface, namespace string, selector labels.Selector) (map[string]PodMetrics, error) {
+	request := clientset.Discovery().RESTClient().Get().AbsPath(MetricsAPIPath, "namespaces", namespace, "pods")
+	if selector != nil && !selector.Empty() {
+		request = request.Param("labelSelector", selector.String())
+	}
+	raw, err := request.Do(ctx).Raw()
+	if err != nil {
+		return nil, err
+	}
+
+	var list struct {
+		Items []PodMetrics `json:"items"`
+	}
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return nil, err
+	}
+	metrics := make(map[string]PodMetrics, len(list.Items))
+	for _, m := range list.Items {
+		metrics[m.Name] = m
+	}
+	return metrics, nil
+}
+
+// GetNodeMetrics returns the metrics of all the nodes, by node name
+func GetNodeMetrics(ctx context.Context, clientset kubernetes.Interface) (map[string]NodeMetrics, error) {
+	raw, err := clientset.Discovery().RESTClient().Get().AbsPath(MetricsAPIPath, "nodes").Do(ctx).Raw()
+	if err != nil {
+		return nil, err
+	}
+
+	var list struct {
+		Items []NodeMetrics `json:"items"`
+	}
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return nil, err
+	}
+	metrics := make(map[string]NodeMetrics, len(list.Items))
+	for _, m := range list.Items {
+		metrics[m.Name] = m
+	}
+	return metrics, nil
+}
+
+// Pods returns the usage of the pods compared with their requests and limits.
+// Finished pods are ignored. The usage is 0 for the pods without metrics (metrics nil or pod just started).
+func Pods(pods []corev1.Pod, metrics map[string]PodMetrics) []models.PodUsage {
+	usages := make([]models.PodUsage, 0, len(pods))
+	for _, pod := range pods {
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		u := models.PodUsage{
+			Name:  pod.Name,
+			Node:  pod.Spec.NodeName,
+			Phase: string(pod.Status.Phase),
+		}
+		for _, container := range pod.Spec.Containers {
+			addAllocation(&u.Usage.CPU, container.Resources, corev1.ResourceCPU)
+			addAllocation(&u.Usage.Memory, container.Resources, corev1.ResourceMemory)
+		}
+		if m, ok := metrics[pod.Name]; ok {
+			for _, container := range m.Containers {
+				u.Usage.CPU.Used += milliValue(container.Usage, corev1.ResourceCPU)
+				u.Usage.Memory.Used += value(container.Usage, corev1.ResourceMemory)
+			}
+		}
+		usages = append(usages, u)
+	}
+	return usages
+}
+
+// Sum returns the total usage of the pods
+func Sum(pods []models.PodUsage) models.ResourceUsage {
+	var total models.ResourceUsage
+	for _, pod := range pods {
+		total.Add(pod.Usage)
+	}
+	return total
+}
+
+// Node returns the usage of the node compared with its allocatable resources
+func Node(node corev1.Node, metrics *NodeMetrics) models.NodeUsage {
+	u := models.NodeUsage{
+		Name: node.Name,
+		CPU: models.NodeResource{
+			Allocatable: milliValue(node.Status.Allocatable, corev1.ResourceCPU),
+			Capacity:    milliValue(node.Status.Capacity, corev1.ResourceCPU),
+		},
+		Memory: models.NodeResource{
+			Allocatable: value(node.Status.Allocatable, corev1.ResourceMemory),
+			Capacity:    value(node.Status.Capacity, corev1.ResourceMemory),
+		},
+	}
+	if metrics != nil {
+		u.CPU.Used = milliValue(metrics.Usage, corev1.ResourceCPU)
+		u.Memory.Used = value(metrics.Usage, corev1.ResourceMemory)
+	}
+	return u
+}
+
+func addAllocation(u *models.Usage, resources corev1.ResourceRequirements, name corev1.ResourceName) {
+	quantity := value
+	if name == corev1.ResourceCPU {
+		quantity = milliValue
+	}
+	u.Requests += quantity(resources.Requests, name)
+	if _, ok := resources.Limits[name]; !ok {
+		u.Unlimited = true
+		return
+	}
+	u.Limits += quantity(resources.Limits, name)
+}
+
+// milliValue returns the quantity of the resource in thousandths, used for the cpu
+func milliValue(list corev1.ResourceList, name corev1.ResourceName) int64 {
+	q, ok := list[name]
+	if !ok {
+		return 0
+	}
+	return q.MilliValue()
+}
+
+func value(list corev1.ResourceList, name corev1.ResourceName) int64 {
+	q, ok := list[name]
+	if !ok {
+		return 0
+	}
+	return q.Value()
+}
@@ -0,0 +1,168 @@
+package usage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/kuro-jojo/kdi-k8s/models"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+func resources(cpu, memory string) corev1.ResourceList {
+	list := corev1.ResourceList{}
+	if cpu != "" {
+		list[corev1.ResourceCPU] = resource.MustParse(cpu)
+	}
+	if memory != "" {
+		list[corev1.ResourceMemory] = resource.MustParse(memory)
+	}
+	return list
+}
+
+func pod(name string, phase corev1.PodPhase, containers ...corev1.ResourceRequirements) corev1.Pod {
+	p := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       corev1.PodSpec{NodeName: "node-1"},
+		Status:     corev1.PodStatus{Phase: phase},
+	}
+	for _, r := range containers {
+		p.Spec.Containers = append(p.Spec.Containers, corev1.Container{Resources: r})
+	}
+	return p
+}
+
+func TestPods(t *testing.T) {
+	limited := corev1.ResourceRequirements{Requests: resources("100m", "64Mi"), Limits: resources("500m", "128Mi")}
+	noLimit := corev1.ResourceRequirements{Requests: resources("250m", "")}
+	pods := []corev1.Pod{
+		pod("web-1", corev1.PodRunning, limited, noLimit),
+		pod("web-2", corev1.PodPending, limited),
+		pod("job-1", corev1.PodSucceeded, limited),
+		pod("job-2", corev1.PodFailed, limited),
+	}
+	metrics := map[string]PodMetrics{
+		"web-1": {Containers: []ContainerMetrics{{Usage: resources("120m", "100Mi")}, {Usage: resources("30m", "28Mi")}}},
+		"job-1": {Containers: []ContainerMetrics{{Usage: resources("1", "1Gi")}}},
+	}
+
+	want := []models.PodUsage{
+		{Name: "web-1", Node: "node-1", Phase: "Running", Usage: models.ResourceUsage{
+			CPU:    models.Usage{Used: 150, Requests: 350, Limits: 500, Unlimited: true},
+			Memory: models.Usage{Used: 128 << 20, Requests: 64 << 20, Limits: 128 << 20, Unlimited: true},
+		}},
+		// no metrics yet for a pod just started
+		{Name: "web-2", Node: "node-1", Phase: "Pending", Usage: models.ResourceUsage{
+			CPU:    models.Usage{Requests: 100, Limits: 500},
+			Memory: models.Usage{Requests: 64 << 20, Limits: 128 << 20},
+		}},
+	}
+	if got := Pods(pods, metrics); !reflect.DeepEqual(got, want) {
+		t.Errorf("Pods() = %+v, want %+v", got, want)
+	}
+
+	// without the metrics api only the requests and limits are known
+	got := Pods(pods[:1], nil)
+	if got[0].Usage.CPU.Used != 0 || got[0].Usage.CPU.Requests != 350 {
+		t.Errorf("Pods() without metrics = %+v", got)
+	}
+}
+
+func TestSum(t *testing.T) {
+	pods := []models.PodUsage{
+		{Usage: models.ResourceUsage{CPU: models.Usage{Used: 150, Requests: 350, Limits: 500, Unlimited: true}, Memory: models.Usage{Used: 10, Requests: 20, Limits: 30}}},
+		{Usage: models.ResourceUsage{CPU: models.Usage{Used: 50, Requests: 100, Limits: 500}, Memory: models.Usage{Used: 5, Requests: 20, Limits: 30}}},
+	}
+	want := models.ResourceUsage{
+		CPU:    models.Usage{Used: 200, Requests: 450, Limits: 1000, Unlimited: true},
+		Memory: models.Usage{Used: 15, Requests: 40, Limits: 60},
+	}
+	if got := Sum(pods); got != want {
+		t.Errorf("Sum() = %+v, want %+v", got, want)
+	}
+	if got := Sum(nil); got != (models.ResourceUsage{}) {
+		t.Errorf("Sum(nil) = %+v, want no usage", got)
+	}
+}
+
+func TestNode(t *testing.T) {
+	node := corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+		Status:     corev1.NodeStatus{Allocatable: resources("3800m", "7Gi"), Capacity: resources("4", "8Gi")},
+	}
+	want := models.NodeUsage{
+		Name:   "node-1",
+		CPU:    models.NodeResource{Used: 1200, Allocatable: 3800, Capacity: 4000},
+		Memory: models.NodeResource{Used: 2 << 30, Allocatable: 7 << 30, Capacity: 8 << 30},
+	}
+	if got := Node(node, &NodeMetrics{Usage: resources("1200m", "2Gi")}); got != want {
+		t.Errorf("Node() = %+v, want %+v", got, want)
+	}
+
+	want.CPU.Used, want.Memory.Used = 0, 0
+	if got := Node(node, nil); got != want {
+		t.Errorf("Node() without metrics = %+v, want %+v", got, want)
+	}
+}
+
+// newClientset returns a clientset of a cluster serving the metrics api with the handler
+func newClientset(t *testing.T, handler http.HandlerFunc) kubernetes.Interface {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	clientset, err := kubernetes.NewForConfig(&rest.Config{Host: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return clientset
+}
+
+func TestGetPodMetrics(t *testing.T) {
+	var query string
+	clientset := newClientset(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != MetricsAPIPath+"/namespaces/shop/pods" {
+			http.NotFound(w, r)
+			return
+		}
+		query = r.URL.Query().Get("labelSelector")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"items":[{"metadata":{"name":"web-1"},"containers":[{"name":"web","usage":{"cpu":"120m","memory":"100Mi"}}]}]}`))
+	})
+
+	metrics, err := GetPodMetrics(context.Background(), clientset, "shop", labels.SelectorFromSet(labels.Set{"app": "web"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query != "app=web" {
+		t.Errorf("labelSelector = %q, want app=web", query)
+	}
+	cpu := metrics["web-1"].Containers[0].Usage[corev1.ResourceCPU]
+	if len(metrics) != 1 || cpu.MilliValue() != 120 {
+		t.Errorf("GetPodMetrics() = %+v", metrics)
+	}
+}
+
+func TestMetricsUnavailable(t *testing.T) {
+	for _, status := range []int{http.StatusNotFound, http.StatusServiceUnavailable} {
+		clientset := newClientset(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+		})
+		if _, err := GetNodeMetrics(context.Background(), clientset); !IsUnavailable(err) {
+			t.Errorf("GetNodeMetrics() with status %d: error = %v, want the metrics api unavailable", status, err)
+		}
+	}
+
+	clientset := newClientset(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	})
+	if _, err := GetNodeMetrics(context.Background(), clientset); err == nil || IsUnavailable(err) {
+		t.Errorf("GetNodeMetrics() when forbidden: error = %v, want an error of the api", err)
+	}
+}
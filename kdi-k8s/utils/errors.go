@@ -1,35 +1,130 @@
 package utils
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"net/http"
+	"strconv"
 	"strings"
+
+	"github.com/gin-gonic/gin"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 )
 
 const (
 	NoRouteToHostErr    = "no route to host"
-	NotFoundErr         = "not found"
-	UnauthorizedErr     = "Unauthorized"
-	ForbiddenErr        = "forbidden"
 	ConnexionRefusedErr = "connection refused"
 )
 
-func IsUnauthorizedError(message string, object string) (bool, error) {
-	//TODO: update the error message
-	if strings.Contains(message, UnauthorizedErr) {
-		return true, fmt.Errorf("cannot access %s", object)
-	}
-	return false, nil
+// Reason codes returned with the errors of the kubernetes api
+const (
+	ReasonBadRequest         = "BadRequest"
+	ReasonUnauthorized       = "Unauthorized"
+	ReasonForbidden          = "Forbidden"
+	ReasonNotFound           = "NotFound"
+	ReasonAlreadyExists      = "AlreadyExists"
+	ReasonConflict           = "Conflict"
+	ReasonInvalid            = "Invalid"
+	ReasonTimeout            = "Timeout"
+	ReasonTooManyRequests    = "TooManyRequests"
+	ReasonServiceUnavailable = "ServiceUnavailable"
+	ReasonInternalError      = "InternalError"
+
+	// Reasons of a rollout that did not complete
+	ReasonRolloutFailed      = "RolloutFailed"
+	ReasonRolloutTimedOut    = "RolloutTimedOut"
+	ReasonRolloutInterrupted = "RolloutInterrupted"
+	// The rollout did not complete and the update was reverted
+	ReasonRolledBack = "RolledBack"
+
+	// The object does not respect a rule with the deny severity
+	ReasonPolicyViolation = "PolicyViolation"
+
+	// The request was interrupted (shutdown of the server, client gone) before the object was handled
+	ReasonInterrupted = "Interrupted"
+)
+
+// ErrorCause is a field level cause of an Invalid error
+type ErrorCause struct {
+	Field   string `json:"field"`
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// K8sError is the classification of an error returned by the kubernetes api
+type K8sError struct {
+	Status            int          `json:"-"`
+	Reason            string       `json:"reason"`
+	Message           string       `json:"message"`
+	Causes            []ErrorCause `json:"causes,omitempty"`
+	RetryAfterSeconds int          `json:"-"`
 }
 
-func IsForbiddenError(message string, object string) (bool, error) {
-	if strings.Contains(message, ForbiddenErr) {
-		return true, fmt.Errorf("cannot access %s", object)
+// ClassifyK8sError maps an error of the kubernetes api to an http status and a reason code
+func ClassifyK8sError(err error) K8sError {
+	e := K8sError{Status: http.StatusInternalServerError, Reason: ReasonInternalError, Message: err.Error()}
+
+	switch {
+	case apierrors.IsNotFound(err):
+		e.Status, e.Reason = http.StatusNotFound, ReasonNotFound
+	case apierrors.IsAlreadyExists(err):
+		e.Status, e.Reason = http.StatusConflict, ReasonAlreadyExists
+	case apierrors.IsConflict(err):
+		e.Status, e.Reason = http.StatusConflict, ReasonConflict
+	case apierrors.IsInvalid(err):
+		e.Status, e.Reason = http.StatusUnprocessableEntity, ReasonInvalid
+	case apierrors.IsTimeout(err), apierrors.IsServerTimeout(err):
+		e.Status, e.Reason = http.StatusGatewayTimeout, ReasonTimeout
+	case apierrors.IsTooManyRequests(err):
+		e.Status, e.Reason = http.StatusTooManyRequests, ReasonTooManyRequests
+	case apierrors.IsUnauthorized(err):
+		e.Status, e.Reason = http.StatusUnauthorized, ReasonUnauthorized
+	case apierrors.IsForbidden(err):
+		e.Status, e.Reason = http.StatusForbidden, ReasonForbidden
+	case apierrors.IsBadRequest(err):
+		e.Status, e.Reason = http.StatusBadRequest, ReasonBadRequest
+	case apierrors.IsServiceUnavailable(err):
+		e.Status, e.Reason = http.StatusServiceUnavailable, ReasonServiceUnavailable
+	}
+
+	if delay, ok := apierrors.SuggestsClientDelay(err); ok {
+		e.RetryAfterSeconds = delay
 	}
-	return false, nil
+
+	var statusErr apierrors.APIStatus
+	if errors.As(err, &statusErr) {
+		if details := statusErr.Status().Details; details != nil {
+			for _, cause := range details.Causes {
+				e.Causes = append(e.Causes, ErrorCause{
+					Field:   cause.Field,
+					Type:    string(cause.Type),
+					Message: cause.Message,
+				})
+			}
+		}
+	}
+	return e
 }
 
-func IsNotFoundError(message string) bool {
-	return strings.Contains(message, NotFoundErr)
+// IsNotFoundError returns true if the kubernetes api did not find the object
+func IsNotFoundError(err error) bool {
+	return apierrors.IsNotFound(err)
+}
+
+// RespondWithK8sError writes the classification of the error of the kubernetes api.
+// The message describes the failed operation, the details of the error are in the causes.
+func RespondWithK8sError(c *gin.Context, err error, message string) {
+	e := ClassifyK8sError(err)
+	if e.RetryAfterSeconds > 0 {
+		c.Header("Retry-After", strconv.Itoa(e.RetryAfterSeconds))
+	}
+	response := gin.H{"message": fmt.Sprintf("%s : %s", message, e.Message), "reason": e.Reason}
+	if len(e.Causes) > 0 {
+		response["causes"] = e.Causes
+	}
+	c.JSON(e.Status, response)
 }
 
 func IsNoRouteToHostError(message string) bool {
@@ -39,3 +134,34 @@ func IsNoRouteToHostError(message string) bool {
 func IsConnexionRefusedError(message string) bool {
 	return strings.Contains(message, ConnexionRefusedErr)
 }
+
+// IsCertificateError returns true if the error comes from the verification of the server certificate
+func IsCertificateError(err error) bool {
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	var verificationErr *tls.CertificateVerificationError
+
+	return errors.As(err, &unknownAuthorityErr) || errors.As(err, &hostnameErr) ||
+		errors.As(err, &invalidErr) || errors.As(err, &verificationErr)
+}
+
+// CertificateErrorMessage returns a human readable explanation of a certificate verification error
+func CertificateErrorMessage(err error) string {
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+
+	switch {
+	case errors.As(err, &unknownAuthorityErr):
+		return "the certificate is signed by an unknown authority - please provide the CA certificate of the cluster"
+	case errors.As(err, &hostnameErr):
+		return fmt.Sprintf("the certificate is not valid for %s - please check the address or set the TLS server name", hostnameErr.Host)
+	case errors.As(err, &invalidErr):
+		if invalidErr.Reason == x509.Expired {
+			return "the certificate has expired or is not yet valid"
+		}
+		return fmt.Sprintf("the certificate is invalid : %s", invalidErr.Error())
+	}
+	return fmt.Sprintf("the certificate could not be verified : %v", err)
+}
@@ -0,0 +1,106 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+var deployments = schema.GroupResource{Group: "apps", Resource: "deployments"}
+
+func invalidDeployment() error {
+	return apierrors.NewInvalid(schema.GroupKind{Group: "apps", Kind: "Deployment"}, "web", field.ErrorList{
+		field.Required(field.NewPath("spec", "selector"), ""),
+	})
+}
+
+func TestClassifyK8sError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		status     int
+		reason     string
+		retryAfter int
+	}{
+		{"not found", apierrors.NewNotFound(deployments, "web"), http.StatusNotFound, ReasonNotFound, 0},
+		{"already exists", apierrors.NewAlreadyExists(deployments, "web"), http.StatusConflict, ReasonAlreadyExists, 0},
+		{"conflict", apierrors.NewConflict(deployments, "web", errors.New("the object has been modified")), http.StatusConflict, ReasonConflict, 0},
+		{"forbidden", apierrors.NewForbidden(deployments, "web", errors.New("no rights")), http.StatusForbidden, ReasonForbidden, 0},
+		{"invalid", invalidDeployment(), http.StatusUnprocessableEntity, ReasonInvalid, 0},
+		{"timeout", apierrors.NewTimeoutError("the request timed out", 3), http.StatusGatewayTimeout, ReasonTimeout, 3},
+		{"server timeout", apierrors.NewServerTimeout(deployments, "update", 2), http.StatusGatewayTimeout, ReasonTimeout, 2},
+		{"too many requests", apierrors.NewTooManyRequests("slow down", 5), http.StatusTooManyRequests, ReasonTooManyRequests, 5},
+		{"unauthorized", apierrors.NewUnauthorized("expired token"), http.StatusUnauthorized, ReasonUnauthorized, 0},
+		{"bad request", apierrors.NewBadRequest("invalid patch"), http.StatusBadRequest, ReasonBadRequest, 0},
+		{"service unavailable", apierrors.NewServiceUnavailable("starting"), http.StatusServiceUnavailable, ReasonServiceUnavailable, 0},
+		{"not an error of the api", errors.New("connection reset"), http.StatusInternalServerError, ReasonInternalError, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := ClassifyK8sError(tt.err)
+			if e.Status != tt.status || e.Reason != tt.reason || e.RetryAfterSeconds != tt.retryAfter {
+				t.Errorf("ClassifyK8sError() = %+v, want %d %s retry after %d", e, tt.status, tt.reason, tt.retryAfter)
+			}
+			if e.Message != tt.err.Error() {
+				t.Errorf("message = %q, want %q", e.Message, tt.err.Error())
+			}
+		})
+	}
+
+	// the causes of an invalid object are kept
+	e := ClassifyK8sError(invalidDeployment())
+	if len(e.Causes) != 1 || e.Causes[0].Field != "spec.selector" || e.Causes[0].Type != string(field.ErrorTypeRequired) {
+		t.Errorf("causes = %+v, want the selector required", e.Causes)
+	}
+}
+
+func TestRespondWithK8sError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		err        error
+		status     int
+		reason     string
+		retryAfter string
+		causes     int
+	}{
+		{"not found", apierrors.NewNotFound(deployments, "web"), http.StatusNotFound, ReasonNotFound, "", 0},
+		{"conflict", apierrors.NewConflict(deployments, "web", errors.New("the object has been modified")), http.StatusConflict, ReasonConflict, "", 0},
+		{"forbidden", apierrors.NewForbidden(deployments, "web", errors.New("no rights")), http.StatusForbidden, ReasonForbidden, "", 0},
+		{"invalid", invalidDeployment(), http.StatusUnprocessableEntity, ReasonInvalid, "", 1},
+		{"timeout", apierrors.NewTimeoutError("the request timed out", 3), http.StatusGatewayTimeout, ReasonTimeout, "3", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			RespondWithK8sError(c, tt.err, "Error while updating deployment")
+
+			var body struct {
+				Message string       `json:"message"`
+				Reason  string       `json:"reason"`
+				Causes  []ErrorCause `json:"causes"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if w.Code != tt.status || body.Reason != tt.reason || len(body.Causes) != tt.causes {
+				t.Errorf("response = %d %+v, want %d %s with %d causes", w.Code, body, tt.status, tt.reason, tt.causes)
+			}
+			if want := "Error while updating deployment : " + tt.err.Error(); body.Message != want {
+				t.Errorf("message = %q, want %q", body.Message, want)
+			}
+			if got := w.Header().Get("Retry-After"); got != tt.retryAfter {
+				t.Errorf("Retry-After = %q, want %q", got, tt.retryAfter)
+			}
+		})
+	}
+}
@@ -0,0 +1,424 @@
+package main
+
+// This file contains the calls to the web api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type api struct {
+	server     string // The url of the web api, with /api/v1
+	token      string
+	httpClient *http.Client
+
+	// The refresh token of the session started by login, used to renew the token once it expired
+	refreshToken string
+	onRefresh    func(token string, refreshToken string)
+}
+
+// apiError is an error response of the web api
+type apiError struct {
+	StatusCode int
+	Message    string              `json:"message"`
+	Messages   map[string][]string `json:"messages"`
+}
+
+func (e *apiError) Error() string {
+	message := e.Message
+	if message == "" && len(e.Messages["error"]) > 0 {
+		message = strings.Join(e.Messages["error"], ", ")
+	}
+	if message == "" {
+		message = http.StatusText(e.StatusCode)
+	}
+	return fmt.Sprintf("kdi : %d %s", e.StatusCode, message)
+}
+
+type Teamspace struct {
+	ID          string    `json:"ID"`
+	Name        string    `json:"Name"`
+	Description string    `json:"Description"`
+	CreatedAt   time.Time `json:"CreatedAt"`
+}
+
+type Project struct {
+	ID          string `json:"ID"`
+	Name        string `json:"Name"`
+	Description string `json:"Description"`
+	TeamspaceID string `json:"TeamspaceID"`
+}
+
+type Environment struct {
+	ID          string `json:"ID"`
+	Name        string `json:"Name"`
+	Description string `json:"Description"`
+	ProjectID   string `json:"ProjectID"`
+	ClusterID   string `json:"ClusterID"`
+}
+
+type Container struct {
+	Name  string `json:"Name"`
+	Image string `json:"Image"`
+	Port  int32  `json:"Port"`
+}
+
+type Microservice struct {
+	ID         string      `json:"ID"`
+	Kind       string      `json:"Kind"`
+	Name       string      `json:"Name"`
+	Namespace  string      `json:"Namespace"`
+	Replicas   int32       `json:"Replicas"`
+	Strategy   string      `json:"Strategy"`
+	Paused     bool        `json:"Paused"`
+	Containers []Container `json:"Containers"`
+}
+
+type PolicyViolation struct {
+	Rule      string `json:"rule"`
+	Severity  string `json:"severity"`
+	Object    string `json:"object"`
+	Container string `json:"container,omitempty"`
+	Message   string `json:"message"`
+}
+
+type OperationResult struct {
+	Object     string            `json:"Object"`
+	Status     string            `json:"Status"`
+	Message    string            `json:"Message,omitempty"`
+	Reason     string            `json:"Reason,omitempty"`
+	Violations []PolicyViolation `json:"Violations,omitempty"`
+}
+
+// Operation is a deployment or an update executed asynchronously by the web api
+type Operation struct {
+	ID             string              `json:"ID"`
+	Type           string              `json:"Type"`
+	Status         string              `json:"Status"`
+	EnvironmentID  string              `json:"EnvironmentID"`
+	MicroserviceID string              `json:"MicroserviceID,omitempty"`
+	Results        []OperationResult   `json:"Results"`
+	Messages       map[string][]string `json:"Messages,omitempty"`
+	Error          string              `json:"Error,omitempty"`
+	CreatedAt      time.Time           `json:"CreatedAt"`
+	FinishedAt     time.Time           `json:"FinishedAt"`
+}
+
+// Operation statuses
+const (
+	operationSucceeded = "succeeded"
+	operationFailed    = "failed"
+)
+
+func (o *Operation) isFinished() bool {
+	return o.Status == operationSucceeded || o.Status == operationFailed
+}
+
+// UpdateForm is the update of a microservice, see MicroserviceUpdateForm in the controllers of the web api
+type UpdateForm struct {
+	Strategy       string `json:"strategy"`
+	Container      string `json:"container,omitempty"`
+	Image          string `json:"image,omitempty"`
+	Replicas       int32  `json:"replicas"`
+	MaxUnavailable string `json:"maxUnavailable,omitempty"`
+	MaxSurge       string `json:"maxSurge,omitempty"`
+	Wait           bool   `json:"wait"`
+	Timeout        int    `json:"timeout,omitempty"`
+	AutoRollback   bool   `json:"autoRollback"`
+}
+
+// DeployForm is the upload of manifests to an environment
+type DeployForm struct {
+	Files     []string // The paths of the yaml files
+	Namespace string
+	Wait      bool
+	Timeout   int
+}
+
+// session holds the tokens returned by login and refresh
+type session struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+}
+
+func (a *api) login(ctx context.Context, email string, password string) (*session, error) {
+	form := struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}{email, password}
+	var response session
+	if err := a.send(ctx, http.MethodPost, "/login", form, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// refresh renews the token with the refresh token, which is replaced
+func (a *api) refresh(ctx context.Context) error {
+	form := struct {
+		RefreshToken string `json:"refreshToken"`
+	}{a.refreshToken}
+	var response session
+	a.refreshToken = "" // the refresh is not retried
+	if err := a.send(ctx, http.MethodPost, "/refresh", form, &response); err != nil {
+		return err
+	}
+	a.token, a.refreshToken = response.Token, response.RefreshToken
+	if a.onRefresh != nil {
+		a.onRefresh(a.token, a.refreshToken)
+	}
+	return nil
+}
+
+// teamspaces returns the teamspaces created or joined by the user
+func (a *api) teamspaces(ctx context.Context) ([]Teamspace, error) {
+	var teamspaces []Teamspace
+	seen := map[string]bool{}
+	for _, path := range []string{"/dashboard/teamspaces/owned", "/dashboard/teamspaces/joined"} {
+		var response struct {
+			Teamspaces []Teamspace `json:"teamspaces"`
+		}
+		if err := a.get(ctx, path, &response); err != nil {
+			return nil, err
+		}
+		for _, teamspace := range response.Teamspaces {
+			if !seen[teamspace.ID] {
+				seen[teamspace.ID] = true
+				teamspaces = append(teamspaces, teamspace)
+			}
+		}
+	}
+	return teamspaces, nil
+}
+
+// projects returns the projects of the teamspace, or the ones created by the user and of its teamspaces if teamspace is empty
+func (a *api) projects(ctx context.Context, teamspace string) ([]Project, error) {
+	paths := []string{"/dashboard/projects/owned", "/dashboard/projects/joinedTeamspaces"}
+	if teamspace != "" {
+		paths = []string{"/dashboard/teamspaces/" + url.PathEscape(teamspace) + "/projects"}
+	}
+	var projects []Project
+	seen := map[string]bool{}
+	for _, path := range paths {
+		var response struct {
+			Projects []Project `json:"projects"`
+		}
+		if err := a.get(ctx, path, &response); err != nil {
+			return nil, err
+		}
+		for _, project := range response.Projects {
+			if !seen[project.ID] {
+				seen[project.ID] = true
+				projects = append(projects, project)
+			}
+		}
+	}
+	return projects, nil
+}
+
+// environments returns the environments of the project, or all of them if project is empty
+func (a *api) environments(ctx context.Context, project string) ([]Environment, error) {
+	path := "/dashboard/environments"
+	if project != "" {
+		path += "/projects/" + url.PathEscape(project)
+	}
+	var response struct {
+		Environments []Environment `json:"environments"`
+	}
+	if err := a.get(ctx, path, &response); err != nil {
+		return nil, err
+	}
+	return response.Environments, nil
+}
+
+func (a *api) microservices(ctx context.Context, environment string) ([]Microservice, error) {
+	var response struct {
+		Microservices []Microservice `json:"microservices"`
+	}
+	if err := a.get(ctx, environmentPath(environment, "microservices"), &response); err != nil {
+		return nil, err
+	}
+	return response.Microservices, nil
+}
+
+func (a *api) microservice(ctx context.Context, environment string, id string) (*Microservice, error) {
+	var response struct {
+		Microservice Microservice `json:"microservice"`
+	}
+	if err := a.get(ctx, environmentPath(environment, "microservices", id), &response); err != nil {
+		return nil, err
+	}
+	return &response.Microservice, nil
+}
+
+// deploy uploads the manifests to the environment and returns the operation deploying them
+func (a *api) deploy(ctx context.Context, environment string, form DeployForm) (*Operation, error) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for _, path := range form.Files {
+		if err := addFile(writer, path); err != nil {
+			return nil, err
+		}
+	}
+	fields := map[string]string{}
+	if form.Namespace != "" {
+		fields["namespace"] = form.Namespace
+	}
+	if form.Wait {
+		fields["wait"] = "true"
+		if form.Timeout > 0 {
+			fields["timeout"] = strconv.Itoa(form.Timeout)
+		}
+	}
+	for name, value := range fields {
+		if err := writer.WriteField(name, value); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		Operation Operation `json:"operation"`
+	}
+	if err := a.do(ctx, http.MethodPost, environmentPath(environment, "microservices", "with-yaml"), writer.FormDataContentType(), body.Bytes(), &response); err != nil {
+		return nil, err
+	}
+	return &response.Operation, nil
+}
+
+// update updates the microservice and returns the operation updating it
+func (a *api) update(ctx context.Context, environment string, microservice string, form UpdateForm) (*Operation, error) {
+	var response struct {
+		Operation Operation `json:"operation"`
+	}
+	if err := a.send(ctx, http.MethodPatch, environmentPath(environment, "microservices", microservice), form, &response); err != nil {
+		return nil, err
+	}
+	return &response.Operation, nil
+}
+
+func (a *api) operation(ctx context.Context, environment string, id string) (*Operation, error) {
+	var response struct {
+		Operation Operation `json:"operation"`
+	}
+	if err := a.get(ctx, environmentPath(environment, "operations", id), &response); err != nil {
+		return nil, err
+	}
+	return &response.Operation, nil
+}
+
+// wait polls the operation until it is finished
+func (a *api) wait(ctx context.Context, operation *Operation, interval time.Duration) (*Operation, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for !operation.isFinished() {
+		select {
+		case <-ctx.Done():
+			return operation, fmt.Errorf("operation %s is still %s : %w", operation.ID, operation.Status, ctx.Err())
+		case <-ticker.C:
+		}
+		current, err := a.operation(ctx, operation.EnvironmentID, operation.ID)
+		if err != nil {
+			return operation, err
+		}
+		operation = current
+	}
+	return operation, nil
+}
+
+func environmentPath(environment string, segments ...string) string {
+	path := "/dashboard/environments/" + url.PathEscape(environment)
+	for _, segment := range segments {
+		path += "/" + url.PathEscape(segment)
+	}
+	return path
+}
+
+func addFile(writer *multipart.Writer, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	part, err := writer.CreateFormFile("files", filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(part, file)
+	return err
+}
+
+func (a *api) get(ctx context.Context, path string, out any) error {
+	return a.do(ctx, http.MethodGet, path, "", nil, out)
+}
+
+func (a *api) send(ctx context.Context, method string, path string, in any, out any) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return a.do(ctx, method, path, "application/json", body, out)
+}
+
+// do sends the request, it is sent again with a new token if the token expired and can be refreshed
+func (a *api) do(ctx context.Context, method string, path string, contentType string, body []byte, out any) error {
+	err := a.request(ctx, method, path, contentType, body, out)
+	var apiErr *apiError
+	if a.refreshToken != "" && errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusUnauthorized {
+		if err := a.refresh(ctx); err != nil {
+			return fmt.Errorf("the session expired, run kdictl login : %w", err)
+		}
+		return a.request(ctx, method, path, contentType, body, out)
+	}
+	return err
+}
+
+func (a *api) request(ctx context.Context, method string, path string, contentType string, body []byte, out any) error {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	request, err := http.NewRequestWithContext(ctx, method, a.server+path, reader)
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+	if a.token != "" {
+		request.Header.Set("Authorization", "Bearer "+a.token)
+	}
+
+	response, err := a.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= http.StatusBadRequest {
+		apiErr := &apiError{StatusCode: response.StatusCode}
+		_ = json.NewDecoder(response.Body).Decode(apiErr)
+		return apiErr
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(response.Body).Decode(out); err != nil {
+		return fmt.Errorf("cannot decode the response of %s %s : %w", method, path, err)
+	}
+	return nil
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Strategies of the updates, see the models of the web api
+var strategies = []string{"RollingUpdate", "Recreate", "canary", "blue-green", "ab-testing"}
+
+var objectIDPattern = regexp.MustCompile(`^[0-9a-f]{24}$`)
+
+// login saves the token of the user, to be used by the next commands
+func login(ctx context.Context, c *cli, args []string) error {
+	email := c.flags.String("email", os.Getenv("KDI_EMAIL"), "The email of the user")
+	password := c.flags.String("password", os.Getenv("KDI_PASSWORD"), "The password of the user (prefer KDI_PASSWORD)")
+	if err := c.parse(args); err != nil {
+		return err
+	}
+	if *email == "" || *password == "" {
+		return usageError("the email and the password are required")
+	}
+
+	a, err := c.api(false)
+	if err != nil {
+		return err
+	}
+	session, err := a.login(ctx, *email, *password)
+	if err != nil {
+		return err
+	}
+	if err := saveConfig(config{Server: c.server, Token: session.Token, RefreshToken: session.RefreshToken}); err != nil {
+		return fmt.Errorf("cannot save the token : %w", err)
+	}
+	path, _ := configPath()
+	fmt.Fprintf(c.stderr, "Logged in to %s, the token is saved in %s\n", c.server, path)
+	return nil
+}
+
+// get lists the teamspaces, the projects, the environments or the microservices
+func get(ctx context.Context, c *cli, args []string) error {
+	teamspace := c.flags.String("teamspace", "", "List the projects of this teamspace")
+	project := c.flags.String("project", "", "List the environments of this project")
+	environment := c.flags.String("environment", "", "List the microservices of this environment (required for microservices)")
+	if err := c.parse(args); err != nil {
+		return err
+	}
+	if c.flags.NArg() != 1 {
+		return usageError("expected one of teamspaces, projects, environments or microservices")
+	}
+	a, err := c.api(true)
+	if err != nil {
+		return err
+	}
+
+	switch resource := c.flags.Arg(0); resource {
+	case "teamspaces", "teamspace":
+		teamspaces, err := a.teamspaces(ctx)
+		if err != nil {
+			return err
+		}
+		return c.print(teamspaces, func(t *table) {
+			t.row("ID", "NAME", "DESCRIPTION")
+			for _, teamspace := range teamspaces {
+				t.row(teamspace.ID, teamspace.Name, teamspace.Description)
+			}
+		})
+	case "projects", "project":
+		projects, err := a.projects(ctx, *teamspace)
+		if err != nil {
+			return err
+		}
+		return c.print(projects, func(t *table) {
+			t.row("ID", "NAME", "TEAMSPACE", "DESCRIPTION")
+			for _, project := range projects {
+				t.row(project.ID, project.Name, project.TeamspaceID, project.Description)
+			}
+		})
+	case "environments", "environment":
+		environments, err := a.environments(ctx, *project)
+		if err != nil {
+			return err
+		}
+		return c.print(environments, func(t *table) {
+			t.row("ID", "NAME", "PROJECT", "CLUSTER")
+			for _, environment := range environments {
+				t.row(environment.ID, environment.Name, environment.ProjectID, environment.ClusterID)
+			}
+		})
+	case "microservices", "microservice":
+		if *environment == "" {
+			return usageError("--environment is required to list the microservices")
+		}
+		microservices, err := a.microservices(ctx, *environment)
+		if err != nil {
+			return err
+		}
+		return c.print(microservices, func(t *table) {
+			t.row("ID", "NAME", "NAMESPACE", "KIND", "REPLICAS", "STRATEGY", "IMAGES")
+			for _, microservice := range microservices {
+				var images []string
+				for _, container := range microservice.Containers {
+					images = append(images, container.Image)
+				}
+				t.row(microservice.ID, microservice.Name, microservice.Namespace, microservice.Kind, strconv.Itoa(int(microservice.Replicas)), microservice.Strategy, strings.Join(images, ","))
+			}
+		})
+	default:
+		return usageError("unknown resource %q, expected one of teamspaces, projects, environments or microservices", resource)
+	}
+}
+
+// deploy uploads manifests to an environment and waits for the operation deploying them
+func deploy(ctx context.Context, c *cli, args []string) error {
+	environment := c.flags.String("environment", "", "The environment where the manifests are deployed (required)")
+	namespace := c.flags.String("namespace", "", "The namespace of the objects which do not set one")
+	timeout := c.flags.Int("timeout", 0, "The deadline of the rollouts in seconds")
+	noWait := c.flags.Bool("no-wait", false, "Do not wait for the rollouts and the end of the operation")
+	if err := c.parse(args); err != nil {
+		return err
+	}
+	if *environment == "" {
+		return usageError("--environment is required")
+	}
+	if c.flags.NArg() == 0 {
+		return usageError("expected the yaml files to deploy")
+	}
+	a, err := c.api(true)
+	if err != nil {
+		return err
+	}
+
+	op, err := a.deploy(ctx, *environment, DeployForm{
+		Files:     c.flags.Args(),
+		Namespace: *namespace,
+		Wait:      !*noWait,
+		Timeout:   *timeout,
+	})
+	if err != nil {
+		return err
+	}
+	return c.follow(ctx, a, op, !*noWait)
+}
+
+// update updates a microservice with a strategy and waits for the operation updating it
+func update(ctx context.Context, c *cli, args []string) error {
+	environment := c.flags.String("environment", "", "The environment of the microservice (required)")
+	strategy := c.flags.String("strategy", "", "The strategy of the update : "+strings.Join(strategies, ", ")+" (default: the strategy of the microservice)")
+	image := c.flags.String("image", "", "The new image")
+	container := c.flags.String("container", "", "The container of the new image, if the microservice has several containers")
+	replicas := c.flags.Int("replicas", 0, "The number of replicas (default: the replicas of the microservice)")
+	maxUnavailable := c.flags.String("max-unavailable", "", "The maximum number of unavailable pods of a rolling update")
+	maxSurge := c.flags.String("max-surge", "", "The maximum number of pods above the replicas of a rolling update")
+	timeout := c.flags.Int("timeout", 0, "The deadline of the rollout in seconds")
+	autoRollback := c.flags.Bool("auto-rollback", false, "Revert the update if the rollout fails")
+	noWait := c.flags.Bool("no-wait", false, "Do not wait for the rollout and the end of the operation")
+	if err := c.parse(args); err != nil {
+		return err
+	}
+	if *environment == "" {
+		return usageError("--environment is required")
+	}
+	if c.flags.NArg() != 1 {
+		return usageError("expected the ID or the name of the microservice")
+	}
+	if *strategy != "" && !slices.Contains(strategies, *strategy) {
+		return usageError("invalid strategy %q, expected one of %s", *strategy, strings.Join(strategies, ", "))
+	}
+	a, err := c.api(true)
+	if err != nil {
+		return err
+	}
+
+	microservice, err := findMicroservice(ctx, a, *environment, c.flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	form := UpdateForm{
+		Strategy:       *strategy,
+		Container:      *container,
+		Image:          *image,
+		Replicas:       int32(*replicas),
+		MaxUnavailable: *maxUnavailable,
+		MaxSurge:       *maxSurge,
+		Wait:           !*noWait,
+		Timeout:        *timeout,
+		AutoRollback:   *autoRollback,
+	}
+	if form.Strategy == "" {
+		form.Strategy = microservice.Strategy
+	}
+	if form.Strategy == "" {
+		form.Strategy = "RollingUpdate"
+	}
+	if form.Replicas == 0 {
+		form.Replicas = microservice.Replicas
+	}
+
+	op, err := a.update(ctx, *environment, microservice.ID, form)
+	if err != nil {
+		return err
+	}
+	return c.follow(ctx, a, op, !*noWait)
+}
+
+// operation prints an operation, and waits for its end with --wait
+func operation(ctx context.Context, c *cli, args []string) error {
+	environment := c.flags.String("environment", "", "The environment of the operation (required)")
+	wait := c.flags.Bool("wait", false, "Wait for the end of the operation")
+	if err := c.parse(args); err != nil {
+		return err
+	}
+	if *environment == "" {
+		return usageError("--environment is required")
+	}
+	if c.flags.NArg() != 1 {
+		return usageError("expected the ID of the operation")
+	}
+	a, err := c.api(true)
+	if err != nil {
+		return err
+	}
+	op, err := a.operation(ctx, *environment, c.flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	return c.follow(ctx, a, op, *wait)
+}
+
+// follow prints the operation once it is finished, or right away if wait is false.
+// errOperationFailed is returned if it failed.
+func (c *cli) follow(ctx context.Context, a *api, op *Operation, wait bool) error {
+	if wait && !op.isFinished() {
+		fmt.Fprintf(c.stderr, "Waiting for the %s operation %s...\n", op.Type, op.ID)
+		var err error
+		op, err = a.wait(ctx, op, pollInterval)
+		if err != nil {
+			return err
+		}
+	}
+	if err := c.printOperation(op); err != nil {
+		return err
+	}
+	if op.Status == operationFailed {
+		return errOperationFailed
+	}
+	return nil
+}
+
+// findMicroservice returns the microservice of the environment with the ID or the name
+func findMicroservice(ctx context.Context, a *api, environment string, ref string) (*Microservice, error) {
+	if objectIDPattern.MatchString(ref) {
+		return a.microservice(ctx, environment, ref)
+	}
+	microservices, err := a.microservices(ctx, environment)
+	if err != nil {
+		return nil, err
+	}
+	var found *Microservice
+	for i, microservice := range microservices {
+		if microservice.Name != ref {
+			continue
+		}
+		if found != nil {
+			return nil, fmt.Errorf("several microservices are named %s, use the ID", ref)
+		}
+		found = &microservices[i]
+	}
+	if found == nil {
+		return nil, errors.New("microservice " + ref + " not found in the environment")
+	}
+	return found, nil
+}
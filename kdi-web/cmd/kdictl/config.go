@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// config is saved by the login command so that the next commands are authenticated
+type config struct {
+	Server       string `json:"server"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken,omitempty"`
+}
+
+// configPath returns the path of the config, KDICTL_CONFIG overrides the default one in the config directory of the user
+func configPath() (string, error) {
+	if path := os.Getenv("KDICTL_CONFIG"); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "kdictl", "config.json"), nil
+}
+
+// loadConfig returns an empty config if none was saved
+func loadConfig() (config, error) {
+	var cfg config
+	path, err := configPath()
+	if err != nil {
+		return cfg, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+	return cfg, json.Unmarshal(data, &cfg)
+}
+
+func saveConfig(cfg config) error {
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	// The token gives access to the account of the user
+	return os.WriteFile(path, data, 0o600)
+}
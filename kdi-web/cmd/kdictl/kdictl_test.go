@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	environmentID  = "665f1c2e8b3d4a0012345678"
+	microserviceID = "665f1c2e8b3d4a0087654321"
+	operationID    = "665f1c2e8b3d4a00aaaaaaaa"
+)
+
+// fakeAPI serves the routes of the web api used by kdictl, the operations finish with status
+func fakeAPI(t *testing.T, status string) (*httptest.Server, *[]string) {
+	t.Helper()
+	var requests []string
+	polls := 0
+	operation := func(current string) object {
+		return object{"operation": object{"ID": operationID, "Type": "update", "Status": current, "EnvironmentID": environmentID,
+			"Results": []object{{"Object": "Deployment/web", "Status": current, "Message": "rollout " + current}}}}
+	}
+
+	mux := http.NewServeMux()
+	// the token returned by login is already expired, it is renewed with the refresh token
+	mux.HandleFunc("POST /api/v1/login", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, object{"message": "Logged in", "token": "expired", "refreshToken": "refresh-1"})
+	})
+	mux.HandleFunc("POST /api/v1/refresh", func(w http.ResponseWriter, r *http.Request) {
+		var form map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&form)
+		if form["refreshToken"] != "refresh-1" {
+			writeJSON(w, http.StatusUnauthorized, object{"message": "Session is expired or revoked"})
+			return
+		}
+		writeJSON(w, http.StatusOK, object{"message": "Token refreshed", "token": "jwt", "refreshToken": "refresh-2"})
+	})
+	mux.HandleFunc("GET /api/v1/dashboard/environments/{e_id}/microservices", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, object{"microservices": []object{{"ID": microserviceID, "Kind": "StatefulSet", "Name": "web", "Namespace": "default", "Replicas": 3, "Strategy": "RollingUpdate",
+			"Containers": []object{{"Name": "web", "Image": "nginx:1.25"}}}}, "size": 1})
+	})
+	mux.HandleFunc("PATCH /api/v1/dashboard/environments/{e_id}/microservices/{m_id}", func(w http.ResponseWriter, r *http.Request) {
+		var form map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&form); err != nil {
+			t.Errorf("cannot decode the update form : %v", err)
+		}
+		requests = append(requests, "update "+r.PathValue("m_id")+" "+form["strategy"].(string)+" "+form["image"].(string))
+		if form["replicas"] != float64(3) {
+			t.Errorf("the replicas of the microservice should be kept, got %v", form["replicas"])
+		}
+		writeJSON(w, http.StatusAccepted, operation("pending"))
+	})
+	mux.HandleFunc("POST /api/v1/dashboard/environments/{e_id}/microservices/with-yaml", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Errorf("cannot parse the form : %v", err)
+		}
+		requests = append(requests, "deploy "+r.FormValue("namespace")+" "+r.FormValue("wait")+" "+r.MultipartForm.File["files"][0].Filename)
+		writeJSON(w, http.StatusAccepted, operation("pending"))
+	})
+	mux.HandleFunc("GET /api/v1/dashboard/environments/{e_id}/operations/{op_id}", func(w http.ResponseWriter, r *http.Request) {
+		polls++
+		if polls < 2 {
+			writeJSON(w, http.StatusOK, operation("running"))
+			return
+		}
+		writeJSON(w, http.StatusOK, operation(status))
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/login" && r.URL.Path != "/api/v1/refresh" && r.Header.Get("Authorization") != "Bearer jwt" {
+			writeJSON(w, http.StatusUnauthorized, object{"message": "Unauthorized"})
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+type object map[string]any
+
+func writeJSON(w http.ResponseWriter, code int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func runKdictl(t *testing.T, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func setup(t *testing.T) {
+	t.Setenv("KDICTL_CONFIG", filepath.Join(t.TempDir(), "config.json"))
+	t.Setenv("KDI_SERVER", "")
+	t.Setenv("KDI_TOKEN", "")
+	pollInterval = time.Millisecond
+}
+
+func TestLoginSavesTheTokens(t *testing.T) {
+	setup(t)
+	server, _ := fakeAPI(t, "succeeded")
+
+	if code, _, stderr := runKdictl(t, "get", "microservices", "--environment", environmentID); code != exitFailed || !strings.Contains(stderr, "not logged in") {
+		t.Fatalf("expected an error before the login, got %d %q", code, stderr)
+	}
+	if code, _, stderr := runKdictl(t, "login", "--server", server.URL+"/api/v1", "--email", "dev@kdi.io", "--password", "secret"); code != exitOK {
+		t.Fatalf("login failed : %d %s", code, stderr)
+	}
+	code, stdout, stderr := runKdictl(t, "get", "microservices", "--environment", environmentID, "-o", "json")
+	if code != exitOK {
+		t.Fatalf("get failed : %d %s", code, stderr)
+	}
+	var microservices []Microservice
+	if err := json.Unmarshal([]byte(stdout), &microservices); err != nil {
+		t.Fatalf("invalid json output %q : %v", stdout, err)
+	}
+	if len(microservices) != 1 || microservices[0].Name != "web" || microservices[0].Kind != "StatefulSet" || microservices[0].Containers[0].Image != "nginx:1.25" {
+		t.Errorf("unexpected microservices %+v", microservices)
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Token != "jwt" || cfg.RefreshToken != "refresh-2" {
+		t.Errorf("the refreshed tokens should be saved, got %+v", cfg)
+	}
+}
+
+func TestUpdateWaitsForTheOperation(t *testing.T) {
+	setup(t)
+	server, requests := fakeAPI(t, "succeeded")
+
+	code, stdout, stderr := runKdictl(t, "update", "web", "--server", server.URL+"/api/v1", "--token", "jwt",
+		"--environment", environmentID, "--strategy", "canary", "--image", "nginx:1.27")
+	if code != exitOK {
+		t.Fatalf("update failed : %d %s", code, stderr)
+	}
+	if got := strings.Join(*requests, ";"); got != "update "+microserviceID+" canary nginx:1.27" {
+		t.Errorf("unexpected requests %q", got)
+	}
+	if !strings.Contains(stdout, "succeeded") || !strings.Contains(stdout, "Deployment/web") {
+		t.Errorf("the results of the operation should be printed, got %q", stdout)
+	}
+}
+
+func TestDeployExitsWithAnErrorWhenTheOperationFails(t *testing.T) {
+	setup(t)
+	server, requests := fakeAPI(t, "failed")
+	manifest := filepath.Join(t.TempDir(), "web.yaml")
+	if err := os.WriteFile(manifest, []byte("kind: Deployment\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	code, stdout, stderr := runKdictl(t, "deploy", "--server", server.URL+"/api/v1", "--token", "jwt",
+		"--environment", environmentID, "--namespace", "staging", manifest)
+	if code != exitFailed {
+		t.Fatalf("expected the exit code %d, got %d (%s)", exitFailed, code, stderr)
+	}
+	if got := strings.Join(*requests, ";"); got != "deploy staging true web.yaml" {
+		t.Errorf("unexpected requests %q", got)
+	}
+	if !strings.Contains(stdout, "rollout failed") {
+		t.Errorf("the results of the operation should be printed, got %q", stdout)
+	}
+}
+
+func TestUsageErrors(t *testing.T) {
+	setup(t)
+	for _, args := range [][]string{
+		{},
+		{"unknown"},
+		{"get"},
+		{"get", "clusters", "--token", "jwt"},
+		{"update", "web", "--token", "jwt", "--environment", environmentID, "--strategy", "unknown"},
+		{"deploy", "--token", "jwt", "--environment", environmentID},
+		{"get", "teamspaces", "-o", "yaml"},
+	} {
+		if code, _, _ := runKdictl(t, args...); code != exitUsage {
+			t.Errorf("kdictl %s : expected the exit code %d, got %d", strings.Join(args, " "), exitUsage, code)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+// kdictl is the command-line client of the web api, made for the CI pipelines.
+// It deploys through the web api so that the permissions and the history of the operations stay in KDI.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Exit codes
+const (
+	exitOK     = 0
+	exitFailed = 1 // A call to the web api or an operation failed
+	exitUsage  = 2
+)
+
+const defaultServer = "http://localhost:8070/api/v1"
+
+// pollInterval is the interval between two checks of an operation
+var pollInterval = 2 * time.Second
+
+const usage = `kdictl is the command-line client of KDI.
+
+Usage:
+  kdictl login --email EMAIL [--password PASSWORD]
+  kdictl get teamspaces|projects|environments|microservices [flags]
+  kdictl deploy --environment ID [--namespace NS] [--timeout SECONDS] [--no-wait] FILE...
+  kdictl update --environment ID [--strategy STRATEGY] [--image IMAGE] [flags] MICROSERVICE
+  kdictl operation --environment ID [--wait] OPERATION
+
+The server and the token are read from --server and --token, then from KDI_SERVER and KDI_TOKEN,
+then from the config saved by login. Every command accepts -o table|json.
+Run "kdictl COMMAND -h" for the flags of a command.
+`
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	os.Exit(run(ctx, os.Args[1:], os.Stdout, os.Stderr))
+}
+
+type command func(ctx context.Context, cli *cli, args []string) error
+
+var commands = map[string]command{
+	"login":     login,
+	"get":       get,
+	"deploy":    deploy,
+	"update":    update,
+	"operation": operation,
+}
+
+// cli holds the flags shared by the commands
+type cli struct {
+	flags        *flag.FlagSet
+	server       string
+	token        string
+	refreshToken string // Only set for the token saved by login
+	output       string
+
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// errUsage is returned for invalid arguments
+type errUsage struct {
+	message string
+}
+
+func (e errUsage) Error() string {
+	return e.message
+}
+
+func usageError(format string, args ...any) error {
+	return errUsage{fmt.Sprintf(format, args...)}
+}
+
+// errOperationFailed is returned when the operation awaited failed, its results are already printed
+var errOperationFailed = errors.New("the operation failed")
+
+func run(ctx context.Context, args []string, stdout io.Writer, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		fmt.Fprint(stderr, usage)
+		if len(args) == 0 {
+			return exitUsage
+		}
+		return exitOK
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "unknown command %q\n\n%s", args[0], usage)
+		return exitUsage
+	}
+
+	c := &cli{
+		flags:  flag.NewFlagSet("kdictl "+args[0], flag.ContinueOnError),
+		stdout: stdout,
+		stderr: stderr,
+	}
+	c.flags.SetOutput(stderr)
+	c.flags.StringVar(&c.server, "server", os.Getenv("KDI_SERVER"), "The url of the web api, with /api/v1")
+	c.flags.StringVar(&c.token, "token", os.Getenv("KDI_TOKEN"), "The token of the user")
+	c.flags.StringVar(&c.output, "o", "table", "The output format : table or json")
+
+	err := cmd(ctx, c, args[1:])
+	var usageErr errUsage
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, flag.ErrHelp):
+		return exitOK
+	case errors.As(err, &usageErr):
+		if usageErr.message != "" {
+			fmt.Fprintf(stderr, "%v\n", err)
+			c.flags.Usage()
+		}
+		return exitUsage
+	case errors.Is(err, errOperationFailed):
+		return exitFailed
+	default:
+		fmt.Fprintf(stderr, "Error : %v\n", err)
+		return exitFailed
+	}
+}
+
+// parse parses the flags of the command and completes the server and the token with the saved config
+func (c *cli) parse(args []string) error {
+	if err := c.flags.Parse(interspersed(c.flags, args)); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		// the flag package already printed the error and the usage
+		return errUsage{}
+	}
+	if c.output != "table" && c.output != "json" {
+		return usageError("invalid output %q, expected table or json", c.output)
+	}
+	if c.server == "" || c.token == "" {
+		cfg, err := loadConfig()
+		if err != nil {
+			return fmt.Errorf("cannot read the config : %w", err)
+		}
+		if c.server == "" {
+			c.server = cfg.Server
+		}
+		if c.token == "" {
+			c.token, c.refreshToken = cfg.Token, cfg.RefreshToken
+		}
+	}
+	if c.server == "" {
+		c.server = defaultServer
+	}
+	c.server = strings.TrimSuffix(c.server, "/")
+	return nil
+}
+
+// api returns the client of the web api, the commands other than login need a token
+func (c *cli) api(authenticated bool) (*api, error) {
+	if authenticated && c.token == "" {
+		return nil, errors.New("not logged in, run kdictl login or set KDI_TOKEN")
+	}
+	a := &api{server: c.server, token: c.token, refreshToken: c.refreshToken, httpClient: &http.Client{Timeout: time.Minute}}
+	// the tokens of the session are replaced at each refresh
+	a.onRefresh = func(token string, refreshToken string) {
+		if err := saveConfig(config{Server: c.server, Token: token, RefreshToken: refreshToken}); err != nil {
+			fmt.Fprintf(c.stderr, "Warning : cannot save the refreshed token : %v\n", err)
+		}
+	}
+	return a, nil
+}
+
+// interspersed moves the arguments after the flags so that flags can follow them, as in kdictl get projects -o json
+func interspersed(flags *flag.FlagSet, args []string) []string {
+	var ordered, positional []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			positional = append(positional, args[i+1:]...)
+			break
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			positional = append(positional, arg)
+			continue
+		}
+		ordered = append(ordered, arg)
+		name := strings.TrimLeft(arg, "-")
+		if strings.Contains(name, "=") {
+			continue
+		}
+		// the value of a flag which is not a boolean is the next argument
+		if f := flags.Lookup(name); f != nil && !isBoolFlag(f) && i+1 < len(args) {
+			i++
+			ordered = append(ordered, args[i])
+		}
+	}
+	return append(append(ordered, "--"), positional...)
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
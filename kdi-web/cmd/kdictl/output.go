@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+)
+
+// table aligns the columns of the rows printed
+type table struct {
+	writer *tabwriter.Writer
+}
+
+func (t *table) row(columns ...string) {
+	fmt.Fprintln(t.writer, strings.Join(columns, "\t"))
+}
+
+// print prints the value in JSON, or as the table written by rows
+func (c *cli) print(value any, rows func(t *table)) error {
+	if c.output == "json" {
+		encoder := json.NewEncoder(c.stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	}
+	t := &table{writer: tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)}
+	rows(t)
+	return t.writer.Flush()
+}
+
+func (c *cli) printOperation(op *Operation) error {
+	return c.print(op, func(t *table) {
+		fmt.Fprintf(t.writer, "Operation %s (%s) : %s\n", op.ID, op.Type, op.Status)
+		if op.Error != "" {
+			fmt.Fprintf(t.writer, "Error : %s\n", op.Error)
+		}
+		for _, message := range op.Messages["error"] {
+			fmt.Fprintf(t.writer, "Error : %s\n", message)
+		}
+		if len(op.Results) == 0 {
+			return
+		}
+		t.row("OBJECT", "STATUS", "MESSAGE")
+		for _, result := range op.Results {
+			t.row(result.Object, result.Status, result.Message)
+			for _, violation := range result.Violations {
+				t.row("", violation.Severity, violation.Rule+" : "+violation.Message)
+			}
+		}
+	})
+}
@@ -1,13 +1,13 @@
 package controllers
 
 import (
-	"encoding/json"
-	"log"
+	"context"
 	"net/http"
 	"os"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/kuro-jojo/kdi-k8s/shared/logging"
 	"github.com/kuro-jojo/kdi-web/db"
 	"github.com/kuro-jojo/kdi-web/models"
 	"github.com/kuro-jojo/kdi-web/models/utils"
@@ -23,6 +23,13 @@ type ClusterForm struct {
 	Port        string `json:"port"`
 	Token       string `json:"token"`
 
+	// tls fields
+	CAData         string `json:"caData"`
+	TLSServerName  string `json:"tlsServerName"`
+	ClientCertData string `json:"clientCertData"`
+	ClientKeyData  string `json:"clientKeyData"`
+	Insecure       bool   `json:"insecure"`
+
 	// aws eks fields
 	Region      string `json:"region"`
 	AccessKeyID string `json:"accessKeyID"`
@@ -34,11 +41,11 @@ type ClusterForm struct {
 }
 
 func TestConnectionToCluster(c *gin.Context) {
-	log.Println("Testing connection to cluster...")
+	logging.Logger(c).Debug("Testing connection to cluster...")
 
 	var clusterForm ClusterForm
-	if c.BindJSON(&clusterForm) != nil {
-		log.Printf("Invalid form : %v", c.BindJSON(&clusterForm).Error())
+	if err := c.BindJSON(&clusterForm); err != nil {
+		logging.Logger(c).Warn("Invalid form", "error", err)
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid form"})
 		return
 	}
@@ -47,7 +54,7 @@ func TestConnectionToCluster(c *gin.Context) {
 	switch clusterForm.Type {
 	case models.TypeEKS:
 		if clusterForm.Region == "" || clusterForm.AccessKeyID == "" || clusterForm.SecretKey == "" {
-			log.Println("Invalid form fields : missing region, accessKeyID or secretAccess")
+			logging.Logger(c).Warn("Invalid form fields : missing region, accessKeyID or secretAccess")
 			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid form fields : missing region, accessKeyID or secretAccess"})
 			return
 		}
@@ -60,18 +67,29 @@ func TestConnectionToCluster(c *gin.Context) {
 		}
 	default:
 		if clusterForm.Address == "" || clusterForm.Token == "" {
-			log.Println("Invalid form fields")
+			logging.Logger(c).Warn("Invalid form fields")
 			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid form fields : missing address or token"})
 			return
 		}
 
+		if code, message := checkClusterTLSFields(c.Request.Context(), clusterForm); code != 0 {
+			c.JSON(code, gin.H{"message": message})
+			return
+		}
+
 		cluster = models.Cluster{
 			Address: clusterForm.Address,
 			Port:    clusterForm.Port,
+
+			CAData:         clusterForm.CAData,
+			TLSServerName:  clusterForm.TLSServerName,
+			ClientCertData: clusterForm.ClientCertData,
+			ClientKeyData:  clusterForm.ClientKeyData,
+			Insecure:       clusterForm.Insecure,
 		}
 		exp, err := GetTokenExpirationDate(clusterForm.Token)
 		if err != nil {
-			log.Printf("Error getting token expiration date: %v", err)
+			logging.Logger(c).Error("Error getting token expiration date", "error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
 			return
 		}
@@ -79,50 +97,48 @@ func TestConnectionToCluster(c *gin.Context) {
 		cluster.ExpiryDate = exp
 	}
 
-	token, err := generateClusterJWT(cluster, clusterForm.Token)
+	token, err := generateClusterJWT(c.Request.Context(), cluster, clusterForm.Token)
 	if err != nil {
-		log.Printf("Error generating cluster token: %v", err)
+		logging.Logger(c).Error("Error generating cluster token", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
 		return
 	}
 
 	cluster.Token = token
 	// Make a request to the kubernetes api
-	resp, body, ok := MakeRequestToKubernetesAPI(c, cluster, "GET", "/auth", c.Request.Body)
-	if !ok {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), KubernetesAPITimeout)
+	defer cancel()
+	if err := kubernetesAPI(cluster).Auth(ctx); err != nil {
+		logging.Logger(c).Error("Error connecting to the cluster", "error", err)
+		RespondWithK8sApiError(c, err)
 		return
 	}
 
-	if resp.StatusCode != 200 {
-		message := make(map[string]string)
-		err = json.Unmarshal(body, &message)
-		if err != nil {
-			log.Printf("Error unmarshalling response body %v", err)
-			c.JSON(resp.StatusCode, gin.H{"message": string(body)})
-			return
-		}
-		log.Printf("Error making request : %v", message["message"])
-		c.JSON(resp.StatusCode, message)
-		return
+	logging.Logger(c).Info("Connection to cluster successful")
+	response := gin.H{"message": "Connection to cluster successful"}
+	// the inventory helps to check that this is the expected cluster, failing to get it does not fail the test
+	inventory, err := fetchClusterInventory(c.Request.Context(), cluster)
+	if err != nil {
+		logging.Logger(c).Error("Error getting the inventory of the cluster", "error", err)
+	} else {
+		response["inventory"] = inventory
 	}
-
-	log.Println("Connection to cluster successful")
-	c.JSON(http.StatusOK, gin.H{"message": "Connection to cluster successful"})
+	c.JSON(http.StatusOK, response)
 }
 
 func AddCluster(c *gin.Context) {
-	log.Println("Creating cluster...")
+	logging.Logger(c).Debug("Creating cluster...")
 
 	user, driver := GetUserFromContext(c)
 
 	var clusterForm ClusterForm
-	if c.BindJSON(&clusterForm) != nil {
-		log.Printf("Invalid form : %v", c.BindJSON(&clusterForm).Error())
+	if err := c.BindJSON(&clusterForm); err != nil {
+		logging.Logger(c).Warn("Invalid form", "error", err)
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid form"})
 		return
 	}
 
-	cluster, code, message := setupCluster(driver, clusterForm, user)
+	cluster, code, message := setupCluster(c.Request.Context(), driver, clusterForm, user)
 	if code != 0 {
 		c.JSON(code, gin.H{"message": message})
 		return
@@ -131,7 +147,7 @@ func AddCluster(c *gin.Context) {
 	cluster.CreatedAt = time.Now()
 	err := cluster.Add(driver)
 	if err != nil {
-		log.Printf("Error creating cluster %v", err)
+		logging.Logger(c).Warn("Error creating cluster", "error", err)
 		if er := utils.OnDuplicateKeyError(err, "Cluster"); er != nil {
 			c.JSON(http.StatusConflict, gin.H{"message": er.Error()})
 		} else {
@@ -139,30 +155,37 @@ func AddCluster(c *gin.Context) {
 		}
 		return
 	}
-	log.Println("Cluster created successfully")
+	logging.Logger(c).Info("Cluster created successfully")
+	// the request is over when the inventory is refreshed, its logger is kept
+	logger := logging.Logger(c)
+	go func() {
+		if err := refreshClusterInventory(context.Background(), driver, &cluster); err != nil {
+			logger.Error("Error getting the inventory of cluster", "cluster", cluster.Name, "error", err)
+		}
+	}()
 	c.JSON(http.StatusCreated, gin.H{"message": "Cluster created successfully"})
 }
 
 func UpdateCluster(c *gin.Context) {
-	log.Println("Editing cluster...")
+	logging.Logger(c).Debug("Editing cluster...")
 
 	user, driver := GetUserFromContext(c)
 
 	var clusterForm ClusterForm
-	if c.BindJSON(&clusterForm) != nil {
-		log.Printf("Invalid form : %v", c.BindJSON(&clusterForm).Error())
+	if err := c.BindJSON(&clusterForm); err != nil {
+		logging.Logger(c).Warn("Invalid form", "error", err)
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid form"})
 		return
 	}
 
 	id, err := primitive.ObjectIDFromHex(c.Param("id"))
 	if err != nil {
-		log.Printf("Invalid cluster ID %v", err)
+		logging.Logger(c).Warn("Invalid cluster ID", "error", err)
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid cluster ID"})
 		return
 	}
 
-	cluster, code, message := setupCluster(driver, clusterForm, user)
+	cluster, code, message := setupCluster(c.Request.Context(), driver, clusterForm, user)
 	if code != 0 {
 		c.JSON(code, gin.H{"message": message})
 		return
@@ -177,7 +200,7 @@ func UpdateCluster(c *gin.Context) {
 
 	err = cluster.Update(driver)
 	if err != nil {
-		log.Printf("Error creating cluster %v", err)
+		logging.Logger(c).Warn("Error creating cluster", "error", err)
 		if er := utils.OnDuplicateKeyError(err, "Cluster"); er != nil {
 			c.JSON(http.StatusConflict, gin.H{"message": er.Error()})
 		} else {
@@ -185,24 +208,24 @@ func UpdateCluster(c *gin.Context) {
 		}
 		return
 	}
-	log.Println("Cluster edited successfully")
+	logging.Logger(c).Info("Cluster edited successfully")
 	c.JSON(http.StatusCreated, gin.H{"message": "Cluster edited successfully"})
 }
 
 func DeleteCluster(c *gin.Context) {
-	log.Println("Deleting cluster...")
+	logging.Logger(c).Debug("Deleting cluster...")
 
 	user, driver := GetUserFromContext(c)
 
 	clusterID := c.Param("id")
 	if clusterID == "" {
-		log.Println("Invalid cluster ID")
+		logging.Logger(c).Warn("Invalid cluster ID")
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid cluster ID"})
 		return
 	}
 	id, err := primitive.ObjectIDFromHex(c.Param("id"))
 	if err != nil {
-		log.Printf("Invalid cluster ID %v", err)
+		logging.Logger(c).Warn("Invalid cluster ID", "error", err)
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid cluster ID"})
 		return
 	}
@@ -218,7 +241,7 @@ func DeleteCluster(c *gin.Context) {
 
 	err = cluster.Delete(driver)
 	if err != nil {
-		log.Printf("Error deleting cluster %v", err)
+		logging.Logger(c).Warn("Error deleting cluster", "error", err)
 		if utils.OnNotFoundError(err, "Cluster") != nil {
 			c.JSON(http.StatusNotFound, gin.H{"message": "Cluster not found"})
 		} else {
@@ -226,13 +249,13 @@ func DeleteCluster(c *gin.Context) {
 		}
 		return
 	}
-	log.Println("Cluster deleted successfully")
+	logging.Logger(c).Info("Cluster deleted successfully")
 	c.JSON(http.StatusOK, gin.H{"message": "Cluster deleted successfully"})
 }
 
 // GetClustersByCreator returns all clusters of the current user
 func GetClustersByCreator(c *gin.Context) {
-	log.Println("Listing all clusters of the current user...")
+	logging.Logger(c).Debug("Listing all clusters of the current user...")
 	user, driver := GetUserFromContext(c)
 
 	cluster := models.Cluster{
@@ -241,7 +264,7 @@ func GetClustersByCreator(c *gin.Context) {
 
 	clusters, err := cluster.GetAllByCreator(driver)
 	if err != nil {
-		log.Printf("Error getting cluster %v", err)
+		logging.Logger(c).Warn("Error getting cluster", "error", err)
 		if utils.OnNotFoundError(err, "Cluster") != nil {
 			c.JSON(http.StatusNotFound, gin.H{"message": "Cluster not found"})
 		} else {
@@ -249,24 +272,24 @@ func GetClustersByCreator(c *gin.Context) {
 		}
 		return
 	}
-	log.Println("Clusters retrieved successfully")
+	logging.Logger(c).Info("Clusters retrieved successfully")
 	c.JSON(http.StatusOK, gin.H{"clusters": clusters, "size": len(clusters)})
 }
 
 // GetClusterByIDAndCreator returns a cluster by its ID only if the creator is the one making the request
 func GetClusterByIDAndCreator(c *gin.Context) {
-	log.Println("Getting cluster by ID...")
+	logging.Logger(c).Debug("Getting cluster by ID...")
 	user, driver := GetUserFromContext(c)
 
 	clusterID := c.Param("id")
 	if clusterID == "" {
-		log.Println("Invalid cluster ID")
+		logging.Logger(c).Warn("Invalid cluster ID")
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid cluster ID"})
 		return
 	}
 	id, err := primitive.ObjectIDFromHex(clusterID)
 	if err != nil {
-		log.Printf("Invalid cluster ID %v", err)
+		logging.Logger(c).Warn("Invalid cluster ID", "error", err)
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid cluster ID"})
 		return
 	}
@@ -277,7 +300,7 @@ func GetClusterByIDAndCreator(c *gin.Context) {
 
 	err = cluster.GetByCreator(driver, user.ID)
 	if err != nil {
-		log.Printf("Error getting cluster %v", err)
+		logging.Logger(c).Warn("Error getting cluster", "error", err)
 		if utils.OnNotFoundError(err, "Cluster") != nil {
 			c.JSON(http.StatusNotFound, gin.H{"message": "Cluster not found"})
 		} else {
@@ -291,14 +314,14 @@ func GetClusterByIDAndCreator(c *gin.Context) {
 		// Retreive the cluster token from the JWT token
 		token, err := GetClusterTokenFromJWT(cluster.Token)
 		if err != nil {
-			log.Printf("Error getting cluster token from JWT %v", err)
+			logging.Logger(c).Error("Error getting cluster token from JWT", "error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error getting cluster token from JWT"})
 			return
 		}
 		cluster.Token = token
 	}
 
-	log.Println("Cluster retrieved successfully")
+	logging.Logger(c).Info("Cluster retrieved successfully")
 	c.JSON(http.StatusOK, gin.H{"cluster": cluster})
 }
 
@@ -315,7 +338,7 @@ func GetClusterName(c *gin.Context) {
 	err := cluster.Get(driver)
 
 	if err != nil {
-		log.Printf("Error getting cluster %v", err)
+		logging.Logger(c).Warn("Error getting cluster", "error", err)
 		if er := utils.OnDuplicateKeyError(err, "Cluster"); er != nil {
 			c.JSON(http.StatusConflict, gin.H{"message": er.Error()})
 		} else {
@@ -330,18 +353,18 @@ func GetClusterName(c *gin.Context) {
 
 // GetClustersByTeamspace returns all clusters of the teamspace the user is in
 func GetClustersByTeamspace(c *gin.Context) {
-	log.Println("Getting clusters by teamspace...")
+	logging.Logger(c).Debug("Getting clusters by teamspace...")
 	user, driver := GetUserFromContext(c)
 
 	teamspaceID := c.Param("id")
 	if teamspaceID == "" {
-		log.Println("Invalid teamspace ID")
+		logging.Logger(c).Warn("Invalid teamspace ID")
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid teamspace ID"})
 		return
 	}
 	id, err := primitive.ObjectIDFromHex(teamspaceID)
 	if err != nil {
-		log.Printf("Invalid teamspace ID %v", err)
+		logging.Logger(c).Warn("Invalid teamspace ID", "error", err)
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid teamspace ID"})
 		return
 	}
@@ -352,7 +375,7 @@ func GetClustersByTeamspace(c *gin.Context) {
 
 	err = teamspace.Get(driver)
 	if err != nil {
-		log.Printf("Error getting teamspace %v", err)
+		logging.Logger(c).Warn("Error getting teamspace", "error", err)
 		if utils.OnNotFoundError(err, "Teamspace") != nil {
 			c.JSON(http.StatusNotFound, gin.H{"message": "Teamspace not found"})
 		} else {
@@ -362,7 +385,7 @@ func GetClustersByTeamspace(c *gin.Context) {
 	}
 	yes := teamspace.HasMember(driver, models.Member{UserID: user.ID.Hex()})
 	if !yes {
-		log.Printf("User %s is not a member of the teamspace", user.ID)
+		logging.Logger(c).Warn("User is not a member of the teamspace", logging.KeyUserID, user.ID.Hex())
 		c.JSON(http.StatusForbidden, gin.H{"message": "You are not a member of the teamspace"})
 		return
 	}
@@ -373,7 +396,7 @@ func GetClustersByTeamspace(c *gin.Context) {
 
 	clusters, err := cluster.GetAllByTeamspace(driver)
 	if err != nil {
-		log.Printf("Error getting clusters %v", err)
+		logging.Logger(c).Warn("Error getting clusters", "error", err)
 		if utils.OnNotFoundError(err, "Cluster") != nil {
 			c.JSON(http.StatusNotFound, gin.H{"message": "Cluster not found"})
 		} else {
@@ -381,7 +404,7 @@ func GetClustersByTeamspace(c *gin.Context) {
 		}
 		return
 	}
-	log.Println("Clusters retrieved successfully")
+	logging.Logger(c).Info("Clusters retrieved successfully")
 	c.JSON(http.StatusOK, gin.H{"clusters": clusters, "size": len(clusters)})
 }
 
@@ -393,14 +416,14 @@ func UserHasRightOnCluster(c *gin.Context, driver db.Driver, cluster models.Clus
 		return true
 	}
 	if utils.OnNotFoundError(err, "Cluster") == nil {
-		log.Printf("Error getting cluster %v", err)
+		logging.Logger(c).Error("Error getting cluster", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error getting cluster"})
 		return false
 	}
 
 	// or if the cluster is in a teamspace check if the user is a member of the teamspace and has the right permissions
 	if len(cluster.Teamspaces) == 0 {
-		log.Printf("Error getting cluster %v", err)
+		logging.Logger(c).Warn("Error getting cluster", "error", err)
 		if utils.OnNotFoundError(err, "Cluster") != nil {
 			c.JSON(http.StatusNotFound, gin.H{"message": "Cluster not found"})
 			return false
@@ -410,7 +433,7 @@ func UserHasRightOnCluster(c *gin.Context, driver db.Driver, cluster models.Clus
 		for _, teamspaceID := range cluster.Teamspaces {
 			t_id, err := primitive.ObjectIDFromHex(teamspaceID)
 			if err != nil {
-				log.Printf("Invalid teamspace ID %v", err)
+				logging.Logger(c).Warn("Invalid teamspace ID", "error", err)
 				// c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid teamspace ID"})
 				// return false
 				continue
@@ -419,36 +442,39 @@ func UserHasRightOnCluster(c *gin.Context, driver db.Driver, cluster models.Clus
 				ID: t_id,
 			}
 			// Check if the user has the right to udpate or delete the teamspace
-			yes, _, _ := MemberHasEnoughPrivilege(driver, roles, teamspace, user)
+			yes, _, _ := MemberHasEnoughPrivilege(c.Request.Context(), driver, roles, teamspace, user)
 			if yes {
 				return true
 			}
 		}
-		log.Printf("User %s does not have the right to update or delete the cluster", user.ID)
+		logging.Logger(c).Warn("User does not have the right to update or delete the cluster", logging.KeyUserID, user.ID.Hex())
 		c.JSON(http.StatusForbidden, gin.H{"message": "You do not have the right to update or delete the cluster"})
 		return false
 	}
 	return true
 }
 
-func setupCluster(driver db.Driver, clusterForm ClusterForm, user models.User) (models.Cluster, int, string) {
+func setupCluster(ctx context.Context, driver db.Driver, clusterForm ClusterForm, user models.User) (models.Cluster, int, string) {
 	var cluster models.Cluster
 
 	switch clusterForm.Type {
 	case models.TypeEKS:
 		if clusterForm.Region == "" || clusterForm.AccessKeyID == "" || clusterForm.SecretKey == "" {
-			log.Println("Invalid form fields : missing region, accessKeyID or secretAccess")
+			logging.FromContext(ctx).Warn("Invalid form fields : missing region, accessKeyID or secretAccess")
 			return models.Cluster{}, http.StatusBadRequest, "Invalid form fields : missing region, accessKeyID or secretAccess"
 		}
 
 	default:
 		if clusterFormIsInValid(clusterForm) {
-			log.Println("Invalid form fields")
+			logging.FromContext(ctx).Warn("Invalid form fields")
 			return models.Cluster{}, http.StatusBadRequest, "Invalid form fields : missing address or token"
 		}
+		if code, message := checkClusterTLSFields(ctx, clusterForm); code != 0 {
+			return models.Cluster{}, code, message
+		}
 		exp, err := GetTokenExpirationDate(clusterForm.Token)
 		if err != nil {
-			log.Printf("Error getting token expiration date: %v", err)
+			logging.FromContext(ctx).Error("Error getting token expiration date", "error", err)
 			return models.Cluster{}, http.StatusInternalServerError, err.Error()
 		}
 		cluster.ExpiryDate = exp
@@ -461,6 +487,12 @@ func setupCluster(driver db.Driver, clusterForm ClusterForm, user models.User) (
 		Address:     clusterForm.Address,
 		Port:        clusterForm.Port,
 
+		CAData:         clusterForm.CAData,
+		TLSServerName:  clusterForm.TLSServerName,
+		ClientCertData: clusterForm.ClientCertData,
+		ClientKeyData:  clusterForm.ClientKeyData,
+		Insecure:       clusterForm.Insecure,
+
 		Region:      clusterForm.Region,
 		AccessKeyID: clusterForm.AccessKeyID,
 		SecretKey:   clusterForm.SecretKey,
@@ -478,7 +510,7 @@ func setupCluster(driver db.Driver, clusterForm ClusterForm, user models.User) (
 		}
 		ts, err := t.GetAllByCreator(driver)
 		if err != nil {
-			log.Printf("Error getting teamspace %v", err)
+			logging.FromContext(ctx).Error("Error getting teamspace", "error", err)
 			return models.Cluster{}, http.StatusInternalServerError, err.Error()
 		}
 		for _, ts := range ts {
@@ -486,17 +518,17 @@ func setupCluster(driver db.Driver, clusterForm ClusterForm, user models.User) (
 		}
 	}
 
-	token, err := generateClusterJWT(cluster, clusterForm.Token)
+	token, err := generateClusterJWT(ctx, cluster, clusterForm.Token)
 	if err != nil {
-		log.Printf("Error generating cluster token: %v", err)
+		logging.FromContext(ctx).Error("Error generating cluster token", "error", err)
 		return models.Cluster{}, http.StatusInternalServerError, err.Error()
 	}
 	cluster.Token = token
 	return cluster, 0, ""
 }
 
-func generateClusterJWT(cluster models.Cluster, token string) (string, error) {
-	log.Println("Generating cluster JWT...")
+func generateClusterJWT(ctx context.Context, cluster models.Cluster, token string) (string, error) {
+	logging.FromContext(ctx).Debug("Generating cluster JWT...")
 	claims := make(map[string]interface{})
 	claims["sub"] = os.Getenv("KDI_JWT_SUB_FOR_K8S_API")
 	claims["token"] = token
@@ -506,6 +538,11 @@ func generateClusterJWT(cluster models.Cluster, token string) (string, error) {
 	claims["access-key-id"] = cluster.AccessKeyID
 	claims["secret-key-id"] = cluster.SecretKey
 	claims["region"] = cluster.Region
+	claims["ca-data"] = cluster.CAData
+	claims["tls-server-name"] = cluster.TLSServerName
+	claims["client-cert-data"] = cluster.ClientCertData
+	claims["client-key-data"] = cluster.ClientKeyData
+	claims["insecure"] = cluster.Insecure
 	// TODO: same expiration date as the token
 	if !cluster.ExpiryDate.IsZero() {
 		claims["exp"] = cluster.ExpiryDate.Unix()
@@ -514,6 +551,19 @@ func generateClusterJWT(cluster models.Cluster, token string) (string, error) {
 	return GenerateJWT(claims)
 }
 
+// checkClusterTLSFields checks that the TLS fields of the form are consistent
+func checkClusterTLSFields(ctx context.Context, form ClusterForm) (int, string) {
+	if (form.ClientCertData == "") != (form.ClientKeyData == "") {
+		logging.FromContext(ctx).Warn("Invalid form fields : client certificate and client key must be provided together")
+		return http.StatusBadRequest, "Invalid form fields : client certificate and client key must be provided together"
+	}
+	if form.Insecure && form.CAData != "" {
+		logging.FromContext(ctx).Warn("Invalid form fields : a CA certificate cannot be used with the insecure mode")
+		return http.StatusBadRequest, "Invalid form fields : a CA certificate cannot be used with the insecure mode"
+	}
+	return 0, ""
+}
+
 func clusterFormIsInValid(form ClusterForm) bool {
 	return form.Name == "" || form.Address == "" || form.Token == "" ||
 		(form.Type != models.TypeOpenshift && form.Type != models.TypeGKE && form.Type != models.TypeEKS && form.Type != models.TypeAKS && form.Type != models.TypeOnprem)
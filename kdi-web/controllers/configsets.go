@@ -0,0 +1,342 @@
+package controllers
+
+// This file contains the config sets of the environments : configmaps and secrets attached to the microservices
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kuro-jojo/kdi-k8s/client"
+	"github.com/kuro-jojo/kdi-k8s/shared/logging"
+	"github.com/kuro-jojo/kdi-web/db"
+	"github.com/kuro-jojo/kdi-web/models"
+	"github.com/kuro-jojo/kdi-web/models/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ConfigSetForm struct {
+	Name      string            `json:"name"`
+	Kind      string            `json:"kind"` // ConfigMap or Secret
+	Namespace string            `json:"namespace"`
+	Data      map[string]string `json:"data"`
+
+	RestartConsumers bool `json:"restartConsumers"` // Restart the microservices consuming the config set after an update
+}
+
+func GetConfigSetsByEnvironment(c *gin.Context) {
+	_, driver := GetUserFromContext(c)
+
+	configSet := models.ConfigSet{EnvironmentID: c.Param("e_id")}
+	configSets, err := configSet.GetAllByEnvironment(driver)
+	if err != nil {
+		logging.Logger(c).Error("Error getting config sets", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error getting config sets"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"configSets": configSets, "size": len(configSets)})
+}
+
+func GetConfigSet(c *gin.Context) {
+	_, driver := GetUserFromContext(c)
+
+	configSet, ok := getConfigSet(c, driver)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"configSet": configSet})
+}
+
+// CreateConfigSet saves the config set and creates its configmap or secret in the namespace of the environment's cluster
+func CreateConfigSet(c *gin.Context) {
+	user, driver := GetUserFromContext(c)
+
+	var form ConfigSetForm
+	if err := c.ShouldBindJSON(&form); err != nil || form.Name == "" || form.Namespace == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid form - Please provide the name, the kind and the namespace of the config set"})
+		return
+	}
+	if form.Kind != models.ConfigMapKind && form.Kind != models.SecretKind {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid kind - use ConfigMap or Secret"})
+		return
+	}
+
+	e_id := c.Param("e_id")
+	_, cluster, ok := getEnvironmentAndCluster(c, driver, e_id)
+	if !ok {
+		return
+	}
+
+	configSet := models.ConfigSet{
+		Name:          form.Name,
+		Kind:          form.Kind,
+		Namespace:     form.Namespace,
+		EnvironmentID: e_id,
+		CreatorID:     user.ID.Hex(),
+	}
+	setConfigSetData(&configSet, form.Data)
+
+	// The config set is saved first so that two config sets cannot share the same configmap or secret
+	err := configSet.Create(driver)
+	if err != nil {
+		logging.Logger(c).Warn("Error creating config set", "error", err)
+		if er := utils.OnDuplicateKeyError(err, "Config set"); er != nil {
+			c.JSON(http.StatusConflict, gin.H{"message": er.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error creating config set"})
+		}
+		return
+	}
+
+	if !applyConfigSet(c, cluster, configSet, form.Data) {
+		if err := configSet.Delete(driver); err != nil {
+			logging.Logger(c).Error("Error deleting config set", "error", err)
+		}
+		return
+	}
+
+	logging.Logger(c).Info("Config set created", "config_set", configSet.Name, "environment_id", e_id)
+	c.JSON(http.StatusCreated, gin.H{"message": "Config set created successfully", "configSet": configSet})
+}
+
+// UpdateConfigSet replaces the data of the config set.
+// The microservices consuming it only see the new values after a restart, which is done if asked.
+func UpdateConfigSet(c *gin.Context) {
+	_, driver := GetUserFromContext(c)
+
+	var form ConfigSetForm
+	if err := c.ShouldBindJSON(&form); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid form"})
+		return
+	}
+
+	configSet, ok := getConfigSet(c, driver)
+	if !ok {
+		return
+	}
+	_, cluster, ok := getEnvironmentAndCluster(c, driver, configSet.EnvironmentID)
+	if !ok {
+		return
+	}
+
+	if !applyConfigSet(c, cluster, configSet, form.Data) {
+		return
+	}
+	setConfigSetData(&configSet, form.Data)
+	if err := configSet.Update(driver); err != nil {
+		logging.Logger(c).Error("Error updating config set", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating config set"})
+		return
+	}
+
+	response := gin.H{"message": "Config set updated successfully", "configSet": configSet}
+	if form.RestartConsumers {
+		results, failed := restartConfigSetConsumers(c, driver, cluster, configSet)
+		response["results"] = results
+		if failed > 0 {
+			response["message"] = fmt.Sprintf("Config set updated but %d of %d microservices could not be restarted", failed, len(results))
+			logging.Logger(c).Info("Config set updated, consumers not restarted", "config_set", configSet.Name, "failed", failed)
+			c.JSON(http.StatusMultiStatus, response)
+			return
+		}
+	}
+
+	logging.Logger(c).Info("Config set updated", "config_set", configSet.Name)
+	c.JSON(http.StatusOK, response)
+}
+
+// DeleteConfigSet deletes the config set and its configmap or secret.
+// A config set still consumed by microservices cannot be deleted.
+func DeleteConfigSet(c *gin.Context) {
+	_, driver := GetUserFromContext(c)
+
+	configSet, ok := getConfigSet(c, driver)
+	if !ok {
+		return
+	}
+	if len(configSet.MicroserviceIDs) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"message": fmt.Sprintf("Config set %s is used by %d microservices - detach it first", configSet.Name, len(configSet.MicroserviceIDs))})
+		return
+	}
+	_, cluster, ok := getEnvironmentAndCluster(c, driver, configSet.EnvironmentID)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), KubernetesAPITimeout)
+	defer cancel()
+	// The configmap or secret may have been deleted directly from the cluster
+	err := kubernetesAPI(cluster).DeleteConfig(ctx, configSet.Namespace, configSet.Kind, configSet.Name)
+	if err != nil && !client.IsNotFound(err) {
+		logging.Logger(c).Error("Error deleting the config of the config set", "error", err)
+		RespondWithK8sApiError(c, err)
+		return
+	}
+
+	if err := configSet.Delete(driver); err != nil {
+		logging.Logger(c).Error("Error deleting config set", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error deleting config set"})
+		return
+	}
+
+	logging.Logger(c).Info("Config set deleted", "config_set", configSet.Name)
+	c.JSON(http.StatusOK, gin.H{"message": "Config set deleted successfully"})
+}
+
+// AttachConfigSet adds the config set to the environment variables of the microservice
+func AttachConfigSet(c *gin.Context) {
+	updateConfigSetConsumer(c, true)
+}
+
+// DetachConfigSet removes the config set from the environment variables of the microservice
+func DetachConfigSet(c *gin.Context) {
+	updateConfigSetConsumer(c, false)
+}
+
+func updateConfigSetConsumer(c *gin.Context, attach bool) {
+	_, driver := GetUserFromContext(c)
+
+	configSet, ok := getConfigSet(c, driver)
+	if !ok {
+		return
+	}
+
+	m_id, err := primitive.ObjectIDFromHex(c.Param("m_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid microservice ID"})
+		return
+	}
+	microservice := models.Microservice{
+		ID: m_id,
+	}
+	err = microservice.Get(driver)
+	if err != nil || microservice.EnvironmentID != configSet.EnvironmentID {
+		logging.Logger(c).Warn("Error getting microservice", "error", err)
+		c.JSON(http.StatusNotFound, gin.H{"message": "Microservice not found"})
+		return
+	}
+	if !microservice.IsDeployment() {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Config sets can only be attached to microservices deployed as deployments"})
+		return
+	}
+	if microservice.Namespace != configSet.Namespace {
+		c.JSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("The microservice is not in the namespace %s of the config set", configSet.Namespace)})
+		return
+	}
+
+	_, cluster, ok := getEnvironmentAndCluster(c, driver, configSet.EnvironmentID)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), KubernetesAPITimeout)
+	defer cancel()
+	api := kubernetesAPI(cluster)
+	source := client.ConfigSource{Kind: configSet.Kind, Name: configSet.Name}
+	if attach {
+		_, err = api.AttachConfigSource(ctx, microservice.Namespace, microservice.Name, source)
+	} else {
+		_, err = api.DetachConfigSource(ctx, microservice.Namespace, microservice.Name, source)
+	}
+	if err != nil {
+		logging.Logger(c).Error("Error updating the config sources of microservice", "microservice", microservice.Name, "error", err)
+		RespondWithK8sApiError(c, err)
+		return
+	}
+
+	if attach {
+		err = configSet.AttachMicroservice(driver, m_id.Hex())
+	} else {
+		err = configSet.DetachMicroservice(driver, m_id.Hex())
+	}
+	if err != nil {
+		logging.Logger(c).Error("Error updating config set", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating config set"})
+		return
+	}
+
+	action := "attached to"
+	if !attach {
+		action = "detached from"
+	}
+	logging.Logger(c).Info("Config set applied to microservice", "config_set", configSet.Name, "action", action, "microservice", microservice.Name)
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Config set %s %s microservice %s", configSet.Name, action, microservice.Name)})
+}
+
+// getConfigSet returns the config set of the request, it must belong to the environment of the request
+func getConfigSet(c *gin.Context, driver db.Driver) (models.ConfigSet, bool) {
+	cs_id, err := primitive.ObjectIDFromHex(c.Param("cs_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid config set ID"})
+		return models.ConfigSet{}, false
+	}
+
+	configSet := models.ConfigSet{
+		ID: cs_id,
+	}
+	err = configSet.Get(driver)
+	if err != nil || configSet.EnvironmentID != c.Param("e_id") {
+		logging.Logger(c).Warn("Error getting config set", "error", err)
+		c.JSON(http.StatusNotFound, gin.H{"message": "Config set not found"})
+		return models.ConfigSet{}, false
+	}
+	return configSet, true
+}
+
+// applyConfigSet creates or replaces the configmap or the secret of the config set on the cluster
+func applyConfigSet(c *gin.Context, cluster models.Cluster, configSet models.ConfigSet, data map[string]string) bool {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), KubernetesAPITimeout)
+	defer cancel()
+	err := kubernetesAPI(cluster).ApplyConfig(ctx, configSet.Namespace, configSet.Kind, client.ConfigRequest{Name: configSet.Name, Data: data})
+	if err != nil {
+		logging.Logger(c).Error("Error applying the config of the config set", "error", err)
+		RespondWithK8sApiError(c, err)
+		return false
+	}
+	return true
+}
+
+// restartConfigSetConsumers restarts the microservices consuming the config set so that they load its new values
+func restartConfigSetConsumers(c *gin.Context, driver db.Driver, cluster models.Cluster, configSet models.ConfigSet) ([]models.OperationResult, int) {
+	results := make([]models.OperationResult, 0)
+	failed := 0
+	for _, id := range configSet.MicroserviceIDs {
+		m_id, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			continue
+		}
+		microservice := models.Microservice{
+			ID: m_id,
+		}
+		if err := microservice.Get(driver); err != nil {
+			logging.Logger(c).Error("Error getting microservice", "error", err)
+			results = append(results, models.OperationResult{Object: id, Status: models.OperationFailed, Message: "Microservice not found"})
+			failed++
+			continue
+		}
+
+		result := restartMicroservice(c.Request.Context(), cluster, microservice)
+		if result.Status == models.OperationFailed {
+			failed++
+		}
+		results = append(results, result)
+	}
+	return results, failed
+}
+
+// setConfigSetData saves the keys of the config set, and its values if it is not a secret
+func setConfigSetData(configSet *models.ConfigSet, data map[string]string) {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	configSet.Keys = keys
+
+	configSet.Data = nil
+	if !configSet.IsSecret() {
+		configSet.Data = data
+	}
+}
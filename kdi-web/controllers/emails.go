@@ -0,0 +1,267 @@
+package controllers
+
+// This file contains the flows going through the email of the users : the verification of their email address and the reset of their password
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kuro-jojo/kdi-k8s/shared/logging"
+	"github.com/kuro-jojo/kdi-web/db"
+	"github.com/kuro-jojo/kdi-web/mailer"
+	"github.com/kuro-jojo/kdi-web/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	VerifyEmailTokenLifetime   = 24 * time.Hour
+	ResetPasswordTokenLifetime = time.Hour
+)
+
+const emailTimeout = 30 * time.Second
+
+// Mailer sends the emails to the users, set by the server from the environment
+var Mailer mailer.Mailer = mailer.LogMailer{}
+
+// backgroundEmails are the emails sent after the response, so that its time does not tell if the email is registered
+var backgroundEmails sync.WaitGroup
+
+// sendInBackground runs send after the response with its own timeout, the logger of the request is kept
+func sendInBackground(c *gin.Context, send func(ctx context.Context) error) {
+	logger := logging.Logger(c)
+	backgroundEmails.Add(1)
+	go func() {
+		defer backgroundEmails.Done()
+		ctx, cancel := context.WithTimeout(logging.NewContext(context.Background(), logger), emailTimeout)
+		defer cancel()
+		if err := send(ctx); err != nil {
+			logging.FromContext(ctx).Error("Error while sending email", "error", err)
+		}
+	}()
+}
+
+// WaitForEmails waits for the emails being sent, at the shutdown
+func WaitForEmails(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		backgroundEmails.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type EmailForm struct {
+	Email string `json:"email"`
+}
+
+type EmailTokenForm struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// VerifyEmail marks the email of the user of the token as verified
+func VerifyEmail(c *gin.Context) {
+	d, _ := c.Get("driver")
+	driver := d.(db.Driver)
+
+	var form EmailTokenForm
+	if err := c.ShouldBindJSON(&form); err != nil || form.Token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid form"})
+		return
+	}
+	user, ok := consumeEmailToken(c, driver, form.Token, models.VerifyEmailPurpose)
+	if !ok {
+		return
+	}
+	if err := user.VerifyEmail(driver); err != nil {
+		logging.Logger(c).Error("Error while verifying email", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error while verifying email"})
+		return
+	}
+	logging.Logger(c).Info("Email of user verified", logging.KeyUserID, user.ID.Hex())
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified successfully"})
+}
+
+// ResendVerificationEmail sends a new verification email.
+// The response is the same whether the email is registered or not, so that the emails of the users cannot be found with it.
+func ResendVerificationEmail(c *gin.Context) {
+	d, _ := c.Get("driver")
+	driver := d.(db.Driver)
+
+	var form EmailForm
+	if err := c.ShouldBindJSON(&form); err != nil || form.Email == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid form"})
+		return
+	}
+	user := models.User{Email: form.Email}
+	err := user.GetByEmail(driver)
+	if err != nil && !strings.Contains(err.Error(), "not found") {
+		logging.Logger(c).Error("Error while checking email", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error while checking email"})
+		return
+	}
+	if err == nil && user.Password != "" && !user.EmailVerified {
+		sendInBackground(c, func(ctx context.Context) error {
+			return sendVerificationEmail(ctx, driver, user)
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "If the email is registered and not verified yet, a verification email was sent"})
+}
+
+// ForgotPassword sends an email with a link to reset the password of the user.
+// The response is the same whether the email is registered or not.
+func ForgotPassword(c *gin.Context) {
+	d, _ := c.Get("driver")
+	driver := d.(db.Driver)
+
+	var form EmailForm
+	if err := c.ShouldBindJSON(&form); err != nil || form.Email == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid form"})
+		return
+	}
+	user := models.User{Email: form.Email}
+	err := user.GetByEmail(driver)
+	if err != nil && !strings.Contains(err.Error(), "not found") {
+		logging.Logger(c).Error("Error while checking email", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error while checking email"})
+		return
+	}
+	// the users signed in with an OpenID Connect provider have no password
+	if err == nil && user.Password != "" {
+		sendInBackground(c, func(ctx context.Context) error {
+			token, err := createEmailToken(driver, user, models.ResetPasswordPurpose, ResetPasswordTokenLifetime)
+			if err != nil {
+				return err
+			}
+			return Mailer.Send(ctx, mailer.Message{
+				To:      user.Email,
+				Subject: "Reset your KDI password",
+				Body: fmt.Sprintf("Hello %s,\n\nOpen this link to choose a new password, it expires in an hour :\n%s\n\nIf you did not ask to reset your password, ignore this email.\n",
+					user.Name, webappLink("reset-password", token)),
+			})
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "If the email is registered, an email to reset the password was sent"})
+}
+
+// ResetPassword replaces the password of the user of the token. The sessions of the user are revoked.
+func ResetPassword(c *gin.Context) {
+	d, _ := c.Get("driver")
+	driver := d.(db.Driver)
+
+	var form EmailTokenForm
+	if err := c.ShouldBindJSON(&form); err != nil || form.Token == "" || form.Password == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid form"})
+		return
+	}
+	// the token is only used once the password is accepted
+	if err := checkNewPassword(form.Password); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	user, ok := consumeEmailToken(c, driver, form.Token, models.ResetPasswordPurpose)
+	if !ok {
+		return
+	}
+	if err := user.UpdatePassword(driver, form.Password); err != nil {
+		logging.Logger(c).Error("Error while updating password", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error while resetting password"})
+		return
+	}
+	// the link was received by email so the email is verified too
+	if !user.EmailVerified {
+		if err := user.VerifyEmail(driver); err != nil {
+			logging.Logger(c).Error("Error while verifying email", "error", err)
+		}
+	}
+	session := models.Session{UserID: user.ID.Hex()}
+	if _, err := session.RevokeAllByUser(driver); err != nil {
+		logging.Logger(c).Error("Error while revoking sessions", "error", err)
+	}
+	logging.Logger(c).Info("Password of user reset", logging.KeyUserID, user.ID.Hex())
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully"})
+}
+
+// sendVerificationEmail sends an email with a link to verify the email of the user
+func sendVerificationEmail(ctx context.Context, driver db.Driver, user models.User) error {
+	token, err := createEmailToken(driver, user, models.VerifyEmailPurpose, VerifyEmailTokenLifetime)
+	if err != nil {
+		return err
+	}
+	return Mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your KDI email address",
+		Body: fmt.Sprintf("Hello %s,\n\nOpen this link to verify your email address, it expires in 24 hours :\n%s\n",
+			user.Name, webappLink("verify-email", token)),
+	})
+}
+
+// createEmailToken saves a new token of the user and returns its value, to be sent by email
+func createEmailToken(driver db.Driver, user models.User, purpose string, lifetime time.Duration) (string, error) {
+	value, err := models.GenerateEmailToken()
+	if err != nil {
+		return "", err
+	}
+	token := models.EmailToken{
+		UserID:    user.ID.Hex(),
+		Purpose:   purpose,
+		Hash:      models.HashToken(value),
+		ExpiresAt: time.Now().Add(lifetime),
+	}
+	if err := token.Create(driver); err != nil {
+		return "", err
+	}
+	return value, nil
+}
+
+// consumeEmailToken uses the token and returns its user
+func consumeEmailToken(c *gin.Context, driver db.Driver, value string, purpose string) (models.User, bool) {
+	token := models.EmailToken{
+		Hash:    models.HashToken(value),
+		Purpose: purpose,
+	}
+	if err := token.Consume(driver); err != nil {
+		logging.Logger(c).Warn("Error while using email token", "error", err)
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid or expired token"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error while checking token"})
+		}
+		return models.User{}, false
+	}
+	uid, err := primitive.ObjectIDFromHex(token.UserID)
+	if err != nil {
+		logging.Logger(c).Warn("Error while parsing user ID", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid or expired token"})
+		return models.User{}, false
+	}
+	user := models.User{ID: uid}
+	if err := user.Get(driver); err != nil {
+		logging.Logger(c).Warn("Error while getting user", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid or expired token"})
+		return models.User{}, false
+	}
+	return user, true
+}
+
+// webappLink returns the link to a page of the webapp with the token
+func webappLink(page string, token string) string {
+	return strings.TrimSuffix(os.Getenv("KDI_WEBAPP_ENDPOINT"), "/") + "/" + page + "?token=" + url.QueryEscape(token)
+}
+
+// emailVerificationRequired tells if the users have to verify their email before logging in with a password
+func emailVerificationRequired() bool {
+	return os.Getenv("KDI_REQUIRE_EMAIL_VERIFICATION") == "true"
+}
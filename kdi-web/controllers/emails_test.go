@@ -0,0 +1,289 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kuro-jojo/kdi-web/db/mongodb"
+	"github.com/kuro-jojo/kdi-web/mailer"
+	"github.com/kuro-jojo/kdi-web/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// recordingMailer keeps the emails instead of sending them
+type recordingMailer struct {
+	mu       sync.Mutex
+	messages []mailer.Message
+}
+
+func (m *recordingMailer) Send(ctx context.Context, message mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, message)
+	return nil
+}
+
+// useRecordingMailer replaces the mailer during the test and returns the emails sent once they are all sent
+func useRecordingMailer(t *testing.T) func() []mailer.Message {
+	recorder := &recordingMailer{}
+	previous := Mailer
+	Mailer = recorder
+	t.Cleanup(func() { Mailer = previous })
+	return func() []mailer.Message {
+		backgroundEmails.Wait()
+		recorder.mu.Lock()
+		defer recorder.mu.Unlock()
+		return recorder.messages
+	}
+}
+
+func TestCheckNewPassword(t *testing.T) {
+	tests := map[string]bool{
+		"":                      false,
+		"12345":                 false,
+		"123456":                true,
+		"éééééé":                true,
+		strings.Repeat("a", 72): true,
+		strings.Repeat("a", 73): false,
+		strings.Repeat("é", 40): false,
+	}
+	for password, valid := range tests {
+		if err := checkNewPassword(password); (err == nil) != valid {
+			t.Errorf("checkNewPassword(%q) = %v, want valid %v", password, err, valid)
+		}
+	}
+}
+
+func TestForgotPassword(t *testing.T) {
+	mongodb.DbName = "kdi"
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("registered email", func(mt *mtest.T) {
+		sent := useRecordingMailer(mt.T)
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "kdi.users", mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: primitive.NewObjectID()},
+				{Key: "email", Value: "user@example.com"},
+				{Key: "password", Value: "hash"},
+			}),
+			mtest.CreateSuccessResponse(), // the previous tokens are removed
+			mtest.CreateSuccessResponse(), // the token is saved
+		)
+		w := serve(mt, ForgotPassword, nil, http.MethodPost, `{"email":"user@example.com"}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+		}
+		messages := sent()
+		if len(messages) != 1 || messages[0].To != "user@example.com" || !strings.Contains(messages[0].Body, "/reset-password?token=") {
+			t.Errorf("messages = %+v", messages)
+		}
+	})
+
+	mt.Run("unknown email", func(mt *mtest.T) {
+		sent := useRecordingMailer(mt.T)
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "kdi.users", mtest.FirstBatch))
+		w := serve(mt, ForgotPassword, nil, http.MethodPost, `{"email":"unknown@example.com"}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+		}
+		if messages := sent(); len(messages) != 0 {
+			t.Errorf("messages = %+v", messages)
+		}
+	})
+}
+
+func TestResetPassword(t *testing.T) {
+	mongodb.DbName = "kdi"
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	userID := primitive.NewObjectID()
+
+	mt.Run("new password", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: bson.D{{Key: "user_id", Value: userID.Hex()}, {Key: "purpose", Value: models.ResetPasswordPurpose}}}),
+			mtest.CreateCursorResponse(0, "kdi.users", mtest.FirstBatch, bson.D{{Key: "_id", Value: userID}, {Key: "email_verified", Value: false}}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}), // the password
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}), // the email is verified
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 2}, bson.E{Key: "nModified", Value: 2}), // the sessions are revoked
+		)
+		w := serve(mt, ResetPassword, nil, http.MethodPost, `{"token":"secret","password":"new-password"}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+		}
+		if got := strings.Join(commands(mt), ","); got != "findAndModify,find,update,update,update" {
+			t.Errorf("commands = %s", got)
+		}
+	})
+
+	mt.Run("password refused by the rules of the registration", func(mt *mtest.T) {
+		w := serve(mt, ResetPassword, nil, http.MethodPost, `{"token":"secret","password":"123"}`)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+		}
+		// the token can still be used with another password
+		if got := commands(mt); len(got) != 0 {
+			t.Errorf("commands = %v", got)
+		}
+	})
+
+	mt.Run("used or expired token", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil}))
+		w := serve(mt, ResetPassword, nil, http.MethodPost, `{"token":"secret","password":"new-password"}`)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "Invalid or expired token") {
+			t.Errorf("status = %d: %s", w.Code, w.Body.String())
+		}
+	})
+}
+
+func TestVerifyEmail(t *testing.T) {
+	mongodb.DbName = "kdi"
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	userID := primitive.NewObjectID()
+
+	mt.Run("valid token", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: bson.D{{Key: "user_id", Value: userID.Hex()}, {Key: "purpose", Value: models.VerifyEmailPurpose}}}),
+			mtest.CreateCursorResponse(0, "kdi.users", mtest.FirstBatch, bson.D{{Key: "_id", Value: userID}}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+		)
+		w := serve(mt, VerifyEmail, nil, http.MethodPost, `{"token":"secret"}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+		}
+		mt.GetStartedEvent()
+		mt.GetStartedEvent()
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		if !update.Lookup("u", "$set", "email_verified").Boolean() {
+			t.Errorf("update = %v", update)
+		}
+	})
+
+	mt.Run("token of another purpose", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil}))
+		w := serve(mt, VerifyEmail, nil, http.MethodPost, `{"token":"reset-token"}`)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+		}
+		query := mt.GetStartedEvent().Command.Lookup("query").Document()
+		if purpose := query.Lookup("purpose").StringValue(); purpose != models.VerifyEmailPurpose {
+			t.Errorf("purpose = %q", purpose)
+		}
+	})
+}
+
+func TestLoginRequiresVerifiedEmail(t *testing.T) {
+	mongodb.DbName = "kdi"
+	t.Setenv("KDI_JWT_SECRET_KEY", "secret")
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	hash, err := models.HashPassword("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := func(verified bool) bson.D {
+		return bson.D{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "email", Value: "user@example.com"}, {Key: "password", Value: hash}, {Key: "email_verified", Value: verified}}
+	}
+	body := `{"email":"user@example.com","password":"password"}`
+
+	mt.Run("unverified", func(mt *mtest.T) {
+		mt.Setenv("KDI_REQUIRE_EMAIL_VERIFICATION", "true")
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "kdi.users", mtest.FirstBatch, user(false)))
+		if w := serve(mt, Login, nil, http.MethodPost, body); w.Code != http.StatusForbidden {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusForbidden)
+		}
+	})
+
+	mt.Run("verified", func(mt *mtest.T) {
+		mt.Setenv("KDI_REQUIRE_EMAIL_VERIFICATION", "true")
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "kdi.users", mtest.FirstBatch, user(true)), mtest.CreateSuccessResponse())
+		if w := serve(mt, Login, nil, http.MethodPost, body); w.Code != http.StatusOK {
+			t.Errorf("status = %d: %s", w.Code, w.Body.String())
+		}
+	})
+
+	mt.Run("verification not required", func(mt *mtest.T) {
+		mt.Setenv("KDI_REQUIRE_EMAIL_VERIFICATION", "")
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "kdi.users", mtest.FirstBatch, user(false)), mtest.CreateSuccessResponse())
+		if w := serve(mt, Login, nil, http.MethodPost, body); w.Code != http.StatusOK {
+			t.Errorf("status = %d: %s", w.Code, w.Body.String())
+		}
+	})
+}
+
+// blockingMailer holds the emails until it is released, sending tells that an email is held
+type blockingMailer struct {
+	recordingMailer
+	sending chan struct{}
+	release chan struct{}
+}
+
+func (m *blockingMailer) Send(ctx context.Context, message mailer.Message) error {
+	m.sending <- struct{}{}
+	<-m.release
+	return m.recordingMailer.Send(ctx, message)
+}
+
+// The user is created without waiting for the verification email
+func TestRegisterSendsVerificationEmailInBackground(t *testing.T) {
+	mongodb.DbName = "kdi"
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("slow mail server", func(mt *mtest.T) {
+		blocking := &blockingMailer{sending: make(chan struct{}, 1), release: make(chan struct{})}
+		previous := Mailer
+		Mailer = blocking
+		mt.Cleanup(func() { Mailer = previous })
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "kdi.users", mtest.FirstBatch), // the email is not used
+			mtest.CreateSuccessResponse(),                                // the user is saved
+			mtest.CreateSuccessResponse(),                                // the previous tokens are removed
+			mtest.CreateSuccessResponse(),                                // the token is saved
+		)
+		responses := make(chan *httptest.ResponseRecorder, 1)
+		go func() {
+			responses <- serve(mt, Register, nil, http.MethodPost, `{"name":"user","email":"user@example.com","password":"password"}`)
+		}()
+		// the response is written while the email is held, the password is hashed before so only then the time counts
+		<-blocking.sending
+		select {
+		case w := <-responses:
+			if w.Code != http.StatusCreated {
+				mt.Errorf("status = %d: %s", w.Code, w.Body.String())
+			}
+		case <-time.After(5 * time.Second):
+			close(blocking.release)
+			mt.Fatal("Register waits for the verification email")
+		}
+
+		close(blocking.release)
+		backgroundEmails.Wait()
+		if messages := blocking.messages; len(messages) != 1 || messages[0].To != "user@example.com" || !strings.Contains(messages[0].Body, "/verify-email?token=") {
+			mt.Errorf("messages = %+v", messages)
+		}
+	})
+}
+
+func TestWaitForEmails(t *testing.T) {
+	release := make(chan struct{})
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+	sendInBackground(c, func(ctx context.Context) error {
+		<-release
+		return nil
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := WaitForEmails(ctx); err == nil {
+		t.Error("expected the email to be still sending")
+	}
+	close(release)
+	if err := WaitForEmails(context.Background()); err != nil {
+		t.Errorf("WaitForEmails() = %v", err)
+	}
+}
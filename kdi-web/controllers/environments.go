@@ -1,10 +1,12 @@
 package controllers
 
 import (
-	"log"
+	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/kuro-jojo/kdi-k8s/shared/logging"
+	"github.com/kuro-jojo/kdi-web/db"
 	"github.com/kuro-jojo/kdi-web/models"
 	"github.com/kuro-jojo/kdi-web/models/utils"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -16,10 +18,12 @@ type EnvironmentForm struct {
 	Description string `json:"description"`
 	ClusterID   string `json:"clusterId"`
 	ProjectID   string `json:"projectId"`
+
+	Variables map[string]string `json:"variables"` // The values of the ${VAR} placeholders of the manifests
 }
 
 func CreateEnvironment(c *gin.Context) {
-	log.Println("Creating environment...")
+	logging.Logger(c).Debug("Creating environment...")
 
 	user, driver := GetUserFromContext(c)
 
@@ -42,15 +46,23 @@ func CreateEnvironment(c *gin.Context) {
 		return
 	}
 
+	for name := range environmentForm.Variables {
+		if !VariableNamePattern.MatchString(name) {
+			c.JSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("Invalid variable name %q - use letters, digits and underscores", name)})
+			return
+		}
+	}
+
 	environment := models.Environment{
 		Name:        environmentForm.Name,
 		Description: environmentForm.Description,
+		Variables:   environmentForm.Variables,
 		//ClusterID:   environmentForm.ClusterID,
 	}
 
 	cluster_id, err := primitive.ObjectIDFromHex(environmentForm.ClusterID)
 	if err != nil {
-		log.Println("Error creating environment: Invalid Cluster ID")
+		logging.Logger(c).Info("Error creating environment: Invalid Cluster ID")
 		c.JSON(http.StatusBadRequest, gin.H{"Invalid Cluster ID": err.Error()})
 		return
 	}
@@ -91,7 +103,7 @@ func CreateEnvironment(c *gin.Context) {
 
 	err = environment.Create(driver)
 	if err != nil {
-		log.Printf("Error creating environment %v", err)
+		logging.Logger(c).Warn("Error creating environment", "error", err)
 		if er := utils.OnDuplicateKeyError(err, "Environment"); er != nil {
 			c.JSON(http.StatusConflict, gin.H{"message": er.Error()})
 		} else {
@@ -108,7 +120,7 @@ func EnvironmentFormIsInValid(form EnvironmentForm) bool {
 }
 
 func GetEnvironmentsByCluster(c *gin.Context) {
-	log.Println("Listing all environments in a cluster...")
+	logging.Logger(c).Debug("Listing all environments in a cluster...")
 	_, driver := GetUserFromContext(c)
 
 	var envForm EnvironmentForm
@@ -144,7 +156,7 @@ func GetEnvironmentsByCluster(c *gin.Context) {
 
 	environments, err := env.GetAllByCluster(driver)
 	if err != nil {
-		log.Printf("Error getting projects %v", err)
+		logging.Logger(c).Error("Error getting projects", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error getting environments"})
 		return
 	}
@@ -153,7 +165,7 @@ func GetEnvironmentsByCluster(c *gin.Context) {
 }
 
 func GetEnvironments(c *gin.Context) {
-	log.Println("Listing all environments...")
+	logging.Logger(c).Debug("Listing all environments...")
 	_, driver := GetUserFromContext(c)
 	//defer driver.Close()
 
@@ -161,7 +173,7 @@ func GetEnvironments(c *gin.Context) {
 
 	environments, err := environment.GetAll(driver)
 	if err != nil {
-		log.Printf("Error getting environments %v", err)
+		logging.Logger(c).Error("Error getting environments", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error getting environments"})
 		return
 	}
@@ -181,7 +193,7 @@ func GetEnvironment(c *gin.Context) {
 	err := env.Get(driver)
 
 	if err != nil {
-		log.Printf("Error getting environment %v", err)
+		logging.Logger(c).Warn("Error getting environment", "error", err)
 		if er := utils.OnDuplicateKeyError(err, "Environment"); er != nil {
 			c.JSON(http.StatusConflict, gin.H{"message": er.Error()})
 		} else {
@@ -209,48 +221,48 @@ func DeleteEnvironment(c *gin.Context) {
 	}
 	// TODO: check if user has enough privilege to delete the environment
 	// 1. Get all the microservices of the environment
-	log.Printf("Environment %s - %s", env.ID.Hex(), env.Name)
+	logging.Logger(c).Debug("Deleting environment", "environment", env.Name)
 	m := models.Microservice{
 		EnvironmentID: env.ID.Hex(),
 	}
 	microservices, err := m.GetAllByEnvironment(driver)
 	if err != nil {
-		log.Printf("Error getting microservices %v", err)
+		logging.Logger(c).Error("Error getting microservices", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete project"})
 		return
 	}
 	for _, microservice := range microservices {
 		// TODO : Do not delete the microservice on the cluster if the user says so
-		log.Printf("Microservice %s - %s", microservice.ID.Hex(), microservice.Name)
+		logging.Logger(c).Debug("Deleting microservice", "microservice", microservice.Name)
 		// 2. Get all the containers of the microservice
 		co := models.Container{
 			MicroserviceID: microservice.ID.Hex(),
 		}
 		containers, err := co.GetAllByMicroservice(driver)
 		if err != nil {
-			log.Printf("Error getting containers %v", err)
+			logging.Logger(c).Error("Error getting containers", "error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete project"})
 			return
 		}
 		for _, container := range containers {
-			log.Printf("Container %s - %s", container.ID.Hex(), container.Name)
+			logging.Logger(c).Debug("Deleting container", "container", container.Name)
 			// 3. Delete the container
 			err = container.Delete(driver)
 			if err != nil {
-				log.Printf("Error deleting container %v", err)
+				logging.Logger(c).Error("Error deleting container", "error", err)
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete project"})
 				return
 			}
-			log.Printf("Container %s deleted successfully", container.ID.Hex())
+			logging.Logger(c).Info("Container deleted successfully", "container", container.Name)
 		}
 		// 4. Delete the microservice
 		err = microservice.Delete(driver)
 		if err != nil {
-			log.Printf("Error deleting microservice %v", err)
+			logging.Logger(c).Error("Error deleting microservice", "error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete project"})
 			return
 		}
-		log.Printf("Microservice %s deleted successfully", microservice.ID.Hex())
+		logging.Logger(c).Info("Microservice deleted successfully", "microservice", microservice.Name)
 	}
 }
 
@@ -278,8 +290,44 @@ func UpdateEnvironment(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"Updated project": updatedEnvironment})
 }
 
+type EnvironmentVariablesForm struct {
+	Variables map[string]string `json:"variables"`
+}
+
+// SetEnvironmentVariables replaces the variables substituted in the manifests deployed in the environment
+func SetEnvironmentVariables(c *gin.Context) {
+	user, driver := GetUserFromContext(c)
+
+	var form EnvironmentVariablesForm
+	if err := c.ShouldBindJSON(&form); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid form - Please provide the variables"})
+		return
+	}
+	for name := range form.Variables {
+		if !VariableNamePattern.MatchString(name) {
+			c.JSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("Invalid variable name %q - use letters, digits and underscores", name)})
+			return
+		}
+	}
+
+	environment, _, ok := getEnvironmentAndCluster(c, driver, c.Param("e_id"))
+	if !ok {
+		return
+	}
+	if _, ok := getManagedProject(c, driver, user, environment, []string{models.CreateDeploymentRole}); !ok {
+		return
+	}
+	if err := environment.SetVariables(driver, form.Variables); err != nil {
+		logging.Logger(c).Error("Error updating the variables of environment", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating the variables of the environment"})
+		return
+	}
+	logging.Logger(c).Info("Variables of environment updated", "environment", environment.Name)
+	c.JSON(http.StatusOK, gin.H{"message": "Variables updated successfully", "variables": environment.Variables})
+}
+
 func GetEnvironmentsByProject(c *gin.Context) {
-	log.Println("Listing all environments associated to a project...")
+	logging.Logger(c).Debug("Listing all environments associated to a project...")
 	_, driver := GetUserFromContext(c)
 
 	id := c.Param("project_id")
@@ -300,7 +348,7 @@ func GetEnvironmentsByProject(c *gin.Context) {
 	}
 
 	/* Vérifiez les privilèges de l'utilisateur
-	ok, code, message := MemberHasEnoughPrivilege(driver, []string{models.ListProjectsRole}, project, user)
+	ok, code, message := MemberHasEnoughPrivilege(c.Request.Context(), driver, []string{models.ListProjectsRole}, project, user)
 	if !ok {
 		c.JSON(code, gin.H{"message": message})
 		return
@@ -313,7 +361,7 @@ func GetEnvironmentsByProject(c *gin.Context) {
 
 	environments, err := e.GetAllByProject(driver)
 	if err != nil {
-		log.Printf("Error getting environments %v", err)
+		logging.Logger(c).Error("Error getting environments", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error getting environments"})
 		return
 	}
@@ -328,3 +376,42 @@ func GetEnvironmentsByProject(c *gin.Context) {
 	// Envoyer la réponse JSON
 	c.JSON(http.StatusOK, response)
 }
+
+// getManagedProject returns the project of the environment if the user is its creator or has the roles in its teamspace
+func getManagedProject(c *gin.Context, driver db.Driver, user models.User, environment models.Environment, roles []string) (models.Project, bool) {
+	p_id, err := primitive.ObjectIDFromHex(environment.ProjectID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid project ID"})
+		return models.Project{}, false
+	}
+	project := models.Project{ID: p_id}
+	if err := project.Get(driver); err != nil {
+		logging.Logger(c).Error("Error getting project", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error getting project"})
+		return models.Project{}, false
+	}
+	if project.CreatorID == user.ID.Hex() {
+		return project, true
+	}
+	if project.TeamspaceID == "" {
+		c.JSON(http.StatusForbidden, gin.H{"message": "Only the creator of the project can change its environments"})
+		return models.Project{}, false
+	}
+
+	t_id, err := primitive.ObjectIDFromHex(project.TeamspaceID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid teamspace ID"})
+		return models.Project{}, false
+	}
+	teamspace := models.Teamspace{ID: t_id}
+	if err := teamspace.Get(driver); err != nil {
+		logging.Logger(c).Error("Error getting teamspace", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error getting teamspace"})
+		return models.Project{}, false
+	}
+	if ok, code, message := MemberHasEnoughPrivilege(c.Request.Context(), driver, roles, teamspace, user); !ok {
+		c.JSON(code, gin.H{"message": message})
+		return models.Project{}, false
+	}
+	return project, true
+}
@@ -0,0 +1,168 @@
+package controllers
+
+// This file contains the inventory of the clusters : version, nodes, storage classes, ingress classes and CRDs.
+// The inventory is cached on the cluster and refreshed periodically.
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kuro-jojo/kdi-k8s/shared/logging"
+	"github.com/kuro-jojo/kdi-web/db"
+	"github.com/kuro-jojo/kdi-web/models"
+	"github.com/kuro-jojo/kdi-web/models/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// InventoryRefreshInterval is the time between two refreshes of the inventory of all the clusters
+	InventoryRefreshInterval = 30 * time.Minute
+	// InventoryTimeout is the maximum duration of the collection of the inventory of a cluster
+	InventoryTimeout = 60 * time.Second
+)
+
+var (
+	stopInventoryRefresher context.CancelFunc
+	inventoryRefresherDone chan struct{}
+)
+
+// StartInventoryRefresher refreshes the inventory of every cluster at each interval
+func StartInventoryRefresher(driver db.Driver, interval time.Duration) {
+	ctx, cancel := context.WithCancel(context.Background())
+	stopInventoryRefresher = cancel
+	inventoryRefresherDone = make(chan struct{})
+	go func() {
+		defer close(inventoryRefresherDone)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				refreshAllInventories(ctx, driver)
+			}
+		}
+	}()
+}
+
+// StopInventoryRefresher stops the refresher, the refresh in progress is canceled
+func StopInventoryRefresher() {
+	stopInventoryRefresher()
+	<-inventoryRefresherDone
+}
+
+func refreshAllInventories(ctx context.Context, driver db.Driver) {
+	var c models.Cluster
+	clusters, err := c.GetAll(driver)
+	if err != nil {
+		logging.FromContext(ctx).Error("Error getting clusters", "error", err)
+		return
+	}
+	for _, cluster := range clusters {
+		if ctx.Err() != nil {
+			return
+		}
+		// the token of the cluster can no longer be used
+		if !cluster.ExpiryDate.IsZero() && cluster.ExpiryDate.Before(time.Now()) {
+			continue
+		}
+		if err := refreshClusterInventory(ctx, driver, &cluster); err != nil {
+			logging.FromContext(ctx).Error("Error refreshing the inventory of cluster", "cluster", cluster.Name, "error", err)
+		}
+	}
+	logging.FromContext(ctx).Info("Inventory of clusters refreshed", "clusters", len(clusters))
+}
+
+// refreshClusterInventory collects the inventory of the cluster and saves it on the cluster
+func refreshClusterInventory(ctx context.Context, driver db.Driver, cluster *models.Cluster) error {
+	inventory, err := fetchClusterInventory(ctx, *cluster)
+	if err != nil {
+		return err
+	}
+	return cluster.SetInventory(driver, inventory)
+}
+
+func fetchClusterInventory(ctx context.Context, cluster models.Cluster) (models.ClusterInventory, error) {
+	ctx, cancel := context.WithTimeout(ctx, InventoryTimeout)
+	defer cancel()
+
+	response, err := kubernetesAPI(cluster).Inventory(ctx)
+	if err != nil {
+		return models.ClusterInventory{}, fmt.Errorf("%s", k8sApiErrorMessage(err))
+	}
+
+	inventory := inventoryFrom(response.Inventory)
+	if len(response.Errors) > 0 {
+		inventory.Errors = make(map[string]string)
+		for part, e := range response.Errors {
+			inventory.Errors[part] = e.Message
+		}
+	}
+	return inventory, nil
+}
+
+// GetClusterInventory returns the cached inventory of the cluster.
+// The inventory is collected first if it was never collected or if refresh=true.
+func GetClusterInventory(c *gin.Context) {
+	cluster, ok := getClusterForInventory(c)
+	if !ok {
+		return
+	}
+	if cluster.Inventory == nil || c.Query("refresh") == "true" {
+		respondWithRefreshedInventory(c, cluster)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"inventory": cluster.Inventory})
+}
+
+// RefreshClusterInventory collects the inventory of the cluster again
+func RefreshClusterInventory(c *gin.Context) {
+	cluster, ok := getClusterForInventory(c)
+	if !ok {
+		return
+	}
+	respondWithRefreshedInventory(c, cluster)
+}
+
+func respondWithRefreshedInventory(c *gin.Context, cluster models.Cluster) {
+	_, driver := GetUserFromContext(c)
+
+	if err := refreshClusterInventory(c.Request.Context(), driver, &cluster); err != nil {
+		logging.Logger(c).Error("Error refreshing the inventory of cluster", "cluster", cluster.Name, "error", err)
+		c.JSON(http.StatusBadGateway, gin.H{"message": "Error getting the inventory of the cluster", "details": err.Error()})
+		return
+	}
+	logging.Logger(c).Info("Inventory of cluster refreshed", "cluster", cluster.Name)
+	c.JSON(http.StatusOK, gin.H{"inventory": cluster.Inventory})
+}
+
+func getClusterForInventory(c *gin.Context) (models.Cluster, bool) {
+	user, driver := GetUserFromContext(c)
+
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid cluster ID"})
+		return models.Cluster{}, false
+	}
+	cluster := models.Cluster{
+		ID: id,
+	}
+	if !UserHasRightOnCluster(c, driver, cluster, user, []string{models.ViewClusterRole}) {
+		return models.Cluster{}, false
+	}
+	err = cluster.Get(driver)
+	if err != nil {
+		logging.Logger(c).Warn("Error getting cluster", "error", err)
+		if utils.OnNotFoundError(err, "Cluster") != nil {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Cluster not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error getting cluster"})
+		}
+		return models.Cluster{}, false
+	}
+	return cluster, true
+}
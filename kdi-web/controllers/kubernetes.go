@@ -0,0 +1,106 @@
+package controllers
+
+// This file converts the objects returned by the kubernetes api to the models of the web api
+
+import (
+	"github.com/kuro-jojo/kdi-k8s/client"
+	"github.com/kuro-jojo/kdi-web/models"
+)
+
+func conditionsFrom(conditions []client.Condition) []models.Conditions {
+	if conditions == nil {
+		return nil
+	}
+	converted := make([]models.Conditions, 0, len(conditions))
+	for _, condition := range conditions {
+		converted = append(converted, models.Conditions(condition))
+	}
+	return converted
+}
+
+func microserviceFrom(m client.Microservice) models.Microservice {
+	microservice := models.Microservice{
+		Kind:       m.Kind,
+		Name:       m.Name,
+		Namespace:  m.Namespace,
+		Replicas:   m.Replicas,
+		Labels:     m.Labels,
+		Selectors:  m.Selectors,
+		Strategy:   m.Strategy,
+		Conditions: conditionsFrom(m.Conditions),
+	}
+	for _, container := range m.Containers {
+		microservice.Containers = append(microservice.Containers, models.Container{Name: container.Name, Image: container.Image, Port: container.Port})
+	}
+	return microservice
+}
+
+func violationsFrom(violations []client.PolicyViolation) []models.PolicyViolation {
+	if violations == nil {
+		return nil
+	}
+	converted := make([]models.PolicyViolation, 0, len(violations))
+	for _, violation := range violations {
+		converted = append(converted, models.PolicyViolation(violation))
+	}
+	return converted
+}
+
+func workloadFrom(w client.Workload) models.Workload {
+	workload := models.Workload{
+		Kind:             w.Kind,
+		Name:             w.Name,
+		Namespace:        w.Namespace,
+		Replicas:         w.Replicas,
+		ReadyReplicas:    w.ReadyReplicas,
+		Images:           w.Images,
+		Labels:           w.Labels,
+		Selectors:        w.Selectors,
+		Strategy:         w.Strategy,
+		Conditions:       conditionsFrom(w.Conditions),
+		CreatedAt:        w.CreatedAt,
+		Schedule:         w.Schedule,
+		Suspended:        w.Suspended,
+		LastScheduleTime: w.LastScheduleTime,
+	}
+	if w.Owner != nil {
+		workload.Owner = &models.WorkloadOwner{Kind: w.Owner.Kind, Name: w.Owner.Name}
+	}
+	return workload
+}
+
+func inventoryFrom(i client.Inventory) models.ClusterInventory {
+	inventory := models.ClusterInventory{
+		ServerVersion: i.ServerVersion,
+		Platform:      i.Platform,
+		CollectedAt:   i.CollectedAt,
+	}
+	for _, n := range i.Nodes {
+		node := models.NodeInventory{
+			Name:             n.Name,
+			Roles:            n.Roles,
+			KubeletVersion:   n.KubeletVersion,
+			OSImage:          n.OSImage,
+			ContainerRuntime: n.ContainerRuntime,
+			Architecture:     n.Architecture,
+			Unschedulable:    n.Unschedulable,
+			Allocatable:      models.NodeResources(n.Allocatable),
+			Allocated:        models.NodeAllocation(n.Allocated),
+			CreatedAt:        n.CreatedAt,
+		}
+		for _, condition := range n.Conditions {
+			node.Conditions = append(node.Conditions, models.NodeCondition(condition))
+		}
+		inventory.Nodes = append(inventory.Nodes, node)
+	}
+	for _, storageClass := range i.StorageClasses {
+		inventory.StorageClasses = append(inventory.StorageClasses, models.StorageClass(storageClass))
+	}
+	for _, ingressClass := range i.IngressClasses {
+		inventory.IngressClasses = append(inventory.IngressClasses, models.IngressClass(ingressClass))
+	}
+	for _, crd := range i.CRDs {
+		inventory.CRDs = append(inventory.CRDs, models.CRD(crd))
+	}
+	return inventory
+}
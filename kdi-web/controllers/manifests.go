@@ -0,0 +1,182 @@
+package controllers
+
+// This file transforms the uploaded manifests before they are sent to the kubernetes api :
+// the ${VAR} placeholders are replaced by the variables of the environment.
+// They are replaced in the values of the parsed YAML so that a variable cannot change the structure of a manifest.
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"regexp"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// variablePattern matches the ${VAR} placeholders and their escaped form $${VAR} which is kept as ${VAR}
+	variablePattern = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+	// VariableNamePattern is the pattern of a valid variable name
+	VariableNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// substituteVariables replaces the placeholders of the content with the variables and returns the undefined ones
+func substituteVariables(content []byte, variables map[string]string) ([]byte, []string) {
+	undefined := make([]string, 0)
+	result := variablePattern.ReplaceAllFunc(content, func(match []byte) []byte {
+		if bytes.HasPrefix(match, []byte("$$")) {
+			return match[1:]
+		}
+		name := string(match[2 : len(match)-1])
+		value, ok := variables[name]
+		if !ok {
+			if !slices.Contains(undefined, name) {
+				undefined = append(undefined, name)
+			}
+			return match
+		}
+		return []byte(value)
+	})
+	return result, undefined
+}
+
+// substituteManifest replaces the placeholders of the scalars of the YAML documents and returns the undefined variables.
+// A file without placeholders is returned unchanged.
+func substituteManifest(content []byte, variables map[string]string) ([]byte, []string, error) {
+	if !variablePattern.Match(content) {
+		return content, nil, nil
+	}
+
+	var documents []*yaml.Node
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	for {
+		var document yaml.Node
+		if err := decoder.Decode(&document); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, nil, err
+		}
+		documents = append(documents, &document)
+	}
+
+	undefined := make([]string, 0)
+	var substitute func(node *yaml.Node)
+	substitute = func(node *yaml.Node) {
+		if node.Kind == yaml.ScalarNode {
+			value, missing := substituteVariables([]byte(node.Value), variables)
+			for _, name := range missing {
+				if !slices.Contains(undefined, name) {
+					undefined = append(undefined, name)
+				}
+			}
+			if string(value) != node.Value {
+				node.Value = string(value)
+				// an unquoted placeholder takes the type of its value (replicas: ${REPLICAS}), the encoder quotes it if needed
+				if node.Style&(yaml.TaggedStyle|yaml.SingleQuotedStyle|yaml.DoubleQuotedStyle|yaml.LiteralStyle|yaml.FoldedStyle) == 0 {
+					node.Tag = ""
+				}
+			}
+		}
+		for _, child := range node.Content {
+			substitute(child)
+		}
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	for _, document := range documents {
+		substitute(document)
+		if err := encoder.Encode(document); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, nil, err
+	}
+	return buf.Bytes(), undefined, nil
+}
+
+// templateManifests substitutes the variables in every file of the multipart payload.
+// The undefined variables are returned by file, the payload is then not usable.
+func templateManifests(payload []byte, contentType string, variables map[string]string) ([]byte, map[string][]string, error) {
+	undefined := make(map[string][]string)
+	result, err := rewriteMultipart(payload, contentType, func(part *multipart.Part, content []byte) ([]byte, bool, error) {
+		if part.FileName() == "" {
+			return content, true, nil
+		}
+		content, missing, err := substituteManifest(content, variables)
+		if err != nil {
+			return nil, false, fmt.Errorf("%s : %v", part.FileName(), err)
+		}
+		if len(missing) > 0 {
+			undefined[part.FileName()] = missing
+		}
+		return content, true, nil
+	}, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return result, undefined, nil
+}
+
+// rewriteMultipart copies the parts of the multipart payload keeping its boundary, so that the content type is unchanged.
+// rewrite returns the new content of a part or false to drop it, the fields are added after the parts.
+func rewriteMultipart(payload []byte, contentType string, rewrite func(part *multipart.Part, content []byte) ([]byte, bool, error), fields map[string]string) ([]byte, error) {
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, err
+	}
+	boundary := params["boundary"]
+	if boundary == "" {
+		return nil, fmt.Errorf("no boundary in content type %s", contentType)
+	}
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	if err := writer.SetBoundary(boundary); err != nil {
+		return nil, err
+	}
+
+	reader := multipart.NewReader(bytes.NewReader(payload), boundary)
+	for {
+		part, err := reader.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		content, err := io.ReadAll(part)
+		if err != nil {
+			return nil, err
+		}
+		content, keep, err := rewrite(part, content)
+		if err != nil {
+			return nil, err
+		}
+		if !keep {
+			continue
+		}
+		w, err := writer.CreatePart(part.Header)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(content); err != nil {
+			return nil, err
+		}
+	}
+
+	for name, value := range fields {
+		if err := writer.WriteField(name, value); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
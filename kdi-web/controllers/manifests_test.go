@@ -0,0 +1,220 @@
+package controllers
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestSubstituteVariables(t *testing.T) {
+	variables := map[string]string{"IMAGE": "nginx:1.27", "REPLICAS": "3", "EMPTY": ""}
+	tests := []struct {
+		content   string
+		want      string
+		undefined []string
+	}{
+		{"image: ${IMAGE}", "image: nginx:1.27", []string{}},
+		{"${REPLICAS}${REPLICAS}", "33", []string{}},
+		{"value: '${EMPTY}'", "value: ''", []string{}},
+		{"escaped: $${IMAGE}", "escaped: ${IMAGE}", []string{}},
+		{"not a placeholder: $IMAGE ${1X} ${}", "not a placeholder: $IMAGE ${1X} ${}", []string{}},
+		{"${HOST}:${PORT} ${HOST}", "${HOST}:${PORT} ${HOST}", []string{"HOST", "PORT"}},
+	}
+	for _, tt := range tests {
+		got, undefined := substituteVariables([]byte(tt.content), variables)
+		if string(got) != tt.want || !reflect.DeepEqual(undefined, tt.undefined) {
+			t.Errorf("substituteVariables(%q) = %q, %v, want %q, %v", tt.content, got, undefined, tt.want, tt.undefined)
+		}
+	}
+}
+
+func TestSubstituteManifest(t *testing.T) {
+	variables := map[string]string{
+		"NAME":      "api",
+		"REPLICAS":  "3",
+		"INJECTION": "x\n  privileged: true",
+		"FLOW":      "{privileged: true}",
+	}
+	content := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: ${NAME}
+  labels:
+    note: "${FLOW}"
+spec:
+  # the replicas of the environment
+  replicas: ${REPLICAS}
+  template:
+    spec:
+      containers:
+        - name: ${INJECTION}
+          image: ${FLOW}
+---
+kind: Service
+metadata:
+  name: ${NAME}
+  annotations:
+    kept: $${NAME}
+`
+	got, undefined, err := substituteManifest([]byte(content), variables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(undefined) != 0 {
+		t.Errorf("undefined = %v", undefined)
+	}
+	if !strings.Contains(string(got), "# the replicas of the environment") {
+		t.Errorf("the comments are lost:\n%s", got)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(got))
+	var deployment struct {
+		Metadata struct {
+			Name   string
+			Labels map[string]string
+		}
+		Spec struct {
+			Replicas any
+			Template struct {
+				Spec struct {
+					Containers []map[string]any
+				}
+			}
+		}
+	}
+	if err := decoder.Decode(&deployment); err != nil {
+		t.Fatalf("decode %v:\n%s", err, got)
+	}
+	if deployment.Metadata.Name != "api" || deployment.Metadata.Labels["note"] != "{privileged: true}" {
+		t.Errorf("metadata = %+v", deployment.Metadata)
+	}
+	if deployment.Spec.Replicas != 3 {
+		t.Errorf("replicas = %#v, want the number 3", deployment.Spec.Replicas)
+	}
+	// the values are strings, they cannot add fields
+	container := deployment.Spec.Template.Spec.Containers[0]
+	if len(container) != 2 || container["name"] != variables["INJECTION"] || container["image"] != variables["FLOW"] {
+		t.Errorf("container = %#v", container)
+	}
+
+	var service struct {
+		Metadata struct {
+			Name        string
+			Annotations map[string]string
+		}
+	}
+	if err := decoder.Decode(&service); err != nil {
+		t.Fatal(err)
+	}
+	if service.Metadata.Name != "api" || service.Metadata.Annotations["kept"] != "${NAME}" {
+		t.Errorf("service metadata = %+v", service.Metadata)
+	}
+}
+
+func TestSubstituteManifestErrors(t *testing.T) {
+	got, undefined, err := substituteManifest([]byte("image: ${IMAGE}\ntag: ${TAG}\nagain: ${IMAGE}\n"), map[string]string{})
+	if err != nil || !reflect.DeepEqual(undefined, []string{"IMAGE", "TAG"}) {
+		t.Errorf("substituteManifest() = %v, %v, want IMAGE and TAG undefined", undefined, err)
+	}
+	if got == nil {
+		t.Error("no content")
+	}
+
+	if _, _, err := substituteManifest([]byte("name: ${NAME}\n  bad: [indent"), map[string]string{"NAME": "api"}); err == nil {
+		t.Error("expected an error for an invalid file")
+	}
+
+	unchanged := []byte("# no placeholder\nname:   api\n")
+	if got, _, _ := substituteManifest(unchanged, nil); !bytes.Equal(got, unchanged) {
+		t.Errorf("a file without placeholder is changed: %q", got)
+	}
+}
+
+// multipartPayload returns a payload with the fields and the files, in this order
+func multipartPayload(t *testing.T, fields map[string]string, files map[string]string) ([]byte, string) {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	for name, value := range fields {
+		writer.WriteField(name, value)
+	}
+	for name, content := range files {
+		w, err := writer.CreateFormFile("files", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	writer.Close()
+	return buf.Bytes(), writer.FormDataContentType()
+}
+
+// readParts returns the content of the parts by field or file name
+func readParts(t *testing.T, payload []byte, contentType string) map[string]string {
+	t.Helper()
+	_, boundary, _ := strings.Cut(contentType, "boundary=")
+	parts := make(map[string]string)
+	reader := multipart.NewReader(bytes.NewReader(payload), boundary)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return parts
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(part)
+		name := part.FileName()
+		if name == "" {
+			name = part.FormName()
+		}
+		parts[name] = string(content)
+	}
+}
+
+func TestRewriteMultipart(t *testing.T) {
+	payload, contentType := multipartPayload(t,
+		map[string]string{"namespace": "dev", NameForPoliciesForm: "[]"},
+		map[string]string{"app.yaml": "name: app"})
+
+	got, err := rewriteMultipart(payload, contentType, func(part *multipart.Part, content []byte) ([]byte, bool, error) {
+		if part.FormName() == NameForPoliciesForm {
+			return nil, false, nil
+		}
+		return bytes.ToUpper(content), true, nil
+	}, map[string]string{"added": "value"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"namespace": "DEV", "app.yaml": "NAME: APP", "added": "value"}
+	if parts := readParts(t, got, contentType); !reflect.DeepEqual(parts, want) {
+		t.Errorf("parts = %v, want %v", parts, want)
+	}
+
+	if _, err := rewriteMultipart(payload, "multipart/form-data", nil, nil); err == nil {
+		t.Error("expected an error without boundary")
+	}
+}
+
+func TestTemplateManifests(t *testing.T) {
+	payload, contentType := multipartPayload(t,
+		map[string]string{"namespace": "${NOT_A_FILE}"},
+		map[string]string{"app.yaml": "image: ${IMAGE}\n", "db.yaml": "image: ${DB_IMAGE}\n"})
+
+	got, undefined, err := templateManifests(payload, contentType, map[string]string{"IMAGE": "nginx:1.27"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(undefined, map[string][]string{"db.yaml": {"DB_IMAGE"}}) {
+		t.Errorf("undefined = %v", undefined)
+	}
+	parts := readParts(t, got, contentType)
+	if parts["app.yaml"] != "image: nginx:1.27\n" || parts["namespace"] != "${NOT_A_FILE}" {
+		t.Errorf("parts = %v", parts)
+	}
+}
@@ -1,13 +1,14 @@
 package controllers
 
 import (
+	"context"
 	"fmt"
-	"log"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/kuro-jojo/kdi-k8s/shared/logging"
 	"github.com/kuro-jojo/kdi-web/db"
 	"github.com/kuro-jojo/kdi-web/models"
 	"github.com/kuro-jojo/kdi-web/models/utils"
@@ -32,7 +33,7 @@ const (
 )
 
 func AddMemberToTeamspace(c *gin.Context) {
-	log.Println("Adding member to teamspace...")
+	logging.Logger(c).Debug("Adding member to teamspace...")
 
 	driver, teamspace, member, userMember, code, message := setupMember(c, []string{models.AddMemberRole}, false, false)
 	if code != 0 {
@@ -44,7 +45,7 @@ func AddMemberToTeamspace(c *gin.Context) {
 
 	err := teamspace.AddMember(driver, member)
 	if err != nil {
-		log.Printf("Error adding member to the teamspace: %v", err)
+		logging.Logger(c).Warn("Error adding member to the teamspace", "error", err)
 		if er := utils.OnDuplicateKeyError(err, "Member"); er != nil {
 			c.JSON(http.StatusConflict, gin.H{"message": "User's already member of the teamspace"})
 		} else {
@@ -57,13 +58,13 @@ func AddMemberToTeamspace(c *gin.Context) {
 
 	err = userMember.AddToTeamspace(driver, teamspace)
 	if err != nil {
-		log.Printf("Error adding teamspace to user: %v", err)
+		logging.Logger(c).Error("Error adding teamspace to user", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Internal server error"})
 
 		// Rollback
 		err = teamspace.RemoveMember(driver, member)
 		if err != nil {
-			log.Printf("Error rolling back: %v", err)
+			logging.Logger(c).Error("Error rolling back", "error", err)
 		}
 		return
 	}
@@ -76,18 +77,18 @@ func AddMemberToTeamspace(c *gin.Context) {
 	}
 
 	// Send notification to all members of the teamspace
-	log.Println("Sending notification to all members of the teamspace...")
+	logging.Logger(c).Debug("Sending notification to all members of the teamspace...")
 	messageContent = fmt.Sprintf(NewMemberAddedInformation, user.Name, userMember.Name, teamspace.Name, member.ProfileName)
 	ok = SendNotificationToAllMembers(c, userMember, teamspace, driver, messageContent)
 	if !ok {
 		return
 	}
-	log.Println("Member added to teamspace successfully")
+	logging.Logger(c).Info("Member added to teamspace successfully")
 	c.JSON(http.StatusCreated, gin.H{"message": "Member added to teamspace successfully"})
 }
 
 func UpdateMemberInTeamspace(c *gin.Context) {
-	log.Println("Updating member in teamspace...")
+	logging.Logger(c).Debug("Updating member in teamspace...")
 	driver, teamspace, member, userMember, code, message := setupMember(c, []string{models.UpdateMemberRole}, false, true)
 	if code != 0 {
 		c.JSON(code, gin.H{"message": message})
@@ -96,7 +97,7 @@ func UpdateMemberInTeamspace(c *gin.Context) {
 
 	err := teamspace.UpdateMember(driver, member)
 	if err != nil {
-		log.Printf("Error updating member to the teamspace: %v", err)
+		logging.Logger(c).Warn("Error updating member to the teamspace", "error", err)
 		if er := utils.OnSameValueError(err, "profile"); er != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"message": er.Error()})
 		} else {
@@ -114,7 +115,7 @@ func UpdateMemberInTeamspace(c *gin.Context) {
 	}
 
 	// Send notification to all members of the teamspace
-	log.Println("Sending notification to all members of the teamspace...")
+	logging.Logger(c).Debug("Sending notification to all members of the teamspace...")
 	messageContent = fmt.Sprintf(MemberProfileUpdatedInformation, user.Name, userMember.Name, member.ProfileName, teamspace.Name)
 	ok = SendNotificationToAllMembers(c, userMember, teamspace, driver, messageContent)
 	if !ok {
@@ -124,7 +125,7 @@ func UpdateMemberInTeamspace(c *gin.Context) {
 }
 
 func RemoveMemberFromTeamspace(c *gin.Context) {
-	log.Println("Removing member from teamspace...")
+	logging.Logger(c).Debug("Removing member from teamspace...")
 	driver, teamspace, member, userMember, code, message := setupMember(c, []string{models.RemoveMemberRole}, true, false)
 	if code != 0 {
 		c.JSON(code, gin.H{"message": message})
@@ -133,7 +134,7 @@ func RemoveMemberFromTeamspace(c *gin.Context) {
 
 	err := teamspace.RemoveMember(driver, member)
 	if err != nil {
-		log.Printf("Error removing member to the teamspace: %v", err)
+		logging.Logger(c).Warn("Error removing member to the teamspace", "error", err)
 		if er := utils.OnNotFoundError(err, "Member"); er != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"message": er.Error()})
 		} else {
@@ -146,13 +147,13 @@ func RemoveMemberFromTeamspace(c *gin.Context) {
 
 	err = userMember.RemoveFromTeamspace(driver, teamspace)
 	if err != nil {
-		log.Printf("Error adding teamspace to user: %v", err)
+		logging.Logger(c).Error("Error adding teamspace to user", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Internal server error"})
 
 		// Rollback
 		err = teamspace.RemoveMember(driver, member)
 		if err != nil {
-			log.Printf("Error rolling back: %v", err)
+			logging.Logger(c).Error("Error rolling back", "error", err)
 		}
 		return
 	}
@@ -166,7 +167,7 @@ func RemoveMemberFromTeamspace(c *gin.Context) {
 	}
 
 	// Send notification to all members of the teamspace
-	log.Println("Sending notification to all members of the teamspace...")
+	logging.Logger(c).Debug("Sending notification to all members of the teamspace...")
 	messageContent = fmt.Sprintf(MemberRemovedInformation, user.Name, userMember.Name, teamspace.Name)
 	ok = SendNotificationToAllMembers(c, userMember, teamspace, driver, messageContent)
 	if !ok {
@@ -177,7 +178,7 @@ func RemoveMemberFromTeamspace(c *gin.Context) {
 
 // GetMembersByTeamspace returns all members of a teamspace
 func GetMembersByTeamspace(c *gin.Context) {
-	log.Println("Getting members of a teamspace...")
+	logging.Logger(c).Debug("Getting members of a teamspace...")
 	user, driver := GetUserFromContext(c)
 
 	teamspaceID := c.Param("teamspace_id")
@@ -197,7 +198,7 @@ func GetMembersByTeamspace(c *gin.Context) {
 
 	err = teamspace.Get(driver)
 	if err != nil {
-		log.Printf("Error getting teamspace %v", err)
+		logging.Logger(c).Warn("Error getting teamspace", "error", err)
 		if utils.OnNotFoundError(err, "Teamspace") != nil {
 			c.JSON(http.StatusNotFound, gin.H{"message": "Teamspace not found"})
 		} else {
@@ -206,7 +207,7 @@ func GetMembersByTeamspace(c *gin.Context) {
 		return
 	}
 
-	yes, code, message := MemberHasEnoughPrivilege(driver, []string{models.ListMembersRole}, teamspace, user)
+	yes, code, message := MemberHasEnoughPrivilege(c.Request.Context(), driver, []string{models.ListMembersRole}, teamspace, user)
 	if !yes {
 		c.JSON(code, gin.H{"message": message})
 		return
@@ -222,11 +223,11 @@ func setupMember(c *gin.Context, roles []string, isDeletion bool, isUpdate bool)
 	var memberForm MemberForm
 	if !isDeletion {
 		if c.BindJSON(&memberForm) != nil {
-			log.Println("Error binding JSON : Invalid form")
+			logging.Logger(c).Warn("Error binding JSON : Invalid form")
 			return nil, models.Teamspace{}, models.Member{}, models.User{}, http.StatusBadRequest, "Invalid form"
 		}
 		if (isUpdate && memberForm.ProfileID == "") || (!isUpdate && memberFormIsInValid(memberForm)) {
-			log.Println("Error with the form: Invalid form values")
+			logging.Logger(c).Warn("Error with the form: Invalid form values")
 			return nil, models.Teamspace{}, models.Member{}, models.User{}, http.StatusBadRequest, "Invalid form"
 		}
 	}
@@ -236,7 +237,7 @@ func setupMember(c *gin.Context, roles []string, isDeletion bool, isUpdate bool)
 
 	t_id, err := primitive.ObjectIDFromHex(c.Param("id"))
 	if err != nil {
-		log.Println("Error with the form: Invalid teamspace ID")
+		logging.Logger(c).Warn("Error with the form: Invalid teamspace ID")
 		return nil, models.Teamspace{}, models.Member{}, models.User{}, http.StatusBadRequest, "Invalid teamspace ID"
 	}
 
@@ -246,7 +247,7 @@ func setupMember(c *gin.Context, roles []string, isDeletion bool, isUpdate bool)
 
 	err = teamspace.Get(driver)
 	if err != nil {
-		log.Printf("Error getting teamspace %v", err)
+		logging.Logger(c).Warn("Error getting teamspace", "error", err)
 		if utils.OnNotFoundError(err, "Teamspace") != nil {
 			c.JSON(http.StatusNotFound, gin.H{"message": "Teamspace not found"})
 			return nil, models.Teamspace{}, models.Member{}, models.User{}, http.StatusBadRequest, "Teamspace not found"
@@ -257,7 +258,7 @@ func setupMember(c *gin.Context, roles []string, isDeletion bool, isUpdate bool)
 	}
 	// Check if user has the right to add member to teamspace
 
-	yes, code, message := MemberHasEnoughPrivilege(driver, roles, teamspace, user)
+	yes, code, message := MemberHasEnoughPrivilege(c.Request.Context(), driver, roles, teamspace, user)
 	if !yes {
 		return driver, teamspace, models.Member{}, models.User{}, code, message
 	}
@@ -269,7 +270,7 @@ func setupMember(c *gin.Context, roles []string, isDeletion bool, isUpdate bool)
 	if memberForm.UserID == "" {
 		err := userMember.GetByEmail(driver)
 		if err != nil {
-			log.Printf("Error getting user by email: %v", err)
+			logging.Logger(c).Warn("Error getting user by email", "error", err)
 			return nil, models.Teamspace{}, models.Member{}, userMember, http.StatusBadRequest, "User not found"
 		}
 		memberForm.UserID = userMember.ID.Hex()
@@ -281,7 +282,7 @@ func setupMember(c *gin.Context, roles []string, isDeletion bool, isUpdate bool)
 		userMember.ID = u_id
 		err = userMember.Get(driver)
 		if err != nil {
-			log.Printf("Error getting user: %v", err)
+			logging.Logger(c).Warn("Error getting user", "error", err)
 			return nil, models.Teamspace{}, models.Member{}, userMember, http.StatusBadRequest, "User not found"
 		}
 	}
@@ -297,7 +298,7 @@ func setupMember(c *gin.Context, roles []string, isDeletion bool, isUpdate bool)
 	if !isDeletion {
 		p_id, err := primitive.ObjectIDFromHex(memberForm.ProfileID)
 		if err != nil {
-			log.Printf("Error getting profile ID: %v", err)
+			logging.Logger(c).Warn("Error getting profile ID", "error", err)
 			return nil, models.Teamspace{}, models.Member{}, userMember, http.StatusBadRequest, "Invalid profile ID"
 		}
 
@@ -306,7 +307,7 @@ func setupMember(c *gin.Context, roles []string, isDeletion bool, isUpdate bool)
 		}
 		err = profile.Get(driver)
 		if err != nil {
-			log.Printf("Error getting profile: %v", err)
+			logging.Logger(c).Warn("Error getting profile", "error", err)
 			return nil, models.Teamspace{}, models.Member{}, userMember, http.StatusBadRequest, "Profile not found"
 		}
 		member.ProfileName = profile.Name
@@ -316,28 +317,21 @@ func setupMember(c *gin.Context, roles []string, isDeletion bool, isUpdate bool)
 }
 
 // MemberHasEnoughPrivilege checks if the user has enough privilege to do an action in a teamspace
-func MemberHasEnoughPrivilege(driver db.Driver, roles []string, teamspace models.Teamspace, user models.User) (bool, int, string) {
-	// Bypass if user is the creator
-	if teamspace.CreatorID != user.ID.Hex() {
-		// 1. Get all profiles that have the desired roles
-		// 2. User must be a member of the team
-		// 3. Must have a profile that has an role
-		p := models.Profile{}
-		profilesWithRole, err := p.GetAllByRoles(driver, roles)
-
-		if err != nil {
-			log.Printf("Error getting profiles with %v role: %v", roles, err)
-			return false, http.StatusInternalServerError, "Internal server error"
-		}
-
-		profileNames := utils.ModelArrayToStringArray[models.Profile](profilesWithRole, func(p models.Profile) string {
-			return p.Name
-		})
-
-		if !teamspace.HasMemberWithProfile(driver, user.ID.Hex(), profileNames) {
-			log.Printf("User hasn't the right to %s in the teamspace", strings.Join(roles, ", "))
-			return false, http.StatusForbidden, fmt.Sprintf("User hasn't the right to %s in the teamspace", strings.Join(roles, ", "))
-		}
+func MemberHasEnoughPrivilege(ctx context.Context, driver db.Driver, roles []string, teamspace models.Teamspace, user models.User) (bool, int, string) {
+	// A personal access token restricts the teamspaces and the roles, even for the creator
+	if user.AccessToken != nil && !user.AccessToken.Allows(teamspace.ID.Hex(), roles) {
+		logging.FromContext(ctx).Warn("Access token doesn't allow the roles in the teamspace", "token_id", user.AccessToken.ID.Hex(), "roles", roles)
+		return false, http.StatusForbidden, fmt.Sprintf("The access token doesn't allow to %s in the teamspace", strings.Join(roles, ", "))
+	}
+	// The creator has all the roles, a member needs a profile with the roles
+	granted, err := teamspace.GrantsRoles(driver, user.ID.Hex(), roles)
+	if err != nil {
+		logging.FromContext(ctx).Error("Error getting the profiles with the roles", "roles", roles, "error", err)
+		return false, http.StatusInternalServerError, "Internal server error"
+	}
+	if !granted {
+		logging.FromContext(ctx).Warn("User hasn't the right in the teamspace", "roles", roles)
+		return false, http.StatusForbidden, fmt.Sprintf("User hasn't the right to %s in the teamspace", strings.Join(roles, ", "))
 	}
 	return true, 0, ""
 }
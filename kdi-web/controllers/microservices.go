@@ -1,16 +1,18 @@
 package controllers
 
 import (
-	"bytes"
 	"encoding/json"
+	"fmt"
 	"io"
-	"log"
 	"net/http"
-	"os"
 	"slices"
-	"time"
+	"sort"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/kuro-jojo/kdi-k8s/client"
+	"github.com/kuro-jojo/kdi-k8s/shared/logging"
+	"github.com/kuro-jojo/kdi-web/db"
 	"github.com/kuro-jojo/kdi-web/models"
 	"github.com/kuro-jojo/kdi-web/models/utils"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -21,39 +23,96 @@ const (
 	// TODO: Change this for production
 )
 
-type K8sApiHttpResponse struct {
-	Messages      map[string][]string   `json:"messages"`
-	Message       string                `json:"message"`
-	Microservices []models.Microservice `json:"microservices"`
-}
-
 type MicroserviceUpdateForm struct {
 	Name      string `json:"name" `
 	Namespace string `json:"namespace" `
 	Strategy  string `json:"strategy" binding:"required"`
-	Container string `json:"container"`
-	Image     string `json:"image" binding:"required"`
+	Container string `json:"container"` // The container targeted by Image (optional if the microservice has a single container)
+	Image     string `json:"image"`
 	Replicas  int32  `json:"replicas" binding:"required"`
 	// Add more fields here depending on the strategy
 
 	// For rolling update strategy
 	MaxUnavailable string `json:"maxUnavailable"` // The maximum number of pods that can be unavailable during the update process
 	MaxSurge       string `json:"maxSurge"`       // The maximum number of pods that can be scheduled above the desired number of pods
+
+	// Pod template updates
+	Containers     []ContainerUpdateForm `json:"containers"`     // The containers (and init containers) to update, targeted by name
+	PodAnnotations map[string]string     `json:"podAnnotations"` // The annotations to set on the pod template
+	PatchType      string                `json:"patchType"`      // strategic (default) or json
+	JSONPatch      json.RawMessage       `json:"jsonPatch"`      // Additional JSON patch operations applied when patchType is json
+
+	// Wait for the rollout to complete
+	Wait    bool `json:"wait"`
+	Timeout int  `json:"timeout"` // The deadline of the rollout in seconds
+	// Revert the update if the new version fails its rollout (implies wait)
+	AutoRollback bool `json:"autoRollback"`
+}
+
+// ContainerUpdateForm describes the changes to apply to a container of the microservice.
+// Env, resources and probes use the kubernetes format and are forwarded as is.
+type ContainerUpdateForm struct {
+	Name           string          `json:"name" binding:"required"`
+	Init           bool            `json:"init"`
+	Image          string          `json:"image"`
+	Env            json.RawMessage `json:"env"`
+	Resources      json.RawMessage `json:"resources"`
+	LivenessProbe  json.RawMessage `json:"livenessProbe"`
+	ReadinessProbe json.RawMessage `json:"readinessProbe"`
+	StartupProbe   json.RawMessage `json:"startupProbe"`
+}
+
+func (f MicroserviceUpdateForm) toK8sUpdateRequest() client.UpdateRequest {
+	request := client.UpdateRequest{
+		Strategy:       f.Strategy,
+		Container:      f.Container,
+		Image:          f.Image,
+		Replicas:       f.Replicas,
+		MaxUnavailable: f.MaxUnavailable,
+		MaxSurge:       f.MaxSurge,
+		PodAnnotations: f.PodAnnotations,
+		PatchType:      f.PatchType,
+		JSONPatch:      f.JSONPatch,
+		Wait:           f.Wait,
+		Timeout:        f.Timeout,
+		AutoRollback:   f.AutoRollback,
+	}
+	for _, container := range f.Containers {
+		request.Containers = append(request.Containers, client.ContainerUpdate(container))
+	}
+	return request
+}
+
+// updatedImages returns the new image of each updated (non init) container of the microservice
+func updatedImages(request client.UpdateRequest, containers []models.Container) map[string]string {
+	images := map[string]string{}
+	if request.Image != "" {
+		if request.Container != "" {
+			images[request.Container] = request.Image
+		} else if len(containers) == 1 {
+			images[containers[0].Name] = request.Image
+		}
+	}
+	for _, container := range request.Containers {
+		if !container.Init && container.Image != "" {
+			images[container.Name] = container.Image
+		}
+	}
+	return images
 }
 
 func CreateMicroserviceWithYaml(c *gin.Context) {
-	log.Println("Creating microservice with yaml files ...")
-	kubernetesApiUrl := os.Getenv("KDI_K8S_API_ENDPOINT")
-	var r K8sApiHttpResponse
-	r.Messages = make(map[string][]string)
+	messages := make(map[string][]string)
 	// retrieve the cluster from the environment
 	user, driver := GetUserFromContext(c)
+	logger := logging.Logger(c)
+	logger.Info("Creating microservice with yaml files")
 
 	eId := c.Param("e_id")
 	id, err := primitive.ObjectIDFromHex(eId)
 	if err != nil {
-		r.Messages["error"] = append(r.Messages["error"], "Invalid environment ID")
-		c.JSON(http.StatusBadRequest, gin.H{"messages": r.Messages})
+		messages["error"] = append(messages["error"], "Invalid environment ID")
+		c.JSON(http.StatusBadRequest, gin.H{"messages": messages})
 		return
 	}
 
@@ -63,18 +122,18 @@ func CreateMicroserviceWithYaml(c *gin.Context) {
 	}
 	err = environment.Get(driver)
 	if err != nil {
-		log.Printf("Error getting environment %v", err)
-		r.Messages["error"] = append(r.Messages["error"], "Error getting environment")
-		c.JSON(http.StatusInternalServerError, gin.H{"messages": r.Messages})
+		logger.Error("Error getting environment", "error", err)
+		messages["error"] = append(messages["error"], "Error getting environment")
+		c.JSON(http.StatusInternalServerError, gin.H{"messages": messages})
 		return
 	}
 
 	// 2. Get the project and check if the user has access to it
 	p_id, err := primitive.ObjectIDFromHex(environment.ProjectID)
 	if err != nil {
-		log.Printf("Invalid project ID : %v", err)
-		r.Messages["error"] = append(r.Messages["error"], "Invalid project ID")
-		c.JSON(http.StatusBadRequest, gin.H{"messages": r.Messages})
+		logger.Warn("Invalid project ID", "error", err)
+		messages["error"] = append(messages["error"], "Invalid project ID")
+		c.JSON(http.StatusBadRequest, gin.H{"messages": messages})
 		return
 	}
 
@@ -82,29 +141,29 @@ func CreateMicroserviceWithYaml(c *gin.Context) {
 		ID: p_id,
 	}
 
-	log.Println("Getting project ...")
+	logger.Debug("Getting project")
 	err = project.Get(driver)
 	if err != nil {
-		log.Printf("Error getting project %v", err)
-		r.Messages["error"] = append(r.Messages["error"], "Error getting project")
-		c.JSON(http.StatusBadRequest, gin.H{"messages": r.Messages})
+		logger.Warn("Error getting project", "error", err)
+		messages["error"] = append(messages["error"], "Error getting project")
+		c.JSON(http.StatusBadRequest, gin.H{"messages": messages})
 		return
 	}
 	// Check if the user has enough privilege in the project to make deployments
 	if project.CreatorID != user.ID.Hex() {
 		if project.TeamspaceID == "" && project.CreatorID != user.ID.Hex() {
-			log.Printf("Unauthorized: Cannot make deployments to a project you do not own")
-			r.Messages["error"] = append(r.Messages["error"], "Unauthorized: Cannot make deployments to a project you do not own")
-			c.JSON(http.StatusUnauthorized, gin.H{"messages": r.Messages})
+			logger.Warn("Unauthorized: Cannot make deployments to a project you do not own")
+			messages["error"] = append(messages["error"], "Unauthorized: Cannot make deployments to a project you do not own")
+			c.JSON(http.StatusUnauthorized, gin.H{"messages": messages})
 			return
 		}
 		// Check if the user has enough privilege in the teamspace to make deployments
 		if project.TeamspaceID != "" {
 			t_id, err := primitive.ObjectIDFromHex(project.TeamspaceID)
 			if err != nil {
-				log.Printf("Invalid teamspace ID : %v", err)
-				r.Messages["error"] = append(r.Messages["error"], "Invalid teamspace ID")
-				c.JSON(http.StatusBadRequest, gin.H{"messages": r.Messages})
+				logger.Warn("Invalid teamspace ID", "error", err)
+				messages["error"] = append(messages["error"], "Invalid teamspace ID")
+				c.JSON(http.StatusBadRequest, gin.H{"messages": messages})
 				return
 			}
 			teamspace := models.Teamspace{
@@ -112,25 +171,28 @@ func CreateMicroserviceWithYaml(c *gin.Context) {
 			}
 			err = teamspace.Get(driver)
 			if err != nil {
-				log.Printf("Error getting teamspace %v", err)
-				r.Messages["error"] = append(r.Messages["error"], "Error getting teamspace")
-				c.JSON(http.StatusInternalServerError, gin.H{"messages": r.Messages})
+				logger.Error("Error getting teamspace", "error", err)
+				messages["error"] = append(messages["error"], "Error getting teamspace")
+				c.JSON(http.StatusInternalServerError, gin.H{"messages": messages})
 				return
 			}
-			ok, code, message := MemberHasEnoughPrivilege(driver, []string{models.CreateDeploymentRole}, teamspace, user)
+			ok, code, message := MemberHasEnoughPrivilege(c.Request.Context(), driver, []string{models.CreateDeploymentRole}, teamspace, user)
 			if !ok {
-				log.Println(message)
-				r.Messages["error"] = append(r.Messages["error"], message)
-				c.JSON(code, gin.H{"messages": r.Messages})
+				logger.Warn(message)
+				messages["error"] = append(messages["error"], message)
+				c.JSON(code, gin.H{"messages": messages})
 				return
 			}
 		}
 	}
+	logging.With(c, logging.KeyTeamspace, project.TeamspaceID, logging.KeyClusterID, environment.ClusterID)
+	logger = logging.Logger(c)
+
 	// 3. Get the cluster and make a request to the kubernetes api to create the microservice
 	c_id, err := primitive.ObjectIDFromHex(environment.ClusterID)
 	if err != nil {
-		r.Messages["error"] = append(r.Messages["error"], "Invalid cluster ID")
-		c.JSON(http.StatusBadRequest, gin.H{"messages": r.Messages})
+		messages["error"] = append(messages["error"], "Invalid cluster ID")
+		c.JSON(http.StatusBadRequest, gin.H{"messages": messages})
 		return
 	}
 
@@ -140,88 +202,65 @@ func CreateMicroserviceWithYaml(c *gin.Context) {
 
 	err = cluster.Get(driver)
 	if err != nil {
-		log.Printf("Error getting cluster %v", err)
-		r.Messages["error"] = append(r.Messages["error"], "Error getting cluster")
-		c.JSON(http.StatusInternalServerError, gin.H{"messages": r.Messages})
+		logger.Error("Error getting cluster", "error", err)
+		messages["error"] = append(messages["error"], "Error getting cluster")
+		c.JSON(http.StatusInternalServerError, gin.H{"messages": messages})
 		return
 	}
 
 	if slices.Contains(cluster.Teamspaces, project.TeamspaceID) {
-		r.Messages["error"] = append(r.Messages["error"], "Unauthorized")
-		c.JSON(http.StatusUnauthorized, gin.H{"messages": r.Messages})
+		messages["error"] = append(messages["error"], "Unauthorized")
+		c.JSON(http.StatusUnauthorized, gin.H{"messages": messages})
 		return
 	}
 
-	// Make a request to the kubernetes api
-	req, err := http.NewRequest("POST", kubernetesApiUrl+"/resources/with-yaml", c.Request.Body)
+	// 3. Save the operation, the deployments are made on the cluster by a worker
+	payload, err := io.ReadAll(c.Request.Body)
 	if err != nil {
-		log.Printf("Error creating request %v", err)
-		r.Messages["error"] = append(r.Messages["error"], "Error making deployments on the cluster")
-		c.JSON(http.StatusInternalServerError, gin.H{"messages": r.Messages})
+		logger.Warn("Error reading request body", "error", err)
+		messages["error"] = append(messages["error"], "Error reading the files")
+		c.JSON(http.StatusBadRequest, gin.H{"messages": messages})
 		return
 	}
-	req.Header.Set("Content-Type", c.Request.Header.Get("Content-Type"))
-	req.Header.Set("Authorization", cluster.Token)
-	req.Header.Set("cluster-type", cluster.Type)
 
-	// Create a client
-	client := &http.Client{
-		Timeout: 60 * time.Second,
-	}
-	resp, err := client.Do(req)
+	// the placeholders of the manifests are replaced by the variables of the environment, an undefined one refuses the deployment
+	var undefined map[string][]string
+	payload, undefined, err = templateManifests(payload, c.Request.Header.Get("Content-Type"), environment.Variables)
 	if err != nil {
-		log.Printf("Error making deployments %v", err)
-		r.Messages["error"] = append(r.Messages["error"], "Error making deployments on the cluster")
-		c.JSON(http.StatusInternalServerError, gin.H{"messages": r.Messages})
+		logger.Warn("Error templating the files", "error", err)
+		messages["error"] = append(messages["error"], fmt.Sprintf("Error reading the files : %v", err))
+		c.JSON(http.StatusBadRequest, gin.H{"messages": messages})
 		return
 	}
-
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Printf("Error reading response body %v", err)
-		r.Messages["error"] = append(r.Messages["error"], "Error reading response body")
-		c.JSON(resp.StatusCode, gin.H{"messages": r.Messages})
+	if len(undefined) > 0 {
+		for file, variables := range undefined {
+			messages["error"] = append(messages["error"], fmt.Sprintf("Undefined variables in %s : %s", file, strings.Join(variables, ", ")))
+		}
+		sort.Strings(messages["error"])
+		c.JSON(http.StatusBadRequest, gin.H{"messages": messages})
 		return
 	}
 
-	err = json.Unmarshal(body, &r)
+	operation := models.Operation{
+		Type:          models.DeployOperation,
+		EnvironmentID: eId,
+		ClusterID:     environment.ClusterID,
+		CreatorID:     user.ID.Hex(),
+		Payload:       payload,
+		ContentType:   c.Request.Header.Get("Content-Type"),
+		RequestID:     logging.RequestID(c.Request.Context()),
+	}
+	err = operation.Create(driver)
 	if err != nil {
-		log.Printf("Error unmarshalling response body %v", err)
-		r.Messages["error"] = append(r.Messages["error"], "Error unmarshalling response body")
-		c.JSON(resp.StatusCode, gin.H{"messages": r.Messages, "microservices": r.Microservices})
+		logger.Error("Error creating operation", "error", err)
+		messages["error"] = append(messages["error"], "Error making deployments on the cluster")
+		c.JSON(http.StatusInternalServerError, gin.H{"messages": messages})
 		return
 	}
+	enqueueOperation(operation.ID)
 
-	// TODO : Save the microservices in the database even if it already exists in the cluster
-	// 4. Save the microservice in the database
-	for _, m := range r.Microservices {
-
-		// 4.1 Save the microservice
-		m.EnvironmentID = eId
-		m.CreatorID = user.ID.Hex()
-		m.DeployedAt = time.Now()
-
-		err = m.Create(driver)
-		if err != nil {
-			log.Printf("Error creating microservice %v", err)
-			if er := utils.OnDuplicateKeyError(err, "Microservice"); er != nil {
-				r.Messages["info"] = append(r.Messages["info"], "Microservice "+m.Name+" already saved")
-			} else {
-				r.Messages["error"] = append(r.Messages["error"], "Error saving microservice "+m.Name)
-			}
-			continue
-		}
-		log.Printf("Microservice %s saved successfully", m.Name)
-		r.Messages["success"] = append(r.Messages["success"], "Microservice "+m.Name+" saved successfully")
-	}
-
-	if r.Message != "" {
-		r.Messages["error"] = append(r.Messages["error"], r.Message)
-	}
-	log.Println("Microservices created successfully")
-	c.JSON(resp.StatusCode, gin.H{"messages": r.Messages, "microservices": r.Microservices})
+	logger.Info("Deployment operation created", logging.KeyOperationID, operation.ID.Hex())
+	c.JSON(http.StatusAccepted, gin.H{"message": "Deployment operation started", "operation": operation})
 }
 
 func GetMicroservices(c *gin.Context) {
@@ -232,7 +271,7 @@ func GetMicroservices(c *gin.Context) {
 	}
 	microservices, err := m.GetAllByCreator(driver)
 	if err != nil {
-		log.Printf("Error getting microservices %v", err)
+		logging.Logger(c).Error("Error getting microservices", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error getting microservices"})
 		return
 	}
@@ -259,7 +298,7 @@ func GetMicroserviceByEnvironment(c *gin.Context) {
 	err = microservice.Get(driver)
 
 	if err != nil {
-		log.Printf("Error getting microservice %v", err)
+		logging.Logger(c).Warn("Error getting microservice", "error", err)
 		if er := utils.OnDuplicateKeyError(err, "Microservice"); er != nil {
 			c.JSON(http.StatusConflict, gin.H{"message": er.Error()})
 		} else {
@@ -281,7 +320,7 @@ func GetMicroservicesByEnvironment(c *gin.Context) {
 
 	microservices, err := m.GetAllByEnvironment(driver)
 	if err != nil {
-		log.Printf("Error getting microservices %v", err)
+		logging.Logger(c).Error("Error getting microservices", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error getting microservices"})
 		return
 	}
@@ -297,12 +336,11 @@ func UpdateMicroservice(c *gin.Context) {
 		return
 	}
 
-	_, driver := GetUserFromContext(c)
+	user, driver := GetUserFromContext(c)
 
 	id := c.Param("m_id")
 	e_id := c.Param("e_id")
-	m_id, _ := primitive.ObjectIDFromHex(id)
-	env_id, err := primitive.ObjectIDFromHex(e_id)
+	m_id, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid microservice or environment ID"})
 		return
@@ -315,88 +353,87 @@ func UpdateMicroservice(c *gin.Context) {
 
 	err = microservice.Get(driver)
 	if err != nil {
-		log.Printf("Error getting microservice %v", err)
+		logging.Logger(c).Error("Error getting microservice", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error getting microservice"})
 		return
 	}
-
-	// 2. Get the environment
-	environment := models.Environment{
-		ID: env_id,
-	}
-	err = environment.Get(driver)
-	if err != nil {
-		log.Printf("Error getting environment %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error getting environment"})
+	logging.With(c, logging.KeyNamespace, microservice.Namespace)
+	if !microservice.IsDeployment() {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Only the microservices deployed as deployments can be updated"})
 		return
 	}
 
-	// 3. Get the cluster and make a request to the kubernetes api to create the microservice
-	c_id, err := primitive.ObjectIDFromHex(environment.ClusterID)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid cluster ID"})
-		return
-	}
-
-	cluster := models.Cluster{
-		ID: c_id,
-	}
-
-	err = cluster.Get(driver)
-	if err != nil {
-		log.Printf("Error getting cluster %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error getting cluster"})
+	// 2. Get the environment and its cluster
+	environment, _, ok := getEnvironmentAndCluster(c, driver, e_id)
+	if !ok {
 		return
 	}
 
 	// Serialize the updateForm to JSON for the request body
-	updateFormJSON, err := json.Marshal(updateForm)
+	updateFormJSON, err := json.Marshal(updateForm.toK8sUpdateRequest())
 	if err != nil {
-		log.Printf("Error marshalling update form to JSON: %v", err)
+		logging.Logger(c).Error("Error marshalling update form to JSON", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error preparing update data"})
 		return
 	}
 
-	// Make a request to the kubernetes api
-	resp, body, ok := MakeRequestToKubernetesAPI(c, cluster, "PATCH", "/resources/namespaces/"+microservice.Namespace+"/deployments/"+microservice.Name, bytes.NewBuffer(updateFormJSON))
-	if !ok {
-		return
+	// Save the operation, the update is made on the cluster by a worker
+	operation := models.Operation{
+		Type:           models.UpdateOperation,
+		EnvironmentID:  e_id,
+		ClusterID:      environment.ClusterID,
+		MicroserviceID: id,
+		CreatorID:      user.ID.Hex(),
+		Payload:        updateFormJSON,
+		ContentType:    "application/json",
+		RequestID:      logging.RequestID(c.Request.Context()),
 	}
-
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("Error from Kubernetes API: %v", string(body))
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error from Kubernetes API", "details": string(body)})
+	err = operation.Create(driver)
+	if err != nil {
+		logging.Logger(c).Error("Error creating operation", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating microservice"})
 		return
 	}
+	enqueueOperation(operation.ID)
 
-	if updateForm.Strategy == "blue-green" {
+	logging.Logger(c).Info("Update operation created", logging.KeyOperationID, operation.ID.Hex(), "microservice", microservice.Name)
+	c.JSON(http.StatusAccepted, gin.H{"message": "Update operation started", "operation": operation})
+}
 
-		// Only update the microservice information if the Kubernetes API call was successful
-		microservice.Replicas = updateForm.Replicas
-		microservice.DeployedAt = time.Now()
-		microservice.Labels["version"] = "green"
-		microservice.Name = microservice.Name + "-green"
-		for i := range microservice.Containers {
-			microservice.Containers[i].Image = updateForm.Image
-		}
+// getEnvironmentAndCluster returns the environment and the cluster it is deployed on.
+// It responds to the request and returns false if one of them cannot be retrieved.
+func getEnvironmentAndCluster(c *gin.Context, driver db.Driver, e_id string) (models.Environment, models.Cluster, bool) {
+	env_id, err := primitive.ObjectIDFromHex(e_id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid environment ID"})
+		return models.Environment{}, models.Cluster{}, false
+	}
 
-	} else {
-		// Only update the microservice information if the Kubernetes API call was successful
-		microservice.Replicas = updateForm.Replicas
-		microservice.Strategy = updateForm.Strategy
-		microservice.DeployedAt = time.Now()
-		for i := range microservice.Containers {
-			microservice.Containers[i].Image = updateForm.Image
-		}
+	environment := models.Environment{
+		ID: env_id,
+	}
+	err = environment.Get(driver)
+	if err != nil {
+		logging.Logger(c).Error("Error getting environment", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error getting environment"})
+		return models.Environment{}, models.Cluster{}, false
 	}
 
-	err = microservice.Update(driver)
+	c_id, err := primitive.ObjectIDFromHex(environment.ClusterID)
 	if err != nil {
-		log.Printf("Error updating microservice %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating microservice"})
-		return
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid cluster ID"})
+		return models.Environment{}, models.Cluster{}, false
 	}
 
-	log.Printf("Microservice %s updated successfully", microservice.Name)
-	c.JSON(resp.StatusCode, gin.H{"message": "Microservice updated successfully", "microservice": microservice})
+	cluster := models.Cluster{
+		ID: c_id,
+	}
+	err = cluster.Get(driver)
+	if err != nil {
+		logging.Logger(c).Error("Error getting cluster", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error getting cluster"})
+		return models.Environment{}, models.Cluster{}, false
+	}
+	logging.With(c, logging.KeyClusterID, cluster.ID.Hex())
+	return environment, cluster, true
 }
@@ -1,11 +1,11 @@
 package controllers
 
 import (
-	"encoding/json"
-	"log"
+	"context"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/kuro-jojo/kdi-k8s/shared/logging"
 	"github.com/kuro-jojo/kdi-web/models"
 	"github.com/kuro-jojo/kdi-web/models/utils"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -13,14 +13,14 @@ import (
 
 // GetNamespacesFromCluster gets all namespaces from the cluster by calling the kubernetes API
 func GetNamespacesFromCluster(c *gin.Context) {
-	log.Println("Getting all namespaces...")
+	logging.Logger(c).Debug("Getting all namespaces...")
 
 	user, driver := GetUserFromContext(c)
 
 	c_id := c.Param("id")
 	id, err := primitive.ObjectIDFromHex(c_id)
 	if err != nil {
-		log.Printf("Error converting id %v", err)
+		logging.Logger(c).Warn("Error converting id", "error", err)
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid id"})
 		return
 	}
@@ -34,7 +34,7 @@ func GetNamespacesFromCluster(c *gin.Context) {
 	}
 	err = cluster.Get(driver)
 	if err != nil {
-		log.Printf("Error getting cluster %v", err)
+		logging.Logger(c).Warn("Error getting cluster", "error", err)
 		if utils.OnNotFoundError(err, "Cluster") != nil {
 			c.JSON(http.StatusNotFound, gin.H{"message": "Cluster not found"})
 		} else {
@@ -43,24 +43,62 @@ func GetNamespacesFromCluster(c *gin.Context) {
 		return
 	}
 
-	resp, body, ok := MakeRequestToKubernetesAPI(c, cluster, "GET", "/resources/namespaces", c.Request.Body)
-	if !ok {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), KubernetesAPITimeout)
+	defer cancel()
+	namespaces, err := kubernetesAPI(cluster).Namespaces(ctx)
+	if err != nil {
+		logging.Logger(c).Error("Error getting namespaces", "error", err)
+		RespondWithK8sApiError(c, err)
 		return
 	}
 
-	response := make(map[string][]string)
-	err = json.Unmarshal(body, &response)
+	c.JSON(http.StatusOK, gin.H{"namespaces": namespaces})
+}
+
+// GetWorkloadsFromCluster gets the workloads (deployments, statefulsets, daemonsets and cronjobs) of a namespace of the cluster
+func GetWorkloadsFromCluster(c *gin.Context) {
+	logging.Logger(c).Debug("Getting workloads...")
+
+	user, driver := GetUserFromContext(c)
+
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		logging.Logger(c).Warn("Error converting id", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid id"})
+		return
+	}
+	cluster := models.Cluster{
+		ID: id,
+	}
+
+	ok := UserHasRightOnCluster(c, driver, cluster, user, []string{models.ViewClusterRole})
+	if !ok {
+		return
+	}
+	err = cluster.Get(driver)
 	if err != nil {
-		log.Printf("Error unmarshalling response %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error unmarshalling response"})
+		logging.Logger(c).Warn("Error getting cluster", "error", err)
+		if utils.OnNotFoundError(err, "Cluster") != nil {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Cluster not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error getting cluster"})
+		}
 		return
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("Error making request : %v", response["message"])
-		c.JSON(resp.StatusCode, response)
+	logging.With(c, logging.KeyClusterID, cluster.ID.Hex(), logging.KeyNamespace, c.Param("namespace"))
+	ctx, cancel := context.WithTimeout(c.Request.Context(), KubernetesAPITimeout)
+	defer cancel()
+	response, err := kubernetesAPI(cluster).Workloads(ctx, c.Param("namespace"), c.Query("kind"))
+	if err != nil {
+		logging.Logger(c).Error("Error getting workloads", "error", err)
+		RespondWithK8sApiError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, response)
+	workloads := make([]models.Workload, 0, len(response.Workloads))
+	for _, workload := range response.Workloads {
+		workloads = append(workloads, workloadFrom(workload))
+	}
+	c.JSON(http.StatusOK, gin.H{"workloads": workloads, "size": len(workloads), "errors": response.Errors})
 }
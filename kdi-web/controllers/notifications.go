@@ -1,11 +1,13 @@
 package controllers
 
 import (
-	"log"
+	"context"
+	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/kuro-jojo/kdi-k8s/shared/logging"
 	"github.com/kuro-jojo/kdi-web/db"
 	"github.com/kuro-jojo/kdi-web/models"
 	"github.com/kuro-jojo/kdi-web/models/utils"
@@ -20,7 +22,7 @@ type NotificationForm struct {
 }
 
 func GetNotifications(c *gin.Context) {
-	log.Println("Getting notifications...")
+	logging.Logger(c).Debug("Getting notifications...")
 
 	user, driver := GetUserFromContext(c)
 	notification := models.Notification{ID: user.ID}
@@ -28,7 +30,7 @@ func GetNotifications(c *gin.Context) {
 	err := notification.Get(driver)
 	if err != nil {
 		if err = utils.OnNotFoundError(err, "Notification"); err == nil {
-			log.Printf("Error getting notifications: %v", err)
+			logging.Logger(c).Error("Error getting notifications", "error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"message": "Internal server error"})
 			return
 		}
@@ -38,19 +40,19 @@ func GetNotifications(c *gin.Context) {
 }
 
 func ReadNotification(c *gin.Context) {
-	log.Println("Reading notification...")
+	logging.Logger(c).Debug("Reading notification...")
 
 	user, driver := GetUserFromContext(c)
 	notificationForm := NotificationForm{}
 	if err := c.ShouldBindJSON(&notificationForm); err != nil {
-		log.Printf("Error binding JSON: %v", err)
+		logging.Logger(c).Warn("Error binding JSON", "error", err)
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request"})
 		return
 	}
 	notification := models.Notification{ID: user.ID}
 	createdAt, err := time.Parse(time.RFC3339, notificationForm.CreatedAt)
 	if err != nil {
-		log.Printf("Error parsing created_at: %v", err)
+		logging.Logger(c).Warn("Error parsing created_at", "error", err)
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid created_at format"})
 		return
 	}
@@ -63,40 +65,86 @@ func ReadNotification(c *gin.Context) {
 	}
 	err = notification.Read(driver, notitificationContent)
 	if err != nil {
-		log.Printf("Error reading notification: %v", err)
+		logging.Logger(c).Error("Error reading notification", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Internal server error"})
 		return
 	}
-	log.Println("Notification read successfully")
+	logging.Logger(c).Info("Notification read successfully")
 	c.JSON(http.StatusOK, gin.H{"message": "Notification read successfully"})
 }
 
 func DeleteNotifications(c *gin.Context) {
-	log.Println("Deleting all notifications...")
+	logging.Logger(c).Debug("Deleting all notifications...")
 
 	user, driver := GetUserFromContext(c)
 	notification := models.Notification{ID: user.ID}
 
 	err := notification.Delete(driver)
 	if err != nil {
-		log.Printf("Error deleting notifications: %v", err)
+		logging.Logger(c).Error("Error deleting notifications", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Internal server error"})
 		return
 	}
-	log.Println("Notifications deleted successfully")
+	logging.Logger(c).Info("Notifications deleted successfully")
 	c.JSON(http.StatusOK, gin.H{"message": "Notifications deleted successfully"})
 }
 
 func SendNotificationToMember(c *gin.Context, userMember models.User, teamspace models.Teamspace, messageContent string) bool {
 	user, driver := GetUserFromContext(c)
 
+	if err := addNotification(c.Request.Context(), driver, user.ID.Hex(), userMember, teamspace, messageContent); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Internal server error"})
+		return false
+	}
+	return true
+}
+
+func SendNotificationToAllMembers(c *gin.Context, userMember models.User, teamspace models.Teamspace, driver db.Driver, messageContent string) bool {
+	user, _ := GetUserFromContext(c)
+
+	if err := notifyMembers(c.Request.Context(), driver, user.ID.Hex(), userMember, teamspace, messageContent); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Internal server error"})
+		return false
+	}
+	return true
+}
+
+// notifyMembers adds a message from the sender to the notifications of all the members of the teamspace except userMember.
+// It can be used outside of a request, by the operations for instance.
+func notifyMembers(ctx context.Context, driver db.Driver, senderID string, userMember models.User, teamspace models.Teamspace, messageContent string) error {
+	for _, m := range teamspace.Members {
+		if m.UserID != userMember.ID.Hex() {
+			m_id, err := primitive.ObjectIDFromHex(m.UserID)
+			if err != nil {
+				logging.FromContext(ctx).Error("Error getting member ID", "error", err)
+				continue
+			}
+
+			member := models.User{
+				ID: m_id,
+			}
+			err = member.Get(driver)
+			if err != nil {
+				logging.FromContext(ctx).Error("Error getting member", "error", err)
+				continue
+			}
+			if err := addNotification(ctx, driver, senderID, member, teamspace, messageContent); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// addNotification adds a message from the sender to the notifications of the member
+func addNotification(ctx context.Context, driver db.Driver, senderID string, userMember models.User, teamspace models.Teamspace, messageContent string) error {
 	notification := models.Notification{
 		ID: userMember.ID,
 	}
 
 	err := notification.Get(driver)
 	notificationContent := models.NotificationContent{
-		SenderID:    user.ID.Hex(),
+		SenderID:    senderID,
 		TeamspaceID: teamspace.ID.Hex(),
 		Content:     messageContent,
 		CreatedAt:   time.Now(),
@@ -107,55 +155,26 @@ func SendNotificationToMember(c *gin.Context, userMember models.User, teamspace
 	if err != nil {
 
 		if err = utils.OnNotFoundError(err, "Notification"); err != nil {
-			log.Printf("Notification section doesn't exist, creating it...")
+			logging.FromContext(ctx).Debug("Notification section doesn't exist, creating it...")
 			err = notification.Create(driver)
 			if err != nil {
-				log.Printf("Error creating notification: %v", err)
-				c.JSON(http.StatusInternalServerError, gin.H{"message": "Internal server error"})
-				return false
+				logging.FromContext(ctx).Error("Error creating notification", "error", err)
+				return err
 			}
 		} else {
-			log.Printf("Error getting notification: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Internal server error"})
-			return false
+			logging.FromContext(ctx).Error("Error getting notification", "error", err)
+			return fmt.Errorf("error getting notification")
 		}
 	} else {
 
-		log.Printf("Notification section exists, adding message to it...")
+		logging.FromContext(ctx).Debug("Notification section exists, adding message to it...")
 		err = notification.AddMessage(driver, notificationContent)
 		if err != nil {
-			log.Printf("Error adding message to notification: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Internal server error"})
-			return false
+			logging.FromContext(ctx).Error("Error adding message to notification", "error", err)
+			return err
 		}
 	}
 
-	log.Printf("Notification sent to %s", userMember.Email)
-	return true
-}
-
-func SendNotificationToAllMembers(c *gin.Context, userMember models.User, teamspace models.Teamspace, driver db.Driver, messageContent string) bool {
-	for _, m := range teamspace.Members {
-		if m.UserID != userMember.ID.Hex() {
-			m_id, err := primitive.ObjectIDFromHex(m.UserID)
-			if err != nil {
-				log.Printf("Error getting member ID: %v", err)
-				continue
-			}
-
-			member := models.User{
-				ID: m_id,
-			}
-			err = member.Get(driver)
-			if err != nil {
-				log.Printf("Error getting member: %v", err)
-				continue
-			}
-			ok := SendNotificationToMember(c, member, teamspace, messageContent)
-			if !ok {
-				return false
-			}
-		}
-	}
-	return true
+	logging.FromContext(ctx).Info("Notification sent", "email", userMember.Email)
+	return nil
 }
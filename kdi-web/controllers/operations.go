@@ -0,0 +1,523 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kuro-jojo/kdi-k8s/client"
+	"github.com/kuro-jojo/kdi-k8s/shared/logging"
+	"github.com/kuro-jojo/kdi-web/db"
+	"github.com/kuro-jojo/kdi-web/metrics"
+	"github.com/kuro-jojo/kdi-web/models"
+	"github.com/kuro-jojo/kdi-web/models/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// OperationWorkers is the number of operations executed at the same time
+	OperationWorkers = 4
+	// OperationTimeout is the maximum duration of a request to the kubernetes api made by an operation
+	OperationTimeout = 15 * time.Minute
+	// MaxOperationsListed is the number of operations returned when listing the operations of an environment
+	MaxOperationsListed = 20
+
+	// StaleOperationMessage is the error of the operations interrupted by a restart of the server
+	StaleOperationMessage = "The operation was interrupted by a restart of the server. The state of the cluster may be partial, please check it before retrying."
+	// OperationInterruptTimeout is the time given to the interrupted operations to be saved during a shutdown
+	OperationInterruptTimeout = 5 * time.Second
+	// OperationHeartbeatInterval is how often a running operation is reported alive and the stale operations are looked for
+	OperationHeartbeatInterval = 30 * time.Second
+	// OperationHeartbeatTimeout is the time after which a running operation not reported alive is stale.
+	// It leaves a few heartbeats to a server slowed down before its operations are taken as lost.
+	OperationHeartbeatTimeout = 4 * OperationHeartbeatInterval
+)
+
+var (
+	// operationQueue holds the IDs of the operations waiting for a worker
+	operationQueue chan primitive.ObjectID
+	// operationsStopping is closed when the server shuts down, the workers stop taking operations
+	operationsStopping chan struct{}
+	// operationsContext is the parent of the requests of the operations, canceled if they outlast the shutdown grace period
+	operationsContext   context.Context
+	interruptOperations context.CancelFunc
+	operationWorkers    sync.WaitGroup
+)
+
+// StartOperationWorkers starts the workers executing the operations.
+// Pending operations of a previous run are resumed. The running operations are reported alive by the server running them,
+// the ones no server reported alive for OperationHeartbeatTimeout are marked as failed since there is no way to know how far they went.
+// The operations of the other servers sharing the database are left alone while they are alive.
+func StartOperationWorkers(driver db.Driver, workers int) {
+	operationQueue = make(chan primitive.ObjectID, 100)
+	operationsStopping = make(chan struct{})
+	operationsContext, interruptOperations = context.WithCancel(context.Background())
+	for i := 0; i < workers; i++ {
+		operationWorkers.Add(1)
+		go operationWorker(driver)
+	}
+
+	failStaleOperations(driver)
+	go func() {
+		ticker := time.NewTicker(OperationHeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-operationsStopping:
+				return
+			case <-ticker.C:
+				failStaleOperations(driver)
+			}
+		}
+	}()
+
+	var o models.Operation
+	pending, err := o.GetAllByStatus(driver, models.OperationPending)
+	if err != nil {
+		slog.Error("Error getting pending operations", "error", err)
+	}
+	for _, operation := range pending {
+		slog.Info("Resuming operation", logging.KeyOperationID, operation.ID.Hex())
+		enqueueOperation(operation.ID)
+	}
+}
+
+// failStaleOperations marks as failed the running operations no server reported alive for OperationHeartbeatTimeout
+func failStaleOperations(driver db.Driver) {
+	var o models.Operation
+	before := time.Now().Add(-OperationHeartbeatTimeout)
+	stale, err := o.GetAllStale(driver, before)
+	if err != nil {
+		slog.Error("Error getting stale operations", "error", err)
+		return
+	}
+	for _, operation := range stale {
+		failed, err := operation.FailIfStale(driver, before, StaleOperationMessage)
+		if err != nil {
+			slog.Error("Error marking operation as stale", logging.KeyOperationID, operation.ID.Hex(), "error", err)
+			continue
+		}
+		if failed {
+			slog.Info("Operation marked as stale", logging.KeyOperationID, operation.ID.Hex(), "heartbeat", operation.HeartbeatAt)
+		}
+	}
+}
+
+// keepOperationAlive reports the operation alive until the returned function is called
+func keepOperationAlive(driver db.Driver, id primitive.ObjectID) func() {
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(OperationHeartbeatInterval)
+		defer ticker.Stop()
+		operation := models.Operation{ID: id}
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := operation.Heartbeat(driver); err != nil {
+					slog.Error("Error reporting operation alive", logging.KeyOperationID, id.Hex(), "error", err)
+				}
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-stopped
+	}
+}
+
+// StopOperationWorkers stops the workers once their running operation is finished.
+// The operations still running when ctx expires are interrupted and saved as failed;
+// the pending ones stay pending and are resumed by the next start.
+func StopOperationWorkers(ctx context.Context) error {
+	close(operationsStopping)
+	stopped := make(chan struct{})
+	go func() {
+		operationWorkers.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+	}
+	slog.Info("Interrupting the running operations")
+	interruptOperations()
+	select {
+	case <-stopped:
+		return nil
+	case <-time.After(OperationInterruptTimeout):
+		return fmt.Errorf("operations still running after %v", OperationInterruptTimeout)
+	}
+}
+
+// enqueueOperation hands the operation to the workers without blocking the caller
+func enqueueOperation(id primitive.ObjectID) {
+	go func() {
+		select {
+		case operationQueue <- id:
+		case <-operationsStopping:
+		}
+	}()
+}
+
+func operationWorker(driver db.Driver) {
+	defer operationWorkers.Done()
+	for {
+		select {
+		case <-operationsStopping:
+			return
+		case id := <-operationQueue:
+			runQueuedOperation(driver, id)
+		}
+	}
+}
+
+func runQueuedOperation(driver db.Driver, id primitive.ObjectID) {
+	select {
+	case <-operationsStopping:
+		// left pending for the next start
+		return
+	default:
+	}
+	operation := models.Operation{ID: id}
+	if err := operation.Get(driver); err != nil {
+		slog.Error("Error getting operation", logging.KeyOperationID, id.Hex(), "error", err)
+		return
+	}
+	started, err := operation.Start(driver)
+	if err != nil {
+		slog.Error("Error starting operation", logging.KeyOperationID, id.Hex(), "error", err)
+		return
+	}
+	if !started {
+		return
+	}
+
+	ctx := operationContext(operation)
+	logger := logging.FromContext(ctx)
+	logger.Info("Running operation", "type", operation.Type)
+	stopHeartbeat := keepOperationAlive(driver, operation.ID)
+	status := runOperation(ctx, driver, &operation)
+	stopHeartbeat()
+	finished, err := operation.Finish(driver, status)
+	if err != nil {
+		logger.Error("Error saving operation", "error", err)
+		return
+	}
+	if !finished {
+		logger.Warn("Operation failed as stale meanwhile, its outcome is not saved", "type", operation.Type, "status", status)
+		return
+	}
+	metrics.ObserveOperation(operation.Type, status)
+	logger.Info("Operation finished", "type", operation.Type, "status", status, "error", operation.Error)
+}
+
+// operationContext returns the context of the requests of the operation, its logger carries the fields of the operation
+// and the id of the request that created it
+func operationContext(operation models.Operation) context.Context {
+	ctx := operationsContext
+	if operation.RequestID != "" {
+		ctx = logging.WithRequestID(ctx, operation.RequestID)
+	}
+	logger := logging.FromContext(ctx).With(
+		logging.KeyOperationID, operation.ID.Hex(),
+		logging.KeyUserID, operation.CreatorID,
+		logging.KeyClusterID, operation.ClusterID,
+	)
+	return logging.NewContext(ctx, logger)
+}
+
+// runOperation executes the operation and returns its final status
+func runOperation(ctx context.Context, driver db.Driver, operation *models.Operation) string {
+	operation.Messages = make(map[string][]string)
+
+	c_id, err := primitive.ObjectIDFromHex(operation.ClusterID)
+	if err != nil {
+		operation.Error = "Invalid cluster ID"
+		return models.OperationFailed
+	}
+	cluster := models.Cluster{ID: c_id}
+	if err := cluster.Get(driver); err != nil {
+		logging.FromContext(ctx).Error("Error getting cluster", "error", err)
+		operation.Error = "Error getting cluster"
+		return models.OperationFailed
+	}
+
+	switch operation.Type {
+	case models.DeployOperation:
+		return runDeployOperation(ctx, driver, operation, cluster)
+	case models.UpdateOperation:
+		return runUpdateOperation(ctx, driver, operation, cluster)
+	}
+	operation.Error = fmt.Sprintf("Unknown operation type %s", operation.Type)
+	return models.OperationFailed
+}
+
+// runDeployOperation creates the objects of the uploaded files and saves the microservices
+func runDeployOperation(ctx context.Context, driver db.Driver, operation *models.Operation, cluster models.Cluster) string {
+	logger := logging.FromContext(ctx)
+	ctx, cancel := context.WithTimeout(ctx, OperationTimeout)
+	defer cancel()
+
+	// the policies of the environment are added at execution time so that they cannot be set by the uploader
+	payload, err := withEnvironmentPolicies(driver, operation.EnvironmentID, operation.Payload, operation.ContentType)
+	if err != nil {
+		logger.Error("Error adding the policies to the payload", "error", err)
+		operation.Error = "Error getting the policies of the environment"
+		return models.OperationFailed
+	}
+
+	r, err := kubernetesAPI(cluster).UploadResources(ctx, operation.ContentType, bytes.NewReader(payload))
+	apiErr, isAPIError := client.AsError(err)
+	if err != nil && !isAPIError {
+		logger.Error("Error making deployments", "error", err)
+		operation.Error = operationRequestError("Error making deployments on the cluster")
+		return models.OperationFailed
+	}
+	for k, v := range r.Messages {
+		operation.Messages[k] = append(operation.Messages[k], v...)
+	}
+
+	status := models.OperationSucceeded
+	if isAPIError {
+		status = models.OperationFailed
+		operation.Error = apiErr.Message
+	}
+	for _, result := range r.Results {
+		res := models.OperationResult{
+			Object:  result.Namespace + "/" + result.Object,
+			Status:  models.OperationSucceeded,
+			Message: result.Message,
+			Reason:  result.Reason,
+
+			Violations: violationsFrom(result.Violations),
+		}
+		if result.Status >= http.StatusBadRequest {
+			res.Status = models.OperationFailed
+			status = models.OperationFailed
+		} else if result.Rollout != nil && result.Rollout.Outcome != client.RolloutAvailable {
+			// the object was created but its rollout did not complete
+			res.Status = models.OperationFailed
+			res.Message = result.Rollout.Message
+			res.Reason = result.Rollout.Outcome
+			status = models.OperationFailed
+		}
+		operation.Results = append(operation.Results, res)
+	}
+
+	// Save the microservices in the database
+	for _, created := range r.Microservices {
+		m := microserviceFrom(created)
+		if m.Kind == "" {
+			m.Kind = models.DeploymentKind
+		}
+		m.EnvironmentID = operation.EnvironmentID
+		m.CreatorID = operation.CreatorID
+		m.DeployedAt = time.Now()
+
+		err = m.Create(driver)
+		if err != nil {
+			logger.Error("Error creating microservice", "microservice", m.Name, logging.KeyNamespace, m.Namespace, "error", err)
+			if er := utils.OnDuplicateKeyError(err, "Microservice"); er != nil {
+				operation.Messages["info"] = append(operation.Messages["info"], "Microservice "+m.Name+" already saved")
+			} else {
+				operation.Messages["error"] = append(operation.Messages["error"], "Error saving microservice "+m.Name)
+			}
+			continue
+		}
+		logger.Info("Microservice saved", "microservice", m.Name, logging.KeyNamespace, m.Namespace)
+		operation.Messages["success"] = append(operation.Messages["success"], "Microservice "+m.Name+" saved successfully")
+		operation.Microservices = append(operation.Microservices, m)
+	}
+
+	// the errors of the files are already in the messages
+	if isAPIError && len(apiErr.Messages) == 0 && apiErr.Message != "" {
+		operation.Messages["error"] = append(operation.Messages["error"], apiErr.Message)
+	}
+	return status
+}
+
+// operationRequestError returns the error of an operation whose request to the kubernetes api failed
+func operationRequestError(message string) string {
+	if operationsContext.Err() != nil {
+		return StaleOperationMessage
+	}
+	return message
+}
+
+// runUpdateOperation updates the deployment of the microservice and saves the new state of the microservice
+func runUpdateOperation(ctx context.Context, driver db.Driver, operation *models.Operation, cluster models.Cluster) string {
+	logger := logging.FromContext(ctx)
+	m_id, err := primitive.ObjectIDFromHex(operation.MicroserviceID)
+	if err != nil {
+		operation.Error = "Invalid microservice ID"
+		return models.OperationFailed
+	}
+	microservice := models.Microservice{ID: m_id}
+	if err := microservice.Get(driver); err != nil {
+		logger.Error("Error getting microservice", "error", err)
+		operation.Error = "Error getting microservice"
+		return models.OperationFailed
+	}
+	logger = logger.With("microservice", microservice.Name, logging.KeyNamespace, microservice.Namespace)
+
+	var request client.UpdateRequest
+	if err := json.Unmarshal(operation.Payload, &request); err != nil {
+		operation.Error = "Invalid update form"
+		return models.OperationFailed
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, OperationTimeout)
+	defer cancel()
+
+	r, err := kubernetesAPI(cluster).UpdateDeployment(ctx, microservice.Namespace, microservice.Name, request)
+	apiErr, isAPIError := client.AsError(err)
+	if err != nil && !isAPIError {
+		logger.Error("Error making request", "error", err)
+		operation.Error = operationRequestError("Error making request to the cluster")
+		return models.OperationFailed
+	}
+
+	result := models.OperationResult{
+		Object:  microservice.Namespace + "/" + microservice.Name,
+		Message: r.Message,
+		Reason:  r.Reason,
+	}
+	if r.Rollout != nil {
+		// keep the state of the rollout even if it failed
+		microservice.Conditions = conditionsFrom(r.Rollout.Conditions)
+		if err := microservice.Update(driver); err != nil {
+			logger.Error("Error updating microservice conditions", "error", err)
+		}
+		if r.Rollout.Rollback != nil {
+			notifyRollback(ctx, driver, operation, microservice, *r.Rollout.Rollback, r.Rollout.Message)
+		}
+	}
+	if isAPIError {
+		logger.Warn("Error from Kubernetes API", "status", apiErr.StatusCode, "error", apiErr.Error())
+		result.Status = models.OperationFailed
+		operation.Results = append(operation.Results, result)
+		operation.Error = apiErr.Message
+		if operation.Error == "" {
+			operation.Error = string(apiErr.Body)
+		}
+		return models.OperationFailed
+	}
+	result.Status = models.OperationSucceeded
+	operation.Results = append(operation.Results, result)
+
+	images := updatedImages(request, microservice.Containers)
+	if request.Strategy == models.BlueGreenStrategy {
+		microservice.Labels["version"] = "green"
+		microservice.Name = microservice.Name + "-green"
+	} else {
+		microservice.Strategy = request.Strategy
+	}
+	// Only update the microservice information if the Kubernetes API call was successful
+	microservice.Replicas = request.Replicas
+	microservice.DeployedAt = time.Now()
+	for i, container := range microservice.Containers {
+		if image, ok := images[container.Name]; ok {
+			microservice.Containers[i].Image = image
+		}
+	}
+
+	if err := microservice.Update(driver); err != nil {
+		logger.Error("Error updating microservice", "error", err)
+		operation.Error = "Error updating microservice"
+		return models.OperationFailed
+	}
+	operation.Microservices = append(operation.Microservices, microservice)
+	return models.OperationSucceeded
+}
+
+// notifyRollback tells the members of the teamspace of the microservice that its update was reverted
+func notifyRollback(ctx context.Context, driver db.Driver, operation *models.Operation, microservice models.Microservice, rollback client.Rollback, reason string) {
+	content := fmt.Sprintf("The update of the microservice %s was rolled back: %s (%s)", microservice.Name, reason, rollback.Message)
+	if !rollback.Succeeded {
+		content = fmt.Sprintf("The update of the microservice %s failed and could not be rolled back: %s (%s)", microservice.Name, reason, rollback.Error)
+	}
+	operation.Messages["info"] = append(operation.Messages["info"], content)
+
+	e_id, err := primitive.ObjectIDFromHex(operation.EnvironmentID)
+	if err != nil {
+		return
+	}
+	environment := models.Environment{ID: e_id}
+	if err := environment.Get(driver); err != nil {
+		logging.FromContext(ctx).Error("Error getting environment", "error", err)
+		return
+	}
+	p_id, err := primitive.ObjectIDFromHex(environment.ProjectID)
+	if err != nil {
+		return
+	}
+	project := models.Project{ID: p_id}
+	if err := project.Get(driver); err != nil {
+		logging.FromContext(ctx).Error("Error getting project", "error", err)
+		return
+	}
+	// projects outside of a teamspace have no one else to notify
+	if project.TeamspaceID == "" {
+		return
+	}
+	t_id, err := primitive.ObjectIDFromHex(project.TeamspaceID)
+	if err != nil {
+		return
+	}
+	teamspace := models.Teamspace{ID: t_id}
+	if err := teamspace.Get(driver); err != nil {
+		logging.FromContext(ctx).Error("Error getting teamspace", "error", err)
+		return
+	}
+
+	// every member is notified, including the one who made the update
+	if err := notifyMembers(ctx, driver, operation.CreatorID, models.User{}, teamspace, content); err != nil {
+		logging.FromContext(ctx).Error("Error notifying the members of teamspace", logging.KeyTeamspace, teamspace.Name, "error", err)
+	}
+}
+
+// GetOperation returns an operation of the environment
+func GetOperation(c *gin.Context) {
+	_, driver := GetUserFromContext(c)
+
+	id, err := primitive.ObjectIDFromHex(c.Param("op_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid operation ID"})
+		return
+	}
+
+	operation := models.Operation{ID: id}
+	err = operation.Get(driver)
+	if err != nil || operation.EnvironmentID != c.Param("e_id") {
+		logging.Logger(c).Warn("Error getting operation", "error", err)
+		c.JSON(http.StatusNotFound, gin.H{"message": "Operation not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"operation": operation})
+}
+
+// GetOperationsByEnvironment returns the latest operations of the environment
+func GetOperationsByEnvironment(c *gin.Context) {
+	_, driver := GetUserFromContext(c)
+
+	o := models.Operation{EnvironmentID: c.Param("e_id")}
+	operations, err := o.GetAllByEnvironment(driver, MaxOperationsListed)
+	if err != nil {
+		logging.Logger(c).Error("Error getting operations", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error getting operations"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"operations": operations, "size": len(operations)})
+}
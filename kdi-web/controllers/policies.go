@@ -0,0 +1,307 @@
+package controllers
+
+// This file contains the policy rule sets : the rules checked by the kubernetes api on the manifests before they are applied.
+// A rule set is attached to environments so that production can deny what dev only warns about.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kuro-jojo/kdi-k8s/shared/logging"
+	"github.com/kuro-jojo/kdi-web/db"
+	"github.com/kuro-jojo/kdi-web/models"
+	"github.com/kuro-jojo/kdi-web/models/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// NameForPoliciesForm is the form field holding the rules sent to the kubernetes api
+const NameForPoliciesForm = "policies"
+
+type RuleSetForm struct {
+	Name        string              `json:"name"`
+	Description string              `json:"description"`
+	Rules       []models.PolicyRule `json:"rules"`
+}
+
+type AttachRuleSetForm struct {
+	RuleSetID string `json:"ruleSetId"`
+}
+
+// GetPolicyRules returns the rules that can be used in a rule set
+func GetPolicyRules(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"rules": models.PolicyRules, "severities": []string{models.SeverityWarn, models.SeverityDeny}})
+}
+
+func CreateRuleSet(c *gin.Context) {
+	user, driver := GetUserFromContext(c)
+
+	var form RuleSetForm
+	if err := c.ShouldBindJSON(&form); err != nil || form.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid form - Please provide the name and the rules of the rule set"})
+		return
+	}
+	if err := validateRules(form.Rules); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	ruleSet := models.RuleSet{
+		Name:        form.Name,
+		Description: form.Description,
+		Rules:       form.Rules,
+		CreatorID:   user.ID.Hex(),
+	}
+	if err := ruleSet.Create(driver); err != nil {
+		logging.Logger(c).Error("Error creating rule set", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error creating rule set"})
+		return
+	}
+	logging.Logger(c).Info("Rule set created", "rule_set", ruleSet.Name)
+	c.JSON(http.StatusCreated, gin.H{"message": "Rule set created successfully", "ruleSet": ruleSet})
+}
+
+func GetRuleSets(c *gin.Context) {
+	user, driver := GetUserFromContext(c)
+
+	ruleSet := models.RuleSet{CreatorID: user.ID.Hex()}
+	ruleSets, err := ruleSet.GetAllByCreator(driver)
+	if err != nil {
+		logging.Logger(c).Error("Error getting rule sets", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error getting rule sets"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ruleSets": ruleSets, "size": len(ruleSets)})
+}
+
+func GetRuleSet(c *gin.Context) {
+	_, driver := GetUserFromContext(c)
+
+	ruleSet, ok := getRuleSet(c, driver, c.Param("rs_id"))
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ruleSet": ruleSet})
+}
+
+// UpdateRuleSet replaces the rules of the rule set, the next deployments of the environments using it are checked against the new rules
+func UpdateRuleSet(c *gin.Context) {
+	user, driver := GetUserFromContext(c)
+
+	ruleSet, ok := getRuleSet(c, driver, c.Param("rs_id"))
+	if !ok {
+		return
+	}
+	if ruleSet.CreatorID != user.ID.Hex() {
+		c.JSON(http.StatusForbidden, gin.H{"message": "Only the creator of the rule set can update it"})
+		return
+	}
+
+	var form RuleSetForm
+	if err := c.ShouldBindJSON(&form); err != nil || form.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid form - Please provide the name and the rules of the rule set"})
+		return
+	}
+	if err := validateRules(form.Rules); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	ruleSet.Name = form.Name
+	ruleSet.Description = form.Description
+	ruleSet.Rules = form.Rules
+	if err := ruleSet.Update(driver); err != nil {
+		logging.Logger(c).Error("Error updating rule set", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating rule set"})
+		return
+	}
+	logging.Logger(c).Info("Rule set updated", "rule_set", ruleSet.Name)
+	c.JSON(http.StatusOK, gin.H{"message": "Rule set updated successfully", "ruleSet": ruleSet})
+}
+
+// DeleteRuleSet deletes the rule set if no environment uses it
+func DeleteRuleSet(c *gin.Context) {
+	user, driver := GetUserFromContext(c)
+
+	ruleSet, ok := getRuleSet(c, driver, c.Param("rs_id"))
+	if !ok {
+		return
+	}
+	if ruleSet.CreatorID != user.ID.Hex() {
+		c.JSON(http.StatusForbidden, gin.H{"message": "Only the creator of the rule set can delete it"})
+		return
+	}
+
+	var environment models.Environment
+	count, err := environment.CountByRuleSet(driver, ruleSet.ID.Hex())
+	if err != nil {
+		logging.Logger(c).Error("Error counting environments", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error deleting rule set"})
+		return
+	}
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"message": fmt.Sprintf("The rule set is used by %d environment(s) - detach it first", count)})
+		return
+	}
+
+	if err := ruleSet.Delete(driver); err != nil {
+		logging.Logger(c).Error("Error deleting rule set", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error deleting rule set"})
+		return
+	}
+	logging.Logger(c).Info("Rule set deleted", "rule_set", ruleSet.Name)
+	c.JSON(http.StatusOK, gin.H{"message": "Rule set deleted successfully"})
+}
+
+// AttachRuleSet makes the rule set the policy of the environment, replacing the previous one.
+// The user must be the creator of the project or able to update the projects of its teamspace,
+// and the rule set must be one of the user or of a member of the teamspace.
+func AttachRuleSet(c *gin.Context) {
+	user, driver := GetUserFromContext(c)
+
+	var form AttachRuleSetForm
+	if err := c.ShouldBindJSON(&form); err != nil || form.RuleSetID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid form - Please provide the rule set ID"})
+		return
+	}
+
+	environment, _, ok := getEnvironmentAndCluster(c, driver, c.Param("e_id"))
+	if !ok {
+		return
+	}
+	project, ok := getManagedProject(c, driver, user, environment, []string{models.UpdateProjectRole})
+	if !ok {
+		return
+	}
+	ruleSet, ok := getRuleSet(c, driver, form.RuleSetID)
+	if !ok {
+		return
+	}
+	if !canUseRuleSet(c.Request.Context(), driver, ruleSet, user, project) {
+		c.JSON(http.StatusForbidden, gin.H{"message": "The rule set must be yours or one of a member of the teamspace"})
+		return
+	}
+
+	if err := environment.SetRuleSet(driver, ruleSet.ID.Hex()); err != nil {
+		logging.Logger(c).Error("Error attaching rule set", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error attaching rule set"})
+		return
+	}
+	logging.Logger(c).Info("Rule set attached to environment", "rule_set", ruleSet.Name, "environment", environment.Name)
+	c.JSON(http.StatusOK, gin.H{"message": "Rule set attached successfully", "ruleSet": ruleSet})
+}
+
+func DetachRuleSet(c *gin.Context) {
+	user, driver := GetUserFromContext(c)
+
+	environment, _, ok := getEnvironmentAndCluster(c, driver, c.Param("e_id"))
+	if !ok {
+		return
+	}
+	if _, ok := getManagedProject(c, driver, user, environment, []string{models.UpdateProjectRole}); !ok {
+		return
+	}
+	if err := environment.SetRuleSet(driver, ""); err != nil {
+		logging.Logger(c).Error("Error detaching rule set", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error detaching rule set"})
+		return
+	}
+	logging.Logger(c).Info("Rule set detached from environment", "environment", environment.Name)
+	c.JSON(http.StatusOK, gin.H{"message": "Rule set detached successfully"})
+}
+
+func getRuleSet(c *gin.Context, driver db.Driver, id string) (models.RuleSet, bool) {
+	rs_id, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid rule set ID"})
+		return models.RuleSet{}, false
+	}
+	ruleSet := models.RuleSet{ID: rs_id}
+	if err := ruleSet.Get(driver); err != nil {
+		logging.Logger(c).Warn("Error getting rule set", "error", err)
+		if utils.OnNotFoundError(err, "Rule set") != nil {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Rule set not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error getting rule set"})
+		}
+		return models.RuleSet{}, false
+	}
+	return ruleSet, true
+}
+
+// canUseRuleSet returns true if the rule set was created by the user or, for a project of a teamspace, by one of its members
+func canUseRuleSet(ctx context.Context, driver db.Driver, ruleSet models.RuleSet, user models.User, project models.Project) bool {
+	if ruleSet.CreatorID == user.ID.Hex() {
+		return true
+	}
+	creatorID, err := primitive.ObjectIDFromHex(ruleSet.CreatorID)
+	if err != nil || project.TeamspaceID == "" {
+		return false
+	}
+	return isTeamspaceMember(ctx, driver, project.TeamspaceID, models.User{ID: creatorID})
+}
+
+func validateRules(rules []models.PolicyRule) error {
+	seen := make(map[string]bool)
+	for _, rule := range rules {
+		if !slices.Contains(models.PolicyRules, rule.ID) {
+			return fmt.Errorf("Unknown policy rule %q", rule.ID)
+		}
+		if seen[rule.ID] {
+			return fmt.Errorf("The rule %s is used more than once", rule.ID)
+		}
+		seen[rule.ID] = true
+		if rule.Severity != models.SeverityWarn && rule.Severity != models.SeverityDeny {
+			return fmt.Errorf("Invalid severity %q for rule %s - use warn or deny", rule.Severity, rule.ID)
+		}
+		if rule.ID == models.AllowedRegistriesRule && len(rule.Registries) == 0 {
+			return fmt.Errorf("The rule %s needs at least one registry", rule.ID)
+		}
+	}
+	return nil
+}
+
+// withEnvironmentPolicies returns the multipart payload of a deployment with the rules of the environment's rule set.
+// A policies part sent by the uploader is always removed.
+func withEnvironmentPolicies(driver db.Driver, environmentID string, payload []byte, contentType string) ([]byte, error) {
+	var rules []models.PolicyRule
+
+	e_id, err := primitive.ObjectIDFromHex(environmentID)
+	if err != nil {
+		return nil, err
+	}
+	environment := models.Environment{ID: e_id}
+	if err := environment.Get(driver); err != nil {
+		return nil, err
+	}
+	if environment.RuleSetID != "" {
+		rs_id, err := primitive.ObjectIDFromHex(environment.RuleSetID)
+		if err != nil {
+			return nil, err
+		}
+		ruleSet := models.RuleSet{ID: rs_id}
+		if err := ruleSet.Get(driver); err != nil {
+			return nil, err
+		}
+		rules = ruleSet.Rules
+	}
+	return withPolicies(payload, contentType, rules)
+}
+
+func withPolicies(payload []byte, contentType string, rules []models.PolicyRule) ([]byte, error) {
+	fields := make(map[string]string)
+	if len(rules) > 0 {
+		policies, err := json.Marshal(rules)
+		if err != nil {
+			return nil, err
+		}
+		fields[NameForPoliciesForm] = string(policies)
+	}
+	return rewriteMultipart(payload, contentType, func(part *multipart.Part, content []byte) ([]byte, bool, error) {
+		return content, part.FormName() != NameForPoliciesForm, nil
+	}, fields)
+}
@@ -1,11 +1,11 @@
 package controllers
 
 import (
-	"log"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/kuro-jojo/kdi-k8s/shared/logging"
 	"github.com/kuro-jojo/kdi-web/db"
 	"github.com/kuro-jojo/kdi-web/models"
 	"github.com/kuro-jojo/kdi-web/models/utils"
@@ -17,7 +17,7 @@ type ProfileForm struct {
 }
 
 func CreateProfile(c *gin.Context) {
-	log.Println("Creating new profile...")
+	logging.Logger(c).Debug("Creating new profile...")
 	d, _ := c.Get("driver")
 	driver := d.(db.Driver)
 
@@ -44,7 +44,7 @@ func CreateProfile(c *gin.Context) {
 
 	err := profile.Create(driver)
 	if err != nil {
-		log.Printf("Error adding new profile %v", err)
+		logging.Logger(c).Warn("Error adding new profile", "error", err)
 		if er := utils.OnDuplicateKeyError(err, "Profile"); er != nil {
 			c.JSON(http.StatusConflict, gin.H{"message": er.Error()})
 		} else {
@@ -56,18 +56,18 @@ func CreateProfile(c *gin.Context) {
 }
 
 func GetProfiles(c *gin.Context) {
-	log.Println("Getting profiles...")
+	logging.Logger(c).Debug("Getting profiles...")
 	d, _ := c.Get("driver")
 	driver := d.(db.Driver)
 
 	profile := models.Profile{}
 	profiles, err := profile.GetAll(driver)
 	if err != nil {
-		log.Printf("Error getting profiles %v", err)
+		logging.Logger(c).Error("Error getting profiles", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Internal server error"})
 		return
 	}
-	log.Println("Profiles retrieved successfully")
+	logging.Logger(c).Info("Profiles retrieved successfully")
 	c.JSON(http.StatusOK, gin.H{"profiles": profiles, "size": len(profiles)})
 }
 
@@ -1,11 +1,11 @@
 package controllers
 
 import (
-	"log"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/kuro-jojo/kdi-k8s/shared/logging"
 	"github.com/kuro-jojo/kdi-web/db"
 	"github.com/kuro-jojo/kdi-web/models"
 	"github.com/kuro-jojo/kdi-web/models/utils"
@@ -20,7 +20,7 @@ type ProjectForm struct {
 }
 
 func CreateProject(c *gin.Context) {
-	log.Println("Creating project...")
+	logging.Logger(c).Debug("Creating project...")
 
 	code, message := createProject(c)
 	if code != 0 {
@@ -28,12 +28,12 @@ func CreateProject(c *gin.Context) {
 		return
 	}
 
-	log.Printf("Project created successfully")
+	logging.Logger(c).Info("Project created successfully")
 	c.JSON(http.StatusCreated, gin.H{"message": "Project created successfully"})
 }
 
 func GetProjectsByCreator(c *gin.Context) {
-	log.Println("Listing all projects of the current user...")
+	logging.Logger(c).Debug("Listing all projects of the current user...")
 	user, driver := GetUserFromContext(c)
 
 	p := models.Project{
@@ -42,16 +42,17 @@ func GetProjectsByCreator(c *gin.Context) {
 
 	projects, err := p.GetAllByCreator(driver)
 	if err != nil {
-		log.Printf("Error getting projects %v", err)
+		logging.Logger(c).Error("Error getting projects", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error getting projects"})
 		return
 	}
 
+	projects = inTokenScope(user, projects, func(p models.Project) string { return p.TeamspaceID })
 	c.JSON(http.StatusOK, gin.H{"projects": projects, "size": len(projects)})
 }
 
 func GetProjectsByTeamspace(c *gin.Context) {
-	log.Println("Listing all projects in teamspace...")
+	logging.Logger(c).Debug("Listing all projects in teamspace...")
 	user, driver := GetUserFromContext(c)
 
 	id := c.Param("id")
@@ -75,7 +76,7 @@ func GetProjectsByTeamspace(c *gin.Context) {
 	// Vérifiez les privilèges de l'utilisateur
 
 	// Vérifiez les privilèges de l'utilisateur
-	ok, code, message := MemberHasEnoughPrivilege(driver, []string{models.ListProjectsRole}, teamspace, user)
+	ok, code, message := MemberHasEnoughPrivilege(c.Request.Context(), driver, []string{models.ListProjectsRole}, teamspace, user)
 	if !ok {
 		c.JSON(code, gin.H{"message": message})
 		return
@@ -89,7 +90,7 @@ func GetProjectsByTeamspace(c *gin.Context) {
 
 	projects, err := p.GetAllByTeamspace(driver)
 	if err != nil {
-		log.Printf("Error getting projects %v", err)
+		logging.Logger(c).Error("Error getting projects", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error getting projects"})
 		return
 	}
@@ -112,7 +113,7 @@ func GetProjectsOfJoinedTeamspaces(c *gin.Context) {
 	// Obtenir la liste des teamspaces auxquels l'utilisateur a rejoint
 	teamspaces, err := user.GetAllJoinedTeamspaces(driver)
 	if err != nil {
-		log.Printf("Error getting teamspaces %v", err)
+		logging.Logger(c).Error("Error getting teamspaces", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error getting teamspaces"})
 		return
 	}
@@ -126,12 +127,13 @@ func GetProjectsOfJoinedTeamspaces(c *gin.Context) {
 		}
 		projects, err := p.GetAllByTeamspace(driver)
 		if err != nil {
-			log.Printf("Error getting projects %v", err)
+			logging.Logger(c).Error("Error getting projects", "error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error getting projects"})
 			return
 		}
 		allProjects = append(allProjects, projects...)
 	}
+	allProjects = inTokenScope(user, allProjects, func(p models.Project) string { return p.TeamspaceID })
 
 	response := gin.H{
 		"projects": allProjects,
@@ -188,7 +190,7 @@ func createProject(c *gin.Context) (int, string) {
 		}
 
 		// Vérifiez si l'utilisateur a les autorisations nécessaires pour accéder à ce Teamspace
-		ok, code, message := MemberHasEnoughPrivilege(driver, []string{models.CreateProjectRole}, teamspace, user)
+		ok, code, message := MemberHasEnoughPrivilege(c.Request.Context(), driver, []string{models.CreateProjectRole}, teamspace, user)
 		if !ok {
 			return code, message
 		}
@@ -201,7 +203,7 @@ func createProject(c *gin.Context) (int, string) {
 	// Créez le projet dans la base de données
 	err := project.Create(driver)
 	if err != nil {
-		log.Printf("Error creating project: %v", err)
+		logging.Logger(c).Warn("Error creating project", "error", err)
 		if er := utils.OnDuplicateKeyError(err, "Project"); er != nil {
 			return http.StatusConflict, er.Error()
 		} else {
@@ -224,7 +226,7 @@ func GetProject(c *gin.Context) {
 	err := project.Get(driver)
 
 	if err != nil {
-		log.Printf("Error getting project %v", err)
+		logging.Logger(c).Warn("Error getting project", "error", err)
 		if utils.OnNotFoundError(err, "Project") != nil {
 			c.JSON(http.StatusNotFound, gin.H{"message": "Project not found"})
 		} else {
@@ -265,7 +267,7 @@ func DeleteProject(c *gin.Context) {
 	if project.TeamspaceID != "" {
 		t_id, err := primitive.ObjectIDFromHex(project.TeamspaceID)
 		if err != nil {
-			log.Printf("Invalid teamspace ID : %v", err)
+			logging.Logger(c).Warn("Invalid teamspace ID", "error", err)
 			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid teamspace ID"})
 			return
 		}
@@ -274,13 +276,13 @@ func DeleteProject(c *gin.Context) {
 		}
 		err = teamspace.Get(driver)
 		if err != nil {
-			log.Printf("Error getting teamspace %v", err)
+			logging.Logger(c).Error("Error getting teamspace", "error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error getting teamspace"})
 			return
 		}
-		ok, code, message := MemberHasEnoughPrivilege(driver, []string{models.DeleteClusterRole}, teamspace, user)
+		ok, code, message := MemberHasEnoughPrivilege(c.Request.Context(), driver, []string{models.DeleteClusterRole}, teamspace, user)
 		if !ok {
-			log.Println(message)
+			logging.Logger(c).Warn(message)
 			c.JSON(code, gin.H{"message": message})
 			return
 		}
@@ -292,63 +294,63 @@ func DeleteProject(c *gin.Context) {
 	}
 	environments, err := e.GetAllByProject(driver)
 	if err != nil {
-		log.Printf("Error getting environments %v", err)
+		logging.Logger(c).Error("Error getting environments", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete project"})
 		return
 	}
 	for _, env := range environments {
 		// 2. Get all the microservices of the environment
-		log.Printf("Environment %s - %s", env.ID.Hex(), env.Name)
+		logging.Logger(c).Debug("Deleting environment", "environment", env.Name)
 		m := models.Microservice{
 			EnvironmentID: env.ID.Hex(),
 		}
 		microservices, err := m.GetAllByEnvironment(driver)
 		if err != nil {
-			log.Printf("Error getting microservices %v", err)
+			logging.Logger(c).Error("Error getting microservices", "error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete project"})
 			return
 		}
 		for _, microservice := range microservices {
 			// TODO : Do not delete the microservice on the cluster if the user says so
-			log.Printf("Microservice %s - %s", microservice.ID.Hex(), microservice.Name)
+			logging.Logger(c).Debug("Deleting microservice", "microservice", microservice.Name)
 			// 3. Get all the containers of the microservice
 			co := models.Container{
 				MicroserviceID: microservice.ID.Hex(),
 			}
 			containers, err := co.GetAllByMicroservice(driver)
 			if err != nil {
-				log.Printf("Error getting containers %v", err)
+				logging.Logger(c).Error("Error getting containers", "error", err)
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete project"})
 				return
 			}
 			for _, container := range containers {
-				log.Printf("Container %s - %s", container.ID.Hex(), container.Name)
+				logging.Logger(c).Debug("Deleting container", "container", container.Name)
 				// 4. Delete the container
 				err = container.Delete(driver)
 				if err != nil {
-					log.Printf("Error deleting container %v", err)
+					logging.Logger(c).Error("Error deleting container", "error", err)
 					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete project"})
 					return
 				}
-				log.Printf("Container %s deleted successfully", container.ID.Hex())
+				logging.Logger(c).Info("Container deleted successfully", "container", container.Name)
 			}
 			// 5. Delete the microservice
 			err = microservice.Delete(driver)
 			if err != nil {
-				log.Printf("Error deleting microservice %v", err)
+				logging.Logger(c).Error("Error deleting microservice", "error", err)
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete project"})
 				return
 			}
-			log.Printf("Microservice %s deleted successfully", microservice.ID.Hex())
+			logging.Logger(c).Info("Microservice deleted successfully", "microservice", microservice.Name)
 		}
 		// 6. Delete the environment
 		err = env.Delete(driver)
 		if err != nil {
-			log.Printf("Error deleting environment %v", err)
+			logging.Logger(c).Error("Error deleting environment", "error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete project"})
 			return
 		}
-		log.Printf("Environment %s deleted successfully", env.ID.Hex())
+		logging.Logger(c).Info("Environment deleted successfully", "environment", env.Name)
 	}
 
 	// Delete the project
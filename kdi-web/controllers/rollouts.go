@@ -0,0 +1,161 @@
+package controllers
+
+// This file contains the pause, resume and restart actions of the microservices
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kuro-jojo/kdi-k8s/client"
+	"github.com/kuro-jojo/kdi-k8s/shared/logging"
+	"github.com/kuro-jojo/kdi-web/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	PauseAction   = client.PauseAction
+	ResumeAction  = client.ResumeAction
+	RestartAction = client.RestartAction
+)
+
+// PauseMicroservice stops the rollout of the deployment of the microservice
+func PauseMicroservice(c *gin.Context) {
+	runMicroserviceAction(c, PauseAction)
+}
+
+// ResumeMicroservice resumes the rollout of the deployment of the microservice
+func ResumeMicroservice(c *gin.Context) {
+	runMicroserviceAction(c, ResumeAction)
+}
+
+// RestartMicroservice replaces all the pods of the microservice
+func RestartMicroservice(c *gin.Context) {
+	runMicroserviceAction(c, RestartAction)
+}
+
+func runMicroserviceAction(c *gin.Context, action string) {
+	_, driver := GetUserFromContext(c)
+
+	e_id := c.Param("e_id")
+	m_id, err := primitive.ObjectIDFromHex(c.Param("m_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid microservice ID"})
+		return
+	}
+
+	microservice := models.Microservice{
+		ID: m_id,
+	}
+	err = microservice.Get(driver)
+	if err != nil || microservice.EnvironmentID != e_id {
+		logging.Logger(c).Warn("Error getting microservice", "error", err)
+		c.JSON(http.StatusNotFound, gin.H{"message": "Microservice not found"})
+		return
+	}
+	logging.With(c, logging.KeyNamespace, microservice.Namespace)
+	if !microservice.IsDeployment() {
+		c.JSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("Cannot %s a %s", action, microservice.Kind)})
+		return
+	}
+
+	_, cluster, ok := getEnvironmentAndCluster(c, driver, e_id)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), KubernetesAPITimeout)
+	defer cancel()
+	if _, err := kubernetesAPI(cluster).DeploymentAction(ctx, microservice.Namespace, microservice.Name, action); err != nil {
+		logging.Logger(c).Error("Error running the action on microservice", "action", action, "microservice", microservice.Name, "error", err)
+		RespondWithK8sApiError(c, err)
+		return
+	}
+
+	if action == PauseAction || action == ResumeAction {
+		microservice.Paused = action == PauseAction
+		if err := microservice.Update(driver); err != nil {
+			logging.Logger(c).Error("Error updating microservice", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating microservice"})
+			return
+		}
+	}
+
+	logging.Logger(c).Info("Action done on microservice", "action", action, "microservice", microservice.Name)
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Microservice %s %s", microservice.Name, pastTense(action)), "microservice": microservice})
+}
+
+// RestartMicroservicesByEnvironment restarts all the microservices of the environment.
+// Every microservice is restarted even if the restart of another one failed.
+func RestartMicroservicesByEnvironment(c *gin.Context) {
+	_, driver := GetUserFromContext(c)
+	e_id := c.Param("e_id")
+
+	_, cluster, ok := getEnvironmentAndCluster(c, driver, e_id)
+	if !ok {
+		return
+	}
+
+	m := models.Microservice{EnvironmentID: e_id}
+	microservices, err := m.GetAllByEnvironment(driver)
+	if err != nil {
+		logging.Logger(c).Error("Error getting microservices", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error getting microservices"})
+		return
+	}
+
+	results := make([]models.OperationResult, 0)
+	failed := 0
+	for _, microservice := range microservices {
+		if !microservice.IsDeployment() {
+			continue
+		}
+		result := restartMicroservice(c.Request.Context(), cluster, microservice)
+		if result.Status == models.OperationFailed {
+			failed++
+		}
+		results = append(results, result)
+	}
+
+	status := http.StatusOK
+	message := fmt.Sprintf("%d microservices restarted", len(results))
+	if failed > 0 {
+		status = http.StatusMultiStatus
+		message = fmt.Sprintf("%d of %d microservices could not be restarted", failed, len(results))
+	}
+	logging.Logger(c).Warn(message)
+	c.JSON(status, gin.H{"message": message, "results": results, "size": len(results)})
+}
+
+// restartMicroservice restarts the deployment of the microservice and returns the result of the restart
+func restartMicroservice(ctx context.Context, cluster models.Cluster, microservice models.Microservice) models.OperationResult {
+	result := models.OperationResult{
+		Object: microservice.Namespace + "/" + microservice.Name,
+		Status: models.OperationSucceeded,
+	}
+
+	response, err := kubernetesAPI(cluster).RestartDeployment(ctx, microservice.Namespace, microservice.Name)
+	if err != nil {
+		logging.FromContext(ctx).Error("Error restarting microservice", "microservice", microservice.Name, "error", err)
+		result.Status = models.OperationFailed
+		result.Message = "Error making request to the cluster"
+		if e, ok := client.AsError(err); ok {
+			result.Message = e.Message
+			result.Reason = e.Reason
+		}
+		return result
+	}
+	result.Message = response.Message
+	return result
+}
+
+func pastTense(action string) string {
+	switch action {
+	case PauseAction:
+		return "paused"
+	case ResumeAction:
+		return "resumed"
+	}
+	return "restarted"
+}
@@ -0,0 +1,208 @@
+package controllers
+
+// This file contains the sessions of the users logged in with a password : short-lived access tokens renewed with refresh tokens
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kuro-jojo/kdi-k8s/shared/logging"
+	"github.com/kuro-jojo/kdi-web/db"
+	"github.com/kuro-jojo/kdi-web/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	AccessTokenLifetime  = 15 * time.Minute   // The lifetime of the JWTs of the sessions
+	RefreshTokenLifetime = 7 * 24 * time.Hour // A session expires if it is not refreshed during this time
+)
+
+type RefreshForm struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+// createSession starts a session for the user and returns its tokens in the response
+func createSession(c *gin.Context, driver db.Driver, user models.User) (gin.H, error) {
+	session := models.Session{
+		ID:        primitive.NewObjectID(),
+		UserID:    user.ID.Hex(),
+		UserAgent: c.Request.UserAgent(),
+		ClientIP:  c.ClientIP(),
+		ExpiresAt: time.Now().Add(RefreshTokenLifetime),
+	}
+	refreshToken, err := session.GenerateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	session.RefreshHash = models.HashToken(refreshToken)
+	if err := session.Create(driver); err != nil {
+		return nil, err
+	}
+	return sessionTokens(user, session, refreshToken)
+}
+
+func sessionTokens(user models.User, session models.Session, refreshToken string) (gin.H, error) {
+	token, err := generateUserAuthToken(user, session)
+	if err != nil {
+		return nil, err
+	}
+	return gin.H{"token": token, "refreshToken": refreshToken, "expiresIn": int(AccessTokenLifetime.Seconds())}, nil
+}
+
+// Refresh returns a new access token and replaces the refresh token of the session.
+// A refresh token used twice revokes the session, as it may have been stolen.
+func Refresh(c *gin.Context) {
+	d, _ := c.Get("driver")
+	driver := d.(db.Driver)
+
+	var form RefreshForm
+	if err := c.ShouldBindJSON(&form); err != nil || form.RefreshToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid form"})
+		return
+	}
+	session, ok := getSessionOfRefreshToken(c, driver, form.RefreshToken)
+	if !ok {
+		return
+	}
+
+	uid, err := primitive.ObjectIDFromHex(session.UserID)
+	if err != nil {
+		logging.Logger(c).Warn("Error while parsing user ID", "error", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Unauthorized"})
+		return
+	}
+	user := models.User{ID: uid}
+	if err := user.Get(driver); err != nil {
+		logging.Logger(c).Warn("Error while getting user", "error", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Unauthorized"})
+		return
+	}
+
+	refreshToken, err := session.GenerateRefreshToken()
+	if err != nil {
+		logging.Logger(c).Error("Error while generating refresh token", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error while generating token"})
+		return
+	}
+	err = session.Rotate(driver, session.RefreshHash, models.HashToken(refreshToken), time.Now().Add(RefreshTokenLifetime))
+	if err != nil {
+		logging.Logger(c).Warn("Error while refreshing session", "session_id", session.ID.Hex(), "error", err)
+		if strings.Contains(err.Error(), "already used") {
+			c.JSON(http.StatusUnauthorized, gin.H{"message": "Refresh token already used"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error while refreshing token"})
+		}
+		return
+	}
+
+	response, err := sessionTokens(user, session, refreshToken)
+	if err != nil {
+		logging.Logger(c).Error("Error while generating token", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error while generating token"})
+		return
+	}
+	response["message"] = "Token refreshed successfully"
+	c.JSON(http.StatusOK, response)
+}
+
+// Logout revokes the session of the refresh token, its access tokens are refused right away
+func Logout(c *gin.Context) {
+	d, _ := c.Get("driver")
+	driver := d.(db.Driver)
+
+	var form RefreshForm
+	if err := c.ShouldBindJSON(&form); err != nil || form.RefreshToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid form"})
+		return
+	}
+	session, ok := getSessionOfRefreshToken(c, driver, form.RefreshToken)
+	if !ok {
+		return
+	}
+	if err := session.Revoke(driver); err != nil {
+		logging.Logger(c).Error("Error while revoking session", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error while logging out"})
+		return
+	}
+	logging.Logger(c).Info("Session revoked", "session_id", session.ID.Hex())
+	c.JSON(http.StatusOK, gin.H{"message": "User logged out successfully"})
+}
+
+// RevokeUserSessions revokes the sessions and the personal access tokens of a user, when its account or its tokens are compromised.
+// The users can revoke their own sessions, the administrators (KDI_ADMIN_USERS) the ones of every user.
+func RevokeUserSessions(c *gin.Context) {
+	user, driver := GetUserFromContext(c)
+	if !canManageAccessTokens(c, user) {
+		return
+	}
+
+	userID := c.Param("user_id")
+	if _, err := primitive.ObjectIDFromHex(userID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid user ID"})
+		return
+	}
+	if userID != user.ID.Hex() && !isAdmin(user) {
+		c.JSON(http.StatusForbidden, gin.H{"message": "Only an administrator can revoke the sessions of another user"})
+		return
+	}
+
+	session := models.Session{UserID: userID}
+	sessions, err := session.RevokeAllByUser(driver)
+	if err != nil {
+		logging.Logger(c).Error("Error while revoking sessions", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error while revoking sessions"})
+		return
+	}
+	token := models.AccessToken{UserID: userID}
+	tokens, err := token.RevokeAllByUser(driver)
+	if err != nil {
+		logging.Logger(c).Error("Error while revoking access tokens", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error while revoking tokens"})
+		return
+	}
+
+	logging.Logger(c).Info("Sessions and access tokens of user revoked", "revoked_user_id", userID, "sessions", sessions, "tokens", tokens)
+	c.JSON(http.StatusOK, gin.H{"message": "Sessions revoked successfully", "sessions": sessions, "accessTokens": tokens})
+}
+
+// getSessionOfRefreshToken returns the active session of the refresh token.
+// The session is revoked if the token was already replaced.
+func getSessionOfRefreshToken(c *gin.Context, driver db.Driver, refreshToken string) (models.Session, bool) {
+	id, err := models.SessionIDFromRefreshToken(refreshToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid refresh token"})
+		return models.Session{}, false
+	}
+	session := models.Session{ID: id}
+	if err := session.Get(driver); err != nil {
+		logging.Logger(c).Warn("Error while getting session", "error", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid refresh token"})
+		return models.Session{}, false
+	}
+	if !session.IsActive() {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Session is expired or revoked"})
+		return models.Session{}, false
+	}
+	if models.HashToken(refreshToken) != session.RefreshHash {
+		logging.Logger(c).Info("Refresh token of session used twice, the session is revoked", "session_id", session.ID.Hex())
+		if err := session.Revoke(driver); err != nil {
+			logging.Logger(c).Error("Error while revoking session", "error", err)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Session is expired or revoked"})
+		return models.Session{}, false
+	}
+	return session, true
+}
+
+// isAdmin returns true if the user is an administrator of KDI : KDI_ADMIN_USERS holds their IDs, separated by commas
+func isAdmin(user models.User) bool {
+	for _, id := range strings.Split(os.Getenv("KDI_ADMIN_USERS"), ",") {
+		if strings.TrimSpace(id) == user.ID.Hex() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,213 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kuro-jojo/kdi-web/db/mongodb"
+	"github.com/kuro-jojo/kdi-web/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// serve sends the request to the handler, with the driver of the mocked database and the user if any
+func serve(mt *mtest.T, handler gin.HandlerFunc, user *models.User, method string, body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Handle(method, "/*path", func(c *gin.Context) {
+		c.Set("driver", &mongodb.MongoDriver{Client: mt.Client})
+		if user != nil {
+			c.Set("user", *user)
+		}
+	}, handler)
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, "/", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func sessionDocument(id primitive.ObjectID, userID primitive.ObjectID, refreshToken string, revoked bool) bson.D {
+	doc := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "user_id", Value: userID.Hex()},
+		{Key: "refresh_hash", Value: models.HashToken(refreshToken)},
+		{Key: "expires_at", Value: time.Now().Add(time.Hour)},
+	}
+	if revoked {
+		doc = append(doc, bson.E{Key: "revoked_at", Value: time.Now()})
+	}
+	return doc
+}
+
+// commands returns the names of the commands sent to the database
+func commands(mt *mtest.T) []string {
+	var names []string
+	for _, event := range mt.GetAllStartedEvents() {
+		names = append(names, event.CommandName)
+	}
+	return names
+}
+
+func TestRefresh(t *testing.T) {
+	mongodb.DbName = "kdi"
+	t.Setenv("KDI_JWT_SECRET_KEY", "secret")
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	userID := primitive.NewObjectID()
+
+	mt.Run("rotates the refresh token", func(mt *mtest.T) {
+		id := primitive.NewObjectID()
+		refreshToken := id.Hex() + ".current"
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "kdi.sessions", mtest.FirstBatch, sessionDocument(id, userID, refreshToken, false)),
+			mtest.CreateCursorResponse(0, "kdi.users", mtest.FirstBatch, bson.D{{Key: "_id", Value: userID}}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+		)
+		w := serve(mt, Refresh, nil, http.MethodPost, `{"refreshToken":"`+refreshToken+`"}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+		}
+		var resp struct{ Token, RefreshToken string }
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		if resp.Token == "" || resp.RefreshToken == refreshToken || !strings.HasPrefix(resp.RefreshToken, id.Hex()+".") {
+			t.Errorf("response = %+v", resp)
+		}
+	})
+
+	mt.Run("reused token revokes the session", func(mt *mtest.T) {
+		id := primitive.NewObjectID()
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "kdi.sessions", mtest.FirstBatch, sessionDocument(id, userID, id.Hex()+".next", false)),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+		)
+		w := serve(mt, Refresh, nil, http.MethodPost, `{"refreshToken":"`+id.Hex()+`.previous"}`)
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+		}
+		if got := strings.Join(commands(mt), ","); got != "find,update" {
+			t.Errorf("commands = %s, want the session revoked", got)
+		}
+	})
+
+	mt.Run("concurrent rotation", func(mt *mtest.T) {
+		id := primitive.NewObjectID()
+		refreshToken := id.Hex() + ".current"
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "kdi.sessions", mtest.FirstBatch, sessionDocument(id, userID, refreshToken, false)),
+			mtest.CreateCursorResponse(0, "kdi.users", mtest.FirstBatch, bson.D{{Key: "_id", Value: userID}}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}, bson.E{Key: "nModified", Value: 0}),
+		)
+		w := serve(mt, Refresh, nil, http.MethodPost, `{"refreshToken":"`+refreshToken+`"}`)
+		if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "already used") {
+			t.Errorf("status = %d: %s", w.Code, w.Body.String())
+		}
+	})
+
+	mt.Run("revoked session", func(mt *mtest.T) {
+		id := primitive.NewObjectID()
+		refreshToken := id.Hex() + ".current"
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "kdi.sessions", mtest.FirstBatch, sessionDocument(id, userID, refreshToken, true)))
+		w := serve(mt, Refresh, nil, http.MethodPost, `{"refreshToken":"`+refreshToken+`"}`)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+		}
+	})
+}
+
+func TestLogout(t *testing.T) {
+	mongodb.DbName = "kdi"
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	userID := primitive.NewObjectID()
+
+	mt.Run("revokes the session", func(mt *mtest.T) {
+		id := primitive.NewObjectID()
+		refreshToken := id.Hex() + ".current"
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "kdi.sessions", mtest.FirstBatch, sessionDocument(id, userID, refreshToken, false)),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+		)
+		w := serve(mt, Logout, nil, http.MethodPost, `{"refreshToken":"`+refreshToken+`"}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+		}
+		mt.GetStartedEvent()
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("u").Document()
+		if _, err := update.LookupErr("$set", "revoked_at"); err != nil {
+			t.Errorf("update = %v, want revoked_at set", update)
+		}
+	})
+
+	mt.Run("invalid token", func(mt *mtest.T) {
+		w := serve(mt, Logout, nil, http.MethodPost, `{"refreshToken":"invalid"}`)
+		if w.Code != http.StatusUnauthorized || len(commands(mt)) != 0 {
+			t.Errorf("status = %d, commands = %v", w.Code, commands(mt))
+		}
+	})
+}
+
+func TestRevokeUserSessions(t *testing.T) {
+	mongodb.DbName = "kdi"
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	user := models.User{ID: primitive.NewObjectID()}
+	other := primitive.NewObjectID().Hex()
+
+	revoke := func(mt *mtest.T, user models.User, userID string) *httptest.ResponseRecorder {
+		gin.SetMode(gin.TestMode)
+		router := gin.New()
+		router.DELETE("/users/:user_id/sessions", func(c *gin.Context) {
+			c.Set("driver", &mongodb.MongoDriver{Client: mt.Client})
+			c.Set("user", user)
+		}, RevokeUserSessions)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/users/"+userID+"/sessions", nil))
+		return w
+	}
+
+	mt.Run("own sessions", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 2}, bson.E{Key: "nModified", Value: 2}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+		)
+		w := revoke(mt, user, user.ID.Hex())
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+		}
+		var resp struct{ Sessions, AccessTokens int }
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		if resp.Sessions != 2 || resp.AccessTokens != 1 {
+			t.Errorf("response = %+v", resp)
+		}
+	})
+
+	mt.Run("another user", func(mt *mtest.T) {
+		mt.Setenv("KDI_ADMIN_USERS", "")
+		if w := revoke(mt, user, other); w.Code != http.StatusForbidden {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusForbidden)
+		}
+	})
+
+	mt.Run("another user by an administrator", func(mt *mtest.T) {
+		mt.Setenv("KDI_ADMIN_USERS", primitive.NewObjectID().Hex()+", "+user.ID.Hex())
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}, bson.E{Key: "nModified", Value: 0}),
+		)
+		if w := revoke(mt, user, other); w.Code != http.StatusOK {
+			t.Errorf("status = %d: %s", w.Code, w.Body.String())
+		}
+	})
+
+	mt.Run("with an access token", func(mt *mtest.T) {
+		withToken := user
+		withToken.AccessToken = &models.AccessToken{}
+		if w := revoke(mt, withToken, user.ID.Hex()); w.Code != http.StatusForbidden || len(commands(mt)) != 0 {
+			t.Errorf("status = %d, commands = %v", w.Code, commands(mt))
+		}
+	})
+}
@@ -1,11 +1,11 @@
 package controllers
 
 import (
-	"log"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/kuro-jojo/kdi-k8s/shared/logging"
 	"github.com/kuro-jojo/kdi-web/db"
 	"github.com/kuro-jojo/kdi-web/models"
 	"github.com/kuro-jojo/kdi-web/models/utils"
@@ -20,7 +20,7 @@ type TeamspaceForm struct {
 
 // CreateTeamspace is a controller that creates a teamspace
 func CreateTeamspace(c *gin.Context) {
-	log.Println("Creating teamspace...")
+	logging.Logger(c).Debug("Creating teamspace...")
 	d, _ := c.Get("driver")
 	driver := d.(db.Driver)
 
@@ -55,7 +55,7 @@ func CreateTeamspace(c *gin.Context) {
 
 	err = teamspace.Create(driver)
 	if err != nil {
-		log.Printf("Error creating project %v", err)
+		logging.Logger(c).Warn("Error creating project", "error", err)
 		if er := utils.OnDuplicateKeyError(err, "Teamspace"); er != nil {
 			c.JSON(http.StatusConflict, gin.H{"message": er.Error()})
 		} else {
@@ -79,10 +79,11 @@ func GetTeamspacesByCreator(c *gin.Context) {
 	}
 	teamspaces, err := teamspace.GetAllByCreator(driver)
 	if err != nil {
-		log.Printf("Error getting teamspaces %v", err)
+		logging.Logger(c).Error("Error getting teamspaces", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error getting teamspaces"})
 		return
 	}
+	teamspaces = inTokenScope(user, teamspaces, func(t models.Teamspace) string { return t.ID.Hex() })
 	c.JSON(http.StatusOK, gin.H{"teamspaces": teamspaces, "size": len(teamspaces)})
 }
 
@@ -91,7 +92,7 @@ func GetTeamspace(c *gin.Context) {
 	id := c.Param("id")
 	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		log.Printf("Error parsing teamspace ID %v", err)
+		logging.Logger(c).Warn("Error parsing teamspace ID", "error", err)
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid teamspace ID"})
 		return
 	}
@@ -104,7 +105,7 @@ func GetTeamspace(c *gin.Context) {
 	err = teamspace.Get(driver)
 
 	if err != nil {
-		log.Printf("Error getting teamspace %v", err)
+		logging.Logger(c).Warn("Error getting teamspace", "error", err)
 		if utils.OnNotFoundError(err, "Teamspace") != nil {
 			c.JSON(http.StatusNotFound, gin.H{"message": "Teamspace not found"})
 		} else {
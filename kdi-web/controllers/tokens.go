@@ -0,0 +1,172 @@
+package controllers
+
+// This file contains the personal access tokens of the users, used by the scripts and the CI pipelines
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kuro-jojo/kdi-k8s/shared/logging"
+	"github.com/kuro-jojo/kdi-web/db"
+	"github.com/kuro-jojo/kdi-web/models"
+	"github.com/kuro-jojo/kdi-web/models/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	DefaultAccessTokenLifetime = 30  // days
+	MaxAccessTokenLifetime     = 365 // days
+)
+
+type AccessTokenForm struct {
+	Name       string   `json:"name"`
+	Teamspaces []string `json:"teamspaces"` // The IDs of the teamspaces the token gives access to
+	Roles      []string `json:"roles"`      // The roles the token is limited to in these teamspaces
+	ExpiresIn  int      `json:"expiresIn"`  // The lifetime of the token in days
+}
+
+// CreateAccessToken creates a personal access token for the current user.
+// The token is only returned in the response, only its hash is saved.
+func CreateAccessToken(c *gin.Context) {
+	user, driver := GetUserFromContext(c)
+	if !canManageAccessTokens(c, user) {
+		return
+	}
+
+	var form AccessTokenForm
+	if err := c.ShouldBindJSON(&form); err != nil || form.Name == "" || len(form.Teamspaces) == 0 || len(form.Roles) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid form - Please provide the name, the teamspaces and the roles of the token"})
+		return
+	}
+	for _, role := range form.Roles {
+		if !models.IsRoleValid(role) {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid role " + role})
+			return
+		}
+	}
+	if form.ExpiresIn == 0 {
+		form.ExpiresIn = DefaultAccessTokenLifetime
+	}
+	if form.ExpiresIn < 0 || form.ExpiresIn > MaxAccessTokenLifetime {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid lifetime - A token expires in 1 to 365 days"})
+		return
+	}
+	for _, teamspaceID := range form.Teamspaces {
+		if !isTeamspaceMember(c.Request.Context(), driver, teamspaceID, user) {
+			c.JSON(http.StatusForbidden, gin.H{"message": "User is not a member of the teamspace " + teamspaceID})
+			return
+		}
+	}
+
+	secret, err := models.GenerateAccessToken()
+	if err != nil {
+		logging.Logger(c).Error("Error generating access token", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error creating token"})
+		return
+	}
+	token := models.AccessToken{
+		Name:       form.Name,
+		UserID:     user.ID.Hex(),
+		Hash:       models.HashToken(secret),
+		Hint:       secret[len(secret)-4:],
+		Teamspaces: form.Teamspaces,
+		Roles:      form.Roles,
+		ExpiresAt:  time.Now().AddDate(0, 0, form.ExpiresIn),
+	}
+	err = token.Create(driver)
+	if err != nil {
+		logging.Logger(c).Warn("Error creating access token", "error", err)
+		if er := utils.OnDuplicateKeyError(err, "Token"); er != nil {
+			c.JSON(http.StatusConflict, gin.H{"message": er.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error creating token"})
+		}
+		return
+	}
+
+	logging.Logger(c).Info("Access token created for user", "token_id", token.ID.Hex(), logging.KeyUserID, user.ID.Hex())
+	c.JSON(http.StatusCreated, gin.H{"message": "Token created successfully - Copy it now, it will not be shown again", "token": secret, "accessToken": token})
+}
+
+// GetAccessTokens lists the personal access tokens of the current user, without their value
+func GetAccessTokens(c *gin.Context) {
+	user, driver := GetUserFromContext(c)
+	if !canManageAccessTokens(c, user) {
+		return
+	}
+
+	token := models.AccessToken{UserID: user.ID.Hex()}
+	tokens, err := token.GetAllByUser(driver)
+	if err != nil {
+		logging.Logger(c).Error("Error getting access tokens", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error getting tokens"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"accessTokens": tokens, "size": len(tokens)})
+}
+
+// RevokeAccessToken revokes a personal access token of the current user
+func RevokeAccessToken(c *gin.Context) {
+	user, driver := GetUserFromContext(c)
+	if !canManageAccessTokens(c, user) {
+		return
+	}
+
+	id, err := primitive.ObjectIDFromHex(c.Param("token_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid token ID"})
+		return
+	}
+	token := models.AccessToken{ID: id, UserID: user.ID.Hex()}
+	err = token.Revoke(driver)
+	if err != nil {
+		logging.Logger(c).Warn("Error revoking access token", "error", err)
+		if utils.OnNotFoundError(err, "Token") != nil {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Token not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error revoking token"})
+		}
+		return
+	}
+
+	logging.Logger(c).Info("Access token revoked", "token_id", token.ID.Hex())
+	c.JSON(http.StatusOK, gin.H{"message": "Token revoked successfully", "accessToken": token})
+}
+
+// canManageAccessTokens prevents a personal access token from creating or revoking tokens
+func canManageAccessTokens(c *gin.Context, user models.User) bool {
+	if user.AccessToken != nil {
+		c.JSON(http.StatusForbidden, gin.H{"message": "The tokens cannot be managed with an access token"})
+		return false
+	}
+	return true
+}
+
+func isTeamspaceMember(ctx context.Context, driver db.Driver, teamspaceID string, user models.User) bool {
+	id, err := primitive.ObjectIDFromHex(teamspaceID)
+	if err != nil {
+		return false
+	}
+	teamspace := models.Teamspace{ID: id}
+	if err := teamspace.Get(driver); err != nil {
+		logging.FromContext(ctx).Error("Error getting teamspace", "error", err)
+		return false
+	}
+	return teamspace.CreatorID == user.ID.Hex() || teamspace.HasMember(driver, models.Member{UserID: user.ID.Hex()})
+}
+
+// inTokenScope keeps the items of the teamspaces the access token of the user gives access to
+func inTokenScope[T any](user models.User, items []T, teamspaceID func(T) string) []T {
+	if user.AccessToken == nil {
+		return items
+	}
+	scoped := []T{}
+	for _, item := range items {
+		if user.AccessToken.AllowsTeamspace(teamspaceID(item)) {
+			scoped = append(scoped, item)
+		}
+	}
+	return scoped
+}
@@ -0,0 +1,138 @@
+package controllers
+
+// This file contains the cpu and memory usage of the microservices read from the metrics api of the clusters
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kuro-jojo/kdi-k8s/shared/logging"
+	"github.com/kuro-jojo/kdi-web/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GetMicroserviceUsage returns the usage of the pods of the microservice compared with their requests and limits
+func GetMicroserviceUsage(c *gin.Context) {
+	_, driver := GetUserFromContext(c)
+
+	e_id := c.Param("e_id")
+	m_id, err := primitive.ObjectIDFromHex(c.Param("m_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid microservice ID"})
+		return
+	}
+
+	microservice := models.Microservice{
+		ID: m_id,
+	}
+	err = microservice.Get(driver)
+	if err != nil || microservice.EnvironmentID != e_id {
+		logging.Logger(c).Warn("Error getting microservice", "error", err)
+		c.JSON(http.StatusNotFound, gin.H{"message": "Microservice not found"})
+		return
+	}
+
+	_, cluster, ok := getEnvironmentAndCluster(c, driver, e_id)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), KubernetesAPITimeout)
+	defer cancel()
+	response, err := kubernetesAPI(cluster).WorkloadUsage(ctx, microservice.Namespace, microservice.Kind, microservice.Name)
+	if err != nil {
+		logging.Logger(c).Error("Error getting the usage of the microservice", "error", err)
+		RespondWithK8sApiError(c, err)
+		return
+	}
+
+	result := gin.H{"usage": response.Usage, "metricsAvailable": response.MetricsAvailable}
+	if response.Message != "" {
+		result["message"] = response.Message
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// GetEnvironmentUsage returns the usage of every microservice of the environment and their total.
+// A namespace whose usage cannot be read is reported in errors without failing the others.
+func GetEnvironmentUsage(c *gin.Context) {
+	_, driver := GetUserFromContext(c)
+	e_id := c.Param("e_id")
+
+	_, cluster, ok := getEnvironmentAndCluster(c, driver, e_id)
+	if !ok {
+		return
+	}
+
+	m := models.Microservice{EnvironmentID: e_id}
+	microservices, err := m.GetAllByEnvironment(driver)
+	if err != nil {
+		logging.Logger(c).Error("Error getting microservices", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error getting microservices"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 60*time.Second)
+	defer cancel()
+
+	// The usage is read once per namespace of the environment
+	api := kubernetesAPI(cluster)
+	workloads := make(map[string]models.WorkloadUsage)
+	errs := make(map[string]string)
+	read := make(map[string]bool)
+	available := true
+	for _, microservice := range microservices {
+		if read[microservice.Namespace] {
+			continue
+		}
+		read[microservice.Namespace] = true
+		response, err := api.NamespaceUsage(ctx, microservice.Namespace)
+		if err != nil {
+			logging.Logger(c).Error("Error getting the usage of namespace", logging.KeyNamespace, microservice.Namespace, "error", err)
+			errs[microservice.Namespace] = k8sApiErrorMessage(err)
+			continue
+		}
+		available = available && response.MetricsAvailable
+		for _, w := range response.Workloads {
+			workloads[usageKey(w.Namespace, w.Kind, w.Name)] = w
+		}
+	}
+	if len(read) > 0 && len(errs) == len(read) {
+		c.JSON(http.StatusBadGateway, gin.H{"message": "Error getting the usage of the environment", "errors": errs})
+		return
+	}
+
+	usages, total := microservicesUsage(microservices, workloads)
+	response := gin.H{"microservices": usages, "size": len(usages), "total": total, "metricsAvailable": available, "errors": errs}
+	if !available {
+		response["message"] = "The metrics are not available on the cluster, only the requests and limits are returned"
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// microservicesUsage returns the usage of the microservices found in the workloads, by usage key, and their total.
+// The microservices whose workload is missing (deleted from the cluster, namespace not read) are left out.
+func microservicesUsage(microservices []models.Microservice, workloads map[string]models.WorkloadUsage) ([]models.MicroserviceUsage, models.ResourceUsage) {
+	usages := make([]models.MicroserviceUsage, 0, len(microservices))
+	var total models.ResourceUsage
+	for _, microservice := range microservices {
+		w, ok := workloads[usageKey(microservice.Namespace, microservice.Kind, microservice.Name)]
+		if !ok {
+			continue
+		}
+		usages = append(usages, models.MicroserviceUsage{
+			MicroserviceID: microservice.ID.Hex(),
+			Name:           microservice.Name,
+			Namespace:      microservice.Namespace,
+			Usage:          w.Total,
+		})
+		total.Add(w.Total)
+	}
+	return usages, total
+}
+
+func usageKey(namespace, kind, name string) string {
+	return namespace + "/" + kind + "/" + name
+}
@@ -0,0 +1,47 @@
+package controllers
+
+import (
+	"testing"
+
+	"github.com/kuro-jojo/kdi-web/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMicroservicesUsage(t *testing.T) {
+	web := models.Microservice{ID: primitive.NewObjectID(), Kind: models.DeploymentKind, Name: "web", Namespace: "shop"}
+	db := models.Microservice{ID: primitive.NewObjectID(), Kind: models.StatefulSetKind, Name: "db", Namespace: "shop"}
+	deleted := models.Microservice{ID: primitive.NewObjectID(), Kind: models.DeploymentKind, Name: "old", Namespace: "shop"}
+	// a deployment with the name of the statefulset in another namespace
+	other := models.Microservice{ID: primitive.NewObjectID(), Kind: models.DeploymentKind, Name: "db", Namespace: "staging"}
+
+	workloads := map[string]models.WorkloadUsage{
+		usageKey("shop", models.DeploymentKind, "web"): {Total: models.ResourceUsage{
+			CPU:    models.Usage{Used: 40, Requests: 200, Limits: 2000},
+			Memory: models.Usage{Used: 100, Requests: 200, Limits: 400},
+		}},
+		usageKey("shop", models.StatefulSetKind, "db"): {Total: models.ResourceUsage{
+			CPU:    models.Usage{Used: 300, Requests: 500, Unlimited: true},
+			Memory: models.Usage{Used: 1000, Requests: 2000, Limits: 4000},
+		}},
+		usageKey("shop", models.DeploymentKind, "db"): {Total: models.ResourceUsage{CPU: models.Usage{Used: 999}}},
+	}
+
+	usages, total := microservicesUsage([]models.Microservice{web, db, deleted, other}, workloads)
+	if len(usages) != 2 || usages[0].MicroserviceID != web.ID.Hex() || usages[1].MicroserviceID != db.ID.Hex() {
+		t.Fatalf("microservicesUsage() = %+v, want the usage of web and db", usages)
+	}
+	if usages[1].Usage != workloads[usageKey("shop", models.StatefulSetKind, "db")].Total {
+		t.Errorf("usage of db = %+v, want the usage of the statefulset", usages[1].Usage)
+	}
+	want := models.ResourceUsage{
+		CPU:    models.Usage{Used: 340, Requests: 700, Limits: 2000, Unlimited: true},
+		Memory: models.Usage{Used: 1100, Requests: 2200, Limits: 4400},
+	}
+	if total != want {
+		t.Errorf("total = %+v, want %+v", total, want)
+	}
+
+	if usages, total := microservicesUsage(nil, workloads); len(usages) != 0 || total != (models.ResourceUsage{}) {
+		t.Errorf("microservicesUsage(nil) = %+v, %+v, want no usage", usages, total)
+	}
+}
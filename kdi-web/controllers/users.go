@@ -1,22 +1,24 @@
 package controllers
 
 import (
-	"log"
+	"context"
+	"fmt"
 	"net/http"
 	"regexp"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
+	"github.com/kuro-jojo/kdi-k8s/shared/logging"
 	"github.com/kuro-jojo/kdi-web/db"
 	"github.com/kuro-jojo/kdi-web/models"
 	"github.com/kuro-jojo/kdi-web/models/utils"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-const (
-	TokenEpirationDate = time.Hour * 24 * 1 // 1 days
-)
+// MinPasswordLength is the minimum number of characters of a password, as asked by the webapp
+const MinPasswordLength = 6
 
 type UserForm struct {
 	Name     string `json:"name"`
@@ -25,14 +27,14 @@ type UserForm struct {
 }
 
 func Login(c *gin.Context) {
-	log.Printf("Logging in user...")
+	logging.Logger(c).Debug("Logging in user...")
 
 	d, _ := c.Get("driver")
 	driver := d.(db.Driver)
 	var userForm UserForm
 
-	if c.BindJSON(&userForm) != nil {
-		log.Printf("Invalid form %v", c.BindJSON(&userForm))
+	if err := c.BindJSON(&userForm); err != nil {
+		logging.Logger(c).Warn("Invalid form", "error", err)
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid form"})
 		return
 	}
@@ -54,7 +56,7 @@ func Login(c *gin.Context) {
 			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid credentials"})
 			return
 		}
-		log.Printf("Error while checking email %v", err)
+		logging.Logger(c).Error("Error while checking email", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error while checking email"})
 		return
 	}
@@ -63,34 +65,44 @@ func Login(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid credentials"})
 		return
 	}
+	if emailVerificationRequired() && !user.EmailVerified {
+		c.JSON(http.StatusForbidden, gin.H{"message": "Email not verified"})
+		return
+	}
 
-	token, err := generateUserAuthToken(user)
+	response, err := createSession(c, driver, user)
 	if err != nil {
+		logging.Logger(c).Error("Error while creating session", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error while generating token"})
 		return
 	}
-	log.Printf("User logged successfully")
-	c.JSON(http.StatusOK, gin.H{"message": "User logged successfully", "token": token})
+	logging.Logger(c).Info("User logged successfully")
+	response["message"] = "User logged successfully"
+	c.JSON(http.StatusOK, response)
 }
 
 func Register(c *gin.Context) {
-	log.Printf("Registering new user...")
+	logging.Logger(c).Debug("Registering new user...")
 
 	d, _ := c.Get("driver")
 	driver := d.(db.Driver)
 	var userForm UserForm
 
-	if c.BindJSON(&userForm) != nil {
-		log.Printf("Invalid form %v", c.BindJSON(&userForm))
+	if err := c.BindJSON(&userForm); err != nil {
+		logging.Logger(c).Warn("Invalid form", "error", err)
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid form"})
 		return
 	}
 
 	if formIsInValid(userForm, false, false) {
-		log.Printf("Invalid form %v", userForm)
+		logging.Logger(c).Warn("Invalid form")
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid form fields"})
 		return
 	}
+	if err := checkNewPassword(userForm.Password); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
 	var user models.User = models.User{
 		Name:     userForm.Name,
 		Email:    userForm.Email,
@@ -100,13 +112,13 @@ func Register(c *gin.Context) {
 	// Check if user esxists
 	err := user.GetByEmail(driver)
 	if err == nil {
-		log.Printf("Email already used")
+		logging.Logger(c).Warn("Email already used")
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Email already used"})
 		return
 	}
 
 	if !strings.Contains(err.Error(), "not found") {
-		log.Printf("Error while checking email %v", err)
+		logging.Logger(c).Error("Error while checking email", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error while checking email"})
 		return
 	}
@@ -114,21 +126,27 @@ func Register(c *gin.Context) {
 	// Create user
 	err = user.Create(driver)
 	if err != nil {
-		log.Printf("Error while creating user %v", err)
+		logging.Logger(c).Error("Error while creating user", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error while creating user"})
 		return
 	}
+	// the user can ask for another email if this one is not sent
+	sendInBackground(c, func(ctx context.Context) error {
+		return sendVerificationEmail(ctx, driver, user)
+	})
 
-	log.Printf("User created successfully")
+	logging.Logger(c).Info("User created successfully")
 	c.JSON(http.StatusCreated, gin.H{"message": "User created successfully"})
 }
 
 func RegisterWithMsal(c *gin.Context) {
-	log.Printf("Registering new user with msal...")
+	logging.Logger(c).Debug("Registering new user with msal...")
 
 	user, driver := GetUserFromContext(c)
 
 	user.SignWith = "MSAL"
+	// the email is verified by Microsoft
+	user.EmailVerified = true
 
 	// Check if user esxists
 	err := user.GetByEmail(driver)
@@ -138,7 +156,7 @@ func RegisterWithMsal(c *gin.Context) {
 	}
 
 	if !strings.Contains(err.Error(), "not found") {
-		log.Printf("Error while checking email %v", err)
+		logging.Logger(c).Error("Error while checking email", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error while checking email"})
 		return
 	}
@@ -146,12 +164,12 @@ func RegisterWithMsal(c *gin.Context) {
 	// Create user
 	err = user.Create(driver)
 	if err != nil {
-		log.Printf("Error while creating user %v", err)
+		logging.Logger(c).Error("Error while creating user", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error while creating user"})
 		return
 	}
 
-	log.Printf("User created successfully")
+	logging.Logger(c).Info("User created successfully")
 	c.JSON(http.StatusCreated, gin.H{"message": "User created successfully"})
 }
 
@@ -173,7 +191,7 @@ func GetUserById(c *gin.Context) {
 	err := user.Get(driver)
 
 	if err != nil {
-		log.Printf("Error getting user %v", err)
+		logging.Logger(c).Warn("Error getting user", "error", err)
 		if er := utils.OnDuplicateKeyError(err, "User"); er != nil {
 			c.JSON(http.StatusConflict, gin.H{"message": er.Error()})
 		} else {
@@ -194,21 +212,36 @@ func GetAllJoinedTeamspaces(c *gin.Context) {
 
 	teamspaces, err := user.GetAllJoinedTeamspaces(driver)
 	if err != nil {
-		log.Printf("Error getting teamspaces %v", err)
+		logging.Logger(c).Error("Error getting teamspaces", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error getting teamspaces"})
 		return
 	}
+	teamspaces = inTokenScope(user, teamspaces, func(t models.Teamspace) string { return t.ID.Hex() })
 	c.JSON(http.StatusOK, gin.H{"teamspaces": teamspaces, "size": len(teamspaces)})
 }
 
-func generateUserAuthToken(user models.User) (string, error) {
+// generateUserAuthToken returns an access token of the session, it is refused once the session is revoked
+func generateUserAuthToken(user models.User, session models.Session) (string, error) {
 	claims := make(map[string]interface{})
 	claims["sub"] = user.ID
-	claims["exp"] = time.Now().Add(TokenEpirationDate).Unix()
+	claims["sid"] = session.ID.Hex()
+	claims["exp"] = time.Now().Add(AccessTokenLifetime).Unix()
 
 	return GenerateJWT(claims)
 }
 
+// checkNewPassword returns why a password chosen by a user is refused, at the registration and at the reset of the password
+func checkNewPassword(password string) error {
+	if utf8.RuneCountInString(password) < MinPasswordLength {
+		return fmt.Errorf("The password must have at least %d characters", MinPasswordLength)
+	}
+	// bcrypt only hashes the first 72 bytes
+	if len(password) > 72 {
+		return fmt.Errorf("The password must have at most 72 bytes")
+	}
+	return nil
+}
+
 func formIsInValid(u UserForm, ignoreName bool, ignorePassword bool) bool {
 	b, err := regexp.MatchString(`^[a-zA-Z0-9_+&*-]+(?:\.[a-zA-Z0-9_+&*-]+)*@(?:[a-zA-Z0-9-]+\.)+[a-zA-Z]{2,}$`, u.Email)
 	return err != nil || !b || (u.Password == "" && !ignorePassword) || (u.Name == "" && !ignoreName)
@@ -4,14 +4,15 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
-	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/kuro-jojo/kdi-k8s/client"
+	"github.com/kuro-jojo/kdi-k8s/shared/logging"
 	"github.com/kuro-jojo/kdi-web/db"
 	"github.com/kuro-jojo/kdi-web/models"
 )
@@ -99,36 +100,49 @@ func GetClusterTokenFromJWT(tokenString string) (string, error) {
 	return "", fmt.Errorf("error while parsing token")
 }
 
-func MakeRequestToKubernetesAPI(c *gin.Context, cluster models.Cluster, method string, endpoint string, rBody io.Reader) (*http.Response, []byte, bool) {
-	kubernetesApiUrl := os.Getenv("KDI_K8S_API_ENDPOINT")
+// KubernetesAPITimeout is the maximum duration of the requests to the kubernetes api made while handling a request
+const KubernetesAPITimeout = 60 * time.Second
 
-	req, err := http.NewRequest(method, kubernetesApiUrl+endpoint, rBody)
-	if err != nil {
-		log.Printf("Error creating request %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error creating request"})
-		return nil, nil, false
+// kubernetesAPI returns the client of the kubernetes api acting on behalf of the cluster.
+// The kubernetes api logs the requests with the same request id and cluster.
+func kubernetesAPI(cluster models.Cluster) *client.Client {
+	credentials := client.Credentials{Token: cluster.Token, ClusterType: cluster.Type}
+	if !cluster.ID.IsZero() {
+		credentials.ClusterID = cluster.ID.Hex()
 	}
-	req.Header.Set("Content-Type", c.Request.Header.Get("Content-Type"))
-	req.Header.Set("Authorization", cluster.Token)
-	req.Header.Set("cluster-type", cluster.Type)
+	return client.New(os.Getenv("KDI_K8S_API_ENDPOINT"), credentials, client.WithRequestID(logging.RequestID))
+}
 
-	client := &http.Client{
-		Timeout: 60 * time.Second,
-	}
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Printf("Error making request %v", err)
+// RespondWithK8sApiError forwards the error returned by the kubernetes api with its reason code and causes
+func RespondWithK8sApiError(c *gin.Context, err error) {
+	e, ok := client.AsError(err)
+	if !ok {
+		logging.Logger(c).Error("Error making request to the kubernetes api", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error making request"})
-		return nil, nil, false
+		return
 	}
+	logging.Logger(c).Warn("Error from Kubernetes API", "status", e.StatusCode, "error", e.Error())
+	if e.Message == "" {
+		c.JSON(e.StatusCode, gin.H{"message": "Error from Kubernetes API", "details": string(e.Body)})
+		return
+	}
+	response := gin.H{"message": e.Message}
+	if e.Reason != "" {
+		response["reason"] = e.Reason
+	}
+	if len(e.Causes) > 0 {
+		response["causes"] = e.Causes
+	}
+	if e.RetryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(e.RetryAfter))
+	}
+	c.JSON(e.StatusCode, response)
+}
 
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Printf("Error reading response body %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error reading response body"})
-		return nil, nil, false
+// k8sApiErrorMessage returns the message of the error of the kubernetes api
+func k8sApiErrorMessage(err error) string {
+	if e, ok := client.AsError(err); ok && e.Message != "" {
+		return e.Message
 	}
-	return resp, body, true
+	return err.Error()
 }
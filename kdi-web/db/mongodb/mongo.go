@@ -7,6 +7,7 @@ import (
 	"log"
 	"os"
 
+	"github.com/kuro-jojo/kdi-web/metrics"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -24,6 +25,12 @@ const (
 	ProfilesCollection      = "profiles"
 	EnvironmentsCollection  = "environments"
 	NamespacesCollection    = "namespaces"
+	OperationsCollection    = "operations"
+	ConfigSetsCollection    = "config_sets"
+	RuleSetsCollection      = "rule_sets"
+	AccessTokensCollection  = "access_tokens"
+	SessionsCollection      = "sessions"
+	EmailTokensCollection   = "email_tokens"
 )
 
 type MongoDriver struct {
@@ -42,7 +49,7 @@ func (m *MongoDriver) Connect() error {
 	}
 
 	serverAPI := options.ServerAPI(options.ServerAPIVersion1)
-	opts := options.Client().ApplyURI(uri).SetServerAPIOptions(serverAPI).SetTLSConfig(&tls.Config{})
+	opts := options.Client().ApplyURI(uri).SetServerAPIOptions(serverAPI).SetTLSConfig(&tls.Config{}).SetMonitor(metrics.CommandMonitor())
 	// Create a new client and connect to the server
 	var err error
 	m.Client, err = mongo.Connect(context.TODO(), opts)
@@ -176,6 +183,62 @@ func (m *MongoDriver) InitIndexes() error {
 		Options: options.Index().SetUnique(true),
 	})
 
+	if err != nil {
+		log.Printf("Error creating indexes: %v", err)
+		return fmt.Errorf("error creating indexes: %v", err)
+	}
+	// Create index for the operations of an environment and the operations to resume
+	_, err = m.GetCollection(OperationsCollection).Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "environment_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}}},
+	})
+
+	if err != nil {
+		log.Printf("Error creating indexes: %v", err)
+		return fmt.Errorf("error creating indexes: %v", err)
+	}
+	// Create unique index for config sets : no duplicate name of the same kind in an environment and namespace
+	_, err = m.GetCollection(ConfigSetsCollection).Indexes().CreateOne(context.TODO(), mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "environment_id", Value: 1},
+			{Key: "namespace", Value: 1},
+			{Key: "kind", Value: 1},
+			{Key: "name", Value: 1},
+		},
+		Options: options.Index().SetUnique(true),
+	})
+
+	if err != nil {
+		log.Printf("Error creating indexes: %v", err)
+		return fmt.Errorf("error creating indexes: %v", err)
+	}
+	// Create unique indexes for the access tokens : found by their hash, no duplicate name for a user
+	_, err = m.GetCollection(AccessTokensCollection).Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "name", Value: 1}}, Options: options.Index().SetUnique(true)},
+	})
+
+	if err != nil {
+		log.Printf("Error creating indexes: %v", err)
+		return fmt.Errorf("error creating indexes: %v", err)
+	}
+	// Create indexes for the sessions of a user, the expired sessions are removed
+	_, err = m.GetCollection(SessionsCollection).Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+
+	if err != nil {
+		log.Printf("Error creating indexes: %v", err)
+		return fmt.Errorf("error creating indexes: %v", err)
+	}
+	// Create indexes for the email tokens : found by their hash, the expired tokens are removed
+	_, err = m.GetCollection(EmailTokensCollection).Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "purpose", Value: 1}}},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+
 	if err != nil {
 		log.Printf("Error creating indexes: %v", err)
 		return fmt.Errorf("error creating indexes: %v", err)
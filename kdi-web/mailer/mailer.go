@@ -0,0 +1,139 @@
+package mailer
+
+// This file sends the emails of the web api (verification of the email addresses, reset of the passwords).
+// The emails go through an SMTP server, or only to the logs in development.
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends the emails
+type Mailer interface {
+	Send(ctx context.Context, message Message) error
+}
+
+// FromEnv returns the SMTP mailer if KDI_SMTP_ADDR is set (host:port), and the log mailer otherwise.
+// KDI_SMTP_FROM is the sender, KDI_SMTP_USERNAME and KDI_SMTP_PASSWORD the credentials if the server requires them.
+func FromEnv() Mailer {
+	addr := os.Getenv("KDI_SMTP_ADDR")
+	if addr == "" {
+		log.Println("KDI_SMTP_ADDR is not set, the emails are only logged")
+		return LogMailer{}
+	}
+	return &SMTPMailer{
+		Addr:     addr,
+		From:     os.Getenv("KDI_SMTP_FROM"),
+		Username: os.Getenv("KDI_SMTP_USERNAME"),
+		Password: os.Getenv("KDI_SMTP_PASSWORD"),
+	}
+}
+
+// LogMailer logs the emails instead of sending them, for development
+type LogMailer struct{}
+
+func (LogMailer) Send(_ context.Context, message Message) error {
+	log.Printf("Email to %s : %s\n%s", message.To, message.Subject, message.Body)
+	return nil
+}
+
+// SMTPMailer sends the emails through an SMTP server, with STARTTLS if the server supports it
+type SMTPMailer struct {
+	Addr     string
+	From     string
+	Username string
+	Password string
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, message Message) error {
+	data, err := m.format(message)
+	if err != nil {
+		return err
+	}
+	host, _, err := net.SplitHostPort(m.Addr)
+	if err != nil {
+		return fmt.Errorf("invalid SMTP address %s: %v", m.Addr, err)
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", m.Addr)
+	if err != nil {
+		return fmt.Errorf("error connecting to the SMTP server: %v", err)
+	}
+	// the whole exchange is bound by the context
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(30 * time.Second)
+	}
+	conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("error connecting to the SMTP server: %v", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return fmt.Errorf("error starting TLS: %v", err)
+		}
+	}
+	if m.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.Username, m.Password, host)); err != nil {
+			return fmt.Errorf("error authenticating to the SMTP server: %v", err)
+		}
+	}
+	if err := client.Mail(m.From); err != nil {
+		return fmt.Errorf("error sending email: %v", err)
+	}
+	if err := client.Rcpt(message.To); err != nil {
+		return fmt.Errorf("error sending email: %v", err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("error sending email: %v", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("error sending email: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("error sending email: %v", err)
+	}
+	return client.Quit()
+}
+
+// format returns the headers and the body of the email
+func (m *SMTPMailer) format(message Message) ([]byte, error) {
+	// a line break in a header would add other headers or recipients
+	for _, header := range []string{m.From, message.To, message.Subject} {
+		if strings.ContainsAny(header, "\r\n") {
+			return nil, fmt.Errorf("invalid email header %q", header)
+		}
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", m.From)
+	fmt.Fprintf(&b, "To: %s\r\n", message.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", message.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(message.Body, "\r\n", "\n"), "\n", "\r\n"))
+	return []byte(b.String()), nil
+}
@@ -0,0 +1,124 @@
+package mailer
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+// smtpServer is a local SMTP stand-in keeping the envelope and the data of the last email
+type smtpServer struct {
+	addr string
+	auth string
+	from string
+	to   []string
+	data string
+	done chan struct{}
+}
+
+func newSMTPServer(t *testing.T) *smtpServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	s := &smtpServer{addr: listener.Addr().String(), done: make(chan struct{})}
+	go func() {
+		defer close(s.done)
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		s.serve(textproto.NewConn(conn))
+	}()
+	return s
+}
+
+func (s *smtpServer) serve(conn *textproto.Conn) {
+	conn.PrintfLine("220 localhost ESMTP")
+	for {
+		line, err := conn.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			conn.PrintfLine("250-localhost")
+			conn.PrintfLine("250 AUTH PLAIN")
+		case "AUTH":
+			_, credentials, _ := strings.Cut(arg, " ")
+			decoded, _ := base64.StdEncoding.DecodeString(credentials)
+			s.auth = string(decoded)
+			conn.PrintfLine("235 Authenticated")
+		case "MAIL":
+			s.from = arg
+			conn.PrintfLine("250 OK")
+		case "RCPT":
+			s.to = append(s.to, arg)
+			conn.PrintfLine("250 OK")
+		case "DATA":
+			conn.PrintfLine("354 Go ahead")
+			data, err := conn.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.data = string(data)
+			conn.PrintfLine("250 OK")
+		case "QUIT":
+			conn.PrintfLine("221 Bye")
+			return
+		default:
+			conn.PrintfLine("502 Not implemented")
+		}
+	}
+}
+
+func TestSMTPMailerSendsTheEmail(t *testing.T) {
+	server := newSMTPServer(t)
+	mailer := &SMTPMailer{Addr: server.addr, From: "kdi@example.com", Username: "kdi", Password: "secret"}
+
+	err := mailer.Send(context.Background(), Message{
+		To:      "user@example.com",
+		Subject: "Reset your password",
+		Body:    "Open the link\nto reset it",
+	})
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	<-server.done
+
+	if server.auth != "\x00kdi\x00secret" {
+		t.Errorf("auth = %q", server.auth)
+	}
+	if server.from != "FROM:<kdi@example.com>" || len(server.to) != 1 || server.to[0] != "TO:<user@example.com>" {
+		t.Errorf("envelope = %s %v", server.from, server.to)
+	}
+	reader := bufio.NewReader(strings.NewReader(server.data))
+	header, err := textproto.NewReader(reader).ReadMIMEHeader()
+	if err != nil {
+		t.Fatalf("headers: %v", err)
+	}
+	if header.Get("To") != "user@example.com" || header.Get("Subject") != "Reset your password" {
+		t.Errorf("headers = %v", header)
+	}
+	body, _ := reader.ReadString(0)
+	if body != "Open the link\nto reset it\n" {
+		t.Errorf("body = %q", body)
+	}
+}
+
+func TestSMTPMailerRefusesHeaderInjection(t *testing.T) {
+	mailer := &SMTPMailer{Addr: "127.0.0.1:1", From: "kdi@example.com"}
+	err := mailer.Send(context.Background(), Message{To: "user@example.com\r\nBcc: other@example.com", Subject: "Verify"})
+	if err == nil || !strings.Contains(err.Error(), "invalid email header") {
+		t.Fatalf("err = %v", err)
+	}
+}
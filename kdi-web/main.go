@@ -1,12 +1,15 @@
 package main
 
 import (
+	"github.com/kuro-jojo/kdi-k8s/shared/logging"
 	"github.com/kuro-jojo/kdi-web/server"
 )
 
 func main() {
 	// Load environment variables
 	server.LoadEnv()
+	// Log in JSON with the fields of the requests
+	logging.Init()
 
 	// Initialize Server
 	server.Init()
@@ -0,0 +1,67 @@
+package metrics
+
+// This file exposes the operational metrics of the web api in the prometheus format
+
+import (
+	"context"
+	"sync"
+
+	"github.com/kuro-jojo/kdi-k8s/shared/httpmetrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+const Namespace = "kdi_web"
+
+// Requests are the metrics of the http requests of the api
+var Requests = httpmetrics.NewRequests(Namespace)
+
+var (
+	mongoDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      "mongo_command_duration_seconds",
+		Help:      "Duration of the mongo commands by command, collection and result.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"command", "collection", "result"})
+
+	operations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "operations_total",
+		Help:      "Number of finished operations (deployments, restarts...) by type and status.",
+	}, []string{"type", "status"})
+)
+
+// ObserveOperation records a finished operation
+func ObserveOperation(operationType string, status string) {
+	operations.WithLabelValues(operationType, status).Inc()
+}
+
+// CommandMonitor observes the duration of the commands sent to mongo by the models.
+// The collection is read from the started command since the finished events do not carry it.
+func CommandMonitor() *event.CommandMonitor {
+	var collections sync.Map // request id -> collection
+
+	finished := func(e event.CommandFinishedEvent, result string) {
+		collection := ""
+		if v, ok := collections.LoadAndDelete(e.RequestID); ok {
+			collection = v.(string)
+		}
+		mongoDuration.WithLabelValues(e.CommandName, collection, result).Observe(e.Duration.Seconds())
+	}
+
+	return &event.CommandMonitor{
+		Started: func(_ context.Context, e *event.CommandStartedEvent) {
+			// the value of the command name is the collection for the commands on a collection (find, insert...)
+			if collection, ok := e.Command.Lookup(e.CommandName).StringValueOK(); ok {
+				collections.Store(e.RequestID, collection)
+			}
+		},
+		Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) {
+			finished(e.CommandFinishedEvent, "succeeded")
+		},
+		Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+			finished(e.CommandFinishedEvent, "failed")
+		},
+	}
+}
@@ -1,20 +1,19 @@
 package middlewares
 
 import (
-	"context"
-	"crypto/rsa"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/kuro-jojo/kdi-k8s/shared/logging"
 	"github.com/kuro-jojo/kdi-web/db/mongodb"
 	"github.com/kuro-jojo/kdi-web/models"
-	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/kuro-jojo/kdi-web/oidc"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -22,28 +21,15 @@ const (
 	RegisterWithMsalPath = "/api/v1/web/register/msal"
 )
 
-type JWKS struct {
-	Kty    string   `json:"kty"`
-	Kid    string   `json:"kid"`
-	X5C    []string `json:"x5c"`
-	Issuer string   `json:"issuer"`
-	E      string   `json:"e"`
-	N      string   `json:"n"`
-	RSA    *rsa.PublicKey
-}
-
-type MsalWebAuth struct {
-	Keys []JWKS // Public keys to verify the JWT token signature  from the Azure AD
-}
-
 // AuthMiddleware is a middleware that checks if the user is authenticated
-func AuthMiddleware(msalAuth MsalWebAuth) gin.HandlerFunc {
+// The tokens of the OpenID Connect providers are told apart by the auth-method header, "oidc" (or "msal" for the webapp).
+func AuthMiddleware(providers *oidc.Providers) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		tokenString := getTokenFromHeader(c.Request.Header)
 		// get the value that tells if the token is from MSAL or not
 		// call the right function to validate the token
 		if tokenString == "" {
-			log.Println("No authentication token provided")
+			logging.Logger(c).Warn("No authentication token provided")
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "No authentication token provided"})
 			return
 		}
@@ -51,16 +37,21 @@ func AuthMiddleware(msalAuth MsalWebAuth) gin.HandlerFunc {
 		var status int
 		var message string
 
-		if c.Request.Header.Get("auth-method") == "msal" {
-			isValid, status, message = isMsalTokenValid(tokenString, msalAuth, c)
+		if method := c.Request.Header.Get("auth-method"); method == "msal" || method == "oidc" {
+			isValid, status, message = isOIDCTokenValid(tokenString, providers, c)
+		} else if strings.HasPrefix(tokenString, models.AccessTokenPrefix) {
+			isValid, status, message = isAccessTokenValid(tokenString, c)
 		} else {
 			isValid, status, message = isBaseAuthTokenValid(tokenString, c)
 		}
 		if !isValid {
-			log.Println(message)
+			logging.Logger(c).Warn("Authentication failed", "reason", message)
 			c.AbortWithStatusJSON(status, gin.H{"message": message})
 			return
 		}
+		if user, ok := c.Get("user"); ok && !user.(models.User).ID.IsZero() {
+			logging.With(c, logging.KeyUserID, user.(models.User).ID.Hex())
+		}
 		c.Next()
 	}
 }
@@ -79,7 +70,7 @@ func isBaseAuthTokenValid(tokenString string, c *gin.Context) (bool, int, string
 
 		uid, err := primitive.ObjectIDFromHex(claims["sub"].(string))
 		if err != nil {
-			log.Printf("Error while parsing user ID %v", err)
+			logging.Logger(c).Warn("Error while parsing user ID", "error", err)
 			return false, http.StatusUnauthorized, "Unauthorized"
 		}
 		user := models.User{
@@ -89,9 +80,28 @@ func isBaseAuthTokenValid(tokenString string, c *gin.Context) (bool, int, string
 		driver, _ := c.Get("driver")
 		err = user.Get(driver.(*mongodb.MongoDriver))
 		if err != nil {
-			log.Printf("Error while getting user %v", err)
+			logging.Logger(c).Warn("Error while getting user", "error", err)
 			return false, http.StatusUnauthorized, "Unauthorized"
 		}
+
+		// the token is refused once its session is revoked (logout or revocation of the sessions of the user)
+		sid, _ := claims["sid"].(string)
+		sessionID, err := primitive.ObjectIDFromHex(sid)
+		if err != nil {
+			logging.Logger(c).Warn("Error while parsing session ID", "error", err)
+			return false, http.StatusUnauthorized, "Unauthorized"
+		}
+		session := models.Session{
+			ID: sessionID,
+		}
+		err = session.Get(driver.(*mongodb.MongoDriver))
+		if err != nil || session.UserID != uid.Hex() {
+			logging.Logger(c).Warn("Error while getting session", "error", err)
+			return false, http.StatusUnauthorized, "Unauthorized"
+		}
+		if !session.IsActive() {
+			return false, http.StatusUnauthorized, "Session is expired or revoked"
+		}
 		c.Set("user", user)
 
 	} else {
@@ -100,69 +110,115 @@ func isBaseAuthTokenValid(tokenString string, c *gin.Context) (bool, int, string
 	return true, http.StatusOK, ""
 }
 
-// isMsalTokenValid checks if the token is valid for the MSAL authentication method
-func isMsalTokenValid(tokenString string, msalAuth MsalWebAuth, c *gin.Context) (bool, int, string) {
-	// retrieve the token from teh jwt
+// isAccessTokenValid checks if the token is an active personal access token.
+// The token is kept with the user so that the teamspaces and the roles of the request are restricted to its scope.
+func isAccessTokenValid(tokenString string, c *gin.Context) (bool, int, string) {
+	driver, _ := c.Get("driver")
+	token := models.AccessToken{
+		Hash: models.HashToken(tokenString),
+	}
+	err := token.GetByHash(driver.(*mongodb.MongoDriver))
+	if err != nil {
+		logging.Logger(c).Warn("Error while getting access token", "error", err)
+		return false, http.StatusUnauthorized, "Unauthorized"
+	}
+	if !token.IsActive() {
+		return false, http.StatusUnauthorized, "Token is expired or revoked"
+	}
 
-	token, key, code, message := retrieveTokenFromJWTForMsalAuth(tokenString, msalAuth)
-	if token == nil {
-		log.Printf("Error while retrieving token : %v", message)
-		return false, code, message
+	uid, err := primitive.ObjectIDFromHex(token.UserID)
+	if err != nil {
+		logging.Logger(c).Warn("Error while parsing user ID", "error", err)
+		return false, http.StatusUnauthorized, "Unauthorized"
+	}
+	user := models.User{
+		ID: uid,
+	}
+	err = user.Get(driver.(*mongodb.MongoDriver))
+	if err != nil {
+		logging.Logger(c).Warn("Error while getting user", "error", err)
+		return false, http.StatusUnauthorized, "Unauthorized"
 	}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok {
-		if claims["aud"] != os.Getenv("KDI_MSAL_CLIENT_ID") {
-			log.Printf("Invalid audience")
-			return false, http.StatusUnauthorized, "Invalid audience"
-		}
-		if claims["iss"] != key.Issuer {
-			log.Printf("Invalid issuer")
-			return false, http.StatusUnauthorized, "Unauthorized"
-		}
-		if claims["tid"] != os.Getenv("KDI_MSAL_TENANT_ID") {
-			log.Printf("Invalid tenant")
-			return false, http.StatusUnauthorized, "Invalid tenant"
-		}
-		if claims["preferred_username"] == "" {
-			log.Printf("Invalid username")
-			return false, http.StatusUnauthorized, "Invalid username"
+	// the last use is saved at most once a minute
+	if time.Since(token.LastUsedAt) > time.Minute {
+		if err := token.UpdateLastUsed(driver.(*mongodb.MongoDriver)); err != nil {
+			logging.Logger(c).Error("Error while updating the last use of the access token", "error", err)
 		}
+	}
+	user.AccessToken = &token
+	c.Set("user", user)
+	return true, http.StatusOK, ""
+}
 
-		if claims["name"] == "" {
-			log.Printf("Invalid name")
-			return false, http.StatusUnauthorized, "Invalid name"
-		}
-		driver, _ := c.Get("driver")
-		user := models.User{
-			Email: claims["preferred_username"].(string),
-			Name:  claims["name"].(string),
-		}
-
-		err := user.GetByEmail(driver.(*mongodb.MongoDriver))
-		if err != nil && strings.Contains(err.Error(), "not found") {
-			log.Printf("User not found")
-			// Register the user if it is not found
-			// If the incoming request is for the registration path, then register the user
-			// Otherwise, register the user
-			if c.Request.URL.Path != RegisterWithMsalPath {
-				// Create user
-				log.Printf("Creating user %v", user)
-				err = user.Create(driver.(*mongodb.MongoDriver))
-				if err != nil {
-					log.Printf("Error while creating user %v", err)
-					return false, http.StatusUnauthorized, "Error while creating user"
-				}
-			}
-		} else if err != nil {
-			log.Printf("Error while getting user %v", err)
-			return false, http.StatusUnauthorized, "Unauthorized"
+// isOIDCTokenValid checks if the token is valid for one of the OpenID Connect providers.
+// The user is found by the subject of its account at the provider. An account used for the first time is linked
+// to the user with its email if the user verified it, or registered at its first request.
+func isOIDCTokenValid(tokenString string, providers *oidc.Providers, c *gin.Context) (bool, int, string) {
+	verified, err := providers.Verify(c.Request.Context(), tokenString)
+	if err != nil {
+		logging.Logger(c).Warn("Error while verifying token", "error", err)
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return false, http.StatusUnauthorized, "Token is expired"
 		}
+		return false, http.StatusUnauthorized, "Unauthorized"
+	}
+
+	driver, _ := c.Get("driver")
+	identity := models.Identity{Provider: verified.Provider, Subject: verified.Subject}
+	user := models.User{}
+	err = user.GetByIdentity(driver.(*mongodb.MongoDriver), identity)
+	if err == nil {
 		c.Set("user", user)
+		return true, http.StatusOK, ""
+	}
+	if !strings.Contains(err.Error(), "not found") {
+		logging.Logger(c).Warn("Error while getting user", "error", err)
+		return false, http.StatusUnauthorized, "Unauthorized"
+	}
 
-	} else {
-		log.Printf("Error while parsing claims")
+	user = models.User{Email: verified.Email}
+	err = user.GetByEmail(driver.(*mongodb.MongoDriver))
+	if err != nil && strings.Contains(err.Error(), "not found") {
+		logging.Logger(c).Info("User not found")
+		user = models.User{
+			Email:         verified.Email,
+			Name:          verified.Name,
+			SignWith:      strings.ToUpper(verified.Provider),
+			EmailVerified: true,
+			Identities:    []models.Identity{identity},
+		}
+		// Register the user if it is not found, unless the request is the registration
+		if c.Request.URL.Path != RegisterWithMsalPath {
+			// Create user
+			logging.Logger(c).Info("Creating user", "email", user.Email)
+			err = user.Create(driver.(*mongodb.MongoDriver))
+			if err != nil {
+				logging.Logger(c).Warn("Error while creating user", "error", err)
+				return false, http.StatusUnauthorized, "Error while creating user"
+			}
+		}
+	} else if err != nil {
+		logging.Logger(c).Warn("Error while getting user", "error", err)
 		return false, http.StatusUnauthorized, "Unauthorized"
+	} else {
+		// anyone can register an email without owning it, the account is only trusted once its email is verified
+		if !user.EmailVerified {
+			logging.Logger(c).Warn("Account of the provider not linked to a user with an unverified email", logging.KeyUserID, user.ID.Hex(), "provider", identity.Provider, "subject", identity.Subject)
+			return false, http.StatusForbidden, "An account with this email exists but its email is not verified - Please sign in with its password and verify the email before signing in with the provider"
+		}
+		// the email was given to another account of the provider, the one linked to the user is kept
+		if linked, ok := user.IdentityOf(identity.Provider); ok {
+			logging.Logger(c).Warn("User linked to another account of the provider", logging.KeyUserID, user.ID.Hex(), "provider", linked.Provider, "subject", identity.Subject)
+			return false, http.StatusUnauthorized, "The email is linked to another account of the provider"
+		}
+		if err := user.AddIdentity(driver.(*mongodb.MongoDriver), identity); err != nil {
+			logging.Logger(c).Warn("Error while linking the account", "error", err)
+			return false, http.StatusUnauthorized, "Unauthorized"
+		}
+		logging.Logger(c).Info("Account of the provider linked to user", "provider", identity.Provider, "subject", identity.Subject, logging.KeyUserID, user.ID.Hex())
 	}
+	c.Set("user", user)
 	return true, http.StatusOK, ""
 }
 
@@ -170,17 +226,6 @@ func getTokenFromHeader(header http.Header) string {
 	return strings.TrimPrefix(header.Get("Authorization"), "Bearer ")
 }
 
-func getMSALPublicKey(msalAuth MsalWebAuth, kid string) JWKS {
-	for _, key := range msalAuth.Keys {
-		if key.Kid == kid {
-			JwkToRsaPublicKey(&key)
-			return key
-		}
-	}
-
-	return JWKS{}
-}
-
 func retrieveTokenFromJWT(tokenString string, secretKey string) (*jwt.Token, int, string) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
@@ -197,57 +242,3 @@ func retrieveTokenFromJWT(tokenString string, secretKey string) (*jwt.Token, int
 	}
 	return token, http.StatusOK, ""
 }
-
-func retrieveTokenFromJWTForMsalAuth(tokenString string, msalAuth MsalWebAuth) (*jwt.Token, JWKS, int, string) {
-	var key JWKS
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		switch msalAuth.Keys[0].Kty {
-		case "RSA":
-			if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-		default:
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		key = getMSALPublicKey(msalAuth, token.Header["kid"].(string))
-		return key.RSA, nil
-	})
-
-	if err != nil {
-		if strings.Contains(err.Error(), "token is expired") {
-			return nil, key, http.StatusUnauthorized, "Token is expired"
-		}
-		log.Printf("Error while parsing token %v : ", err)
-		return nil, key, http.StatusInternalServerError, "Error while parsing token"
-	}
-	return token, key, http.StatusOK, ""
-}
-
-func JwkToRsaPublicKey(key *JWKS) {
-	keyBytes, err := json.Marshal(key)
-	if err != nil {
-		log.Printf("failed to marshal public key: %s", err)
-		panic(err)
-	}
-	set, err := jwk.Parse(keyBytes)
-	if err != nil {
-		log.Printf("failed to parse public key: %s", err)
-		panic(err)
-	}
-	for it := set.Iterate(context.Background()); it.Next(context.Background()); {
-		pair := it.Pair()
-		k := pair.Value.(jwk.Key)
-
-		var rawkey interface{}
-		if err := k.Raw(&rawkey); err != nil {
-			log.Printf("failed to create public key: %s", err)
-		}
-
-		var ok bool
-		key.RSA, ok = rawkey.(*rsa.PublicKey)
-		if !ok {
-			panic(fmt.Sprintf("expected ras key, got %T", rawkey))
-		}
-
-	}
-}
@@ -0,0 +1,68 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kuro-jojo/kdi-web/db/mongodb"
+	"github.com/kuro-jojo/kdi-web/oidc"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// The access tokens of a session are refused once it is revoked or expired, or if it is the session of another user
+func TestSessionOfTheAccessToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mongodb.DbName = "kdi"
+	t.Setenv("KDI_JWT_SECRET_KEY", "secret")
+	userID := primitive.NewObjectID()
+
+	tests := []struct {
+		name    string
+		session bson.D
+		status  int
+	}{
+		{"active", bson.D{{Key: "user_id", Value: userID.Hex()}, {Key: "expires_at", Value: time.Now().Add(time.Hour)}}, http.StatusOK},
+		{"revoked", bson.D{{Key: "user_id", Value: userID.Hex()}, {Key: "expires_at", Value: time.Now().Add(time.Hour)}, {Key: "revoked_at", Value: time.Now()}}, http.StatusUnauthorized},
+		{"expired", bson.D{{Key: "user_id", Value: userID.Hex()}, {Key: "expires_at", Value: time.Now().Add(-time.Hour)}}, http.StatusUnauthorized},
+		{"another user", bson.D{{Key: "user_id", Value: primitive.NewObjectID().Hex()}, {Key: "expires_at", Value: time.Now().Add(time.Hour)}}, http.StatusUnauthorized},
+		{"no session", nil, http.StatusUnauthorized},
+	}
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			sessionID := primitive.NewObjectID()
+			sessions := mtest.CreateCursorResponse(0, "kdi.sessions", mtest.FirstBatch)
+			if tt.session != nil {
+				sessions = mtest.CreateCursorResponse(0, "kdi.sessions", mtest.FirstBatch, append(bson.D{{Key: "_id", Value: sessionID}}, tt.session...))
+			}
+			mt.AddMockResponses(mtest.CreateCursorResponse(0, "kdi.users", mtest.FirstBatch, bson.D{{Key: "_id", Value: userID}}), sessions)
+
+			token, err := jwt.NewWithClaims(jwt.SigningMethodHS512, jwt.MapClaims{
+				"sub": userID.Hex(),
+				"sid": sessionID.Hex(),
+				"exp": time.Now().Add(time.Minute).Unix(),
+			}).SignedString([]byte("secret"))
+			if err != nil {
+				mt.Fatal(err)
+			}
+
+			router := gin.New()
+			router.GET("/", func(c *gin.Context) {
+				c.Set("driver", &mongodb.MongoDriver{Client: mt.Client})
+			}, AuthMiddleware(oidc.NewProviders()), func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{}) })
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.status {
+				mt.Errorf("status = %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package middlewares
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kuro-jojo/kdi-web/db/mongodb"
+	"github.com/kuro-jojo/kdi-web/oidc"
+	"github.com/lestrrat-go/jwx/jwk"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// newOIDCProvider serves the metadata and the key of a provider and returns a token of the subject with the email
+func newOIDCProvider(t *testing.T) (*oidc.Providers, func(subject string, email string) string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/keys" {
+			public, _ := jwk.New(&key.PublicKey)
+			public.Set(jwk.KeyIDKey, "key")
+			set := jwk.NewSet()
+			set.Add(public)
+			json.NewEncoder(w).Encode(set)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"issuer": server.URL, "jwks_uri": server.URL + "/keys"})
+	}))
+	t.Cleanup(server.Close)
+
+	providers := oidc.NewProviders(oidc.Config{Name: "keycloak", Issuer: server.URL, ClientID: "kdi"})
+	return providers, func(subject string, email string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss":            server.URL,
+			"aud":            "kdi",
+			"sub":            subject,
+			"exp":            time.Now().Add(time.Hour).Unix(),
+			"email":          email,
+			"email_verified": true,
+		})
+		token.Header["kid"] = "key"
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+}
+
+func TestOIDCAccountsAreLinkedBySubject(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mongodb.DbName = "kdi"
+	providers, sign := newOIDCProvider(t)
+	userID := primitive.NewObjectID()
+	identity := func(subject string) bson.A {
+		return bson.A{bson.D{{Key: "provider", Value: "keycloak"}, {Key: "subject", Value: subject}}}
+	}
+	noUser := mtest.CreateCursorResponse(0, "kdi.users", mtest.FirstBatch)
+	updated := mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1})
+
+	tests := []struct {
+		name      string
+		responses []bson.D
+		status    int
+		commands  string
+	}{
+		{"linked account", []bson.D{
+			mtest.CreateCursorResponse(0, "kdi.users", mtest.FirstBatch, bson.D{{Key: "_id", Value: userID}, {Key: "email", Value: "old@example.com"}, {Key: "identities", Value: identity("sub-1")}}),
+		}, http.StatusOK, "find"},
+		{"existing user linked by email", []bson.D{
+			noUser,
+			mtest.CreateCursorResponse(0, "kdi.users", mtest.FirstBatch, bson.D{{Key: "_id", Value: userID}, {Key: "email", Value: "user@example.com"}, {Key: "email_verified", Value: true}}),
+			updated,
+		}, http.StatusOK, "find,find,update"},
+		// the email may have been registered by someone else to take over the account of the provider
+		{"existing user with an unverified email", []bson.D{
+			noUser,
+			mtest.CreateCursorResponse(0, "kdi.users", mtest.FirstBatch, bson.D{{Key: "_id", Value: userID}, {Key: "email", Value: "user@example.com"}, {Key: "password", Value: "hash"}, {Key: "email_verified", Value: false}}),
+		}, http.StatusForbidden, "find,find"},
+		{"email of another account of the provider", []bson.D{
+			noUser,
+			mtest.CreateCursorResponse(0, "kdi.users", mtest.FirstBatch, bson.D{{Key: "_id", Value: userID}, {Key: "email", Value: "user@example.com"}, {Key: "email_verified", Value: true}, {Key: "identities", Value: identity("sub-2")}}),
+		}, http.StatusUnauthorized, "find,find"},
+		{"new user", []bson.D{noUser, noUser, mtest.CreateSuccessResponse()}, http.StatusOK, "find,find,insert"},
+	}
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			mt.AddMockResponses(tt.responses...)
+			router := gin.New()
+			router.GET("/", func(c *gin.Context) {
+				c.Set("driver", &mongodb.MongoDriver{Client: mt.Client})
+			}, AuthMiddleware(providers), func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{}) })
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", "Bearer "+sign("sub-1", "user@example.com"))
+			req.Header.Set("auth-method", "oidc")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.status {
+				mt.Errorf("status = %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+
+			var commands []string
+			for _, event := range mt.GetAllStartedEvents() {
+				commands = append(commands, event.CommandName)
+			}
+			if got := strings.Join(commands, ","); got != tt.commands {
+				mt.Errorf("commands = %s, want %s", got, tt.commands)
+			}
+		})
+	}
+}
@@ -0,0 +1,227 @@
+package middlewares
+
+// This file restricts the requests authenticated with a personal access token to the teamspaces and the roles of the token
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kuro-jojo/kdi-k8s/shared/logging"
+	"github.com/kuro-jojo/kdi-web/db"
+	"github.com/kuro-jojo/kdi-web/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// teamspacesOf returns the IDs of the teamspaces the resource with the ID belongs to
+type teamspacesOf func(driver db.Driver, id primitive.ObjectID) ([]string, error)
+
+// The scopes are only checked for the requests authenticated with a personal access token.
+// A scope without roles only checks the teamspace of the reads, a scope with roles is needed by the routes changing a resource.
+
+// TeamspaceScope checks that the token gives access to the teamspace of the param
+func TeamspaceScope(param string, writeRoles ...string) gin.HandlerFunc {
+	return tokenScope(param, func(driver db.Driver, id primitive.ObjectID) ([]string, error) {
+		return []string{id.Hex()}, nil
+	}, writeRoles)
+}
+
+// ProjectScope checks that the token gives access to the teamspace of the project of the param
+func ProjectScope(param string, writeRoles ...string) gin.HandlerFunc {
+	return tokenScope(param, projectTeamspaces, writeRoles)
+}
+
+// ClusterScope checks that the token gives access to one of the teamspaces of the cluster of the param
+func ClusterScope(param string, writeRoles ...string) gin.HandlerFunc {
+	return tokenScope(param, func(driver db.Driver, id primitive.ObjectID) ([]string, error) {
+		cluster := models.Cluster{ID: id}
+		if err := cluster.Get(driver); err != nil {
+			return nil, err
+		}
+		return cluster.Teamspaces, nil
+	}, writeRoles)
+}
+
+// EnvironmentScope checks that the token gives access to the teamspace of the environment of the param
+func EnvironmentScope(param string, writeRoles ...string) gin.HandlerFunc {
+	return tokenScope(param, func(driver db.Driver, id primitive.ObjectID) ([]string, error) {
+		environment := models.Environment{ID: id}
+		if err := environment.Get(driver); err != nil {
+			return nil, err
+		}
+		projectID, err := primitive.ObjectIDFromHex(environment.ProjectID)
+		if err != nil {
+			return nil, err
+		}
+		return projectTeamspaces(driver, projectID)
+	}, writeRoles)
+}
+
+// RuleSetScope checks that the token gives access to one of the teamspaces of the environments using the rule set of the param
+func RuleSetScope(param string, writeRoles ...string) gin.HandlerFunc {
+	return tokenScope(param, func(driver db.Driver, id primitive.ObjectID) ([]string, error) {
+		environment := models.Environment{RuleSetID: id.Hex()}
+		environments, err := environment.GetAllByRuleSet(driver)
+		if err != nil {
+			return nil, err
+		}
+		var teamspaces []string
+		for _, e := range environments {
+			projectID, err := primitive.ObjectIDFromHex(e.ProjectID)
+			if err != nil {
+				return nil, err
+			}
+			ids, err := projectTeamspaces(driver, projectID)
+			if err != nil {
+				return nil, err
+			}
+			teamspaces = append(teamspaces, ids...)
+		}
+		return teamspaces, nil
+	}, writeRoles)
+}
+
+func projectTeamspaces(driver db.Driver, id primitive.ObjectID) ([]string, error) {
+	project := models.Project{ID: id}
+	if err := project.Get(driver); err != nil {
+		return nil, err
+	}
+	return []string{project.TeamspaceID}, nil
+}
+
+// writeRoutes are the routes changing a resource registered with a scope with roles by WriteRoute, by method and path
+var writeRoutes = map[string]bool{}
+
+// WriteRoute registers on the group a route changing a resource, with the scope with roles checking the access tokens.
+// AccessTokenWrites only lets the tokens use the routes changing a resource registered this way.
+func WriteRoute(group *gin.RouterGroup, method, relativePath string, scope, handler gin.HandlerFunc) {
+	writeRoutes[method+" "+joinPaths(group.BasePath(), relativePath)] = true
+	group.Handle(method, relativePath, scope, handler)
+}
+
+// AccessTokenWrites refuses the requests other than GET authenticated with a personal access token,
+// unless their route was registered with a scope with roles. A route changing a resource is thus never open to the tokens by mistake.
+func AccessTokenWrites() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		u, _ := c.Get("user")
+		user, _ := u.(models.User)
+		if user.AccessToken != nil && c.Request.Method != http.MethodGet && !writeRoutes[c.Request.Method+" "+c.FullPath()] {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "The access token cannot be used for this request"})
+			return
+		}
+		c.Next()
+	}
+}
+
+func tokenScope(param string, teamspaces teamspacesOf, writeRoles []string) gin.HandlerFunc {
+	if len(writeRoles) > 0 {
+		return writeScope(param, teamspaces, writeRoles)
+	}
+	return readScope(param, teamspaces)
+}
+
+// readScope checks that the token of the request gives access to a teamspace of the resource of the param.
+// The routes without the param are not checked, the lists are filtered by the controllers,
+// and the other requests are refused by AccessTokenWrites or checked by a scope with roles.
+func readScope(param string, teamspaces teamspacesOf) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		u, _ := c.Get("user")
+		user, _ := u.(models.User)
+		if user.AccessToken == nil || c.Request.Method != http.MethodGet || c.Param(param) == "" {
+			c.Next()
+			return
+		}
+		checkTokenTeamspace(c, user, c.Param(param), teamspaces, nil)
+	}
+}
+
+// writeScope checks the teamspace like readScope, and for the requests other than GET
+// that both the token and the user, with their current profile in the teamspace, have the roles
+func writeScope(param string, teamspaces teamspacesOf, writeRoles []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		u, _ := c.Get("user")
+		user, _ := u.(models.User)
+		if user.AccessToken == nil {
+			c.Next()
+			return
+		}
+		if c.Request.Method != http.MethodGet {
+			if c.Param(param) == "" {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "The access token cannot be used for this request"})
+				return
+			}
+			if !user.AccessToken.AllowsRoles(writeRoles) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": fmt.Sprintf("The access token does not have the roles %v", writeRoles)})
+				return
+			}
+			checkTokenTeamspace(c, user, c.Param(param), teamspaces, writeRoles)
+			return
+		}
+		checkTokenTeamspace(c, user, c.Param(param), teamspaces, nil)
+	}
+}
+
+// checkTokenTeamspace checks that the token gives access to a teamspace of the resource of the param,
+// in which the user still has the roles since the profiles of the members can change after the token is created
+func checkTokenTeamspace(c *gin.Context, user models.User, param string, teamspaces teamspacesOf, roles []string) {
+	id, err := primitive.ObjectIDFromHex(param)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": "Invalid ID"})
+		return
+	}
+	d, _ := c.Get("driver")
+	driver, _ := d.(db.Driver)
+	ids, err := teamspaces(driver, id)
+	if err != nil {
+		logging.Logger(c).Warn("Error while getting the teamspaces of the user", "error", err)
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "The access token does not give access to this resource"})
+		return
+	}
+	for _, teamspaceID := range ids {
+		if !user.AccessToken.AllowsTeamspace(teamspaceID) {
+			continue
+		}
+		if len(roles) == 0 {
+			c.Next()
+			return
+		}
+		granted, err := userHasRoles(driver, user, teamspaceID, roles)
+		if err != nil {
+			logging.Logger(c).Error("Error while checking the roles of the user in the teamspace", "teamspace_id", teamspaceID, "error", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": "Internal server error"})
+			return
+		}
+		if granted {
+			c.Next()
+			return
+		}
+		logging.Logger(c).Warn("User of the access token no longer has the roles in the teamspace", "teamspace_id", teamspaceID, "roles", roles)
+	}
+	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "The access token does not give access to this resource"})
+}
+
+func userHasRoles(driver db.Driver, user models.User, teamspaceID string, roles []string) (bool, error) {
+	id, err := primitive.ObjectIDFromHex(teamspaceID)
+	if err != nil {
+		return false, nil
+	}
+	teamspace := models.Teamspace{ID: id}
+	if err := teamspace.Get(driver); err != nil {
+		return false, err
+	}
+	return teamspace.GrantsRoles(driver, user.ID.Hex(), roles)
+}
+
+// joinPaths joins the paths like gin does for the full path of a route
+func joinPaths(absolutePath, relativePath string) string {
+	if relativePath == "" {
+		return absolutePath
+	}
+	finalPath := path.Join(absolutePath, relativePath)
+	if strings.HasSuffix(relativePath, "/") && !strings.HasSuffix(finalPath, "/") {
+		return finalPath + "/"
+	}
+	return finalPath
+}
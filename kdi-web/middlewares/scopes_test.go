@@ -0,0 +1,174 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kuro-jojo/kdi-web/db"
+	"github.com/kuro-jojo/kdi-web/db/mongodb"
+	"github.com/kuro-jojo/kdi-web/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+var (
+	teamspaceA = primitive.NewObjectID().Hex()
+	teamspaceB = primitive.NewObjectID().Hex()
+	tokenUser  = primitive.NewObjectID()
+)
+
+// newScopedRouter returns routes like the ones of the server, the requests are authenticated with the token
+func newScopedRouter(driver db.Driver, token *models.AccessToken) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	ok := func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{}) }
+
+	group := router.Group("teamspaces", func(c *gin.Context) {
+		c.Set("driver", driver)
+		c.Set("user", models.User{ID: tokenUser, AccessToken: token})
+	}, AccessTokenWrites(), TeamspaceScope("id"))
+	group.POST("", ok)
+	group.GET(":id", ok)
+	group.PATCH(":id", ok)
+	WriteRoute(group, http.MethodPatch, ":id/members", TeamspaceScope("id", models.AddMemberRole), ok)
+	WriteRoute(group, http.MethodDelete, ":id/members/:memberId", TeamspaceScope("id", models.RemoveMemberRole), ok)
+	return router
+}
+
+// teamspaceResponse is the teamspace with its creator found by the scope with roles
+func teamspaceResponse(id, creatorID string) bson.D {
+	return mtest.CreateCursorResponse(0, "kdi.teamspaces", mtest.FirstBatch, bson.D{
+		{Key: "_id", Value: mustObjectID(id)},
+		{Key: "creator_id", Value: creatorID},
+	})
+}
+
+func mustObjectID(hex string) primitive.ObjectID {
+	id, _ := primitive.ObjectIDFromHex(hex)
+	return id
+}
+
+func TestTokenScopes(t *testing.T) {
+	mongodb.DbName = "kdi"
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	readOnly := &models.AccessToken{Teamspaces: []string{teamspaceA}, Roles: []string{models.ViewProjectRole}}
+	members := &models.AccessToken{Teamspaces: []string{teamspaceA}, Roles: []string{models.AddMemberRole, models.RemoveMemberRole}}
+
+	tests := []struct {
+		name   string
+		token  *models.AccessToken
+		method string
+		path   string
+		status int
+	}{
+		{"read in scope", readOnly, http.MethodGet, "/teamspaces/" + teamspaceA, http.StatusOK},
+		{"read out of scope", readOnly, http.MethodGet, "/teamspaces/" + teamspaceB, http.StatusForbidden},
+		{"read-only token on PATCH", readOnly, http.MethodPatch, "/teamspaces/" + teamspaceA + "/members", http.StatusForbidden},
+		{"read-only token on DELETE", readOnly, http.MethodDelete, "/teamspaces/" + teamspaceA + "/members/m", http.StatusForbidden},
+		{"write with the roles", members, http.MethodPatch, "/teamspaces/" + teamspaceA + "/members", http.StatusOK},
+		{"write with the roles out of scope", members, http.MethodDelete, "/teamspaces/" + teamspaceB + "/members/m", http.StatusForbidden},
+		{"write without a scope with roles", members, http.MethodPatch, "/teamspaces/" + teamspaceA, http.StatusForbidden},
+		{"unscoped POST", members, http.MethodPost, "/teamspaces", http.StatusForbidden},
+		{"unscoped POST without token", nil, http.MethodPost, "/teamspaces", http.StatusOK},
+		{"write without token", nil, http.MethodPatch, "/teamspaces/" + teamspaceB, http.StatusOK},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			mt.AddMockResponses(teamspaceResponse(teamspaceA, tokenUser.Hex()))
+			w := httptest.NewRecorder()
+			newScopedRouter(&mongodb.MongoDriver{Client: mt.Client}, tt.token).ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+			if w.Code != tt.status {
+				t.Errorf("%s %s = %d, want %d: %s", tt.method, tt.path, w.Code, tt.status, w.Body.String())
+			}
+		})
+	}
+}
+
+// The roles of the token are not enough when the profile of the user in the teamspace no longer has them
+func TestTokenScopesCurrentRoles(t *testing.T) {
+	mongodb.DbName = "kdi"
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	token := &models.AccessToken{Teamspaces: []string{teamspaceA}, Roles: []string{models.AddMemberRole}}
+	path := "/teamspaces/" + teamspaceA + "/members"
+
+	mt.Run("member with the roles", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			teamspaceResponse(teamspaceA, primitive.NewObjectID().Hex()),
+			mtest.CreateCursorResponse(0, "kdi.profiles", mtest.FirstBatch, bson.D{{Key: "name", Value: "admin"}}),
+			teamspaceResponse(teamspaceA, primitive.NewObjectID().Hex()),
+		)
+		w := httptest.NewRecorder()
+		newScopedRouter(&mongodb.MongoDriver{Client: mt.Client}, token).ServeHTTP(w, httptest.NewRequest(http.MethodPatch, path, nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("PATCH %s = %d, want %d: %s", path, w.Code, http.StatusOK, w.Body.String())
+		}
+	})
+
+	mt.Run("member without the roles anymore", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			teamspaceResponse(teamspaceA, primitive.NewObjectID().Hex()),
+			mtest.CreateCursorResponse(0, "kdi.profiles", mtest.FirstBatch, bson.D{{Key: "name", Value: "admin"}}),
+			mtest.CreateCursorResponse(0, "kdi.teamspaces", mtest.FirstBatch),
+		)
+		w := httptest.NewRecorder()
+		newScopedRouter(&mongodb.MongoDriver{Client: mt.Client}, token).ServeHTTP(w, httptest.NewRequest(http.MethodPatch, path, nil))
+		if w.Code != http.StatusForbidden {
+			t.Errorf("PATCH %s = %d, want %d: %s", path, w.Code, http.StatusForbidden, w.Body.String())
+		}
+		// the teamspace, the profiles with the roles, then the member with one of these profiles
+		mt.GetStartedEvent()
+		mt.GetStartedEvent()
+		filter := mt.GetStartedEvent().Command.Lookup("filter")
+		if _, err := filter.Document().LookupErr("members", "$elemMatch", "user_id"); err != nil {
+			t.Errorf("filter = %v, want the member with a profile having the roles", filter)
+		}
+	})
+}
+
+// A rule set is in the scope of the token when one of the environments using it is in a teamspace of the token
+func TestRuleSetScope(t *testing.T) {
+	mongodb.DbName = "kdi"
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	token := &models.AccessToken{Teamspaces: []string{teamspaceA}, Roles: []string{models.ViewProjectRole}}
+	ruleSetID := primitive.NewObjectID().Hex()
+
+	tests := []struct {
+		name      string
+		teamspace string
+		status    int
+	}{
+		{"used in the teamspace of the token", teamspaceA, http.StatusOK},
+		{"used in another teamspace", teamspaceB, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			projectID := primitive.NewObjectID()
+			mt.AddMockResponses(
+				mtest.CreateCursorResponse(0, "kdi.environments", mtest.FirstBatch, bson.D{
+					{Key: "_id", Value: primitive.NewObjectID()},
+					{Key: "project_id", Value: projectID.Hex()},
+					{Key: "rule_set_id", Value: ruleSetID},
+				}),
+				mtest.CreateCursorResponse(0, "kdi.projects", mtest.FirstBatch, bson.D{
+					{Key: "_id", Value: projectID},
+					{Key: "teamspace_id", Value: tt.teamspace},
+				}),
+			)
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.GET("rulesets/:rs_id", func(c *gin.Context) {
+				c.Set("driver", &mongodb.MongoDriver{Client: mt.Client})
+				c.Set("user", models.User{ID: tokenUser, AccessToken: token})
+			}, RuleSetScope("rs_id"), func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{}) })
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/rulesets/"+ruleSetID, nil))
+			if w.Code != tt.status {
+				t.Errorf("GET rule set %s = %d, want %d: %s", tt.name, w.Code, tt.status, w.Body.String())
+			}
+		})
+	}
+}
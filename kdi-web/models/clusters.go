@@ -29,6 +29,13 @@ type Cluster struct {
 	Port        string             `bson:"port,omitempty"`
 	Token       string             `bson:"token,omitempty"`
 
+	// tls fields (on-premise clusters)
+	CAData         string `bson:"ca_data,omitempty"`          // PEM encoded CA bundle used to verify the API server
+	TLSServerName  string `bson:"tls_server_name,omitempty"`  // server name used for the certificate verification
+	ClientCertData string `bson:"client_cert_data,omitempty"` // PEM encoded client certificate
+	ClientKeyData  string `bson:"client_key_data,omitempty"`  // PEM encoded client key
+	Insecure       bool   `bson:"insecure"`                   // skip the certificate verification (explicit opt-in)
+
 	// aws eks fields
 	Region      string `bson:"region,omitempty"`
 	AccessKeyID string `bson:"access_key_id,omitempty"`
@@ -38,13 +45,16 @@ type Cluster struct {
 	Teamspaces []string  `bson:"teamspaces,omitempty"` // teamspaces that have access to this cluster (ids)
 	ExpiryDate time.Time `bson:"expiry_date,omitempty"`
 	CreatedAt  time.Time `bson:"created_at,omitempty"`
+
+	Inventory *ClusterInventory `bson:"inventory,omitempty"` // Cached description of the cluster
 }
 
 func (c *Cluster) Add(driver db.Driver) error {
-	_, err := driver.GetCollection(ClustersColletion).InsertOne(context.Background(), c)
+	r, err := driver.GetCollection(ClustersColletion).InsertOne(context.Background(), c)
 	if err != nil {
 		return fmt.Errorf("%v", err)
 	}
+	c.ID = r.InsertedID.(primitive.ObjectID)
 	return nil
 }
 
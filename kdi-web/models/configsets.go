@@ -0,0 +1,134 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kuro-jojo/kdi-web/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	ConfigSetsCollection = "config_sets"
+
+	// Kinds of config sets
+	ConfigMapKind = "ConfigMap"
+	SecretKind    = "Secret"
+)
+
+// ConfigSet is a configmap or a secret of an environment that can be attached to its microservices.
+// The values of a secret are only sent to the cluster, only its keys are saved.
+type ConfigSet struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty"`
+	Name          string             `bson:"name"`
+	Kind          string             `bson:"kind"` // ConfigMap or Secret
+	Namespace     string             `bson:"namespace"`
+	EnvironmentID string             `bson:"environment_id"`
+	CreatorID     string             `bson:"creator_id"`
+
+	Data map[string]string `bson:"data"` // The values of a configmap
+	Keys []string          `bson:"keys"`
+
+	MicroserviceIDs []string `bson:"microservice_ids"` // The microservices consuming the config set
+
+	CreatedAt time.Time `bson:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at"`
+}
+
+// IsSecret returns true if the config set is a secret
+func (cs *ConfigSet) IsSecret() bool {
+	return cs.Kind == SecretKind
+}
+
+func (cs *ConfigSet) Create(driver db.Driver) error {
+	cs.CreatedAt = time.Now()
+	cs.UpdatedAt = cs.CreatedAt
+	if cs.MicroserviceIDs == nil {
+		cs.MicroserviceIDs = []string{}
+	}
+	r, err := driver.GetCollection(ConfigSetsCollection).InsertOne(context.Background(), cs)
+	if err != nil {
+		return fmt.Errorf("%v", err)
+	}
+	cs.ID = r.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (cs *ConfigSet) Update(driver db.Driver) error {
+	cs.UpdatedAt = time.Now()
+	_, err := driver.GetCollection(ConfigSetsCollection).UpdateByID(context.Background(), cs.ID, bson.D{{Key: "$set", Value: cs}})
+	if err != nil {
+		return fmt.Errorf("%v", err)
+	}
+	return nil
+}
+
+func (cs *ConfigSet) Delete(driver db.Driver) error {
+	r, err := driver.GetCollection(ConfigSetsCollection).DeleteOne(context.TODO(), bson.M{"_id": cs.ID})
+	if err != nil {
+		return fmt.Errorf("failed to delete config set: %v", err)
+	}
+	if r.DeletedCount == 0 {
+		return fmt.Errorf("ID %s not found", cs.ID)
+	}
+	return nil
+}
+
+func (cs *ConfigSet) Get(driver db.Driver) error {
+	filter := bson.D{{Key: "_id", Value: cs.ID}}
+	err := driver.GetCollection(ConfigSetsCollection).FindOne(context.TODO(), filter).Decode(cs)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return fmt.Errorf("ID %s not found", cs.ID)
+		}
+		return fmt.Errorf("%v", err)
+	}
+	return nil
+}
+
+// AttachMicroservice adds the microservice to the consumers of the config set
+func (cs *ConfigSet) AttachMicroservice(driver db.Driver, microserviceID string) error {
+	update := bson.D{
+		{Key: "$addToSet", Value: bson.D{{Key: "microservice_ids", Value: microserviceID}}},
+		{Key: "$set", Value: bson.D{{Key: "updated_at", Value: time.Now()}}},
+	}
+	_, err := driver.GetCollection(ConfigSetsCollection).UpdateByID(context.Background(), cs.ID, update)
+	if err != nil {
+		return fmt.Errorf("%v", err)
+	}
+	return nil
+}
+
+// DetachMicroservice removes the microservice from the consumers of the config set
+func (cs *ConfigSet) DetachMicroservice(driver db.Driver, microserviceID string) error {
+	update := bson.D{
+		{Key: "$pull", Value: bson.D{{Key: "microservice_ids", Value: microserviceID}}},
+		{Key: "$set", Value: bson.D{{Key: "updated_at", Value: time.Now()}}},
+	}
+	_, err := driver.GetCollection(ConfigSetsCollection).UpdateByID(context.Background(), cs.ID, update)
+	if err != nil {
+		return fmt.Errorf("%v", err)
+	}
+	return nil
+}
+
+// GetAllByEnvironment retrieves the config sets of an environment
+func (cs *ConfigSet) GetAllByEnvironment(driver db.Driver) ([]ConfigSet, error) {
+	filter := bson.D{{Key: "environment_id", Value: cs.EnvironmentID}}
+	return cs.GetAllBy(filter, driver)
+}
+
+func (cs *ConfigSet) GetAllBy(filter bson.D, driver db.Driver) ([]ConfigSet, error) {
+	cursor, err := driver.GetCollection(ConfigSetsCollection).Find(context.TODO(), filter)
+	if err != nil {
+		return nil, fmt.Errorf("%v", err)
+	}
+	var configSets []ConfigSet
+	if err = cursor.All(context.Background(), &configSets); err != nil {
+		return nil, fmt.Errorf("%v", err)
+	}
+	return configSets, nil
+}
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/kuro-jojo/kdi-web/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	EmailTokensCollection = "email_tokens"
+
+	// The purposes of the tokens sent by email
+	VerifyEmailPurpose   = "verify_email"
+	ResetPasswordPurpose = "reset_password"
+)
+
+// EmailToken is a token sent by email to a user, to verify its email address or to reset its password.
+// It can only be used once before it expires, and only its hash is saved.
+type EmailToken struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	UserID    string             `bson:"user_id"`
+	Purpose   string             `bson:"purpose"`
+	Hash      string             `bson:"hash" json:"-"`
+	CreatedAt time.Time          `bson:"created_at"`
+	ExpiresAt time.Time          `bson:"expires_at"`
+	UsedAt    time.Time          `bson:"used_at,omitempty"`
+}
+
+// GenerateEmailToken returns a new random token, to be sent in a link
+func GenerateEmailToken() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("error generating token: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// Create saves the token, the unused tokens of the user for the same purpose are removed as it replaces them
+func (t *EmailToken) Create(driver db.Driver) error {
+	filter := bson.D{
+		{Key: "user_id", Value: t.UserID},
+		{Key: "purpose", Value: t.Purpose},
+		{Key: "used_at", Value: bson.D{{Key: "$exists", Value: false}}},
+	}
+	_, err := driver.GetCollection(EmailTokensCollection).DeleteMany(context.Background(), filter)
+	if err != nil {
+		return fmt.Errorf("%v", err)
+	}
+
+	t.CreatedAt = time.Now()
+	r, err := driver.GetCollection(EmailTokensCollection).InsertOne(context.Background(), t)
+	if err != nil {
+		return fmt.Errorf("%v", err)
+	}
+	t.ID = r.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// Consume marks the token with the hash as used and retrieves it.
+// It fails if the token does not exist, was already used or is expired.
+func (t *EmailToken) Consume(driver db.Driver) error {
+	filter := bson.D{
+		{Key: "hash", Value: t.Hash},
+		{Key: "purpose", Value: t.Purpose},
+		{Key: "used_at", Value: bson.D{{Key: "$exists", Value: false}}},
+		{Key: "expires_at", Value: bson.D{{Key: "$gt", Value: time.Now()}}},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "used_at", Value: time.Now()}}}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := driver.GetCollection(EmailTokensCollection).FindOneAndUpdate(context.Background(), filter, update, opts).Decode(t)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return fmt.Errorf("token not found")
+		}
+		return fmt.Errorf("%v", err)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kuro-jojo/kdi-web/db/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestEmailTokenConsume(t *testing.T) {
+	mongodb.DbName = "kdi"
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("unused token", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: bson.D{
+			{Key: "_id", Value: primitive.NewObjectID()},
+			{Key: "user_id", Value: "user"},
+			{Key: "purpose", Value: ResetPasswordPurpose},
+			{Key: "used_at", Value: time.Now()},
+		}}))
+		token := EmailToken{Hash: HashToken("secret"), Purpose: ResetPasswordPurpose}
+		if err := token.Consume(&mongodb.MongoDriver{Client: mt.Client}); err != nil {
+			t.Fatalf("Consume: %v", err)
+		}
+		if token.UserID != "user" || token.UsedAt.IsZero() {
+			t.Errorf("token = %+v", token)
+		}
+
+		// only an unused and unexpired token of the purpose is marked as used
+		query := mt.GetStartedEvent().Command.Lookup("query").Document()
+		if purpose := query.Lookup("purpose").StringValue(); purpose != ResetPasswordPurpose {
+			t.Errorf("purpose = %q", purpose)
+		}
+		if exists := query.Lookup("used_at", "$exists").Boolean(); exists {
+			t.Error("a used token can be consumed")
+		}
+		if _, err := query.LookupErr("expires_at", "$gt"); err != nil {
+			t.Error("an expired token can be consumed")
+		}
+	})
+
+	mt.Run("used, expired or unknown token", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil}))
+		token := EmailToken{Hash: HashToken("secret"), Purpose: VerifyEmailPurpose}
+		err := token.Consume(&mongodb.MongoDriver{Client: mt.Client})
+		if err == nil || err.Error() != "token not found" {
+			t.Errorf("err = %v, want token not found", err)
+		}
+	})
+}
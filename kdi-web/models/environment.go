@@ -20,6 +20,8 @@ type Environment struct {
 	Description string             `bson:"description"`
 	ProjectID   string             `bson:"project_id"`
 	ClusterID   string             `bson:"cluster_id"`
+	RuleSetID   string             `bson:"rule_set_id,omitempty"` // The policy rules checked on the manifests deployed in the environment
+	Variables   map[string]string  `bson:"variables,omitempty"`   // The values of the ${VAR} placeholders of the manifests deployed in the environment
 }
 
 func (e *Environment) Create(driver db.Driver) error {
@@ -39,6 +41,43 @@ func (e *Environment) Update(driver db.Driver) error {
 	return nil
 }
 
+// SetRuleSet attaches the rule set to the environment, an empty ID detaches the current one
+func (e *Environment) SetRuleSet(driver db.Driver, ruleSetID string) error {
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "rule_set_id", Value: ruleSetID}}}}
+	if ruleSetID == "" {
+		update = bson.D{{Key: "$unset", Value: bson.D{{Key: "rule_set_id", Value: ""}}}}
+	}
+	_, err := driver.GetCollection(EnvironmentsCollection).UpdateByID(context.Background(), e.ID, update)
+	if err != nil {
+		return fmt.Errorf("%v", err)
+	}
+	e.RuleSetID = ruleSetID
+	return nil
+}
+
+// SetVariables replaces the variables of the environment
+func (e *Environment) SetVariables(driver db.Driver, variables map[string]string) error {
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "variables", Value: variables}}}}
+	if len(variables) == 0 {
+		update = bson.D{{Key: "$unset", Value: bson.D{{Key: "variables", Value: ""}}}}
+	}
+	_, err := driver.GetCollection(EnvironmentsCollection).UpdateByID(context.Background(), e.ID, update)
+	if err != nil {
+		return fmt.Errorf("%v", err)
+	}
+	e.Variables = variables
+	return nil
+}
+
+// CountByRuleSet returns the number of environments using the rule set
+func (e *Environment) CountByRuleSet(driver db.Driver, ruleSetID string) (int64, error) {
+	count, err := driver.GetCollection(EnvironmentsCollection).CountDocuments(context.Background(), bson.D{{Key: "rule_set_id", Value: ruleSetID}})
+	if err != nil {
+		return 0, fmt.Errorf("%v", err)
+	}
+	return count, nil
+}
+
 func (e *Environment) Delete(driver db.Driver) error {
 	r, err := driver.GetCollection(EnvironmentsCollection).DeleteOne(context.TODO(), bson.M{"_id": e.ID})
 	if err != nil {
@@ -64,6 +103,12 @@ func (e *Environment) Get(driver db.Driver) error {
 	return nil
 }
 
+// GetAllByRuleSet retrieves all environments using the rule set
+func (e *Environment) GetAllByRuleSet(driver db.Driver) ([]Environment, error) {
+	filter := bson.D{{Key: "rule_set_id", Value: e.RuleSetID}}
+	return e.GetAllBy(filter, driver)
+}
+
 // GetAllByCluster retrieves all environments in a cluster
 func (e *Environment) GetAllByCluster(driver db.Driver) ([]Environment, error) {
 	filter := bson.D{{Key: "cluster_id", Value: e.ClusterID}}
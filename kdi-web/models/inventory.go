@@ -0,0 +1,100 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kuro-jojo/kdi-web/db"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ClusterInventory is the description of a cluster returned by the kubernetes api.
+// It is cached on the cluster and refreshed periodically.
+type ClusterInventory struct {
+	ServerVersion  string            `bson:"server_version"`
+	Platform       string            `bson:"platform"`
+	Nodes          []NodeInventory   `bson:"nodes"`
+	StorageClasses []StorageClass    `bson:"storage_classes"`
+	IngressClasses []IngressClass    `bson:"ingress_classes"`
+	CRDs           []CRD             `bson:"crds"`
+	Errors         map[string]string `bson:"errors,omitempty"` // The parts of the inventory that could not be read
+	CollectedAt    time.Time         `bson:"collected_at"`
+}
+
+type NodeCondition struct {
+	Type    string `bson:"type"`
+	Status  string `bson:"status"`
+	Reason  string `bson:"reason"`
+	Message string `bson:"message"`
+}
+
+// NodeResources are the resources of a node, the cpu is in millicores and the memory in bytes
+type NodeResources struct {
+	CPU    int64 `bson:"cpu"`
+	Memory int64 `bson:"memory"`
+	Pods   int64 `bson:"pods"`
+}
+
+// NodeAllocation is the sum of the requests and limits of the pods running on a node
+type NodeAllocation struct {
+	CPURequests    int64 `bson:"cpu_requests"`
+	CPULimits      int64 `bson:"cpu_limits"`
+	MemoryRequests int64 `bson:"memory_requests"`
+	MemoryLimits   int64 `bson:"memory_limits"`
+	Pods           int64 `bson:"pods"`
+}
+
+type NodeInventory struct {
+	Name             string          `bson:"name"`
+	Roles            []string        `bson:"roles"`
+	KubeletVersion   string          `bson:"kubelet_version"`
+	OSImage          string          `bson:"os_image"`
+	ContainerRuntime string          `bson:"container_runtime"`
+	Architecture     string          `bson:"architecture"`
+	Unschedulable    bool            `bson:"unschedulable"`
+	Allocatable      NodeResources   `bson:"allocatable"`
+	Allocated        NodeAllocation  `bson:"allocated"`
+	Conditions       []NodeCondition `bson:"conditions"`
+	CreatedAt        time.Time       `bson:"created_at"`
+}
+
+type StorageClass struct {
+	Name                 string `bson:"name"`
+	Provisioner          string `bson:"provisioner"`
+	ReclaimPolicy        string `bson:"reclaim_policy"`
+	VolumeBindingMode    string `bson:"volume_binding_mode"`
+	AllowVolumeExpansion bool   `bson:"allow_volume_expansion"`
+	Default              bool   `bson:"default"`
+}
+
+type IngressClass struct {
+	Name       string `bson:"name"`
+	Controller string `bson:"controller"`
+	Default    bool   `bson:"default"`
+}
+
+// CRD is a custom resource definition installed on the cluster
+type CRD struct {
+	Name     string   `bson:"name"`
+	Group    string   `bson:"group"`
+	Kind     string   `bson:"kind"`
+	Scope    string   `bson:"scope"`
+	Versions []string `bson:"versions"`
+}
+
+// SetInventory saves the inventory of the cluster without touching its other fields
+func (c *Cluster) SetInventory(driver db.Driver, inventory ClusterInventory) error {
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "inventory", Value: inventory}}}}
+	_, err := driver.GetCollection(ClustersColletion).UpdateByID(context.Background(), c.ID, update)
+	if err != nil {
+		return fmt.Errorf("%v", err)
+	}
+	c.Inventory = &inventory
+	return nil
+}
+
+// GetAll returns all the clusters, used by the background tasks
+func (c *Cluster) GetAll(driver db.Driver) ([]Cluster, error) {
+	return c.GetAllBy(bson.D{}, driver)
+}
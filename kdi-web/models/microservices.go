@@ -20,6 +20,12 @@ const (
 	ABTestingStrategy     = "ab-testing"
 	CanaryStrategy        = "canary"
 	BlueGreenStrategy     = "blue-green"
+
+	// Kinds of workloads a microservice can represent
+	DeploymentKind  = "Deployment"
+	StatefulSetKind = "StatefulSet"
+	DaemonSetKind   = "DaemonSet"
+	CronJobKind     = "CronJob"
 )
 
 // Conditions represents the conditions of a microservice deployed
@@ -39,6 +45,7 @@ type Conditions struct {
 // Microservice represents a deployed microservice
 type Microservice struct {
 	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	Kind       string             `bson:"kind,omitempty"` // The kind of workload represented, microservices saved without it are deployments
 	Name       string             `bson:"name,omitempty"`
 	Namespace  string             `bson:"namespace,omitempty"`
 	Replicas   int32              `bson:"replicas,omitempty"`
@@ -47,12 +54,25 @@ type Microservice struct {
 	Strategy   string             `bson:"strategy,omitempty"` // The deployment strategy used
 	Containers []Container        `bson:"containers,omitempty"`
 	Conditions []Conditions       `bson:"conditions,omitempty"`
+	Paused     bool               `bson:"paused"` // The rollout of the deployment is paused
 
 	EnvironmentID string    `bson:"environment_id,omitempty"`
 	CreatorID     string    `bson:"creator_id,omitempty"`
 	DeployedAt    time.Time `bson:"deployed_at,omitempty"`
 }
 
+// IsDeployment returns true if the microservice represents a deployment
+func (m *Microservice) IsDeployment() bool {
+	return m.Kind == "" || m.Kind == DeploymentKind
+}
+
+// setDefaultKind sets the kind of the microservices saved before it was recorded, they are all deployments
+func (m *Microservice) setDefaultKind() {
+	if m.Kind == "" {
+		m.Kind = DeploymentKind
+	}
+}
+
 func (m *Microservice) Create(driver db.Driver) error {
 	return utils.Create(m, driver, MicroservicesCollection)
 }
@@ -66,6 +86,7 @@ func (m *Microservice) Get(driver db.Driver) error {
 		}
 		return fmt.Errorf("%v", err)
 	}
+	m.setDefaultKind()
 	return nil
 }
 
@@ -113,5 +134,8 @@ func (p *Microservice) GetAllBy(filter bson.D, driver db.Driver) ([]Microservice
 	if err = cursor.All(context.Background(), &microservices); err != nil {
 		return nil, fmt.Errorf("%v", err)
 	}
+	for i := range microservices {
+		microservices[i].setDefaultKind()
+	}
 	return microservices, nil
 }
@@ -0,0 +1,237 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kuro-jojo/kdi-web/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	OperationsCollection = "operations"
+
+	// Operation types
+	DeployOperation = "deploy"
+	UpdateOperation = "update"
+
+	// Operation statuses
+	OperationPending   = "pending"
+	OperationRunning   = "running"
+	OperationSucceeded = "succeeded"
+	OperationFailed    = "failed"
+)
+
+// OperationResult is the outcome of an operation for a single kubernetes object
+type OperationResult struct {
+	Object  string `bson:"object"`
+	Status  string `bson:"status"` // succeeded or failed
+	Message string `bson:"message,omitempty"`
+	Reason  string `bson:"reason,omitempty"` // The reason code returned by the kubernetes api
+
+	Violations []PolicyViolation `bson:"violations,omitempty"` // The policy rules not respected by the object
+}
+
+// Operation is a deployment operation executed asynchronously on a cluster
+type Operation struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty"`
+	Type           string             `bson:"type"`
+	Status         string             `bson:"status"`
+	EnvironmentID  string             `bson:"environment_id"`
+	ClusterID      string             `bson:"cluster_id"`
+	MicroserviceID string             `bson:"microservice_id,omitempty"`
+	CreatorID      string             `bson:"creator_id"`
+	RequestID      string             `bson:"request_id,omitempty"` // The id of the request that created the operation, forwarded to the kubernetes api
+
+	// The request forwarded to the kubernetes api. It is kept until the operation is finished so it can be resumed.
+	Payload     []byte `bson:"payload,omitempty" json:"-"`
+	ContentType string `bson:"content_type,omitempty" json:"-"`
+
+	Results       []OperationResult   `bson:"results"`
+	Messages      map[string][]string `bson:"messages,omitempty"`
+	Microservices []Microservice      `bson:"microservices,omitempty"`
+	Error         string              `bson:"error,omitempty"`
+
+	CreatedAt  time.Time `bson:"created_at"`
+	UpdatedAt  time.Time `bson:"updated_at"`
+	StartedAt  time.Time `bson:"started_at,omitempty"`
+	FinishedAt time.Time `bson:"finished_at,omitempty"`
+	// The last time the server running the operation reported it alive, the operation is stale once it is too old
+	HeartbeatAt time.Time `bson:"heartbeat_at,omitempty"`
+}
+
+// IsFinished returns true if the operation succeeded or failed
+func (o *Operation) IsFinished() bool {
+	return o.Status == OperationSucceeded || o.Status == OperationFailed
+}
+
+func (o *Operation) Create(driver db.Driver) error {
+	o.Status = OperationPending
+	o.CreatedAt = time.Now()
+	o.UpdatedAt = o.CreatedAt
+	r, err := driver.GetCollection(OperationsCollection).InsertOne(context.Background(), o)
+	if err != nil {
+		return fmt.Errorf("%v", err)
+	}
+	o.ID = r.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (o *Operation) Get(driver db.Driver) error {
+	filter := bson.D{{Key: "_id", Value: o.ID}}
+	err := driver.GetCollection(OperationsCollection).FindOne(context.TODO(), filter).Decode(o)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return fmt.Errorf("ID %s not found", o.ID)
+		}
+		return fmt.Errorf("%v", err)
+	}
+	return nil
+}
+
+// Start marks a pending operation as running.
+// It returns false if the operation was already picked up by another worker.
+func (o *Operation) Start(driver db.Driver) (bool, error) {
+	now := time.Now()
+	filter := bson.D{{Key: "_id", Value: o.ID}, {Key: "status", Value: OperationPending}}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "status", Value: OperationRunning},
+		{Key: "started_at", Value: now},
+		{Key: "updated_at", Value: now},
+		{Key: "heartbeat_at", Value: now},
+	}}}
+	r, err := driver.GetCollection(OperationsCollection).UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		return false, fmt.Errorf("%v", err)
+	}
+	if r.MatchedCount == 0 {
+		return false, nil
+	}
+	o.Status = OperationRunning
+	o.StartedAt = now
+	o.UpdatedAt = now
+	o.HeartbeatAt = now
+	return true, nil
+}
+
+// Heartbeat reports the running operation alive so it is not taken as stale by the other servers
+func (o *Operation) Heartbeat(driver db.Driver) error {
+	filter := bson.D{{Key: "_id", Value: o.ID}, {Key: "status", Value: OperationRunning}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "heartbeat_at", Value: time.Now()}}}}
+	_, err := driver.GetCollection(OperationsCollection).UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		return fmt.Errorf("%v", err)
+	}
+	return nil
+}
+
+// staleFilter matches the running operations not reported alive since before.
+// The operations started before the heartbeats were recorded only have their start time.
+func staleFilter(before time.Time) bson.D {
+	return bson.D{
+		{Key: "status", Value: OperationRunning},
+		{Key: "$or", Value: bson.A{
+			bson.D{{Key: "heartbeat_at", Value: bson.D{{Key: "$lt", Value: before}}}},
+			bson.D{
+				{Key: "heartbeat_at", Value: bson.D{{Key: "$exists", Value: false}}},
+				{Key: "started_at", Value: bson.D{{Key: "$lt", Value: before}}},
+			},
+		}},
+	}
+}
+
+// GetAllStale retrieves the running operations not reported alive since before, oldest first
+func (o *Operation) GetAllStale(driver db.Driver, before time.Time) ([]Operation, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	return o.GetAllBy(staleFilter(before), driver, opts)
+}
+
+// FailIfStale marks the operation as failed with the message if it was not reported alive since before.
+// It returns false if the operation is alive or finished, so a server running it is never overridden.
+func (o *Operation) FailIfStale(driver db.Driver, before time.Time, message string) (bool, error) {
+	now := time.Now()
+	filter := append(bson.D{{Key: "_id", Value: o.ID}}, staleFilter(before)...)
+	update := bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "status", Value: OperationFailed},
+			{Key: "error", Value: message},
+			{Key: "finished_at", Value: now},
+			{Key: "updated_at", Value: now},
+		}},
+		{Key: "$unset", Value: bson.D{{Key: "payload", Value: ""}}},
+	}
+	r, err := driver.GetCollection(OperationsCollection).UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		return false, fmt.Errorf("%v", err)
+	}
+	if r.MatchedCount == 0 {
+		return false, nil
+	}
+	o.Status = OperationFailed
+	o.Error = message
+	o.FinishedAt = now
+	o.UpdatedAt = now
+	o.Payload = nil
+	return true, nil
+}
+
+// Finish stores the outcome of the operation and drops its payload.
+// It returns false if the operation is no longer running, when it was failed as stale meanwhile, so that decision holds.
+func (o *Operation) Finish(driver db.Driver, status string) (bool, error) {
+	now := time.Now()
+	filter := bson.D{{Key: "_id", Value: o.ID}, {Key: "status", Value: OperationRunning}}
+	update := bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "status", Value: status},
+			{Key: "results", Value: o.Results},
+			{Key: "messages", Value: o.Messages},
+			{Key: "microservices", Value: o.Microservices},
+			{Key: "error", Value: o.Error},
+			{Key: "finished_at", Value: now},
+			{Key: "updated_at", Value: now},
+		}},
+		{Key: "$unset", Value: bson.D{{Key: "payload", Value: ""}}},
+	}
+	r, err := driver.GetCollection(OperationsCollection).UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		return false, fmt.Errorf("%v", err)
+	}
+	if r.MatchedCount == 0 {
+		return false, nil
+	}
+	o.Status = status
+	o.FinishedAt = now
+	o.UpdatedAt = now
+	o.Payload = nil
+	return true, nil
+}
+
+// GetAllByEnvironment retrieves the operations of an environment, most recent first
+func (o *Operation) GetAllByEnvironment(driver db.Driver, limit int64) ([]Operation, error) {
+	filter := bson.D{{Key: "environment_id", Value: o.EnvironmentID}}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(limit)
+	return o.GetAllBy(filter, driver, opts)
+}
+
+// GetAllByStatus retrieves the operations with the given status, oldest first
+func (o *Operation) GetAllByStatus(driver db.Driver, status string) ([]Operation, error) {
+	filter := bson.D{{Key: "status", Value: status}}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	return o.GetAllBy(filter, driver, opts)
+}
+
+func (o *Operation) GetAllBy(filter bson.D, driver db.Driver, opts ...*options.FindOptions) ([]Operation, error) {
+	cursor, err := driver.GetCollection(OperationsCollection).Find(context.TODO(), filter, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("%v", err)
+	}
+	var operations []Operation
+	if err = cursor.All(context.Background(), &operations); err != nil {
+		return nil, fmt.Errorf("%v", err)
+	}
+	return operations, nil
+}
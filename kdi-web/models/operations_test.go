@@ -0,0 +1,119 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kuro-jojo/kdi-web/db/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestOperationFailIfStale(t *testing.T) {
+	mongodb.DbName = "kdi"
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	before := time.Now().Add(-2 * time.Minute).Truncate(time.Millisecond)
+
+	mt.Run("stale", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+		operation := Operation{ID: primitive.NewObjectID(), Status: OperationRunning, Payload: []byte("files")}
+		failed, err := operation.FailIfStale(&mongodb.MongoDriver{Client: mt.Client}, before, "lost")
+		if err != nil || !failed {
+			t.Fatalf("FailIfStale() = %v, %v, want the operation failed", failed, err)
+		}
+		if operation.Status != OperationFailed || operation.Error != "lost" || operation.FinishedAt.IsZero() || operation.Payload != nil {
+			t.Errorf("operation = %+v", operation)
+		}
+
+		// only a running operation whose last heartbeat is older than before is failed
+		filter := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("q").Document()
+		if status := filter.Lookup("status").StringValue(); status != OperationRunning {
+			t.Errorf("filter on status = %q, want running", status)
+		}
+		heartbeat := filter.Lookup("$or").Array().Index(0).Value().Document().Lookup("heartbeat_at", "$lt").Time()
+		if !heartbeat.Equal(before) {
+			t.Errorf("filter on heartbeat_at = %v, want before %v", heartbeat, before)
+		}
+	})
+
+	mt.Run("alive or finished", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}, bson.E{Key: "nModified", Value: 0}))
+		operation := Operation{ID: primitive.NewObjectID(), Status: OperationRunning}
+		failed, err := operation.FailIfStale(&mongodb.MongoDriver{Client: mt.Client}, before, "lost")
+		if err != nil || failed {
+			t.Fatalf("FailIfStale() = %v, %v, want the operation left alone", failed, err)
+		}
+		if operation.Status != OperationRunning || operation.Error != "" {
+			t.Errorf("operation = %+v", operation)
+		}
+	})
+}
+
+func TestOperationStartAndHeartbeat(t *testing.T) {
+	mongodb.DbName = "kdi"
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("heartbeats", func(mt *mtest.T) {
+		driver := &mongodb.MongoDriver{Client: mt.Client}
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+		)
+		operation := Operation{ID: primitive.NewObjectID(), Status: OperationPending}
+		started, err := operation.Start(driver)
+		if err != nil || !started {
+			t.Fatalf("Start() = %v, %v", started, err)
+		}
+		if operation.HeartbeatAt.IsZero() || !operation.HeartbeatAt.Equal(operation.StartedAt) {
+			t.Errorf("heartbeat = %v, want the start %v", operation.HeartbeatAt, operation.StartedAt)
+		}
+		mt.GetStartedEvent()
+
+		if err := operation.Heartbeat(driver); err != nil {
+			t.Fatal(err)
+		}
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		if status := update.Lookup("q", "status").StringValue(); status != OperationRunning {
+			t.Errorf("filter on status = %q, want only the running operation reported alive", status)
+		}
+		if _, err := update.LookupErr("u", "$set", "heartbeat_at"); err != nil {
+			t.Errorf("heartbeat_at not set: %v", err)
+		}
+	})
+}
+
+func TestOperationFinish(t *testing.T) {
+	mongodb.DbName = "kdi"
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("running", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+		operation := Operation{ID: primitive.NewObjectID(), Status: OperationRunning, Payload: []byte("files")}
+		finished, err := operation.Finish(&mongodb.MongoDriver{Client: mt.Client}, OperationSucceeded)
+		if err != nil || !finished {
+			t.Fatalf("Finish() = %v, %v, want the operation finished", finished, err)
+		}
+		if operation.Status != OperationSucceeded || operation.FinishedAt.IsZero() || operation.Payload != nil {
+			t.Errorf("operation = %+v", operation)
+		}
+
+		// only the operation still running is finished
+		filter := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("q").Document()
+		if status := filter.Lookup("status").StringValue(); status != OperationRunning {
+			t.Errorf("filter on status = %q, want running", status)
+		}
+	})
+
+	mt.Run("failed as stale meanwhile", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}, bson.E{Key: "nModified", Value: 0}))
+		operation := Operation{ID: primitive.NewObjectID(), Status: OperationRunning}
+		finished, err := operation.Finish(&mongodb.MongoDriver{Client: mt.Client}, OperationSucceeded)
+		if err != nil || finished {
+			t.Fatalf("Finish() = %v, %v, want the failure kept", finished, err)
+		}
+		if operation.Status != OperationRunning {
+			t.Errorf("status = %q, want unchanged", operation.Status)
+		}
+	})
+}
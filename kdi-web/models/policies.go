@@ -0,0 +1,112 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kuro-jojo/kdi-web/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	RuleSetsCollection = "rule_sets"
+
+	// Severities of a policy rule
+	SeverityWarn = "warn"
+	SeverityDeny = "deny"
+
+	// Rules checked by the kubernetes api on the manifests before they are applied
+	DisallowLatestTagRule     = "disallow-latest-tag"
+	RequireResourceLimitsRule = "require-resource-limits"
+	DisallowPrivilegedRule    = "disallow-privileged"
+	AllowedRegistriesRule     = "allowed-registries"
+)
+
+// PolicyRules are the rules known by the kubernetes api
+var PolicyRules = []string{DisallowLatestTagRule, RequireResourceLimitsRule, DisallowPrivilegedRule, AllowedRegistriesRule}
+
+// PolicyRule is a check of the manifests with its severity : a denied manifest is not applied, a warning is only reported
+type PolicyRule struct {
+	ID         string   `bson:"id" json:"id"`
+	Severity   string   `bson:"severity" json:"severity"`
+	Registries []string `bson:"registries,omitempty" json:"registries,omitempty"` // The registries allowed by allowed-registries
+}
+
+// PolicyViolation is a rule not respected by an object of a deployment
+type PolicyViolation struct {
+	Rule      string `bson:"rule" json:"rule"`
+	Severity  string `bson:"severity" json:"severity"`
+	Object    string `bson:"object" json:"object"`
+	Container string `bson:"container,omitempty" json:"container,omitempty"`
+	Message   string `bson:"message" json:"message"`
+}
+
+// RuleSet is a set of policy rules that can be attached to environments
+type RuleSet struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty"`
+	Name        string             `bson:"name"`
+	Description string             `bson:"description"`
+	Rules       []PolicyRule       `bson:"rules"`
+	CreatorID   string             `bson:"creator_id"`
+	CreatedAt   time.Time          `bson:"created_at"`
+	UpdatedAt   time.Time          `bson:"updated_at"`
+}
+
+func (r *RuleSet) Create(driver db.Driver) error {
+	r.CreatedAt = time.Now()
+	r.UpdatedAt = r.CreatedAt
+	result, err := driver.GetCollection(RuleSetsCollection).InsertOne(context.Background(), r)
+	if err != nil {
+		return fmt.Errorf("%v", err)
+	}
+	r.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (r *RuleSet) Update(driver db.Driver) error {
+	r.UpdatedAt = time.Now()
+	_, err := driver.GetCollection(RuleSetsCollection).UpdateByID(context.Background(), r.ID, bson.D{{Key: "$set", Value: r}})
+	if err != nil {
+		return fmt.Errorf("%v", err)
+	}
+	return nil
+}
+
+func (r *RuleSet) Delete(driver db.Driver) error {
+	result, err := driver.GetCollection(RuleSetsCollection).DeleteOne(context.TODO(), bson.M{"_id": r.ID})
+	if err != nil {
+		return fmt.Errorf("failed to delete rule set: %v", err)
+	}
+	if result.DeletedCount == 0 {
+		return fmt.Errorf("ID %s not found", r.ID)
+	}
+	return nil
+}
+
+func (r *RuleSet) Get(driver db.Driver) error {
+	filter := bson.D{{Key: "_id", Value: r.ID}}
+	err := driver.GetCollection(RuleSetsCollection).FindOne(context.TODO(), filter).Decode(r)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return fmt.Errorf("ID %s not found", r.ID)
+		}
+		return fmt.Errorf("%v", err)
+	}
+	return nil
+}
+
+func (r *RuleSet) GetAllByCreator(driver db.Driver) ([]RuleSet, error) {
+	filter := bson.D{{Key: "creator_id", Value: r.CreatorID}}
+	cursor, err := driver.GetCollection(RuleSetsCollection).Find(context.TODO(), filter)
+	if err != nil {
+		return nil, fmt.Errorf("%v", err)
+	}
+	var ruleSets []RuleSet
+	if err = cursor.All(context.Background(), &ruleSets); err != nil {
+		return nil, fmt.Errorf("%v", err)
+	}
+	return ruleSets, nil
+}
@@ -0,0 +1,134 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kuro-jojo/kdi-web/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	SessionsCollection = "sessions"
+)
+
+// Session is the login of a user with a password. Its access tokens are short-lived JWTs,
+// it is extended with a refresh token replaced at each use and it can be revoked.
+type Session struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty"`
+	UserID      string             `bson:"user_id"`
+	RefreshHash string             `bson:"refresh_hash" json:"-"` // The hash of the current refresh token
+	UserAgent   string             `bson:"user_agent,omitempty"`
+	ClientIP    string             `bson:"client_ip,omitempty"`
+
+	CreatedAt   time.Time `bson:"created_at"`
+	RefreshedAt time.Time `bson:"refreshed_at,omitempty"`
+	ExpiresAt   time.Time `bson:"expires_at"` // The refresh token cannot be used after
+	RevokedAt   time.Time `bson:"revoked_at,omitempty"`
+}
+
+// GenerateRefreshToken returns a new random refresh token of the session.
+// It starts with the ID of the session so that the session is found even if the token was already replaced.
+func (s *Session) GenerateRefreshToken() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("error generating token: %v", err)
+	}
+	return s.ID.Hex() + "." + base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// SessionIDFromRefreshToken returns the ID of the session of a refresh token
+func SessionIDFromRefreshToken(token string) (primitive.ObjectID, error) {
+	id, _, found := strings.Cut(token, ".")
+	if !found {
+		return primitive.NilObjectID, fmt.Errorf("invalid refresh token")
+	}
+	return primitive.ObjectIDFromHex(id)
+}
+
+// IsActive returns true if the session is neither revoked nor expired
+func (s *Session) IsActive() bool {
+	return s.RevokedAt.IsZero() && time.Now().Before(s.ExpiresAt)
+}
+
+func (s *Session) Create(driver db.Driver) error {
+	s.CreatedAt = time.Now()
+	if s.ID.IsZero() {
+		s.ID = primitive.NewObjectID()
+	}
+	_, err := driver.GetCollection(SessionsCollection).InsertOne(context.Background(), s)
+	if err != nil {
+		return fmt.Errorf("%v", err)
+	}
+	return nil
+}
+
+func (s *Session) Get(driver db.Driver) error {
+	filter := bson.D{{Key: "_id", Value: s.ID}}
+	err := driver.GetCollection(SessionsCollection).FindOne(context.TODO(), filter).Decode(s)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return fmt.Errorf("ID %s not found", s.ID)
+		}
+		return fmt.Errorf("%v", err)
+	}
+	return nil
+}
+
+// Rotate replaces the refresh token of the session, only if it is still the one with the previous hash.
+// It fails if the previous token was already replaced by a concurrent refresh.
+func (s *Session) Rotate(driver db.Driver, previousHash string, hash string, expiresAt time.Time) error {
+	now := time.Now()
+	filter := bson.D{
+		{Key: "_id", Value: s.ID},
+		{Key: "refresh_hash", Value: previousHash},
+		{Key: "revoked_at", Value: bson.D{{Key: "$exists", Value: false}}},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "refresh_hash", Value: hash},
+		{Key: "refreshed_at", Value: now},
+		{Key: "expires_at", Value: expiresAt},
+	}}}
+	r, err := driver.GetCollection(SessionsCollection).UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		return fmt.Errorf("%v", err)
+	}
+	if r.MatchedCount == 0 {
+		return fmt.Errorf("refresh token already used")
+	}
+	s.RefreshHash = hash
+	s.RefreshedAt = now
+	s.ExpiresAt = expiresAt
+	return nil
+}
+
+// Revoke revokes the session, its access tokens are refused right away
+func (s *Session) Revoke(driver db.Driver) error {
+	s.RevokedAt = time.Now()
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "revoked_at", Value: s.RevokedAt}}}}
+	_, err := driver.GetCollection(SessionsCollection).UpdateByID(context.Background(), s.ID, update)
+	if err != nil {
+		return fmt.Errorf("%v", err)
+	}
+	return nil
+}
+
+// RevokeAllByUser revokes the sessions of a user which are not revoked yet and returns their number
+func (s *Session) RevokeAllByUser(driver db.Driver) (int64, error) {
+	filter := bson.D{
+		{Key: "user_id", Value: s.UserID},
+		{Key: "revoked_at", Value: bson.D{{Key: "$exists", Value: false}}},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "revoked_at", Value: time.Now()}}}}
+	r, err := driver.GetCollection(SessionsCollection).UpdateMany(context.Background(), filter, update)
+	if err != nil {
+		return 0, fmt.Errorf("%v", err)
+	}
+	return r.ModifiedCount, nil
+}
@@ -0,0 +1,82 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kuro-jojo/kdi-web/db/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestRefreshTokenHoldsTheSession(t *testing.T) {
+	session := Session{ID: primitive.NewObjectID()}
+	token, err := session.GenerateRefreshToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := SessionIDFromRefreshToken(token)
+	if err != nil || id != session.ID {
+		t.Errorf("SessionIDFromRefreshToken() = %v, %v, want %v", id, err, session.ID)
+	}
+	if other, _ := session.GenerateRefreshToken(); other == token {
+		t.Error("two refresh tokens are the same")
+	}
+	for _, invalid := range []string{"", "no-dot", "not-an-id.secret"} {
+		if _, err := SessionIDFromRefreshToken(invalid); err == nil {
+			t.Errorf("SessionIDFromRefreshToken(%q) should fail", invalid)
+		}
+	}
+}
+
+func TestSessionIsActive(t *testing.T) {
+	tests := map[string]struct {
+		session Session
+		want    bool
+	}{
+		"active":  {Session{ExpiresAt: time.Now().Add(time.Hour)}, true},
+		"expired": {Session{ExpiresAt: time.Now().Add(-time.Hour)}, false},
+		"revoked": {Session{ExpiresAt: time.Now().Add(time.Hour), RevokedAt: time.Now()}, false},
+	}
+	for name, tt := range tests {
+		if got := tt.session.IsActive(); got != tt.want {
+			t.Errorf("%s: IsActive() = %v, want %v", name, got, tt.want)
+		}
+	}
+}
+
+func TestSessionRotate(t *testing.T) {
+	mongodb.DbName = "kdi"
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	expiresAt := time.Now().Add(time.Hour)
+
+	mt.Run("current token", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+		session := Session{ID: primitive.NewObjectID(), RefreshHash: "previous"}
+		if err := session.Rotate(&mongodb.MongoDriver{Client: mt.Client}, "previous", "next", expiresAt); err != nil {
+			t.Fatalf("Rotate: %v", err)
+		}
+		if session.RefreshHash != "next" || !session.ExpiresAt.Equal(expiresAt) || session.RefreshedAt.IsZero() {
+			t.Errorf("session = %+v", session)
+		}
+
+		// only the session still holding the previous hash is updated
+		filter := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("q").Document()
+		if hash := filter.Lookup("refresh_hash").StringValue(); hash != "previous" {
+			t.Errorf("filter on refresh_hash = %q, want previous", hash)
+		}
+	})
+
+	mt.Run("token already replaced", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}, bson.E{Key: "nModified", Value: 0}))
+		session := Session{ID: primitive.NewObjectID(), RefreshHash: "previous"}
+		err := session.Rotate(&mongodb.MongoDriver{Client: mt.Client}, "previous", "next", expiresAt)
+		if err == nil || err.Error() != "refresh token already used" {
+			t.Fatalf("err = %v, want refresh token already used", err)
+		}
+		if session.RefreshHash != "previous" {
+			t.Errorf("hash = %q, want the previous one", session.RefreshHash)
+		}
+	})
+}
@@ -169,6 +169,23 @@ func (t *Teamspace) HasMember(driver db.Driver, member Member) bool {
 	return r.Err() == nil
 }
 
+// GrantsRoles checks if the user is the creator of the teamspace or a member with a profile having the roles
+func (t *Teamspace) GrantsRoles(driver db.Driver, userID string, roles []string) (bool, error) {
+	if t.CreatorID == userID {
+		return true, nil
+	}
+	p := Profile{}
+	profiles, err := p.GetAllByRoles(driver, roles)
+	if err != nil {
+		return false, err
+	}
+	names := make([]string, 0, len(profiles))
+	for _, profile := range profiles {
+		names = append(names, profile.Name)
+	}
+	return t.HasMemberWithProfile(driver, userID, names), nil
+}
+
 func (t *Teamspace) HasMemberWithProfile(driver db.Driver, userID string, profiles []string) bool {
 	filter := bson.D{
 		{Key: "_id", Value: t.ID},
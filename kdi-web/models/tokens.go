@@ -0,0 +1,161 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/kuro-jojo/kdi-web/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	AccessTokensCollection = "access_tokens"
+
+	// AccessTokenPrefix starts the personal access tokens so that they are told apart from the JWTs
+	AccessTokenPrefix = "kdi_pat_"
+)
+
+// AccessToken is a personal access token used by the scripts and the CI pipelines of a user.
+// It only gives access to some teamspaces with some roles, and only its hash is saved.
+type AccessToken struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	Name       string             `bson:"name"`
+	UserID     string             `bson:"user_id"`
+	Hash       string             `bson:"hash" json:"-"`
+	Hint       string             `bson:"hint"`       // The last characters of the token, to recognize it
+	Teamspaces []string           `bson:"teamspaces"` // The IDs of the teamspaces the token gives access to
+	Roles      []string           `bson:"roles"`      // The roles the token is limited to in these teamspaces
+
+	CreatedAt  time.Time `bson:"created_at"`
+	ExpiresAt  time.Time `bson:"expires_at"`
+	LastUsedAt time.Time `bson:"last_used_at,omitempty"`
+	RevokedAt  time.Time `bson:"revoked_at,omitempty"`
+}
+
+// GenerateAccessToken returns a new random token, to be shown once to the user
+func GenerateAccessToken() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("error generating token: %v", err)
+	}
+	return AccessTokenPrefix + base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// HashToken returns the hash saved for a personal access token or a refresh token.
+// The tokens are random so a fast hash is enough, and it lets them be found by their hash.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsActive returns true if the token is neither revoked nor expired
+func (t *AccessToken) IsActive() bool {
+	return t.RevokedAt.IsZero() && time.Now().Before(t.ExpiresAt)
+}
+
+// AllowsTeamspace returns true if the token gives access to the teamspace
+func (t *AccessToken) AllowsTeamspace(teamspaceID string) bool {
+	return slices.Contains(t.Teamspaces, teamspaceID)
+}
+
+// AllowsRoles returns true if the token has all the roles
+func (t *AccessToken) AllowsRoles(roles []string) bool {
+	for _, role := range roles {
+		if !slices.Contains(t.Roles, role) {
+			return false
+		}
+	}
+	return true
+}
+
+// Allows returns true if the token gives access to the teamspace with all the roles
+func (t *AccessToken) Allows(teamspaceID string, roles []string) bool {
+	return t.AllowsTeamspace(teamspaceID) && t.AllowsRoles(roles)
+}
+
+func (t *AccessToken) Create(driver db.Driver) error {
+	t.CreatedAt = time.Now()
+	r, err := driver.GetCollection(AccessTokensCollection).InsertOne(context.Background(), t)
+	if err != nil {
+		return fmt.Errorf("%v", err)
+	}
+	t.ID = r.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// GetByHash retrieves the token with the hash
+func (t *AccessToken) GetByHash(driver db.Driver) error {
+	filter := bson.D{{Key: "hash", Value: t.Hash}}
+	err := driver.GetCollection(AccessTokensCollection).FindOne(context.TODO(), filter).Decode(t)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return fmt.Errorf("token not found")
+		}
+		return fmt.Errorf("%v", err)
+	}
+	return nil
+}
+
+// GetAllByUser retrieves the tokens of a user, the most recent first
+func (t *AccessToken) GetAllByUser(driver db.Driver) ([]AccessToken, error) {
+	filter := bson.D{{Key: "user_id", Value: t.UserID}}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := driver.GetCollection(AccessTokensCollection).Find(context.TODO(), filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("%v", err)
+	}
+	tokens := []AccessToken{}
+	if err = cursor.All(context.Background(), &tokens); err != nil {
+		return nil, fmt.Errorf("%v", err)
+	}
+	return tokens, nil
+}
+
+// Revoke revokes the token of the user, it is kept in the list of the tokens
+func (t *AccessToken) Revoke(driver db.Driver) error {
+	filter := bson.D{{Key: "_id", Value: t.ID}, {Key: "user_id", Value: t.UserID}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "revoked_at", Value: time.Now()}}}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := driver.GetCollection(AccessTokensCollection).FindOneAndUpdate(context.TODO(), filter, update, opts).Decode(t)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return fmt.Errorf("ID %s not found", t.ID)
+		}
+		return fmt.Errorf("%v", err)
+	}
+	return nil
+}
+
+// UpdateLastUsed saves the time the token was used
+func (t *AccessToken) UpdateLastUsed(driver db.Driver) error {
+	t.LastUsedAt = time.Now()
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "last_used_at", Value: t.LastUsedAt}}}}
+	_, err := driver.GetCollection(AccessTokensCollection).UpdateByID(context.Background(), t.ID, update)
+	if err != nil {
+		return fmt.Errorf("%v", err)
+	}
+	return nil
+}
+
+// RevokeAllByUser revokes the tokens of a user which are not revoked yet and returns their number
+func (t *AccessToken) RevokeAllByUser(driver db.Driver) (int64, error) {
+	filter := bson.D{
+		{Key: "user_id", Value: t.UserID},
+		{Key: "revoked_at", Value: bson.D{{Key: "$exists", Value: false}}},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "revoked_at", Value: time.Now()}}}}
+	r, err := driver.GetCollection(AccessTokensCollection).UpdateMany(context.Background(), filter, update)
+	if err != nil {
+		return 0, fmt.Errorf("%v", err)
+	}
+	return r.ModifiedCount, nil
+}
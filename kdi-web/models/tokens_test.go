@@ -0,0 +1,109 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kuro-jojo/kdi-web/db/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestGenerateAccessToken(t *testing.T) {
+	first, err := GenerateAccessToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := GenerateAccessToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(first, AccessTokenPrefix) {
+		t.Errorf("token %q does not start with %q", first, AccessTokenPrefix)
+	}
+	if first == second {
+		t.Error("two tokens are the same")
+	}
+}
+
+func TestHashToken(t *testing.T) {
+	hash := HashToken("kdi_pat_secret")
+	if hash != HashToken("kdi_pat_secret") {
+		t.Error("the hash of a token changes")
+	}
+	if hash == HashToken("kdi_pat_other") {
+		t.Error("two tokens have the same hash")
+	}
+	if strings.Contains(hash, "secret") || len(hash) != 64 {
+		t.Errorf("hash = %q, want a hex sha256", hash)
+	}
+}
+
+func TestAccessTokenAllows(t *testing.T) {
+	token := AccessToken{Teamspaces: []string{"a"}, Roles: []string{ViewProjectRole, UpdateProjectRole}}
+	tests := []struct {
+		teamspace string
+		roles     []string
+		want      bool
+	}{
+		{"a", nil, true},
+		{"a", []string{UpdateProjectRole}, true},
+		{"a", []string{UpdateProjectRole, DeleteProjectRole}, false},
+		{"b", nil, false},
+		{"b", []string{ViewProjectRole}, false},
+	}
+	for _, tt := range tests {
+		if got := token.Allows(tt.teamspace, tt.roles); got != tt.want {
+			t.Errorf("Allows(%q, %v) = %v, want %v", tt.teamspace, tt.roles, got, tt.want)
+		}
+	}
+}
+
+func TestAccessTokenIsActive(t *testing.T) {
+	tests := map[string]struct {
+		token AccessToken
+		want  bool
+	}{
+		"active":  {AccessToken{ExpiresAt: time.Now().Add(time.Hour)}, true},
+		"expired": {AccessToken{ExpiresAt: time.Now().Add(-time.Hour)}, false},
+		"revoked": {AccessToken{ExpiresAt: time.Now().Add(time.Hour), RevokedAt: time.Now()}, false},
+	}
+	for name, tt := range tests {
+		if got := tt.token.IsActive(); got != tt.want {
+			t.Errorf("%s: IsActive() = %v, want %v", name, got, tt.want)
+		}
+	}
+}
+
+func TestAccessTokenGetByHash(t *testing.T) {
+	mongodb.DbName = "kdi"
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("found", func(mt *mtest.T) {
+		id := primitive.NewObjectID()
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "kdi.access_tokens", mtest.FirstBatch, bson.D{
+			{Key: "_id", Value: id},
+			{Key: "user_id", Value: "user"},
+			{Key: "hash", Value: HashToken("kdi_pat_secret")},
+			{Key: "teamspaces", Value: bson.A{"a"}},
+		}))
+		token := AccessToken{Hash: HashToken("kdi_pat_secret")}
+		if err := token.GetByHash(&mongodb.MongoDriver{Client: mt.Client}); err != nil {
+			t.Fatalf("GetByHash: %v", err)
+		}
+		if token.ID != id || token.UserID != "user" || !token.AllowsTeamspace("a") {
+			t.Errorf("token = %+v", token)
+		}
+	})
+
+	mt.Run("not found", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "kdi.access_tokens", mtest.FirstBatch))
+		token := AccessToken{Hash: HashToken("kdi_pat_unknown")}
+		err := token.GetByHash(&mongodb.MongoDriver{Client: mt.Client})
+		if err == nil || err.Error() != "token not found" {
+			t.Errorf("err = %v, want token not found", err)
+		}
+	})
+}
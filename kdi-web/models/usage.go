@@ -0,0 +1,20 @@
+package models
+
+import "github.com/kuro-jojo/kdi-k8s/client"
+
+// The usage is read from the cluster by the kubernetes api and not saved in the database.
+// The cpu is in millicores and the memory in bytes.
+type (
+	Usage         = client.Usage
+	ResourceUsage = client.ResourceUsage
+	PodUsage      = client.PodUsage
+	WorkloadUsage = client.WorkloadUsage
+)
+
+// MicroserviceUsage is the usage of a microservice of an environment
+type MicroserviceUsage struct {
+	MicroserviceID string
+	Name           string
+	Namespace      string
+	Usage          ResourceUsage
+}
@@ -24,11 +24,32 @@ type User struct {
 	Password           string             `bson:"password,omitempty"`
 	JoinedTeamspaceIDs []string           `bson:"joined_teamspaces,omitempty"`
 	SignWith           string             `bson:"sign_with,omitempty"`
+	EmailVerified      bool               `bson:"email_verified"`       // Saved even if false, the users without it were registered before the verification
+	Identities         []Identity         `bson:"identities,omitempty"` // The accounts of the OpenID Connect providers the user signs in with
+
+	// The personal access token the request is authenticated with, nil for the other methods
+	AccessToken *AccessToken `bson:"-" json:"-"`
 	// Projects   []string           `bson:"projects_created,omitempty"`
 	// Teamspaces []string           `bson:"teamspaces_created,omitempty"`
 	// Clusters   []string           `bson:"clusters_added,omitempty"`
 }
 
+// Identity is the account of a user at an OpenID Connect provider, its subject never changes unlike its email
+type Identity struct {
+	Provider string `bson:"provider"`
+	Subject  string `bson:"subject"`
+}
+
+// IdentityOf returns the identity of the user at the provider
+func (u *User) IdentityOf(provider string) (Identity, bool) {
+	for _, identity := range u.Identities {
+		if identity.Provider == provider {
+			return identity, true
+		}
+	}
+	return Identity{}, false
+}
+
 func (u *User) Create(driver db.Driver) error {
 	var err error
 	if u.Password != "" {
@@ -39,10 +60,11 @@ func (u *User) Create(driver db.Driver) error {
 		}
 		u.Password = hashedPassword
 	}
-	_, err = driver.GetCollection(UsersCollection).InsertOne(context.Background(), u)
+	r, err := driver.GetCollection(UsersCollection).InsertOne(context.Background(), u)
 	if err != nil {
 		return fmt.Errorf("%v", err)
 	}
+	u.ID = r.InsertedID.(primitive.ObjectID)
 	return nil
 }
 
@@ -54,6 +76,42 @@ func (u *User) Update(driver db.Driver) error {
 	return nil
 }
 
+// UpdatePassword hashes and saves the new password of the user
+func (u *User) UpdatePassword(driver db.Driver, password string) error {
+	hashedPassword, err := HashPassword(password)
+	if err != nil {
+		return fmt.Errorf("error hashing password: %v", err)
+	}
+	_, err = driver.GetCollection(UsersCollection).UpdateByID(context.Background(), u.ID, bson.D{{Key: "$set", Value: bson.D{{Key: "password", Value: hashedPassword}}}})
+	if err != nil {
+		return fmt.Errorf("%v", err)
+	}
+	u.Password = hashedPassword
+	return nil
+}
+
+// VerifyLegacyEmails marks as verified the emails of the users registered before the verification of the emails,
+// so that they can still log in when it is required. It returns the number of users.
+func VerifyLegacyEmails(driver db.Driver) (int64, error) {
+	filter := bson.D{{Key: "email_verified", Value: bson.D{{Key: "$exists", Value: false}}}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "email_verified", Value: true}}}}
+	r, err := driver.GetCollection(UsersCollection).UpdateMany(context.Background(), filter, update)
+	if err != nil {
+		return 0, fmt.Errorf("%v", err)
+	}
+	return r.ModifiedCount, nil
+}
+
+// VerifyEmail marks the email of the user as verified
+func (u *User) VerifyEmail(driver db.Driver) error {
+	_, err := driver.GetCollection(UsersCollection).UpdateByID(context.Background(), u.ID, bson.D{{Key: "$set", Value: bson.D{{Key: "email_verified", Value: true}}}})
+	if err != nil {
+		return fmt.Errorf("%v", err)
+	}
+	u.EmailVerified = true
+	return nil
+}
+
 func (u *User) Delete(driver db.Driver) error {
 	opts := options.Delete().SetHint(bson.D{{Key: "_id", Value: 1}})
 	_, err := driver.GetCollection(UsersCollection).DeleteOne(context.TODO(), opts)
@@ -90,6 +148,33 @@ func (u *User) GetByEmail(driver db.Driver) error {
 	return nil
 }
 
+// GetByIdentity retrieves the user with the account of an OpenID Connect provider
+func (u *User) GetByIdentity(driver db.Driver, identity Identity) error {
+	filter := bson.D{{Key: "identities", Value: bson.D{{Key: "$elemMatch", Value: bson.D{
+		{Key: "provider", Value: identity.Provider},
+		{Key: "subject", Value: identity.Subject},
+	}}}}}
+	err := driver.GetCollection(UsersCollection).FindOne(context.TODO(), filter).Decode(u)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return fmt.Errorf("identity %s of %s not found", identity.Subject, identity.Provider)
+		}
+		return fmt.Errorf("%v", err)
+	}
+	return nil
+}
+
+// AddIdentity links the account of an OpenID Connect provider to the user
+func (u *User) AddIdentity(driver db.Driver, identity Identity) error {
+	update := bson.D{{Key: "$addToSet", Value: bson.D{{Key: "identities", Value: identity}}}}
+	_, err := driver.GetCollection(UsersCollection).UpdateByID(context.Background(), u.ID, update)
+	if err != nil {
+		return fmt.Errorf("%v", err)
+	}
+	u.Identities = append(u.Identities, identity)
+	return nil
+}
+
 func (u *User) GetAll(driver db.Driver) ([]User, error) {
 	cursor, err := driver.GetCollection(UsersCollection).Find(context.TODO(), bson.D{{}})
 	if err != nil {
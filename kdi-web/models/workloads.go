@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// WorkloadOwner is the controller of a workload (a HelmRelease, an operator...)
+type WorkloadOwner struct {
+	Kind string
+	Name string
+}
+
+// Workload is the summary of a workload of any kind returned by the kubernetes api.
+// Workloads are read from the cluster and not saved in the database.
+type Workload struct {
+	Kind          string
+	Name          string
+	Namespace     string
+	Replicas      int32
+	ReadyReplicas int32
+	Images        []string
+	Labels        map[string]string
+	Selectors     map[string]string
+	Strategy      string
+	Conditions    []Conditions
+	Owner         *WorkloadOwner
+	CreatedAt     time.Time
+
+	// For cronjobs
+	Schedule         string
+	Suspended        bool
+	LastScheduleTime *time.Time
+}
@@ -0,0 +1,379 @@
+package oidc
+
+// This file verifies the tokens of the OpenID Connect providers the users sign in with (Azure AD with MSAL, Keycloak, Google...).
+// The keys of each provider are cached, refreshed in the background and fetched again when a token is signed with an unknown key,
+// so that the rotation of the keys does not need a restart.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lestrrat-go/jwx/jwk"
+)
+
+var (
+	// RefreshInterval is the time between two refreshes of the keys of the providers
+	RefreshInterval = time.Hour
+	// MinRefetchInterval is the minimum time between two fetches of the keys of a provider,
+	// so that the tokens signed with unknown keys do not flood it
+	MinRefetchInterval = time.Minute
+)
+
+// The algorithms of the keys published by the providers
+var signingMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+var ErrUnknownIssuer = errors.New("unknown token issuer")
+
+// ClaimMapping gives the claims holding the email and the name of the user, "email" and "name" by default
+type ClaimMapping struct {
+	Email string `json:"email,omitempty"`
+	Name  string `json:"name,omitempty"`
+}
+
+// Config is the configuration of a provider
+type Config struct {
+	Name string `json:"name"`
+	// Issuer is the iss claim of the tokens, taken from the metadata if empty
+	Issuer string `json:"issuer,omitempty"`
+	// MetadataURL is the discovery document, the one of the issuer by default
+	MetadataURL string `json:"metadataUrl,omitempty"`
+	// ClientID is the aud claim of the tokens
+	ClientID string       `json:"clientId"`
+	Claims   ClaimMapping `json:"claims,omitempty"`
+	// RequiredClaims are claims the tokens must have with these values (the tenant with Azure AD)
+	RequiredClaims map[string]string `json:"requiredClaims,omitempty"`
+	// TrustEmail accepts the email claim without email_verified, for the providers whose emails are managed by the organization
+	TrustEmail bool `json:"trustEmail,omitempty"`
+}
+
+// Identity is the user of a verified token
+type Identity struct {
+	Provider string
+	Subject  string
+	Email    string
+	Name     string
+}
+
+// Provider verifies the tokens of an OpenID Connect provider
+type Provider struct {
+	Config
+	client *http.Client
+
+	mu          sync.Mutex
+	issuer      string
+	keys        jwk.Set
+	lastFetchAt time.Time
+}
+
+func NewProvider(config Config) *Provider {
+	if config.MetadataURL == "" {
+		config.MetadataURL = strings.TrimSuffix(config.Issuer, "/") + "/.well-known/openid-configuration"
+	}
+	if config.Claims.Email == "" {
+		config.Claims.Email = "email"
+	}
+	if config.Claims.Name == "" {
+		config.Claims.Name = "name"
+	}
+	return &Provider{
+		Config: config,
+		client: &http.Client{Timeout: 10 * time.Second},
+		issuer: config.Issuer,
+	}
+}
+
+// Refresh fetches the metadata and the keys of the provider. The previous keys are kept if it fails.
+func (p *Provider) Refresh(ctx context.Context) error {
+	p.mu.Lock()
+	p.lastFetchAt = time.Now()
+	p.mu.Unlock()
+	return p.fetch(ctx)
+}
+
+// claimFetch returns true if the keys can be fetched again, the concurrent requests then wait for the next interval.
+// The lock must be held.
+func (p *Provider) claimFetch() bool {
+	if time.Since(p.lastFetchAt) < MinRefetchInterval {
+		return false
+	}
+	p.lastFetchAt = time.Now()
+	return true
+}
+
+// fetch fetches the metadata and the keys without the lock, so that the verifications with the cached keys are not blocked,
+// then swaps them in
+func (p *Provider) fetch(ctx context.Context) error {
+	var metadata struct {
+		Issuer  string `json:"issuer"`
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := p.get(ctx, p.MetadataURL, &metadata); err != nil {
+		return fmt.Errorf("error fetching the metadata of %s: %v", p.Name, err)
+	}
+	if metadata.JWKSURI == "" {
+		return fmt.Errorf("the metadata of %s has no jwks_uri", p.Name)
+	}
+	if p.Issuer != "" && metadata.Issuer != p.Issuer {
+		return fmt.Errorf("the metadata of %s is for the issuer %s", p.Name, metadata.Issuer)
+	}
+
+	var raw json.RawMessage
+	if err := p.get(ctx, metadata.JWKSURI, &raw); err != nil {
+		return fmt.Errorf("error fetching the keys of %s: %v", p.Name, err)
+	}
+	keys, err := jwk.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("error parsing the keys of %s: %v", p.Name, err)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.issuer = metadata.Issuer
+	p.keys = keys
+	return nil
+}
+
+func (p *Provider) get(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
+
+// resolveIssuer returns the issuer of the provider, the metadata is fetched if it is not known yet
+func (p *Provider) resolveIssuer(ctx context.Context) string {
+	p.mu.Lock()
+	issuer := p.issuer
+	fetch := issuer == "" && p.claimFetch()
+	p.mu.Unlock()
+
+	if fetch {
+		if err := p.fetch(ctx); err != nil {
+			log.Printf("Error refreshing OIDC provider: %v", err)
+		}
+		p.mu.Lock()
+		issuer = p.issuer
+		p.mu.Unlock()
+	}
+	return issuer
+}
+
+// key returns the public key with the ID, the keys are fetched again if it is unknown
+func (p *Provider) key(ctx context.Context, kid string) (any, error) {
+	p.mu.Lock()
+	key, ok := p.lookup(kid)
+	fetch := !ok && p.claimFetch()
+	p.mu.Unlock()
+
+	if fetch {
+		log.Printf("Unknown key %q of OIDC provider %s, fetching the keys", kid, p.Name)
+		if err := p.fetch(ctx); err != nil {
+			log.Printf("Error refreshing OIDC provider: %v", err)
+		}
+		p.mu.Lock()
+		key, ok = p.lookup(kid)
+		p.mu.Unlock()
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+	var raw any
+	if err := key.Raw(&raw); err != nil {
+		return nil, fmt.Errorf("invalid key %q: %v", kid, err)
+	}
+	return raw, nil
+}
+
+// lookup returns the cached key with the ID, the lock must be held
+func (p *Provider) lookup(kid string) (jwk.Key, bool) {
+	if p.keys == nil {
+		return nil, false
+	}
+	// a token without key ID can only be signed by the single key of the provider
+	if kid == "" {
+		if p.keys.Len() != 1 {
+			return nil, false
+		}
+		return p.keys.Get(0)
+	}
+	return p.keys.LookupKeyID(kid)
+}
+
+// Verify checks the signature, the issuer, the audience and the expiration of the token and returns its user
+func (p *Provider) Verify(ctx context.Context, tokenString string) (Identity, error) {
+	issuer := p.resolveIssuer(ctx)
+	if issuer == "" {
+		return Identity{}, fmt.Errorf("the issuer of %s is unknown", p.Name)
+	}
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, kid)
+	},
+		jwt.WithValidMethods(signingMethods),
+		jwt.WithIssuer(issuer),
+		jwt.WithAudience(p.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return Identity{}, err
+	}
+	claims := token.Claims.(jwt.MapClaims)
+
+	for claim, value := range p.RequiredClaims {
+		if fmt.Sprint(claims[claim]) != value {
+			return Identity{}, fmt.Errorf("invalid claim %s", claim)
+		}
+	}
+	// the accounts without identity of the provider are matched by email, it must be owned by the user
+	if verified, _ := claims["email_verified"].(bool); !verified && !p.TrustEmail {
+		return Identity{}, fmt.Errorf("the email is not verified")
+	}
+
+	identity := Identity{Provider: p.Name}
+	identity.Subject, _ = claims["sub"].(string)
+	identity.Email, _ = claims[p.Claims.Email].(string)
+	identity.Name, _ = claims[p.Claims.Name].(string)
+	if identity.Subject == "" {
+		return Identity{}, fmt.Errorf("no sub claim")
+	}
+	if identity.Email == "" {
+		return Identity{}, fmt.Errorf("no email in the claim %s", p.Claims.Email)
+	}
+	if identity.Name == "" {
+		identity.Name = identity.Email
+	}
+	return identity, nil
+}
+
+// Providers are the providers the users can sign in with, the provider of a token is found by its issuer
+type Providers struct {
+	list []*Provider
+
+	stop context.CancelFunc
+	done chan struct{}
+}
+
+func NewProviders(configs ...Config) *Providers {
+	providers := &Providers{}
+	for _, config := range configs {
+		providers.list = append(providers.list, NewProvider(config))
+	}
+	return providers
+}
+
+// FromEnv returns the providers of KDI_OIDC_PROVIDERS, a JSON list of configs.
+// The MSAL provider of KDI_MSAL_CLIENT_ID, KDI_MSAL_OIDC_METADATA_URL and KDI_MSAL_TENANT_ID is added if they are set.
+func FromEnv() (*Providers, error) {
+	var configs []Config
+	if value := os.Getenv("KDI_OIDC_PROVIDERS"); value != "" {
+		if err := json.Unmarshal([]byte(value), &configs); err != nil {
+			return nil, fmt.Errorf("invalid KDI_OIDC_PROVIDERS: %v", err)
+		}
+	}
+	for i, config := range configs {
+		if config.Name == "" || config.ClientID == "" || (config.Issuer == "" && config.MetadataURL == "") {
+			return nil, fmt.Errorf("invalid KDI_OIDC_PROVIDERS: the provider %d needs a name, a clientId and an issuer or a metadataUrl", i)
+		}
+	}
+
+	if clientID := os.Getenv("KDI_MSAL_CLIENT_ID"); clientID != "" {
+		tenantID := os.Getenv("KDI_MSAL_TENANT_ID")
+		configs = append(configs, Config{
+			Name:           "msal",
+			MetadataURL:    fmt.Sprintf(os.Getenv("KDI_MSAL_OIDC_METADATA_URL"), tenantID),
+			ClientID:       clientID,
+			Claims:         ClaimMapping{Email: "preferred_username"},
+			RequiredClaims: map[string]string{"tid": tenantID},
+			// the accounts of the tenant are managed by the organization, Azure AD has no email_verified claim
+			TrustEmail: true,
+		})
+	}
+	return NewProviders(configs...), nil
+}
+
+// Len returns the number of providers
+func (ps *Providers) Len() int {
+	if ps == nil {
+		return 0
+	}
+	return len(ps.list)
+}
+
+// Start fetches the keys of the providers, then refreshes them at each interval.
+// A provider which cannot be reached is fetched again when a token is verified.
+func (ps *Providers) Start(interval time.Duration) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ps.stop = cancel
+	ps.done = make(chan struct{})
+	go func() {
+		defer close(ps.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			ps.refresh(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop stops the refresh of the keys
+func (ps *Providers) Stop() {
+	if ps.stop == nil {
+		return
+	}
+	ps.stop()
+	<-ps.done
+}
+
+func (ps *Providers) refresh(ctx context.Context) {
+	for _, p := range ps.list {
+		if err := p.Refresh(ctx); err != nil {
+			log.Printf("Error refreshing OIDC provider: %v", err)
+		}
+	}
+}
+
+// Verify verifies the token with the provider of its issuer
+func (ps *Providers) Verify(ctx context.Context, tokenString string) (Identity, error) {
+	if ps.Len() == 0 {
+		return Identity{}, fmt.Errorf("no OIDC provider is configured")
+	}
+	// the issuer is only trusted once the token is verified by its provider
+	var claims jwt.RegisteredClaims
+	if _, _, err := jwt.NewParser().ParseUnverified(tokenString, &claims); err != nil {
+		return Identity{}, err
+	}
+	for _, p := range ps.list {
+		if claims.Issuer != "" && p.resolveIssuer(ctx) == claims.Issuer {
+			return p.Verify(ctx, tokenString)
+		}
+	}
+	return Identity{}, ErrUnknownIssuer
+}
@@ -0,0 +1,296 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lestrrat-go/jwx/jwk"
+)
+
+// fakeProvider serves the metadata and the keys of a provider, its keys can be rotated
+type fakeProvider struct {
+	*httptest.Server
+	mu         sync.Mutex
+	keys       map[string]*rsa.PrivateKey
+	keyFetches int
+	// block holds the responses of the keys until it is closed
+	block chan struct{}
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	t.Helper()
+	p := &fakeProvider{keys: map[string]*rsa.PrivateKey{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"issuer": p.URL, "jwks_uri": p.URL + "/keys"})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		p.keyFetches++
+		block := p.block
+		p.mu.Unlock()
+		if block != nil {
+			<-block
+		}
+
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		set := jwk.NewSet()
+		for kid, key := range p.keys {
+			public, err := jwk.New(&key.PublicKey)
+			if err != nil {
+				t.Error(err)
+			}
+			public.Set(jwk.KeyIDKey, kid)
+			set.Add(public)
+		}
+		json.NewEncoder(w).Encode(set)
+	})
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+func (p *fakeProvider) rotate(t *testing.T, kid string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keys = map[string]*rsa.PrivateKey{kid: key}
+}
+
+func (p *fakeProvider) fetches() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.keyFetches
+}
+
+func (p *fakeProvider) sign(t *testing.T, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	p.mu.Lock()
+	key := p.keys[kid]
+	p.mu.Unlock()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func (p *fakeProvider) claims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":                p.URL,
+		"aud":                "kdi",
+		"sub":                "user-1",
+		"exp":                time.Now().Add(time.Hour).Unix(),
+		"preferred_username": "user@example.com",
+		"email_verified":     true,
+		"name":               "User",
+		"tid":                "tenant",
+	}
+}
+
+func TestVerifyMapsTheClaims(t *testing.T) {
+	fake := newFakeProvider(t)
+	fake.rotate(t, "key-1")
+	providers := NewProviders(Config{
+		Name:           "azure",
+		Issuer:         fake.URL,
+		ClientID:       "kdi",
+		Claims:         ClaimMapping{Email: "preferred_username"},
+		RequiredClaims: map[string]string{"tid": "tenant"},
+	})
+
+	identity, err := providers.Verify(context.Background(), fake.sign(t, "key-1", fake.claims()))
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	want := Identity{Provider: "azure", Subject: "user-1", Email: "user@example.com", Name: "User"}
+	if identity != want {
+		t.Errorf("identity = %+v, want %+v", identity, want)
+	}
+}
+
+func TestVerifyRefusesInvalidTokens(t *testing.T) {
+	fake := newFakeProvider(t)
+	fake.rotate(t, "key-1")
+	providers := NewProviders(Config{Name: "keycloak", Issuer: fake.URL, ClientID: "kdi", RequiredClaims: map[string]string{"tid": "tenant"}})
+
+	tests := map[string]func(jwt.MapClaims){
+		"audience":       func(c jwt.MapClaims) { c["aud"] = "other" },
+		"expired":        func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+		"required claim": func(c jwt.MapClaims) { c["tid"] = "other" },
+		"unverified":     func(c jwt.MapClaims) { c["email_verified"] = false },
+		"not verified":   func(c jwt.MapClaims) { delete(c, "email_verified") },
+		"no subject":     func(c jwt.MapClaims) { delete(c, "sub") },
+		"no email":       func(c jwt.MapClaims) {},
+		"issuer":         func(c jwt.MapClaims) { c["iss"] = "https://other.example.com" },
+	}
+	for name, change := range tests {
+		t.Run(name, func(t *testing.T) {
+			claims := fake.claims()
+			if name != "no email" {
+				claims["email"] = "user@example.com"
+			}
+			change(claims)
+			if _, err := providers.Verify(context.Background(), fake.sign(t, "key-1", claims)); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+
+	claims := fake.claims()
+	claims["exp"] = time.Now().Add(-time.Hour).Unix()
+	_, err := providers.Verify(context.Background(), fake.sign(t, "key-1", claims))
+	if !errors.Is(err, jwt.ErrTokenExpired) {
+		t.Errorf("err = %v, want an expired token", err)
+	}
+}
+
+func TestTrustedEmailNeedsNoVerification(t *testing.T) {
+	fake := newFakeProvider(t)
+	fake.rotate(t, "key-1")
+	claims := fake.claims()
+	delete(claims, "email_verified")
+	token := fake.sign(t, "key-1", claims)
+
+	provider := NewProvider(Config{Name: "azure", Issuer: fake.URL, ClientID: "kdi", Claims: ClaimMapping{Email: "preferred_username"}})
+	if _, err := provider.Verify(context.Background(), token); err == nil {
+		t.Error("expected an unverified email")
+	}
+	provider = NewProvider(Config{Name: "azure", Issuer: fake.URL, ClientID: "kdi", Claims: ClaimMapping{Email: "preferred_username"}, TrustEmail: true})
+	if _, err := provider.Verify(context.Background(), token); err != nil {
+		t.Errorf("verify with a trusted email: %v", err)
+	}
+}
+
+func TestUnknownKeyFetchesTheRotatedKeys(t *testing.T) {
+	defer func(interval time.Duration) { MinRefetchInterval = interval }(MinRefetchInterval)
+	MinRefetchInterval = 0
+
+	fake := newFakeProvider(t)
+	fake.rotate(t, "key-1")
+	provider := NewProvider(Config{Name: "keycloak", Issuer: fake.URL, ClientID: "kdi", Claims: ClaimMapping{Email: "preferred_username"}})
+	if err := provider.Refresh(context.Background()); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	fake.rotate(t, "key-2")
+	if _, err := provider.Verify(context.Background(), fake.sign(t, "key-2", fake.claims())); err != nil {
+		t.Fatalf("verify with the rotated key: %v", err)
+	}
+	if fake.fetches() != 2 {
+		t.Errorf("keys fetched %d times, want 2", fake.fetches())
+	}
+}
+
+func TestUnknownKeysAreNotFetchedTooOften(t *testing.T) {
+	fake := newFakeProvider(t)
+	fake.rotate(t, "key-1")
+	provider := NewProvider(Config{Name: "keycloak", Issuer: fake.URL, ClientID: "kdi", Claims: ClaimMapping{Email: "preferred_username"}})
+	if err := provider.Refresh(context.Background()); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	token := fake.sign(t, "key-1", fake.claims())
+	fake.rotate(t, "key-2")
+	for range 3 {
+		if _, err := provider.Verify(context.Background(), fake.sign(t, "key-2", fake.claims())); err == nil {
+			t.Fatal("expected an unknown key")
+		}
+	}
+	if fake.fetches() != 1 {
+		t.Errorf("keys fetched %d times, want 1", fake.fetches())
+	}
+	// the cached keys are still used
+	if _, err := provider.Verify(context.Background(), token); err != nil {
+		t.Errorf("verify with the cached key: %v", err)
+	}
+}
+
+func TestUnreachableProviderIsFetchedLater(t *testing.T) {
+	defer func(interval time.Duration) { MinRefetchInterval = interval }(MinRefetchInterval)
+	MinRefetchInterval = 0
+
+	fake := newFakeProvider(t)
+	fake.rotate(t, "key-1")
+	// the issuer is only known from the metadata, which cannot be fetched at the start
+	provider := NewProvider(Config{Name: "google", MetadataURL: "http://127.0.0.1:1/.well-known/openid-configuration", ClientID: "kdi"})
+	providers := &Providers{list: []*Provider{provider}}
+	providers.Start(time.Hour)
+	providers.Stop()
+
+	claims := fake.claims()
+	claims["email"] = "user@example.com"
+	token := fake.sign(t, "key-1", claims)
+	if _, err := providers.Verify(context.Background(), token); !errors.Is(err, ErrUnknownIssuer) {
+		t.Fatalf("err = %v, want an unknown issuer", err)
+	}
+
+	provider.MetadataURL = fake.URL + "/.well-known/openid-configuration"
+	if _, err := providers.Verify(context.Background(), token); err != nil {
+		t.Fatalf("verify once the provider is reachable: %v", err)
+	}
+}
+
+func TestFetchDoesNotBlockTheCachedKeys(t *testing.T) {
+	defer func(interval time.Duration) { MinRefetchInterval = interval }(MinRefetchInterval)
+	MinRefetchInterval = 0
+
+	fake := newFakeProvider(t)
+	fake.rotate(t, "key-1")
+	provider := NewProvider(Config{Name: "keycloak", Issuer: fake.URL, ClientID: "kdi", Claims: ClaimMapping{Email: "preferred_username"}})
+	if err := provider.Refresh(context.Background()); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	token := fake.sign(t, "key-1", fake.claims())
+
+	// a token with an unknown key fetches the keys, the provider does not answer
+	unknown := jwt.NewWithClaims(jwt.SigningMethodRS256, fake.claims())
+	unknown.Header["kid"] = "key-2"
+	signed, err := unknown.SignedString(fake.keys["key-1"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.mu.Lock()
+	fake.block = make(chan struct{})
+	fake.mu.Unlock()
+	fetched := make(chan struct{})
+	go func() {
+		defer close(fetched)
+		provider.Verify(context.Background(), signed)
+	}()
+	for fake.fetches() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	verified := make(chan error, 1)
+	go func() {
+		_, err := provider.Verify(context.Background(), token)
+		verified <- err
+	}()
+	select {
+	case err := <-verified:
+		if err != nil {
+			t.Errorf("verify with the cached key: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("the verification with the cached key waits for the fetch")
+	}
+	close(fake.block)
+	<-fetched
+}
@@ -28,22 +28,17 @@ func CheckForEnv() {
 	// 	hasError = true
 	// }
 
-	if os.Getenv("KDI_MSAL_CLIENT_ID") == "" {
-		log.Println("KDI_MSAL_CLIENT_ID is not set")
-		hasError = true
-
-	}
-
-	if os.Getenv("KDI_MSAL_OIDC_METADATA_URL") == "" {
-		log.Println("KDI_OIDC_METADATA_URL is not set")
-		hasError = true
-
-	}
-
-	if os.Getenv("KDI_MSAL_TENANT_ID") == "" {
-		log.Println("KDI_MSAL_TENANT_ID is not set")
-		hasError = true
+	// MSAL is optional, the other OpenID Connect providers are configured in KDI_OIDC_PROVIDERS
+	if os.Getenv("KDI_MSAL_CLIENT_ID") != "" {
+		if os.Getenv("KDI_MSAL_OIDC_METADATA_URL") == "" {
+			log.Println("KDI_MSAL_OIDC_METADATA_URL is not set")
+			hasError = true
+		}
 
+		if os.Getenv("KDI_MSAL_TENANT_ID") == "" {
+			log.Println("KDI_MSAL_TENANT_ID is not set")
+			hasError = true
+		}
 	}
 
 	if os.Getenv("KDI_JWT_SUB_FOR_K8S_API") == "" {
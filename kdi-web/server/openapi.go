@@ -0,0 +1,511 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kuro-jojo/kdi-k8s/shared/openapi"
+	"github.com/kuro-jojo/kdi-web/controllers"
+	"github.com/kuro-jojo/kdi-web/models"
+)
+
+// OpenAPIPath is the path of the OpenAPI document of the api
+const OpenAPIPath = BASE_API + "/openapi.json"
+
+const (
+	dashboard    = BASE_API + "/dashboard"
+	environment  = dashboard + "/environments/:e_id"
+	microservice = environment + "/microservices/:m_id"
+	configSet    = environment + "/configsets/:cs_id"
+)
+
+// deployForm is the multipart form of the yaml files forwarded to the kubernetes api
+var deployForm = openapi.Fields{
+	"files":     []openapi.File{},
+	"namespace": "",
+	"wait":      "",
+	"timeout":   "",
+}
+
+// sessionResponse holds the tokens of a session, the access token expires in expiresIn seconds
+var sessionResponse = openapi.Fields{"message": "", "token": "", "refreshToken": "", "expiresIn": 0}
+
+var usageResponse = openapi.Fields{"metricsAvailable": true, "message": ""}
+
+var restartResponse = openapi.Fields{"message": "", "results": []models.OperationResult{}, "size": 0}
+
+var rolloutResponse = openapi.Fields{"message": "", "microservice": models.Microservice{}}
+
+// Docs describes every route of the api, a route without entry fails the tests
+var Docs = openapi.Spec{
+	Title:       "KDI Web API",
+	Description: "Manages the teamspaces, projects, clusters and environments of the users. Every route except login, register, refresh, logout, the email verification, the password reset, health and the document needs the token of a user, or one of its personal access tokens.",
+	APIVersion:  "1.0.0",
+	BasePath:    BASE_API,
+	Operations: map[string]openapi.Operation{
+		openapi.Key(http.MethodGet, OpenAPIPath): {Summary: "OpenAPI document of the api", Tag: "docs", Response: openapi.Fields{}},
+		openapi.Key(http.MethodGet, BASE_API+"/health"): {
+			Summary:  "Check that the api is up",
+			Tag:      "health",
+			Response: openapi.Fields{"status": ""},
+		},
+
+		openapi.Key(http.MethodPost, BASE_API+"/login"): {
+			Summary:  "Log in with an email and a password",
+			Tag:      "users",
+			Request:  controllers.UserForm{},
+			Response: sessionResponse,
+		},
+		openapi.Key(http.MethodPost, BASE_API+"/refresh"): {
+			Summary:  "Get a new access token with the refresh token of a session, the refresh token is replaced",
+			Tag:      "users",
+			Request:  controllers.RefreshForm{},
+			Response: sessionResponse,
+		},
+		openapi.Key(http.MethodPost, BASE_API+"/logout"): {
+			Summary:  "Revoke the session of a refresh token",
+			Tag:      "users",
+			Request:  controllers.RefreshForm{},
+			Response: openapi.Fields{"message": ""},
+		},
+		openapi.Key(http.MethodPost, BASE_API+"/register"): {
+			Summary: "Create an account with an email and a password, a verification email is sent",
+			Tag:     "users",
+			Request: controllers.UserForm{},
+			Status:  http.StatusCreated,
+		},
+		openapi.Key(http.MethodPost, BASE_API+"/verify-email"): {
+			Summary:  "Verify the email of a user with the token of the verification email",
+			Tag:      "users",
+			Request:  openapi.Fields{"token": ""},
+			Response: openapi.Fields{"message": ""},
+		},
+		openapi.Key(http.MethodPost, BASE_API+"/verify-email/resend"): {
+			Summary:  "Send another verification email, the response does not tell if the email is registered",
+			Tag:      "users",
+			Request:  controllers.EmailForm{},
+			Response: openapi.Fields{"message": ""},
+		},
+		openapi.Key(http.MethodPost, BASE_API+"/forgot-password"): {
+			Summary:  "Send an email to reset the password, the response does not tell if the email is registered",
+			Tag:      "users",
+			Request:  controllers.EmailForm{},
+			Response: openapi.Fields{"message": ""},
+		},
+		openapi.Key(http.MethodPost, BASE_API+"/reset-password"): {
+			Summary:  "Choose a new password with the token of the reset email, the sessions of the user are revoked",
+			Tag:      "users",
+			Request:  controllers.EmailTokenForm{},
+			Response: openapi.Fields{"message": ""},
+		},
+		openapi.Key(http.MethodPost, BASE_API+"/register/msal"): {
+			Summary: "Create the account of a user authenticated with MSAL",
+			Tag:     "users",
+			Status:  http.StatusCreated,
+		},
+		openapi.Key(http.MethodGet, dashboard+"/users/current"): {
+			Summary:  "Get the current user",
+			Tag:      "users",
+			Response: openapi.Fields{"user": models.User{}},
+		},
+		openapi.Key(http.MethodGet, dashboard+"/users/:user_id"): {
+			Summary:  "Get the name of a user",
+			Tag:      "users",
+			Response: openapi.Fields{"user": ""},
+		},
+		openapi.Key(http.MethodDelete, dashboard+"/users/:user_id/sessions"): {
+			Summary:  "Revoke the sessions and the personal access tokens of a user (the current user or any user for an administrator)",
+			Tag:      "users",
+			Response: openapi.Fields{"message": "", "sessions": 0, "accessTokens": 0},
+		},
+
+		openapi.Key(http.MethodGet, dashboard+"/users/notifications"): {
+			Summary:  "List the notifications of the current user",
+			Tag:      "notifications",
+			Response: openapi.Fields{"notifications": []models.NotificationContent{}, "size": 0},
+		},
+		openapi.Key(http.MethodPatch, dashboard+"/users/notifications"): {
+			Summary: "Mark a notification as read",
+			Tag:     "notifications",
+			Request: controllers.NotificationForm{},
+		},
+		openapi.Key(http.MethodDelete, dashboard+"/users/notifications"): {
+			Summary: "Delete the notifications of the current user",
+			Tag:     "notifications",
+		},
+
+		openapi.Key(http.MethodPost, dashboard+"/tokens"): {
+			Summary:  "Create a personal access token limited to some teamspaces and roles, its value is only returned once",
+			Tag:      "tokens",
+			Request:  controllers.AccessTokenForm{},
+			Response: openapi.Fields{"message": "", "token": "", "accessToken": models.AccessToken{}},
+			Status:   http.StatusCreated,
+		},
+		openapi.Key(http.MethodGet, dashboard+"/tokens"): {
+			Summary:  "List the personal access tokens of the current user",
+			Tag:      "tokens",
+			Response: openapi.Fields{"accessTokens": []models.AccessToken{}, "size": 0},
+		},
+		openapi.Key(http.MethodDelete, dashboard+"/tokens/:token_id"): {
+			Summary:  "Revoke a personal access token",
+			Tag:      "tokens",
+			Response: openapi.Fields{"message": "", "accessToken": models.AccessToken{}},
+		},
+
+		openapi.Key(http.MethodGet, dashboard+"/projects/owned"): {
+			Summary:  "List the projects created by the current user",
+			Tag:      "projects",
+			Response: openapi.Fields{"projects": []models.Project{}, "size": 0},
+		},
+		openapi.Key(http.MethodGet, dashboard+"/projects/joinedTeamspaces"): {
+			Summary:  "List the projects of the teamspaces joined by the current user",
+			Tag:      "projects",
+			Response: openapi.Fields{"projects": []models.Project{}, "size": 0},
+		},
+		openapi.Key(http.MethodPost, dashboard+"/projects"): {
+			Summary: "Create a project",
+			Tag:     "projects",
+			Request: controllers.ProjectForm{},
+			Status:  http.StatusCreated,
+		},
+		openapi.Key(http.MethodGet, dashboard+"/projects/:id"): {
+			Summary:  "Get a project",
+			Tag:      "projects",
+			Response: openapi.Fields{"project": models.Project{}},
+		},
+		openapi.Key(http.MethodPatch, dashboard+"/projects/:id"): {
+			Summary:  "Update a project",
+			Tag:      "projects",
+			Request:  models.Project{},
+			Response: openapi.Fields{"Updated project": models.Project{}},
+		},
+		openapi.Key(http.MethodDelete, dashboard+"/projects/:id"): {
+			Summary: "Delete a project",
+			Tag:     "projects",
+		},
+
+		openapi.Key(http.MethodPost, dashboard+"/teamspaces"): {
+			Summary: "Create a teamspace",
+			Tag:     "teamspaces",
+			Request: controllers.TeamspaceForm{},
+			Status:  http.StatusCreated,
+		},
+		openapi.Key(http.MethodGet, dashboard+"/teamspaces/owned"): {
+			Summary:  "List the teamspaces created by the current user",
+			Tag:      "teamspaces",
+			Response: openapi.Fields{"teamspaces": []models.Teamspace{}, "size": 0},
+		},
+		openapi.Key(http.MethodGet, dashboard+"/teamspaces/joined"): {
+			Summary:  "List the teamspaces joined by the current user",
+			Tag:      "teamspaces",
+			Response: openapi.Fields{"teamspaces": []models.Teamspace{}, "size": 0},
+		},
+		openapi.Key(http.MethodGet, dashboard+"/teamspaces/:id"): {
+			Summary:  "Get a teamspace",
+			Tag:      "teamspaces",
+			Response: openapi.Fields{"teamspace": models.Teamspace{}},
+		},
+		openapi.Key(http.MethodGet, dashboard+"/teamspaces/:id/projects"): {
+			Summary:  "List the projects of a teamspace",
+			Tag:      "teamspaces",
+			Response: openapi.Fields{"teamspace": models.Teamspace{}, "projects": []models.Project{}, "size": 0},
+		},
+		openapi.Key(http.MethodGet, dashboard+"/teamspaces/:id/clusters"): {
+			Summary:  "List the clusters shared with a teamspace",
+			Tag:      "teamspaces",
+			Response: openapi.Fields{"clusters": []models.Cluster{}, "size": 0},
+		},
+		openapi.Key(http.MethodPatch, dashboard+"/teamspaces/:id/members"): {
+			Summary: "Add a member to a teamspace",
+			Tag:     "members",
+			Request: controllers.MemberForm{},
+			Status:  http.StatusCreated,
+		},
+		openapi.Key(http.MethodPatch, dashboard+"/teamspaces/:id/members/:memberId"): {
+			Summary: "Update the profile of a member of a teamspace",
+			Tag:     "members",
+			Request: controllers.MemberForm{},
+			Status:  http.StatusCreated,
+		},
+		openapi.Key(http.MethodDelete, dashboard+"/teamspaces/:id/members/:memberId"): {
+			Summary: "Remove a member from a teamspace",
+			Tag:     "members",
+			Status:  http.StatusCreated,
+		},
+
+		openapi.Key(http.MethodPost, dashboard+"/profiles"): {
+			Summary: "Create a profile",
+			Tag:     "profiles",
+			Request: controllers.ProfileForm{},
+			Status:  http.StatusCreated,
+		},
+		openapi.Key(http.MethodGet, dashboard+"/profiles"): {
+			Summary:  "List the profiles",
+			Tag:      "profiles",
+			Response: openapi.Fields{"profiles": []models.Profile{}, "size": 0},
+		},
+		openapi.Key(http.MethodGet, dashboard+"/profiles/roles"): {
+			Summary:  "List the roles that can be given to the profiles",
+			Tag:      "profiles",
+			Response: openapi.Fields{"roles": []string{}},
+		},
+
+		openapi.Key(http.MethodPost, dashboard+"/clusters"): {
+			Summary: "Add a cluster",
+			Tag:     "clusters",
+			Request: controllers.ClusterForm{},
+			Status:  http.StatusCreated,
+		},
+		openapi.Key(http.MethodPost, dashboard+"/clusters/test"): {
+			Summary:  "Test the connection to a cluster before adding it",
+			Tag:      "clusters",
+			Request:  controllers.ClusterForm{},
+			Response: openapi.Fields{"message": "", "inventory": models.ClusterInventory{}},
+		},
+		openapi.Key(http.MethodGet, dashboard+"/clusters/owned"): {
+			Summary:  "List the clusters added by the current user",
+			Tag:      "clusters",
+			Response: openapi.Fields{"clusters": []models.Cluster{}, "size": 0},
+		},
+		openapi.Key(http.MethodGet, dashboard+"/clusters/:id"): {
+			Summary:  "Get a cluster",
+			Tag:      "clusters",
+			Response: openapi.Fields{"cluster": models.Cluster{}},
+		},
+		openapi.Key(http.MethodGet, dashboard+"/clusters/Name/:id"): {
+			Summary:  "Get the name of a cluster",
+			Tag:      "clusters",
+			Response: openapi.Fields{"cluster": ""},
+		},
+		openapi.Key(http.MethodPatch, dashboard+"/clusters/:id"): {
+			Summary: "Update a cluster",
+			Tag:     "clusters",
+			Request: controllers.ClusterForm{},
+			Status:  http.StatusCreated,
+		},
+		openapi.Key(http.MethodDelete, dashboard+"/clusters/:id"): {
+			Summary: "Delete a cluster",
+			Tag:     "clusters",
+		},
+		openapi.Key(http.MethodGet, dashboard+"/clusters/:id/environments"): {
+			Summary:  "List the environments of a cluster",
+			Tag:      "clusters",
+			Request:  controllers.EnvironmentForm{},
+			Response: openapi.Fields{"environments": []models.Environment{}, "size": 0},
+		},
+		openapi.Key(http.MethodGet, dashboard+"/clusters/:id/namespaces"): {
+			Summary:  "List the namespaces of a cluster",
+			Tag:      "clusters",
+			Response: openapi.Fields{"namespaces": []string{}},
+		},
+		openapi.Key(http.MethodGet, dashboard+"/clusters/:id/namespaces/:namespace/workloads"): {
+			Summary:  "List the workloads of a namespace of a cluster",
+			Tag:      "clusters",
+			Query:    map[string]string{"kind": "Only list the workloads of this kind (deployments, statefulsets, daemonsets or cronjobs)"},
+			Response: openapi.Fields{"workloads": []models.Workload{}, "size": 0, "errors": map[string]openapi.Error{}},
+		},
+		openapi.Key(http.MethodGet, dashboard+"/clusters/:id/inventory"): {
+			Summary:  "Get the inventory of a cluster, refreshed when it is outdated",
+			Tag:      "clusters",
+			Response: openapi.Fields{"inventory": models.ClusterInventory{}},
+		},
+		openapi.Key(http.MethodPost, dashboard+"/clusters/:id/inventory"): {
+			Summary:  "Refresh the inventory of a cluster",
+			Tag:      "clusters",
+			Response: openapi.Fields{"inventory": models.ClusterInventory{}},
+		},
+
+		openapi.Key(http.MethodGet, dashboard+"/rulesets/rules"): {
+			Summary:  "List the rules that can be enabled in the rule sets",
+			Tag:      "rulesets",
+			Response: openapi.Fields{"rules": []models.PolicyRule{}, "severities": []string{}},
+		},
+		openapi.Key(http.MethodPost, dashboard+"/rulesets"): {
+			Summary:  "Create a rule set",
+			Tag:      "rulesets",
+			Request:  controllers.RuleSetForm{},
+			Response: openapi.Fields{"message": "", "ruleSet": models.RuleSet{}},
+			Status:   http.StatusCreated,
+		},
+		openapi.Key(http.MethodGet, dashboard+"/rulesets"): {
+			Summary:  "List the rule sets of the current user",
+			Tag:      "rulesets",
+			Response: openapi.Fields{"ruleSets": []models.RuleSet{}, "size": 0},
+		},
+		openapi.Key(http.MethodGet, dashboard+"/rulesets/:rs_id"): {
+			Summary:  "Get a rule set",
+			Tag:      "rulesets",
+			Response: openapi.Fields{"ruleSet": models.RuleSet{}},
+		},
+		openapi.Key(http.MethodPut, dashboard+"/rulesets/:rs_id"): {
+			Summary:  "Replace the rules of a rule set",
+			Tag:      "rulesets",
+			Request:  controllers.RuleSetForm{},
+			Response: openapi.Fields{"message": "", "ruleSet": models.RuleSet{}},
+		},
+		openapi.Key(http.MethodDelete, dashboard+"/rulesets/:rs_id"): {
+			Summary: "Delete a rule set that is not attached to an environment",
+			Tag:     "rulesets",
+		},
+
+		openapi.Key(http.MethodPost, dashboard+"/environments"): {
+			Summary: "Create an environment",
+			Tag:     "environments",
+			Request: controllers.EnvironmentForm{},
+			Status:  http.StatusCreated,
+		},
+		openapi.Key(http.MethodGet, dashboard+"/environments"): {
+			Summary:  "List the environments",
+			Tag:      "environments",
+			Response: openapi.Fields{"environments": []models.Environment{}, "size": 0},
+		},
+		openapi.Key(http.MethodGet, environment): {
+			Summary:  "Get an environment",
+			Tag:      "environments",
+			Response: openapi.Fields{"environment": models.Environment{}},
+		},
+		openapi.Key(http.MethodGet, dashboard+"/environments/projects/:project_id"): {
+			Summary:  "List the environments of a project",
+			Tag:      "environments",
+			Response: openapi.Fields{"project": models.Project{}, "environments": []models.Environment{}, "size": 0},
+		},
+		openapi.Key(http.MethodGet, environment+"/usage"): {
+			Summary: "Resource usage of the microservices of an environment",
+			Tag:     "usage",
+			Response: merge(usageResponse, openapi.Fields{
+				"microservices": []models.MicroserviceUsage{},
+				"size":          0,
+				"total":         models.ResourceUsage{},
+				"errors":        map[string]string{},
+			}),
+		},
+		openapi.Key(http.MethodPut, environment+"/variables"): {
+			Summary:  "Replace the variables substituted in the manifests of an environment",
+			Tag:      "environments",
+			Request:  controllers.EnvironmentVariablesForm{},
+			Response: openapi.Fields{"message": "", "variables": map[string]string{}},
+		},
+		openapi.Key(http.MethodPut, environment+"/ruleset"): {
+			Summary:  "Attach a rule set to an environment",
+			Tag:      "rulesets",
+			Request:  controllers.AttachRuleSetForm{},
+			Response: openapi.Fields{"message": "", "ruleSet": models.RuleSet{}},
+		},
+		openapi.Key(http.MethodDelete, environment+"/ruleset"): {
+			Summary: "Detach the rule set of an environment",
+			Tag:     "rulesets",
+		},
+
+		openapi.Key(http.MethodGet, environment+"/microservices"): {
+			Summary:  "List the microservices of an environment",
+			Tag:      "microservices",
+			Response: openapi.Fields{"microservices": []models.Microservice{}, "size": 0},
+		},
+		openapi.Key(http.MethodPost, environment+"/microservices/with-yaml"): {
+			Summary:  "Deploy the uploaded yaml files in an environment, the deployment is made by an operation",
+			Tag:      "microservices",
+			Form:     deployForm,
+			Response: openapi.Fields{"message": "", "operation": models.Operation{}},
+			Status:   http.StatusAccepted,
+		},
+		openapi.Key(http.MethodPost, environment+"/microservices/restart"): {
+			Summary:  "Restart the deployments of an environment",
+			Tag:      "microservices",
+			Response: restartResponse,
+		},
+		openapi.Key(http.MethodGet, microservice): {
+			Summary:  "Get a microservice",
+			Tag:      "microservices",
+			Response: openapi.Fields{"microservice": models.Microservice{}},
+		},
+		openapi.Key(http.MethodPatch, microservice): {
+			Summary:  "Update a microservice with a strategy, the update is made by an operation",
+			Tag:      "microservices",
+			Request:  controllers.MicroserviceUpdateForm{},
+			Response: openapi.Fields{"message": "", "operation": models.Operation{}},
+			Status:   http.StatusAccepted,
+		},
+		openapi.Key(http.MethodPost, microservice+"/pause"): {
+			Summary:  "Pause the rollout of a microservice",
+			Tag:      "microservices",
+			Response: rolloutResponse,
+		},
+		openapi.Key(http.MethodPost, microservice+"/resume"): {
+			Summary:  "Resume the rollout of a microservice",
+			Tag:      "microservices",
+			Response: rolloutResponse,
+		},
+		openapi.Key(http.MethodPost, microservice+"/restart"): {
+			Summary:  "Restart the pods of a microservice",
+			Tag:      "microservices",
+			Response: rolloutResponse,
+		},
+		openapi.Key(http.MethodGet, microservice+"/usage"): {
+			Summary:  "Resource usage of the pods of a microservice",
+			Tag:      "usage",
+			Response: merge(usageResponse, openapi.Fields{"usage": models.WorkloadUsage{}}),
+		},
+
+		openapi.Key(http.MethodGet, environment+"/operations"): {
+			Summary:  "List the operations of an environment",
+			Tag:      "operations",
+			Response: openapi.Fields{"operations": []models.Operation{}, "size": 0},
+		},
+		openapi.Key(http.MethodGet, environment+"/operations/:op_id"): {
+			Summary:  "Get an operation",
+			Tag:      "operations",
+			Response: openapi.Fields{"operation": models.Operation{}},
+		},
+
+		openapi.Key(http.MethodPost, environment+"/configsets"): {
+			Summary:  "Create a config set",
+			Tag:      "configsets",
+			Request:  controllers.ConfigSetForm{},
+			Response: openapi.Fields{"message": "", "configSet": models.ConfigSet{}},
+			Status:   http.StatusCreated,
+		},
+		openapi.Key(http.MethodGet, environment+"/configsets"): {
+			Summary:  "List the config sets of an environment",
+			Tag:      "configsets",
+			Response: openapi.Fields{"configSets": []models.ConfigSet{}, "size": 0},
+		},
+		openapi.Key(http.MethodGet, configSet): {
+			Summary:  "Get a config set",
+			Tag:      "configsets",
+			Response: openapi.Fields{"configSet": models.ConfigSet{}},
+		},
+		openapi.Key(http.MethodPut, configSet): {
+			Summary:  "Replace the data of a config set and restart the microservices consuming it",
+			Tag:      "configsets",
+			Request:  controllers.ConfigSetForm{},
+			Response: openapi.Fields{"message": "", "configSet": models.ConfigSet{}, "results": []models.OperationResult{}},
+		},
+		openapi.Key(http.MethodDelete, configSet): {
+			Summary: "Delete a config set that is not consumed by a microservice",
+			Tag:     "configsets",
+		},
+		openapi.Key(http.MethodPost, configSet+"/microservices/:m_id"): {
+			Summary: "Add a config set to the environment of a microservice",
+			Tag:     "configsets",
+		},
+		openapi.Key(http.MethodDelete, configSet+"/microservices/:m_id"): {
+			Summary: "Remove a config set from the environment of a microservice",
+			Tag:     "configsets",
+		},
+	},
+}
+
+// SetupDocs serves the OpenAPI document of the routes of the router
+func SetupDocs(router *gin.Engine) {
+	router.GET(OpenAPIPath, Docs.Handler(router.Routes))
+}
+
+func merge(fields ...openapi.Fields) openapi.Fields {
+	merged := make(openapi.Fields)
+	for _, f := range fields {
+		for name, value := range f {
+			merged[name] = value
+		}
+	}
+	return merged
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kuro-jojo/kdi-web/oidc"
+)
+
+func newTestRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	SetupRoutes(router.Group(BASE_API), nil, oidc.NewProviders())
+	SetupDocs(router)
+	return router
+}
+
+func TestEveryRouteIsDocumented(t *testing.T) {
+	routes := newTestRouter().Routes()
+
+	for _, key := range Docs.Undocumented(routes) {
+		t.Errorf("route %s has no entry in the OpenAPI spec (server/openapi.go)", key)
+	}
+	for _, key := range Docs.Stale(routes) {
+		t.Errorf("the OpenAPI spec documents %s which is not a route", key)
+	}
+}
+
+func TestOpenAPIDocumentIsServed(t *testing.T) {
+	router := newTestRouter()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, OpenAPIPath, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var document struct {
+		OpenAPI string                    `json:"openapi"`
+		Paths   map[string]map[string]any `json:"paths"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &document); err != nil {
+		t.Fatalf("invalid document: %v", err)
+	}
+	if document.OpenAPI == "" {
+		t.Error("the document has no openapi version")
+	}
+	update, ok := document.Paths["/dashboard/environments/{e_id}/microservices/{m_id}"]
+	if !ok {
+		t.Fatal("the update of a microservice is not documented")
+	}
+	if _, ok := update["patch"]; !ok {
+		t.Error("the patch method of the microservices is not documented")
+	}
+}
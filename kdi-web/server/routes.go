@@ -1,29 +1,39 @@
 package server
 
 import (
+	"net/http"
+
 	"github.com/kuro-jojo/kdi-web/controllers"
 	"github.com/kuro-jojo/kdi-web/db"
 	"github.com/kuro-jojo/kdi-web/middlewares"
+	"github.com/kuro-jojo/kdi-web/models"
+	"github.com/kuro-jojo/kdi-web/oidc"
 
 	"github.com/gin-gonic/gin"
 )
 
 // SetupRoutes sets up the routes for the web API
-func SetupRoutes(group *gin.RouterGroup, driver db.Driver, msalAuth middlewares.MsalWebAuth) {
+func SetupRoutes(group *gin.RouterGroup, driver db.Driver, providers *oidc.Providers) {
 
-	// all routes except login and register require authentication
+	// all routes except login, register and the session and email flows require authentication
 	route := group.Group("")
 	route.Use(middlewares.DbMiddleware(driver))
 
 	route.POST("login", controllers.Login)
 	route.POST("register", controllers.Register)
+	route.POST("refresh", controllers.Refresh)
+	route.POST("logout", controllers.Logout)
+	route.POST("verify-email", controllers.VerifyEmail)
+	route.POST("verify-email/resend", controllers.ResendVerificationEmail)
+	route.POST("forgot-password", controllers.ForgotPassword)
+	route.POST("reset-password", controllers.ResetPassword)
 
 	// this route is for checking the health of the server (if it is up)
 	route.GET("health", controllers.Health)
 
 	// all routes below require authentication
 	authenticatedRoute := route.Group("")
-	authenticatedRoute.Use(middlewares.AuthMiddleware(msalAuth))
+	authenticatedRoute.Use(middlewares.AuthMiddleware(providers), middlewares.AccessTokenWrites())
 	// this route is for registering with msal after the user has been authenticated with msal
 	authenticatedRoute.POST("register/msal", controllers.RegisterWithMsal)
 
@@ -36,19 +46,29 @@ func SetupRoutes(group *gin.RouterGroup, driver db.Driver, msalAuth middlewares.
 			users.PATCH("notifications", controllers.ReadNotification)
 			users.DELETE("notifications", controllers.DeleteNotifications)
 			users.GET(":user_id", controllers.GetUserById)
+			users.DELETE(":user_id/sessions", controllers.RevokeUserSessions)
+		}
+
+		// the personal access tokens are restricted to the teamspaces of their scope by the middlewares of the groups,
+		// and can only change the resources of the routes registered with a scope with roles by WriteRoute
+		tokens := dashboard.Group("tokens")
+		{
+			tokens.POST("", controllers.CreateAccessToken)
+			tokens.GET("", controllers.GetAccessTokens)
+			tokens.DELETE(":token_id", controllers.RevokeAccessToken)
 		}
 
-		projects := dashboard.Group("projects")
+		projects := dashboard.Group("projects", middlewares.ProjectScope("id"))
 		{
 			projects.GET("owned", controllers.GetProjectsByCreator)
 			projects.GET("joinedTeamspaces", controllers.GetProjectsOfJoinedTeamspaces)
 			projects.POST("", controllers.CreateProject)
 			projects.GET(":id", controllers.GetProject)
-			projects.PATCH(":id", controllers.UpdateProject)
-			projects.DELETE(":id", controllers.DeleteProject)
+			middlewares.WriteRoute(projects, http.MethodPatch, ":id", middlewares.ProjectScope("id", models.UpdateProjectRole), controllers.UpdateProject)
+			middlewares.WriteRoute(projects, http.MethodDelete, ":id", middlewares.ProjectScope("id", models.DeleteProjectRole), controllers.DeleteProject)
 		}
 
-		teamspaces := dashboard.Group("teamspaces")
+		teamspaces := dashboard.Group("teamspaces", middlewares.TeamspaceScope("id"))
 		{
 			teamspaces.POST("", controllers.CreateTeamspace)
 			teamspaces.GET("owned", controllers.GetTeamspacesByCreator)
@@ -59,9 +79,9 @@ func SetupRoutes(group *gin.RouterGroup, driver db.Driver, msalAuth middlewares.
 
 			teamspaces.GET(":id/clusters", controllers.GetClustersByTeamspace)
 
-			teamspaces.PATCH(":id/members", controllers.AddMemberToTeamspace)
-			teamspaces.DELETE(":id/members/:memberId", controllers.RemoveMemberFromTeamspace)
-			teamspaces.PATCH(":id/members/:memberId", controllers.UpdateMemberInTeamspace)
+			middlewares.WriteRoute(teamspaces, http.MethodPatch, ":id/members", middlewares.TeamspaceScope("id", models.AddMemberRole), controllers.AddMemberToTeamspace)
+			middlewares.WriteRoute(teamspaces, http.MethodDelete, ":id/members/:memberId", middlewares.TeamspaceScope("id", models.RemoveMemberRole), controllers.RemoveMemberFromTeamspace)
+			middlewares.WriteRoute(teamspaces, http.MethodPatch, ":id/members/:memberId", middlewares.TeamspaceScope("id", models.UpdateMemberRole), controllers.UpdateMemberInTeamspace)
 		}
 
 		profiles := dashboard.Group("profiles")
@@ -71,34 +91,76 @@ func SetupRoutes(group *gin.RouterGroup, driver db.Driver, msalAuth middlewares.
 			profiles.GET("roles", controllers.GetDefinedRoles)
 		}
 
-		clusters := dashboard.Group("clusters")
+		clusters := dashboard.Group("clusters", middlewares.ClusterScope("id"))
 		{
 			clusters.POST("", controllers.AddCluster)
 			clusters.POST("/test", controllers.TestConnectionToCluster)
 			clusters.GET("owned", controllers.GetClustersByCreator)
 			clusters.GET(":id", controllers.GetClusterByIDAndCreator)
 			clusters.GET("Name/:id", controllers.GetClusterName)
-			clusters.PATCH(":id", controllers.UpdateCluster)
-			clusters.DELETE(":id", controllers.DeleteCluster)
+			middlewares.WriteRoute(clusters, http.MethodPatch, ":id", middlewares.ClusterScope("id", models.UpdateClusterRole), controllers.UpdateCluster)
+			middlewares.WriteRoute(clusters, http.MethodDelete, ":id", middlewares.ClusterScope("id", models.DeleteClusterRole), controllers.DeleteCluster)
 
 			clusters.GET(":id/environments", controllers.GetEnvironmentsByCluster)
 			clusters.GET(":id/namespaces", controllers.GetNamespacesFromCluster)
+			clusters.GET(":id/namespaces/:namespace/workloads", controllers.GetWorkloadsFromCluster)
+			clusters.GET(":id/inventory", controllers.GetClusterInventory)
+			middlewares.WriteRoute(clusters, http.MethodPost, ":id/inventory", middlewares.ClusterScope("id", models.ViewClusterRole), controllers.RefreshClusterInventory)
+		}
+
+		// a rule set changes the deployments of the environments using it, so a token can only change the ones of its teamspaces
+		ruleSets := dashboard.Group("rulesets", middlewares.RuleSetScope("rs_id"))
+		{
+			ruleSets.GET("rules", controllers.GetPolicyRules)
+			ruleSets.POST("", controllers.CreateRuleSet)
+			ruleSets.GET("", controllers.GetRuleSets)
+			ruleSets.GET(":rs_id", controllers.GetRuleSet)
+			middlewares.WriteRoute(ruleSets, http.MethodPut, ":rs_id", middlewares.RuleSetScope("rs_id", models.UpdateProjectRole), controllers.UpdateRuleSet)
+			middlewares.WriteRoute(ruleSets, http.MethodDelete, ":rs_id", middlewares.RuleSetScope("rs_id", models.UpdateProjectRole), controllers.DeleteRuleSet)
 		}
 
-		environments := dashboard.Group("environments")
+		// the deployments, the updates and the config sets of an environment need the role to create deployments
+		deploymentScope := middlewares.EnvironmentScope("e_id", models.CreateDeploymentRole)
+		environments := dashboard.Group("environments", middlewares.EnvironmentScope("e_id"), middlewares.ProjectScope("project_id"))
 		{
 			environments.POST("", controllers.CreateEnvironment)
 			environments.GET("", controllers.GetEnvironments)
 			environments.GET(":e_id", controllers.GetEnvironment)
 			environments.GET("projects/:project_id", controllers.GetEnvironmentsByProject)
+			environments.GET(":e_id/usage", controllers.GetEnvironmentUsage)
+			middlewares.WriteRoute(environments, http.MethodPut, ":e_id/variables", deploymentScope, controllers.SetEnvironmentVariables)
+			middlewares.WriteRoute(environments, http.MethodPut, ":e_id/ruleset", middlewares.EnvironmentScope("e_id", models.UpdateProjectRole), controllers.AttachRuleSet)
+			middlewares.WriteRoute(environments, http.MethodDelete, ":e_id/ruleset", middlewares.EnvironmentScope("e_id", models.UpdateProjectRole), controllers.DetachRuleSet)
 
 			microservices := environments.Group(":e_id/microservices")
 			{
 				// microservices.POST("", controllers.CreateMicroservice)
 				microservices.GET("", controllers.GetMicroservicesByEnvironment)
-				microservices.POST("with-yaml", controllers.CreateMicroserviceWithYaml)
+				middlewares.WriteRoute(microservices, http.MethodPost, "with-yaml", deploymentScope, controllers.CreateMicroserviceWithYaml)
 				microservices.GET(":m_id", controllers.GetMicroserviceByEnvironment)
-				microservices.PATCH(":m_id", controllers.UpdateMicroservice)
+				middlewares.WriteRoute(microservices, http.MethodPatch, ":m_id", deploymentScope, controllers.UpdateMicroservice)
+				middlewares.WriteRoute(microservices, http.MethodPost, ":m_id/pause", deploymentScope, controllers.PauseMicroservice)
+				middlewares.WriteRoute(microservices, http.MethodPost, ":m_id/resume", deploymentScope, controllers.ResumeMicroservice)
+				middlewares.WriteRoute(microservices, http.MethodPost, ":m_id/restart", deploymentScope, controllers.RestartMicroservice)
+				microservices.GET(":m_id/usage", controllers.GetMicroserviceUsage)
+				middlewares.WriteRoute(microservices, http.MethodPost, "restart", deploymentScope, controllers.RestartMicroservicesByEnvironment)
+			}
+
+			operations := environments.Group(":e_id/operations")
+			{
+				operations.GET("", controllers.GetOperationsByEnvironment)
+				operations.GET(":op_id", controllers.GetOperation)
+			}
+
+			configSets := environments.Group(":e_id/configsets")
+			{
+				middlewares.WriteRoute(configSets, http.MethodPost, "", deploymentScope, controllers.CreateConfigSet)
+				configSets.GET("", controllers.GetConfigSetsByEnvironment)
+				configSets.GET(":cs_id", controllers.GetConfigSet)
+				middlewares.WriteRoute(configSets, http.MethodPut, ":cs_id", deploymentScope, controllers.UpdateConfigSet)
+				middlewares.WriteRoute(configSets, http.MethodDelete, ":cs_id", deploymentScope, controllers.DeleteConfigSet)
+				middlewares.WriteRoute(configSets, http.MethodPost, ":cs_id/microservices/:m_id", deploymentScope, controllers.AttachConfigSet)
+				middlewares.WriteRoute(configSets, http.MethodDelete, ":cs_id/microservices/:m_id", deploymentScope, controllers.DetachConfigSet)
 			}
 		}
 	}
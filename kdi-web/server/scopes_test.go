@@ -0,0 +1,62 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kuro-jojo/kdi-web/db/mongodb"
+	"github.com/kuro-jojo/kdi-web/models"
+	"github.com/kuro-jojo/kdi-web/oidc"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// Every route changing a resource refuses a personal access token without roles, before reaching its controller
+func TestAccessTokenWithoutRolesCannotChangeAnything(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mongodb.DbName = "kdi"
+	userID := primitive.NewObjectID()
+	teamspaceID := primitive.NewObjectID().Hex()
+	token := models.AccessTokenPrefix + "read-only"
+
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	for _, route := range newTestRouter().Routes() {
+		if route.Method == http.MethodGet || !strings.HasPrefix(route.Path, BASE_API+"/dashboard") {
+			continue
+		}
+		mt.Run(route.Method+" "+route.Path, func(mt *mtest.T) {
+			// the token, then its user
+			mt.AddMockResponses(
+				mtest.CreateCursorResponse(0, "kdi.access_tokens", mtest.FirstBatch, bson.D{
+					{Key: "_id", Value: primitive.NewObjectID()},
+					{Key: "user_id", Value: userID.Hex()},
+					{Key: "hash", Value: models.HashToken(token)},
+					{Key: "teamspaces", Value: bson.A{teamspaceID}},
+					{Key: "roles", Value: bson.A{}},
+					{Key: "expires_at", Value: time.Now().Add(time.Hour)},
+					{Key: "last_used_at", Value: time.Now()},
+				}),
+				mtest.CreateCursorResponse(0, "kdi.users", mtest.FirstBatch, bson.D{
+					{Key: "_id", Value: userID},
+					{Key: "email", Value: "ci@example.com"},
+				}),
+			)
+			router := gin.New()
+			SetupRoutes(router.Group(BASE_API), &mongodb.MongoDriver{Client: mt.Client}, oidc.NewProviders())
+
+			path := strings.NewReplacer(":id", teamspaceID, ":e_id", teamspaceID, ":", "").Replace(route.Path)
+			req := httptest.NewRequest(route.Method, path, nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != http.StatusForbidden {
+				t.Errorf("%s %s = %d, want %d: %s", route.Method, route.Path, w.Code, http.StatusForbidden, w.Body.String())
+			}
+		})
+	}
+}
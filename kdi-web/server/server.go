@@ -1,9 +1,7 @@
 package server
 
 import (
-	"encoding/json"
-	"fmt"
-	"io"
+	"context"
 	"log"
 	"net/http"
 	"os"
@@ -11,9 +9,16 @@ import (
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/kuro-jojo/kdi-k8s/shared/graceful"
+	"github.com/kuro-jojo/kdi-k8s/shared/httpmetrics"
+	"github.com/kuro-jojo/kdi-k8s/shared/logging"
+	"github.com/kuro-jojo/kdi-web/controllers"
 	"github.com/kuro-jojo/kdi-web/db"
 	"github.com/kuro-jojo/kdi-web/db/mongodb"
-	"github.com/kuro-jojo/kdi-web/middlewares"
+	"github.com/kuro-jojo/kdi-web/mailer"
+	"github.com/kuro-jojo/kdi-web/metrics"
+	"github.com/kuro-jojo/kdi-web/models"
+	"github.com/kuro-jojo/kdi-web/oidc"
 )
 
 const BASE_API = "/api/v1"
@@ -23,24 +28,60 @@ func Init() {
 
 	port := os.Getenv("KDI_WEB_API_PORT")
 
+	// Initialize the OpenID Connect providers, their keys are refreshed in the background
+	providers, err := oidc.FromEnv()
+	if err != nil {
+		log.Fatalf("Error initializing the OIDC providers: %v", err)
+	}
+	if providers.Len() == 0 {
+		log.Println("No OIDC provider is configured, only the login with a password is enabled")
+	}
+	providers.Start(oidc.RefreshInterval)
+
+	// Initialize Database
+	driver := &mongodb.MongoDriver{}
+	db.InitDB(driver)
+
+	// The users registered before the verification of the emails keep logging in
+	if n, err := models.VerifyLegacyEmails(driver); err != nil {
+		log.Printf("Error marking the emails of the previous users as verified: %v", err)
+	} else if n > 0 {
+		log.Printf("Emails of %d users registered before the verification marked as verified", n)
+	}
+	// Send the emails through SMTP, or only log them
+	controllers.Mailer = mailer.FromEnv()
+
+	// Start the workers executing the deployment operations
+	controllers.StartOperationWorkers(driver, controllers.OperationWorkers)
+	// Keep the inventory cached on the clusters up to date
+	controllers.StartInventoryRefresher(driver, controllers.InventoryRefreshInterval)
+
 	// Initialize Router
-	r := NewRouter()
+	r := NewRouter(driver, providers)
 
 	log.Printf("Starting server on port: %s\n", port)
 
-	r.Run(": " + port)
+	graceful.Serve(&http.Server{Addr: ":" + port, Handler: r}, graceful.GracePeriod(), func(ctx context.Context) {
+		if err := controllers.StopOperationWorkers(ctx); err != nil {
+			log.Printf("Error stopping the operation workers: %v", err)
+		}
+		if err := controllers.WaitForEmails(ctx); err != nil {
+			log.Printf("Error waiting for the emails: %v", err)
+		}
+	})
+
+	// the database is used until the requests and the operations are drained
+	controllers.StopInventoryRefresher()
+	providers.Stop()
+	if err := driver.Disconnect(); err != nil {
+		log.Printf("Error disconnecting from the database: %v", err)
+		return
+	}
+	log.Println("Disconnected from the database")
 }
 
 // NewRouter : Function with routes
-func NewRouter() *gin.Engine {
-
-	// Initialize Web Auth with MSAL
-	var msalWebAuth middlewares.MsalWebAuth
-	InitWebAuthWithMSAL(&msalWebAuth)
-
-	// Initialize Database
-	driver := &mongodb.MongoDriver{}
-	db.InitDB(driver)
+func NewRouter(driver db.Driver, providers *oidc.Providers) *gin.Engine {
 
 	router := gin.New()
 	router.SetTrustedProxies(nil)
@@ -51,77 +92,25 @@ func NewRouter() *gin.Engine {
 		AllowOrigins:     []string{webappEndpoint},
 		AllowMethods:     []string{"*"},
 		AllowHeaders:     []string{"*"},
+		ExposeHeaders:    []string{logging.RequestIDHeader},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
-	router.Use(gin.Logger())
+	router.Use(logging.Middleware())
 	router.Use(gin.Recovery())
+	router.Use(metrics.Requests.Middleware())
+
+	// the metrics are only exposed to the scrapers knowing the token
+	if token := os.Getenv("KDI_METRICS_TOKEN"); token != "" {
+		router.GET(httpmetrics.Path, httpmetrics.Handler(token))
+	} else {
+		log.Println("KDI_METRICS_TOKEN is not set, the metrics endpoint is disabled")
+	}
 
 	// routes for kubernetes service
 	kubernetesRouter := router.Group(BASE_API)
-	SetupRoutes(kubernetesRouter, driver, msalWebAuth)
+	SetupRoutes(kubernetesRouter, driver, providers)
+	SetupDocs(router)
 
 	return router
 }
-
-// InitWebAuthWithMSAL : Initialize the Web Auth with MSAL (Microsoft Authentication Library)
-//
-// This function will fetch the OIDC Metadata URL from the environment and fetch the public keys to verify the JWT token signature from the Azure AD
-func InitWebAuthWithMSAL(msalWebAuth *middlewares.MsalWebAuth) {
-	// Get the OIDC Metadata URL from the environment
-	// This metadata URL is used to get the public keys to verify the JWT token signature from the Azure AD
-
-	oidcMetadataURL := os.Getenv("KDI_MSAL_OIDC_METADATA_URL")
-	tenantID := os.Getenv("KDI_MSAL_TENANT_ID")
-	oidcMetadataURL = fmt.Sprintf(oidcMetadataURL, tenantID)
-
-	resp, err := http.Get(oidcMetadataURL)
-	if err != nil {
-		log.Printf("Error while fetching metadata: %v", err)
-		log.Fatalf("Exiting...")
-	}
-	defer resp.Body.Close()
-	content, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Printf("Error while reading metadata: %v", err)
-		log.Fatalf("Exiting...")
-	}
-	type Metadata struct {
-		JWKSURI string `json:"jwks_uri"`
-	}
-
-	var data Metadata
-	err = json.Unmarshal(content, &data)
-	if err != nil {
-		log.Printf("Error while parsing metadata: %v", err)
-		log.Fatalf("Exiting...")
-	}
-
-	// Fetch the public keys from the JWKS URI
-	type JWks struct {
-		Keys []middlewares.JWKS `json:"keys"`
-	}
-	keys := JWks{}
-
-	resp, err = http.Get(data.JWKSURI)
-	if err != nil {
-		log.Printf("Error while fetching JWKS: %v", err)
-		log.Fatalf("Exiting...")
-	}
-
-	defer resp.Body.Close()
-
-	content, err = io.ReadAll(resp.Body)
-	if err != nil {
-		log.Printf("Error while reading JWKS: %v", err)
-		log.Fatalf("Exiting...")
-	}
-	err = json.Unmarshal(content, &keys)
-
-	if err != nil {
-		log.Printf("Error while parsing JWKS: %v", err)
-		log.Fatalf("Exiting...")
-	}
-	// We have to store the public keys,
-	msalWebAuth.Keys = keys.Keys
-}
@@ -7,6 +7,13 @@ export interface Cluster {
     Port?: string;
     Token?: string;
 
+    // TLS fields for on-premise clusters
+    CAData?: string;
+    TLSServerName?: string;
+    ClientCertData?: string;
+    ClientKeyData?: string;
+    Insecure?: boolean;
+
     // Additional fields for AWS
     Region?: string;
     AccessKeyID?: string;
@@ -15,4 +22,30 @@ export interface Cluster {
     ExpiryDate?: Date;
     CreatorID?: string;
     Teamspaces?: string[];
+
+    Inventory?: ClusterInventory; // cached description of the cluster
+}
+
+export interface NodeInventory {
+    Name: string;
+    Roles: string[];
+    KubeletVersion: string;
+    OSImage: string;
+    ContainerRuntime: string;
+    Architecture: string;
+    Unschedulable: boolean;
+    Allocatable: { CPU: number; Memory: number; Pods: number }; // cpu in millicores, memory in bytes
+    Allocated: { CPURequests: number; CPULimits: number; MemoryRequests: number; MemoryLimits: number; Pods: number };
+    Conditions: { Type: string; Status: string; Reason: string; Message: string }[];
+}
+
+export interface ClusterInventory {
+    ServerVersion: string;
+    Platform: string;
+    Nodes: NodeInventory[];
+    StorageClasses: { Name: string; Provisioner: string; ReclaimPolicy: string; VolumeBindingMode: string; AllowVolumeExpansion: boolean; Default: boolean }[];
+    IngressClasses: { Name: string; Controller: string; Default: boolean }[];
+    CRDs: { Name: string; Group: string; Kind: string; Scope: string; Versions: string[] }[];
+    Errors?: { [part: string]: string };
+    CollectedAt: Date;
 }
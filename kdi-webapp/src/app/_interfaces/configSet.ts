@@ -0,0 +1,20 @@
+export interface ConfigSet {
+    ID: string;
+    Name: string;
+    Kind: 'ConfigMap' | 'Secret';
+    Namespace: string;
+    EnvironmentID: string;
+    Data?: { [key: string]: string }; // never set for a secret
+    Keys: string[];
+    MicroserviceIDs: string[];
+    CreatedAt: Date;
+    UpdatedAt: Date;
+}
+
+export interface ConfigSetForm {
+    name?: string;
+    kind?: 'ConfigMap' | 'Secret';
+    namespace?: string;
+    data: { [key: string]: string };
+    restartConsumers?: boolean;
+}
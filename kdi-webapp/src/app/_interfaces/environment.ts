@@ -4,4 +4,6 @@ export interface Environment {
     Description?: string;
     ClusterID: string;
     ProjectID: string;
+    RuleSetID?: string;
+    Variables?: { [name: string]: string }; // substituted in the ${VAR} placeholders of the uploaded manifests
 }
\ No newline at end of file
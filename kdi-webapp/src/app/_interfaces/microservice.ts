@@ -2,6 +2,7 @@ import { Container } from "./container";
 
 export interface Microservice {
     ID?: string;
+    Kind?: string;
     Name?: string;
     Namespace: string;
     Replicas?: Int16Array;
@@ -13,6 +14,7 @@ export interface Microservice {
     EnvironmentID?: string;
     Containers: Container[];
     Conditions: Conditions[]
+    Paused?: boolean;
 }
 
 export interface Conditions {
@@ -0,0 +1,24 @@
+import { Microservice } from "./microservice";
+import { PolicyViolation } from "./policy";
+
+export interface OperationResult {
+    Object: string;
+    Status: string;
+    Message?: string;
+    Reason?: string;
+    Violations?: PolicyViolation[];
+}
+
+export interface Operation {
+    ID: string;
+    Type: string;
+    Status: 'pending' | 'running' | 'succeeded' | 'failed';
+    EnvironmentID: string;
+    MicroserviceID?: string;
+    Results?: OperationResult[];
+    Messages?: { success?: string[], info?: string[], error?: string[], warning?: string[] };
+    Microservices?: Microservice[];
+    Error?: string;
+    CreatedAt: Date;
+    FinishedAt?: Date;
+}
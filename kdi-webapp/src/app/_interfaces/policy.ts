@@ -0,0 +1,31 @@
+export type PolicySeverity = 'warn' | 'deny';
+
+export interface PolicyRule {
+    id: 'disallow-latest-tag' | 'require-resource-limits' | 'disallow-privileged' | 'allowed-registries';
+    severity: PolicySeverity;
+    registries?: string[]; // only for allowed-registries
+}
+
+export interface PolicyViolation {
+    rule: string;
+    severity: PolicySeverity;
+    object: string;
+    container?: string;
+    message: string;
+}
+
+export interface RuleSet {
+    ID: string;
+    Name: string;
+    Description: string;
+    Rules: PolicyRule[];
+    CreatorID: string;
+    CreatedAt: Date;
+    UpdatedAt: Date;
+}
+
+export interface RuleSetForm {
+    name: string;
+    description?: string;
+    rules: PolicyRule[];
+}
@@ -1,9 +1,13 @@
 export interface UpdateForm{
     strategy?: string,
     replicas: Number,
+    container?: string,
     image: string,
     maxUnavailable: string,
     maxSurge: string,
     canaryWeight: string,
     canaryAnalysisInterval:string,
+    wait?: boolean,
+    timeout?: number,
+    autoRollback?: boolean,
 }
\ No newline at end of file
@@ -0,0 +1,35 @@
+// cpu in millicores, memory in bytes
+export interface Usage {
+    Used: number;
+    Requests: number;
+    Limits: number;
+    Unlimited: boolean;
+}
+
+export interface ResourceUsage {
+    CPU: Usage;
+    Memory: Usage;
+}
+
+export interface PodUsage {
+    Name: string;
+    Node: string;
+    Phase: string;
+    Usage: ResourceUsage;
+}
+
+export interface WorkloadUsage {
+    Kind: string;
+    Name: string;
+    Namespace: string;
+    MetricsAvailable: boolean;
+    Pods: PodUsage[];
+    Total: ResourceUsage;
+}
+
+export interface MicroserviceUsage {
+    MicroserviceID: string;
+    Name: string;
+    Namespace: string;
+    Usage: ResourceUsage;
+}
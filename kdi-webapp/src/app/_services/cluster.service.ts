@@ -36,6 +36,19 @@ export class ClusterService {
         );
     }
 
+    getClusterInventory(id: string): Observable<any> {
+        return this.http.get<any>(this.apiUrl + '/' + id + '/inventory')
+    }
+
+    // refreshClusterInventory collects the inventory of the cluster again instead of returning the cached one
+    refreshClusterInventory(id: string): Observable<any> {
+        return this.http.post<any>(this.apiUrl + '/' + id + '/inventory', {}).pipe(
+            tap(() => {
+                this.cacheService.deleteAllRelated(this.apiUrl);
+            })
+        );
+    }
+
     deleteCluster(id: string): Observable<any> {
         return this.http.delete<any>(this.apiUrl + '/' + id).pipe(
             tap(() => {
@@ -16,7 +16,7 @@ export class DeploymentService {
         private cacheService: CacheService, // TODO
     ) { }
 
-    addDeploymentWithYaml(environmentID: string, files: File[], namespace: string | undefined = undefined): Observable<any> {
+    addDeploymentWithYaml(environmentID: string, files: File[], namespace: string | undefined = undefined, wait = false, timeout?: number): Observable<any> {
         const formData = new FormData();
         files.forEach(file => {
             formData.append('files', file);
@@ -24,6 +24,12 @@ export class DeploymentService {
         if (namespace) {
             formData.append('namespace', namespace);
         }
+        if (wait) {
+            formData.append('wait', 'true');
+            if (timeout) {
+                formData.append('timeout', timeout.toString());
+            }
+        }
         return this.http.post<any>(this.apiUrl + '/' + environmentID + this.microservicesWithYaml, formData)
     }
 }
@@ -1,10 +1,12 @@
 import { HttpClient } from '@angular/common/http';
 import { Injectable } from '@angular/core';
 import { Environment } from '../_interfaces/environment';
-import { Observable, tap } from 'rxjs';
+import { Observable, map, switchMap, takeWhile, tap, timer } from 'rxjs';
 import { environment } from 'src/environments/environment';
 import { UpdateForm } from '../_interfaces/updateForm';
 import { CacheService } from './cache.service';
+import { Operation } from '../_interfaces/operation';
+import { ConfigSetForm } from '../_interfaces/configSet';
 
 @Injectable({
     providedIn: 'root'
@@ -68,4 +70,120 @@ export class EnvironmentService {
             })
         );
     }
+
+    // runMicroserviceAction pauses, resumes or restarts the rollout of a microservice
+    runMicroserviceAction(envId: string, mId: string, action: 'pause' | 'resume' | 'restart'): Observable<any> {
+        return this.http.post<any>(this.apiUrl + '/' + envId + '/microservices/' + mId + '/' + action, {}).pipe(
+            tap(() => {
+                this.cacheService.deleteAllRelated(this.apiUrl);
+            })
+        );
+    }
+
+    restartMicroservices(envId: string): Observable<any> {
+        return this.http.post<any>(this.apiUrl + '/' + envId + '/microservices/restart', {});
+    }
+
+    getMicroserviceUsage(envId: string, mId: string): Observable<any> {
+        return this.http.get<any>(this.apiUrl + '/' + envId + '/microservices/' + mId + '/usage')
+    }
+
+    // getEnvironmentUsage returns the usage of every microservice of the environment and their total
+    getEnvironmentUsage(envId: string): Observable<any> {
+        return this.http.get<any>(this.apiUrl + '/' + envId + '/usage')
+    }
+
+    getConfigSets(envId: string): Observable<any> {
+        return this.http.get<any>(this.apiUrl + '/' + envId + '/configsets')
+    }
+
+    createConfigSet(envId: string, form: ConfigSetForm): Observable<any> {
+        return this.http.post<any>(this.apiUrl + '/' + envId + '/configsets', form).pipe(
+            tap(() => {
+                this.cacheService.deleteAllRelated(this.apiUrl);
+            })
+        );
+    }
+
+    // updateConfigSet replaces the data of a config set and restarts its consumers if asked
+    updateConfigSet(envId: string, csId: string, form: ConfigSetForm): Observable<any> {
+        return this.http.put<any>(this.apiUrl + '/' + envId + '/configsets/' + csId, form).pipe(
+            tap(() => {
+                this.cacheService.deleteAllRelated(this.apiUrl);
+            })
+        );
+    }
+
+    deleteConfigSet(envId: string, csId: string): Observable<any> {
+        return this.http.delete(this.apiUrl + '/' + envId + '/configsets/' + csId).pipe(
+            tap(() => {
+                this.cacheService.deleteAllRelated(this.apiUrl);
+            })
+        );
+    }
+
+    attachConfigSet(envId: string, csId: string, mId: string): Observable<any> {
+        return this.http.post<any>(this.apiUrl + '/' + envId + '/configsets/' + csId + '/microservices/' + mId, {}).pipe(
+            tap(() => {
+                this.cacheService.deleteAllRelated(this.apiUrl);
+            })
+        );
+    }
+
+    detachConfigSet(envId: string, csId: string, mId: string): Observable<any> {
+        return this.http.delete(this.apiUrl + '/' + envId + '/configsets/' + csId + '/microservices/' + mId).pipe(
+            tap(() => {
+                this.cacheService.deleteAllRelated(this.apiUrl);
+            })
+        );
+    }
+
+    // setVariables replaces the variables substituted in the manifests deployed in the environment
+    setVariables(envId: string, variables: { [name: string]: string }): Observable<any> {
+        return this.http.put<any>(this.apiUrl + '/' + envId + '/variables', { variables: variables }).pipe(
+            tap(() => {
+                this.cacheService.deleteAllRelated(this.apiUrl);
+            })
+        );
+    }
+
+    // attachRuleSet makes the rule set the policy checked on the next deployments of the environment
+    attachRuleSet(envId: string, ruleSetId: string): Observable<any> {
+        return this.http.put<any>(this.apiUrl + '/' + envId + '/ruleset', { ruleSetId: ruleSetId }).pipe(
+            tap(() => {
+                this.cacheService.deleteAllRelated(this.apiUrl);
+            })
+        );
+    }
+
+    detachRuleSet(envId: string): Observable<any> {
+        return this.http.delete(this.apiUrl + '/' + envId + '/ruleset').pipe(
+            tap(() => {
+                this.cacheService.deleteAllRelated(this.apiUrl);
+            })
+        );
+    }
+
+    getOperation(envId: string, opId: string): Observable<Operation> {
+        return this.http.get<any>(this.apiUrl + '/' + envId + '/operations/' + opId).pipe(
+            map(resp => resp.operation)
+        );
+    }
+
+    getOperations(envId: string): Observable<any> {
+        return this.http.get<any>(this.apiUrl + '/' + envId + '/operations')
+    }
+
+    // pollOperation emits the operation until it is finished
+    pollOperation(envId: string, opId: string, interval = 2000): Observable<Operation> {
+        return timer(0, interval).pipe(
+            switchMap(() => this.getOperation(envId, opId)),
+            takeWhile(op => op.Status === 'pending' || op.Status === 'running', true),
+            tap(op => {
+                if (op.Status === 'succeeded' || op.Status === 'failed') {
+                    this.cacheService.deleteAllRelated(this.apiUrl);
+                }
+            })
+        );
+    }
 }
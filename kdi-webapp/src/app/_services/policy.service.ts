@@ -0,0 +1,54 @@
+import { HttpClient } from "@angular/common/http";
+import { Injectable } from "@angular/core";
+import { Observable, tap } from "rxjs";
+import { environment } from "src/environments/environment";
+import { RuleSetForm } from "../_interfaces/policy";
+import { CacheService } from "./cache.service";
+
+@Injectable({
+    providedIn: 'root'
+})
+export class PolicyService {
+    readonly apiUrl = environment.apiUrl + '/dashboard/rulesets';
+
+    constructor(
+        private http: HttpClient,
+        private cacheService: CacheService,
+    ) { }
+
+    getPolicyRules(): Observable<any> {
+        return this.http.get<any>(this.apiUrl + '/rules')
+    }
+
+    getRuleSets(): Observable<any> {
+        return this.http.get<any>(this.apiUrl)
+    }
+
+    getRuleSet(id: string): Observable<any> {
+        return this.http.get<any>(this.apiUrl + '/' + id)
+    }
+
+    createRuleSet(form: RuleSetForm): Observable<any> {
+        return this.http.post<any>(this.apiUrl, form).pipe(
+            tap(() => {
+                this.cacheService.deleteAllRelated(this.apiUrl);
+            })
+        );
+    }
+
+    updateRuleSet(id: string, form: RuleSetForm): Observable<any> {
+        return this.http.put<any>(this.apiUrl + '/' + id, form).pipe(
+            tap(() => {
+                this.cacheService.deleteAllRelated(this.apiUrl);
+            })
+        );
+    }
+
+    deleteRuleSet(id: string): Observable<any> {
+        return this.http.delete(this.apiUrl + '/' + id).pipe(
+            tap(() => {
+                this.cacheService.deleteAllRelated(this.apiUrl);
+            })
+        );
+    }
+}
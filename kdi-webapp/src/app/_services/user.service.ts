@@ -3,7 +3,7 @@ import { HttpClient, HttpErrorResponse } from '@angular/common/http';
 
 import { User } from '../_interfaces';
 import { environment } from 'src/environments/environment';
-import { Observable, catchError, map } from 'rxjs';
+import { Observable, catchError, finalize, map, shareReplay } from 'rxjs';
 import { CacheService } from './cache.service';
 
 
@@ -13,6 +13,9 @@ export class UserService {
     readonly apiUrl = environment.apiUrl;
     private userToken: string | null | undefined;
     private readonly tokenKey = 'api.accessToken';
+    private readonly refreshTokenKey = 'api.refreshToken';
+    // The refresh in progress, shared by the requests failing at the same time : a refresh token can only be used once
+    private refreshing: Observable<string> | null = null;
 
     constructor(
         private http: HttpClient,
@@ -34,6 +37,11 @@ export class UserService {
         localStorage.setItem(this.tokenKey, token);
     }
 
+    // The refresh token of the session, only for the users logged in with a password
+    public get refreshToken(): string | null {
+        return localStorage.getItem(this.refreshTokenKey);
+    }
+
     getCurrentUser(): Observable<any> {
         return this.http.get<User>(this.apiUrl + `/dashboard/users/current`)
     }
@@ -46,6 +54,22 @@ export class UserService {
         return this.http.post<User>(this.apiUrl + `/register`, user)
     }
 
+    verifyEmail(token: string): Observable<any> {
+        return this.http.post<any>(this.apiUrl + `/verify-email`, { token: token })
+    }
+
+    resendVerificationEmail(email: string): Observable<any> {
+        return this.http.post<any>(this.apiUrl + `/verify-email/resend`, { email: email })
+    }
+
+    forgotPassword(email: string): Observable<any> {
+        return this.http.post<any>(this.apiUrl + `/forgot-password`, { email: email })
+    }
+
+    resetPassword(token: string, password: string): Observable<any> {
+        return this.http.post<any>(this.apiUrl + `/reset-password`, { token: token, password: password })
+    }
+
     registerUserWithMsal(): Observable<any> {
         return this.http.post<any>(this.apiUrl + `/register/msal`, {})
     }
@@ -56,6 +80,7 @@ export class UserService {
                 map(resp => {
                     if (resp && resp.token != "") {
                         this.token = resp.token;
+                        localStorage.setItem(this.refreshTokenKey, resp.refreshToken);
                         return resp;
                     }
                     catchError((error: HttpErrorResponse) => {
@@ -65,7 +90,29 @@ export class UserService {
             );
     }
 
+    // Renew the access token of the session, the refresh token is replaced
+    refresh(): Observable<string> {
+        if (!this.refreshing) {
+            this.refreshing = this.http.post<any>(this.apiUrl + `/refresh`, { refreshToken: this.refreshToken })
+                .pipe(
+                    map(resp => {
+                        this.token = resp.token;
+                        localStorage.setItem(this.refreshTokenKey, resp.refreshToken);
+                        return resp.token;
+                    }),
+                    finalize(() => this.refreshing = null),
+                    shareReplay(1)
+                );
+        }
+        return this.refreshing;
+    }
+
     logout() {
+        const refreshToken = this.refreshToken;
+        if (refreshToken) {
+            // Revoke the session, it may already be expired
+            this.http.post<any>(this.apiUrl + `/logout`, { refreshToken: refreshToken }).subscribe({ error: () => { } });
+        }
         if (this.userToken != null) {
             this.userToken = null;
             localStorage.clear();
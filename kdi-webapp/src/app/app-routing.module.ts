@@ -7,6 +7,8 @@ import { BrowserUtils } from '@azure/msal-browser';
 import { AuthGuard } from 'src/app/auth.guard';
 import { LoginComponent } from 'src/app/components/login/login.component';
 import { RegisterComponent } from 'src/app/components/register/register.component';
+import { VerifyEmailComponent } from 'src/app/components/verify-email/verify-email.component';
+import { ResetPasswordComponent } from 'src/app/components/reset-password/reset-password.component';
 
 import { AddClusterComponent } from 'src/app/components/clusters/add-cluster/add-cluster.component';
 import { ListClustersComponent } from 'src/app/components/clusters/list-clusters/list-clusters.component';
@@ -34,6 +36,8 @@ const routes: Routes = [
     { path: "", component: HomeComponent, canActivate: [AuthGuard] },
     { path: "login", component: LoginComponent },
     { path: "register", component: RegisterComponent },
+    { path: "verify-email", component: VerifyEmailComponent, title: "Verify your email" },
+    { path: "reset-password", component: ResetPasswordComponent, title: "Reset your password" },
 
     { path: "projects/add", component: CreateProjectComponent, title: "Add new project", canActivate: [AuthGuard] },
     { path: "projects/:projectId", component: ProjectDetailsComponent, canActivate: [AuthGuard], title: "Project details" },
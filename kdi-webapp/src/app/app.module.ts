@@ -27,6 +27,8 @@ import { AppComponent } from 'src/app/app.component';
 import { HomeComponent } from 'src/app/components/home/home.component';
 import { LoginComponent } from 'src/app/components/login/login.component';
 import { RegisterComponent } from 'src/app/components/register/register.component';
+import { VerifyEmailComponent } from 'src/app/components/verify-email/verify-email.component';
+import { ResetPasswordComponent } from 'src/app/components/reset-password/reset-password.component';
 import { SignInMicrosoftComponent } from 'src/app/components/sign-in-microsoft/sign-in-microsoft.component';
 import { NavbarComponent } from 'src/app/components/navbar/navbar.component';
 import { SidebarComponent } from 'src/app/components/sidebar/sidebar.component';
@@ -75,6 +77,8 @@ export function initializeMsal(msalService: MsalService): () => Promise<void> {
         AppComponent,
         LoginComponent,
         RegisterComponent,
+        VerifyEmailComponent,
+        ResetPasswordComponent,
         SignInMicrosoftComponent,
         HomeComponent,
         NavbarComponent,
@@ -1,6 +1,6 @@
 import { Injectable } from '@angular/core';
-import { HttpInterceptor, HttpRequest, HttpHandler, HttpEvent } from '@angular/common/http';
-import { Observable } from 'rxjs';
+import { HttpInterceptor, HttpRequest, HttpHandler, HttpEvent, HttpErrorResponse } from '@angular/common/http';
+import { Observable, catchError, switchMap, throwError } from 'rxjs';
 import { MsalService } from '@azure/msal-angular';
 import { UserService } from './_services';
 import { Router } from '@angular/router';
@@ -45,11 +45,34 @@ export class AuthInterceptor implements HttpInterceptor {
                     Authorization: `Bearer ${this.userService.token}`
                 }
             });
-            return next.handle(req);
+            return next.handle(req).pipe(
+                catchError((error: HttpErrorResponse) => {
+                    // The access token of the session expired, it is renewed once with the refresh token
+                    if (error.status === 401 && !this.account && this.userService.refreshToken && !this.isSessionRequest(req.url)) {
+                        return this.userService.refresh().pipe(
+                            switchMap(token => next.handle(req.clone({
+                                setHeaders: {
+                                    Authorization: `Bearer ${token}`
+                                }
+                            })))
+                        );
+                    }
+                    return throwError(() => error);
+                })
+            );
         }
-        if (!this.router.url.includes('login') && !this.router.url.includes('register')) {
+        if (!this.router.url.includes('login') && !this.router.url.includes('register') && !this.isEmailRequest(req.url)) {
             this.router.navigateByUrl('/login');
         }
         return next.handle(req);
     }
+
+    private isSessionRequest(url: string): boolean {
+        return url.endsWith('/login') || url.endsWith('/refresh') || url.endsWith('/logout');
+    }
+
+    // The verification of the email and the reset of the password are done without being logged in
+    private isEmailRequest(url: string): boolean {
+        return url.includes('/verify-email') || url.endsWith('/forgot-password') || url.endsWith('/reset-password');
+    }
 }
@@ -3,6 +3,7 @@ import { CanActivateFn, Router } from '@angular/router';
 import { UserService } from './_services';
 import { MsalService } from '@azure/msal-angular';
 import { environment } from 'src/environments/environment';
+import { catchError, map, of } from 'rxjs';
 
 export const AuthGuard: CanActivateFn = (_route, _state) => {
     const userService = inject(UserService);
@@ -27,6 +28,18 @@ export const AuthGuard: CanActivateFn = (_route, _state) => {
         });
     }
 
+    // The access token of a session is short-lived, it is renewed with the refresh token
+    if (userService.token && tokenExpired(userService.token) && userService.refreshToken) {
+        return userService.refresh().pipe(
+            map(() => true),
+            catchError(() => {
+                userService.logout();
+                router.navigateByUrl('/login', { state: { redirect: _state.url } });
+                return of(false);
+            })
+        );
+    }
+
     if (!userService.isAuthentificated || (userService.token && tokenExpired(userService.token))) {
         userService.logout();
         router.navigateByUrl('/login', { state: { redirect: _state.url } });
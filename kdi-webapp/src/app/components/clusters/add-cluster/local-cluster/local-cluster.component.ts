@@ -58,6 +58,11 @@ export class AddLocalClusterComponent {
             Address: ['', Validators.required],
             Port: ['', Validators.pattern('^(0|[1-9][0-9]{0,3}|[1-5][0-9]{4}|6[0-4][0-9]{3}|65[0-4][0-9]{2}|655[0-2][0-9]|6553[0-5])')],
             Token: ['', Validators.required],
+            CAData: [''],
+            TLSServerName: [''],
+            ClientCertData: [''],
+            ClientKeyData: [''],
+            Insecure: [false],
             selectedTeamspaces: [[], Validators.required],
             forTeamspace: ['no', Validators.required]
         });
@@ -149,6 +154,11 @@ export class AddLocalClusterComponent {
                 Address: this.clusterForm.value.Address,
                 Port: this.clusterForm.value.Port,
                 Token: this.clusterForm.value.Token,
+                CAData: this.clusterForm.value.Insecure ? '' : this.clusterForm.value.CAData,
+                TLSServerName: this.clusterForm.value.TLSServerName,
+                ClientCertData: this.clusterForm.value.ClientCertData,
+                ClientKeyData: this.clusterForm.value.ClientKeyData,
+                Insecure: this.clusterForm.value.Insecure,
                 IsGlobal: this.clusterForm.value.forTeamspace == 'all',
                 Teamspaces: this.clusterForm.value.selectedTeamspaces.map((teamspace: Teamspace) => teamspace.ID)
             }
@@ -184,7 +194,7 @@ export class AddLocalClusterComponent {
             this.testLoading = true;
             this.overlay.nativeElement.style.display = 'block';
 
-            this.clusterService.testConnection(this.clusterForm.value)
+            this.clusterService.testConnection({ ...this.clusterForm.value, CAData: this.clusterForm.value.Insecure ? '' : this.clusterForm.value.CAData })
                 .pipe(first())
                 .subscribe({
                     next: (resp) => {
@@ -16,7 +16,7 @@ import { ReloadComponent } from 'src/app/component.util';
 })
 
 export class ListClustersComponent {
-    displayedColumns: string[] = ['Name', 'Description', 'Address', 'Port', 'Type', 'AddedAt', 'ExpiryDate'];
+    displayedColumns: string[] = ['Name', 'Description', 'Address', 'Port', 'Type', 'TLS', 'AddedAt', 'ExpiryDate'];
 
     dataSource: MatTableDataSource<Cluster> = new MatTableDataSource<Cluster>();
     @ViewChild(MatPaginator)
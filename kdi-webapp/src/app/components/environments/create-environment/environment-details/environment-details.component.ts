@@ -11,6 +11,7 @@ import { MatTableDataSource } from '@angular/material/table';
 import { MatPaginator } from '@angular/material/paginator';
 import { MatSort } from '@angular/material/sort';
 import { MessageService } from 'primeng/api';
+import { ResourceUsage } from 'src/app/_interfaces/usage';
 
 @Component({
     selector: 'app-environment-details',
@@ -24,7 +25,7 @@ export class EnvironmentDetailsComponent {
     paginator!: MatPaginator;
     @ViewChild(MatSort)
     sort!: MatSort;
-    displayedColumns: string[] = ['Name', 'Namespace', 'Strategy', 'Conditions', 'Replicas', 'actions'];
+    displayedColumns: string[] = ['Name', 'Kind', 'Namespace', 'Strategy', 'Conditions', 'Replicas', 'actions'];
     dataSource: MatTableDataSource<Microservice> = new MatTableDataSource<Microservice>();
 
     envId: string = '';
@@ -38,6 +39,8 @@ export class EnvironmentDetailsComponent {
     }
 
     clusterTokenExpired: boolean = false;
+    usage?: ResourceUsage;
+    metricsAvailable = false;
 
     constructor(
         private route: ActivatedRoute,
@@ -54,6 +57,7 @@ export class EnvironmentDetailsComponent {
                 this.envId = id;
                 this.loadEnvironmentDetails();
                 this.loadMicroservices();
+                this.loadUsage();
             }
         });
     }
@@ -95,6 +99,26 @@ export class EnvironmentDetailsComponent {
         });
     }
 
+    restartAllMicroservices() {
+        if (!confirm('Restart all the microservices of this environment?')) {
+            return;
+        }
+        this.environmentService.restartMicroservices(this.envId)
+            .subscribe({
+                next: (resp) => {
+                    const failed = (resp.results ?? []).filter((r: { Status: string }) => r.Status === 'failed');
+                    this.messageService.add({
+                        severity: failed.length > 0 ? 'warn' : 'success',
+                        summary: resp.message,
+                        detail: failed.map((r: { Object: string, Message: string }) => `${r.Object}: ${r.Message}`).join(', ') || ' '
+                    });
+                },
+                error: (error: HttpErrorResponse) => {
+                    this.messageService.add({ severity: 'error', summary: 'Failed to restart the microservices', detail: error.error.message });
+                }
+            });
+    }
+
     loadMicroservices() {
         this.environmentService.getMicroservices(this.envId)
             .subscribe({
@@ -111,4 +135,18 @@ export class EnvironmentDetailsComponent {
             });
 
     }
+
+    // loadUsage loads the total usage of the microservices of the environment
+    loadUsage() {
+        this.environmentService.getEnvironmentUsage(this.envId)
+            .subscribe({
+                next: (resp) => {
+                    this.usage = resp.total;
+                    this.metricsAvailable = resp.metricsAvailable;
+                },
+                error: (error: HttpErrorResponse) => {
+                    console.log(error);
+                }
+            });
+    }
 }
@@ -5,6 +5,7 @@ import { FileUploadHandlerEvent } from 'primeng/fileupload';
 import { ClusterService } from 'src/app/_services/cluster.service';
 import { DeploymentService } from 'src/app/_services/deployment.service';
 import { EnvironmentService } from 'src/app/_services/environment.service';
+import { Operation } from 'src/app/_interfaces/operation';
 
 @Component({
     selector: 'app-add-microservice-yaml',
@@ -24,6 +25,8 @@ export class AddMicroserviceYamlComponent {
     namespace: string | undefined; 
     selectedNamespace: string | undefined; 
     inputNamespace: string | undefined; 
+    waitForRollout = false;
+    rolloutTimeout = 300;
     @ViewChild('overlay') overlay!: ElementRef;
 
     constructor(
@@ -73,33 +76,53 @@ export class AddMicroserviceYamlComponent {
             this.uploadedFiles.push(file);
         }
         this.overlay.nativeElement.style.display = 'block';
-        this.deploymentService.addDeploymentWithYaml(this.environmentID, this.uploadedFiles, this.namespace).subscribe({
+        this.deploymentService.addDeploymentWithYaml(this.environmentID, this.uploadedFiles, this.namespace, this.waitForRollout, this.rolloutTimeout).subscribe({
             next: (resp: any) => {
-                this.messages = resp.messages;
-                this.microservices = resp.microservices;
                 this.uploadedFiles = [];
-                if (this.messages && this.messages.success.length > 0) {
-                    this.messageService.add({ severity: 'success', summary: 'Deployments added successfully', detail: ' ' });
-                }
+                this.messageService.add({ severity: 'info', summary: 'Deployment started', detail: 'The files are being deployed on the cluster' });
+                this.followOperation(resp.operation.ID);
             },
             error: (error) => {
                 this.overlay.nativeElement.style.display = 'none';
                 if (error.status === 0) {
                     this.messageService.add({ severity: 'info', summary: 'Server is down', detail: 'Please try again later' });
                 }
-                if (error.error) {
+                if (error.error?.messages) {
                     this.messages = error.error.messages;
-                    this.microservices = error.error.microservices;
-                }
-                if (this.messages && !this.messages.success || this.messages.success.length === 0) {
-                    this.messageService.add({ severity: 'error', summary: 'Failed to add deployments with yaml', detail: 'Please check your yaml files' });
                 }
+                this.messageService.add({ severity: 'error', summary: 'Failed to add deployments with yaml', detail: error.error?.message ?? 'Please check your yaml files' });
                 console.log('Error adding deployment with yaml', error);
                 this.uploadedFiles = [];
+            }
+        });
+    }
+
+    followOperation(operationID: string) {
+        this.environmentService.pollOperation(this.environmentID, operationID).subscribe({
+            next: (operation: Operation) => {
+                if (operation.Status !== 'succeeded' && operation.Status !== 'failed') {
+                    return;
+                }
+                this.overlay.nativeElement.style.display = 'none';
+                this.messages = {
+                    success: [],
+                    info: [],
+                    error: [],
+                    ...(operation.Messages as any)
+                };
+                this.microservices = (operation.Microservices ?? []) as any;
+                if (operation.Error) {
+                    (this.messages.error as string[]).push(operation.Error);
+                }
+                if (operation.Status === 'succeeded') {
+                    this.messageService.add({ severity: 'success', summary: 'Deployments added successfully', detail: ' ' });
+                } else {
+                    this.messageService.add({ severity: 'error', summary: 'Failed to add deployments with yaml', detail: 'Please check your yaml files' });
+                }
             },
-            complete: () => {
+            error: (error) => {
                 this.overlay.nativeElement.style.display = 'none';
-                // See if we will clear the file upload or not
+                this.messageService.add({ severity: 'error', summary: 'Failed to follow the deployment', detail: error.error?.message });
             }
         });
     }
@@ -9,6 +9,8 @@ import { MessageService } from 'primeng/api';
 import { Cluster } from 'src/app/_interfaces/cluster';
 import { Environment } from 'src/app/_interfaces/environment';
 import { Microservice } from 'src/app/_interfaces/microservice';
+import { Operation } from 'src/app/_interfaces/operation';
+import { WorkloadUsage } from 'src/app/_interfaces/usage';
 import { CacheService } from 'src/app/_services/cache.service';
 import { ClusterService } from 'src/app/_services/cluster.service';
 import { EnvironmentService } from 'src/app/_services/environment.service';
@@ -40,6 +42,8 @@ export class MicroserviceDetailsComponent {
     environment!: { "environment": Environment };
     isModalOpen = false;
     isConfirmModalOpen = false;
+    usage?: WorkloadUsage;
+    usageMessage = '';
 
     updateForm: FormGroup;
     submitted = false;
@@ -68,6 +72,7 @@ export class MicroserviceDetailsComponent {
 
                 await this.getCluster();
                 await this.loadMicroserviceDetails();
+                this.loadUsage();
                 this.length = this.conditionsLength;
                 this.generateArray(this.length);
 
@@ -75,13 +80,17 @@ export class MicroserviceDetailsComponent {
         });
 
         this.updateForm = this.fb.group({
+            container: [''],
             image: ['', Validators.required],
             strategy: ['', Validators.required],
             replicas: [1, Validators.required],
             maxUnavailable: [''],
             maxSurge: [''],
             canaryWeight: [''],
-            canaryAnalysisInterval: ['']
+            canaryAnalysisInterval: [''],
+            wait: [false],
+            timeout: [300],
+            autoRollback: [false]
 
         });
     }
@@ -99,6 +108,7 @@ export class MicroserviceDetailsComponent {
                         this.labels.data = resp.microservice.Labels
                         this.selectors.data = resp.microservice.Selectors
                         this.microservice = resp.microservice;
+                        this.updateForm.patchValue({ container: resp.microservice.Containers[0]?.Name });
 
                     },
                     error: (error: HttpErrorResponse) => {
@@ -110,6 +120,33 @@ export class MicroserviceDetailsComponent {
         });
     }
 
+    loadUsage(): void {
+        this.environmentService.getMicroserviceUsage(this.envId, this.microserviceId).subscribe({
+            next: (resp) => {
+                this.usage = resp.usage;
+                this.usageMessage = resp.message || '';
+            },
+            error: (error: HttpErrorResponse) => {
+                this.usageMessage = error.error.message || 'Failed to fetch the resource usage.';
+            }
+        });
+    }
+
+    // usagePercent returns the percentage of the reference (requests or limits) used, or undefined if it is not set
+    usagePercent(used: number, reference: number): number | undefined {
+        return reference > 0 ? Math.round(used * 100 / reference) : undefined;
+    }
+
+    formatBytes(bytes: number): string {
+        const units = ['B', 'Ki', 'Mi', 'Gi', 'Ti'];
+        let i = 0;
+        while (bytes >= 1024 && i < units.length - 1) {
+            bytes /= 1024;
+            i++;
+        }
+        return bytes.toFixed(i === 0 ? 0 : 1) + units[i];
+    }
+
     openModal(): void {
         this.isModalOpen = true;
     }
@@ -136,6 +173,11 @@ export class MicroserviceDetailsComponent {
         this.isConfirmModalOpen = false;
     }
 
+    currentImage(): string {
+        const name = this.updateForm.get('container')?.value;
+        return this.microservice.Containers.find(c => c.Name === name)?.Image ?? '';
+    }
+
     isStrategy(strategy: string): boolean {
         return this.updateForm.get('strategy')?.value === strategy;
     }
@@ -149,37 +191,65 @@ export class MicroserviceDetailsComponent {
             this.environmentService.updateMicroservice(this.updateForm.value, this.envId, this.microserviceId)
                 .subscribe({
                     next: (resp) => {
-                        this.messageService.add({ severity: 'success', summary: 'You have successfully updated the microservice!', detail: ' ' });
-                        /*this.microservice = resp;
-                        this.namespaceService.getNamespace(this.microservice.microservice.namespace).subscribe(
-                          {
-                              next: (resp) => {
-                                  this.microservice.microservice.namespace = resp.namespace;
-                              },
-                              error: (error: HttpErrorResponse) => {
-                                  console.error("Error loading namespace: ", error.error.message);
-                              }
-                          }
-                  
-                      )*/
-                        console.log('Microservice updated', resp)
+                        this.followUpdate(resp.operation.ID);
                     },
                     error: (error: HttpErrorResponse) => {
                         this.overlay.nativeElement.style.display = 'none';
-                        this.messageService.add({ severity: 'info', summary: "Failed to update microservice. Please try again later." });
-                        console.error("Error loading microservice: ", error.error.message);
+                        const causes = (error.error.causes ?? []).map((c: { field: string, message: string }) => `${c.field}: ${c.message}`).join(', ');
+                        this.messageService.add({
+                            severity: 'error',
+                            summary: `Failed to update microservice${error.error.reason ? ' (' + error.error.reason + ')' : ''}`,
+                            detail: causes || error.error.message || 'Please try again later.'
+                        });
+                        console.error("Error updating microservice: ", error.error.message);
                     },
-                    complete: () => {
-                        this.overlay.nativeElement.style.display = 'none';
-                        setTimeout(() => {
-                            this.reloadPage();
-                        }, 1000);
-                    }
                 })
 
         }
     }
 
+    runAction(action: 'pause' | 'resume' | 'restart'): void {
+        this.environmentService.runMicroserviceAction(this.envId, this.microserviceId, action).subscribe({
+            next: (resp) => {
+                this.microservice = resp.microservice;
+                this.messageService.add({ severity: 'success', summary: resp.message, detail: ' ' });
+            },
+            error: (error: HttpErrorResponse) => {
+                this.messageService.add({
+                    severity: 'error',
+                    summary: `Failed to ${action} the microservice${error.error.reason ? ' (' + error.error.reason + ')' : ''}`,
+                    detail: error.error.message || 'Please try again later.'
+                });
+            }
+        });
+    }
+
+    followUpdate(operationID: string): void {
+        this.environmentService.pollOperation(this.envId, operationID).subscribe({
+            next: (operation: Operation) => {
+                if (operation.Status === 'succeeded') {
+                    this.overlay.nativeElement.style.display = 'none';
+                    this.messageService.add({ severity: 'success', summary: 'You have successfully updated the microservice!', detail: ' ' });
+                    setTimeout(() => {
+                        this.reloadPage();
+                    }, 1000);
+                } else if (operation.Status === 'failed') {
+                    this.overlay.nativeElement.style.display = 'none';
+                    const reason = operation.Results?.[0]?.Reason;
+                    this.messageService.add({
+                        severity: 'error',
+                        summary: `Failed to update microservice${reason ? ' (' + reason + ')' : ''}`,
+                        detail: operation.Error || 'Please try again later.'
+                    });
+                }
+            },
+            error: (error: HttpErrorResponse) => {
+                this.overlay.nativeElement.style.display = 'none';
+                this.messageService.add({ severity: 'error', summary: 'Failed to follow the update', detail: error.error.message });
+            }
+        });
+    }
+
     async getCluster(): Promise<void> {
         return new Promise((resolve, reject) => {
             this.environmentService.getEnvironmentDetails(this.envId).subscribe(
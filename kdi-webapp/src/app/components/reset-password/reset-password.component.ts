@@ -0,0 +1,82 @@
+import { Component } from '@angular/core';
+import { FormBuilder, FormGroup, Validators } from '@angular/forms';
+import { ActivatedRoute, Router } from '@angular/router';
+import { UserService } from 'src/app/_services';
+import { first, timer } from 'rxjs';
+import { HttpErrorResponse } from '@angular/common/http';
+import { MessageService } from 'primeng/api';
+
+@Component({
+    selector: 'app-reset-password',
+    templateUrl: './reset-password.component.html',
+    styleUrls: ['../login/login.component.css']
+})
+export class ResetPasswordComponent {
+    // Without the token of the email, the user asks for the email to reset the password
+    token: string | null = null;
+    form: FormGroup;
+    submitted = false;
+    loading = false;
+
+    constructor(
+        private formBuilder: FormBuilder,
+        private route: ActivatedRoute,
+        private router: Router,
+        private userService: UserService,
+        private messageService: MessageService,
+    ) {
+        this.form = new FormGroup({});
+    }
+
+    ngOnInit() {
+        this.token = this.route.snapshot.queryParamMap.get('token');
+        if (this.token) {
+            this.form = this.formBuilder.group({
+                password: ['', [Validators.required, Validators.minLength(6)]]
+            });
+        } else {
+            this.form = this.formBuilder.group({
+                email: ['', [Validators.required, Validators.email]]
+            });
+        }
+    }
+
+    get formControls() { return this.form.controls; }
+
+    onSubmit() {
+        this.submitted = true;
+        if (this.form.invalid) {
+            return;
+        }
+
+        this.loading = true;
+        if (!this.token) {
+            this.userService.forgotPassword(this.form.value.email)
+                .pipe(first())
+                .subscribe({
+                    next: (resp) => {
+                        this.messageService.add({ severity: 'success', summary: 'Email sent', detail: resp.message });
+                        this.loading = false;
+                    },
+                    error: (error: HttpErrorResponse) => {
+                        this.messageService.add({ severity: 'error', summary: 'Email not sent', detail: error.error.message });
+                        this.loading = false;
+                    }
+                });
+            return;
+        }
+
+        this.userService.resetPassword(this.token, this.form.value.password)
+            .pipe(first())
+            .subscribe({
+                next: () => {
+                    this.messageService.add({ severity: 'success', summary: 'Your password was reset!', detail: ' ' });
+                    timer(1000).subscribe(() => this.router.navigateByUrl('/login'));
+                },
+                error: (error: HttpErrorResponse) => {
+                    this.messageService.add({ severity: 'error', summary: 'Reset failed', detail: error.error.message || "Invalid or expired link" });
+                    this.loading = false;
+                }
+            });
+    }
+}
@@ -0,0 +1,76 @@
+import { Component } from '@angular/core';
+import { FormBuilder, FormGroup, Validators } from '@angular/forms';
+import { ActivatedRoute } from '@angular/router';
+import { UserService } from 'src/app/_services';
+import { first } from 'rxjs';
+import { HttpErrorResponse } from '@angular/common/http';
+import { MessageService } from 'primeng/api';
+
+@Component({
+    selector: 'app-verify-email',
+    templateUrl: './verify-email.component.html',
+    styleUrls: ['../login/login.component.css']
+})
+export class VerifyEmailComponent {
+    resendForm: FormGroup;
+    submitted = false;
+    loading = false;
+    verified = false;
+
+    constructor(
+        private formBuilder: FormBuilder,
+        private route: ActivatedRoute,
+        private userService: UserService,
+        private messageService: MessageService,
+    ) {
+        this.resendForm = new FormGroup({});
+    }
+
+    ngOnInit() {
+        this.resendForm = this.formBuilder.group({
+            email: ['', [Validators.required, Validators.email]]
+        });
+
+        // the token of the link sent by email
+        const token = this.route.snapshot.queryParamMap.get('token');
+        if (!token) {
+            return;
+        }
+        this.loading = true;
+        this.userService.verifyEmail(token)
+            .pipe(first())
+            .subscribe({
+                next: () => {
+                    this.verified = true;
+                    this.loading = false;
+                },
+                error: (error: HttpErrorResponse) => {
+                    this.messageService.add({ severity: 'error', summary: 'Verification failed', detail: error.error.message || "Invalid or expired link" });
+                    this.loading = false;
+                }
+            });
+    }
+
+    get formControls() { return this.resendForm.controls; }
+
+    onSubmit() {
+        this.submitted = true;
+        if (this.resendForm.invalid) {
+            return;
+        }
+
+        this.loading = true;
+        this.userService.resendVerificationEmail(this.resendForm.value.email)
+            .pipe(first())
+            .subscribe({
+                next: (resp) => {
+                    this.messageService.add({ severity: 'success', summary: 'Email sent', detail: resp.message });
+                    this.loading = false;
+                },
+                error: (error: HttpErrorResponse) => {
+                    this.messageService.add({ severity: 'error', summary: 'Email not sent', detail: error.error.message });
+                    this.loading = false;
+                }
+            });
+    }
+}